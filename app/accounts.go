@@ -48,7 +48,7 @@ type AccountMetadata struct {
 	LikedIRI     string        `json:"liked,omitempty"`
 	FollowersIRI string        `json:"followers,omitempty"`
 	FollowingIRI string        `json:"following,omitempty"`
-	OAuth        OAuth         `json:-`
+	OAuth        OAuth         `json:"-"`
 }
 
 type AccountCollection []Account
@@ -62,10 +62,12 @@ type Account struct {
 	CreatedBy *Account          `json:"-"`
 	UpdatedAt time.Time         `json:"-"`
 	Flags     FlagBits          `json:"flags,omitempty"`
+	Role      Role              `json:"role,omitempty"`
 	Metadata  *AccountMetadata  `json:"-"`
 	Votes     VoteCollection    `json:"votes,omitempty"`
 	Followers AccountCollection `json:"followers,omitempty"`
 	Following AccountCollection `json:"following,omitempty"`
+	Blocked   AccountCollection `json:"-"`
 }
 
 // Hash is a local type for string, it should hold a [32]byte array actually
@@ -93,6 +95,12 @@ func (h Hash) MarshalText() ([]byte, error) {
 	return h, nil
 }
 
+// UnmarshalText
+func (h *Hash) UnmarshalText(data []byte) error {
+	*h = append(Hash{}, data...)
+	return nil
+}
+
 // HasMetadata
 func (a *Account) HasMetadata() bool {
 	return a != nil && a.Metadata != nil
@@ -0,0 +1,428 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/littr.go/internal/log"
+	"github.com/mariusor/qstring"
+)
+
+// APIPath is where the JSON read API gets mounted
+const APIPath = "/api/v1"
+
+// MaxAPIItems is the maximum page size a client can request through the maxItems parameter
+const MaxAPIItems = 200
+
+type apiAccountRef struct {
+	Hash      Hash   `json:"hash"`
+	Handle    string `json:"handle"`
+	PermaLink string `json:"url"`
+}
+
+type apiScoredAccountRef struct {
+	apiAccountRef
+	Score int `json:"score"`
+}
+
+type apiAccount struct {
+	apiAccountRef
+	Score     int             `json:"score"`
+	CreatedAt *time.Time      `json:"createdAt,omitempty"`
+	Followers []apiAccountRef `json:"followers"`
+	Following []apiAccountRef `json:"following"`
+}
+
+type apiItem struct {
+	Hash          Hash           `json:"hash"`
+	Title         string         `json:"title,omitempty"`
+	MimeType      MimeType       `json:"mediaType"`
+	Content       string         `json:"content,omitempty"`
+	URL           string         `json:"url,omitempty"`
+	PermaLink     string         `json:"permaLink"`
+	Score         int            `json:"score"`
+	Ups           int            `json:"ups"`
+	Downs         int            `json:"downs"`
+	Shares        int            `json:"shares"`
+	CommentsCount *uint          `json:"commentsCount,omitempty"`
+	Author        *apiAccountRef `json:"author,omitempty"`
+	SharedBy      *apiAccountRef `json:"sharedBy,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Mentions      []string       `json:"mentions,omitempty"`
+	SubmittedAt   time.Time      `json:"submittedAt"`
+	UpdatedAt     *time.Time     `json:"updatedAt,omitempty"`
+	Deleted       bool           `json:"deleted,omitempty"`
+	Parent        Hash           `json:"parent,omitempty"`
+	OP            Hash           `json:"op,omitempty"`
+	Level         uint8          `json:"level,omitempty"`
+	Children      []apiItem      `json:"children,omitempty"`
+}
+
+type apiCollection struct {
+	Page       int         `json:"page"`
+	TotalItems uint        `json:"totalItems"`
+	Next       string      `json:"next,omitempty"`
+	Prev       string      `json:"prev,omitempty"`
+	Items      interface{} `json:"items"`
+}
+
+func loadAPIAccountRef(a Account) apiAccountRef {
+	return apiAccountRef{
+		Hash:      a.Hash,
+		Handle:    a.Handle,
+		PermaLink: absoluteLink(AccountPermaLink(a)),
+	}
+}
+
+func loadAPIAccount(a Account) apiAccount {
+	acc := apiAccount{
+		apiAccountRef: loadAPIAccountRef(a),
+		Score:         a.Score,
+		Followers:     make([]apiAccountRef, 0),
+		Following:     make([]apiAccountRef, 0),
+	}
+	if !a.CreatedAt.IsZero() {
+		acc.CreatedAt = &a.CreatedAt
+	}
+	for _, f := range a.Followers {
+		acc.Followers = append(acc.Followers, loadAPIAccountRef(f))
+	}
+	for _, f := range a.Following {
+		acc.Following = append(acc.Following, loadAPIAccountRef(f))
+	}
+	return acc
+}
+
+func loadAPIItem(c comment) apiItem {
+	i := apiItem{
+		Hash:        c.Hash,
+		Title:       c.Title,
+		MimeType:    c.MimeType,
+		PermaLink:   absoluteLink(ItemPermaLink(c.Item)),
+		Score:       c.Score,
+		Ups:         c.Ups,
+		Downs:       c.Downs,
+		Shares:      c.Shares,
+		SubmittedAt: c.SubmittedAt,
+		Deleted:     c.Deleted(),
+		Level:       c.Level,
+	}
+	if !c.Deleted() {
+		if c.IsLink() {
+			i.URL = c.Data
+		} else {
+			i.Content = c.Data
+		}
+	}
+	if c.SubmittedBy != nil {
+		author := loadAPIAccountRef(*c.SubmittedBy)
+		i.Author = &author
+	}
+	if c.SharedBy.IsValid() {
+		sharer := loadAPIAccountRef(*c.SharedBy)
+		i.SharedBy = &sharer
+	}
+	if !c.UpdatedAt.IsZero() && c.UpdatedAt.After(c.SubmittedAt) {
+		i.UpdatedAt = &c.UpdatedAt
+	}
+	if c.HasMetadata() {
+		for _, t := range c.Metadata.Tags {
+			i.Tags = append(i.Tags, t.Name)
+		}
+		for _, t := range c.Metadata.Mentions {
+			i.Mentions = append(i.Mentions, t.Name)
+		}
+	}
+	if c.Item.Parent.IsValid() {
+		i.Parent = c.Item.Parent.Hash
+	}
+	if c.Item.OP.IsValid() {
+		i.OP = c.Item.OP.Hash
+	}
+	for _, ch := range c.Children {
+		i.Children = append(i.Children, loadAPIItem(*ch))
+	}
+	return i
+}
+
+// APIRoutes serves the JSON representation of the listings, items and accounts
+func (h *handler) APIRoutes() func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(h.LoadSession)
+
+		r.Get("/items", h.APIListing)
+		r.Get("/items/{hash}", h.APIItem)
+		r.Get("/t/{tag}", h.APIListing)
+		r.Get("/d/{domain}", h.APIListing)
+		r.Get("/accounts/{handle}", h.APIAccount)
+		r.Get("/accounts/{handle}/items", h.APIListing)
+		r.Get("/accounts/{handle}/followers", h.APIAccountFollows)
+		r.Get("/accounts/{handle}/following", h.APIAccountFollows)
+		r.Get("/search", h.APISearch)
+
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			errors.HandleError(errors.NotFoundf("%s", r.RequestURI)).ServeHTTP(w, r)
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			errors.HandleError(errors.MethodNotAllowedf("%s not allowed", r.Method)).ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h *handler) renderJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error(err.Error())
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
+
+// apiFilters loads the filters for the listing of the current route. The query parameters are the ones of
+// the Filters type, see the qstring tags, plus "sort" and "period", and "federated" for the main listing.
+func apiFilters(r *http.Request) (Filters, error) {
+	f := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Private: []bool{false},
+		},
+		Page:     1,
+		MaxItems: MaxContentItems,
+	}
+	switch {
+	case len(chi.URLParam(r, "tag")) > 0:
+		f.Content = "#" + chi.URLParam(r, "tag")
+		f.ContentMatchType = MatchFuzzy
+	case len(chi.URLParam(r, "domain")) > 0:
+		f.Context = []string{ContextNil}
+		f.LoadItemsFilter.URL = chi.URLParam(r, "domain")
+		f.Type = pub.ActivityVocabularyTypes{pub.PageType}
+	case len(chi.URLParam(r, "handle")) > 0:
+		// NOTE(marius): like on the account's page, we show both the submissions and the comments
+	default:
+		f.InReplyTo = []string{""}
+		f.LoadItemsFilter.Deleted = []bool{false}
+		f.Federated = []bool{false}
+		if fed, _ := strconv.ParseBool(r.URL.Query().Get("federated")); fed {
+			f.Federated = []bool{true}
+		}
+	}
+	if err := qstring.Unmarshal(r.URL.Query(), &f); err != nil {
+		return f, errors.NewBadRequest(err, "invalid query parameters")
+	}
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.MaxItems < 1 || f.MaxItems > MaxAPIItems {
+		f.MaxItems = MaxContentItems
+	}
+	if p := period(r); len(p) > 0 {
+		if !p.IsValid() {
+			return f, errors.BadRequestf("invalid period %q", p)
+		}
+		withPeriod(&f, p, time.Now().UTC())
+	}
+	return f, nil
+}
+
+// commentsCounts returns the number of comments submitted in the threads of the top level items in c,
+// loading them in batches with a single filter for all the threads
+func (h *handler) commentsCounts(c comments) []*uint {
+	counts := make([]*uint, len(c))
+	ids := make([]string, len(c))
+	ctxt := make([]string, 0, len(c))
+	for k, it := range c {
+		if it.Item.Parent.IsValid() {
+			continue
+		}
+		ids[k] = it.Item.Hash.String()
+		if id, ok := BuildIDFromItem(it.Item); ok {
+			ids[k] = string(id)
+		}
+		ctxt = append(ctxt, ids[k])
+		counts[k] = new(uint)
+	}
+	if len(ctxt) == 0 {
+		return counts
+	}
+	f := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Context: ctxt,
+			Deleted: []bool{false},
+		},
+		MaxItems: rankBatchSize,
+	}
+	loaded := 0
+	for f.Page = 1; ; f.Page++ {
+		items, cnt, err := h.storage.LoadItems(f)
+		if err != nil {
+			h.logger.WithContext(log.Ctx{
+				"context": ctxt,
+			}).Warn(err.Error())
+			return make([]*uint, len(c))
+		}
+		for _, it := range items {
+			if !it.OP.IsValid() {
+				continue
+			}
+			for k, top := range c {
+				if counts[k] != nil && (HashesEqual(it.OP.Hash, top.Item.Hash) || hashMatches(Hash(ids[k]), it.OP.Hash, itemID(it.OP))) {
+					*counts[k]++
+					break
+				}
+			}
+		}
+		loaded += len(items)
+		if len(items) < rankBatchSize || uint(loaded) >= cnt {
+			break
+		}
+	}
+	return counts
+}
+
+// APIListing serves GET /api/v1/items, /api/v1/t/{tag}, /api/v1/d/{domain} and /api/v1/accounts/{handle}/items
+func (h *handler) APIListing(w http.ResponseWriter, r *http.Request) {
+	f, err := apiFilters(r)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	if handle := chi.URLParam(r, "handle"); len(handle) > 0 {
+		a, err := h.storage.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{handle}}})
+		if err != nil {
+			errors.HandleError(errors.NotFoundf("account %q not found", handle)).ServeHTTP(w, r)
+			return
+		}
+		f.LoadItemsFilter.AttributedTo = Hashes{a.Hash}
+	}
+	comments, cnt, err := rankItems(h.storage, f, sortType(r), time.Now().UTC())
+	if err != nil {
+		h.logger.Error(err.Error())
+		errors.HandleError(errors.NewNotValid(err, "unable to load items")).ServeHTTP(w, r)
+		return
+	}
+
+	items := make([]apiItem, 0)
+	counts := h.commentsCounts(comments)
+	for k, c := range comments {
+		it := loadAPIItem(*c)
+		it.CommentsCount = counts[k]
+		items = append(items, it)
+	}
+	col := apiCollection{
+		Page:       f.Page,
+		TotalItems: cnt,
+		Items:      items,
+	}
+	if len(comments) >= f.MaxItems {
+		col.Next = absoluteLink(r.URL.Path + string(pageLink(r, f.Page+1)))
+	}
+	if f.Page > 1 {
+		col.Prev = absoluteLink(r.URL.Path + string(pageLink(r, f.Page-1)))
+	}
+	h.renderJSON(w, r, col)
+}
+
+// APIItem serves GET /api/v1/items/{hash} requests with the item and its threaded comments
+func (h *handler) APIItem(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	it, err := h.storage.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil || !it.IsValid() {
+		errors.HandleError(errors.NotFoundf("item %q not found", hash)).ServeHTTP(w, r)
+		return
+	}
+	if it.Private() {
+		errors.HandleError(errors.NotFoundf("item %q not found", hash)).ServeHTTP(w, r)
+		return
+	}
+
+	f := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Depth: 10,
+		},
+		MaxItems: MaxContentItems,
+		Page:     1,
+	}
+	if err := qstring.Unmarshal(r.URL.Query(), &f); err != nil {
+		h.logger.Debug("unable to load url parameters")
+	}
+	if f.MaxItems < 1 || f.MaxItems > MaxAPIItems {
+		f.MaxItems = MaxContentItems
+	}
+	f.Context = []string{it.Hash.String()}
+	if id, ok := BuildIDFromItem(it); ok {
+		f.Context = []string{string(id)}
+	}
+	f.Private = []bool{false}
+	replies, cnt, err := h.storage.LoadItems(f)
+	if err != nil {
+		h.logger.Error(err.Error())
+		errors.HandleError(errors.NewNotValid(err, "unable to load comments")).ServeHTTP(w, r)
+		return
+	}
+
+	thread := comments{&comment{Item: it}}
+	thread = append(thread, loadComments(replies)...)
+	reparentComments(thread)
+	addLevelComments(thread)
+
+	res := loadAPIItem(*thread[0])
+	res.CommentsCount = &cnt
+	h.renderJSON(w, r, res)
+}
+
+// APIAccount serves GET /api/v1/accounts/{handle} requests
+func (h *handler) APIAccount(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+	a, err := h.storage.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{handle}}})
+	if err != nil || !a.IsValid() {
+		errors.HandleError(errors.NotFoundf("account %q not found", handle)).ServeHTTP(w, r)
+		return
+	}
+	if repo, ok := h.storage.(*repository); ok {
+		if a, err = repo.loadAccountsFollowers(a); err != nil {
+			h.logger.Warn(err.Error())
+		}
+		if a, err = repo.loadAccountsFollowing(a); err != nil {
+			h.logger.Warn(err.Error())
+		}
+	}
+	h.renderJSON(w, r, loadAPIAccount(a))
+}
+
+// APIAccountFollows serves GET /api/v1/accounts/{handle}/followers and /api/v1/accounts/{handle}/following requests
+func (h *handler) APIAccountFollows(w http.ResponseWriter, r *http.Request) {
+	f, err := apiFilters(r)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	_, accounts, cnt, err := h.accountFollows(r, f)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	items := make([]apiScoredAccountRef, 0)
+	for _, a := range accounts {
+		items = append(items, apiScoredAccountRef{apiAccountRef: loadAPIAccountRef(a), Score: a.Score})
+	}
+	col := apiCollection{
+		Page:       f.Page,
+		TotalItems: cnt,
+		Items:      items,
+	}
+	if uint(f.Page*f.MaxItems) < cnt {
+		col.Next = absoluteLink(r.URL.Path + string(pageLink(r, f.Page+1)))
+	}
+	if f.Page > 1 {
+		col.Prev = absoluteLink(r.URL.Path + string(pageLink(r, f.Page-1)))
+	}
+	h.renderJSON(w, r, col)
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+func Test_handler_APIItem(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+
+	op := mockItem(t, repo, Item{Title: "Test", Data: "https://example.com", MimeType: MimeTypeURL, SubmittedBy: &jane})
+	reply := mockItem(t, repo, Item{Data: "reply", MimeType: MimeTypeText, SubmittedBy: &john, Parent: &op, OP: &op})
+	mockItem(t, repo, Item{Data: "reply to reply", MimeType: MimeTypeText, SubmittedBy: &jane, Parent: &reply, OP: &op})
+	repo.SaveVote(Vote{SubmittedBy: &john, Item: &op, Weight: 1})
+
+	h := handler{storage: repo, logger: log.Dev(log.PanicLevel)}
+	mux := chi.NewRouter()
+	mux.Route(APIPath, h.APIRoutes())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+"/items/"+op.Hash.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status must be %d, received %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	it := apiItem{}
+	if err := json.Unmarshal(w.Body.Bytes(), &it); err != nil {
+		t.Fatalf("invalid response: %s", err)
+	}
+	if it.URL != op.Data || it.Score != 1 || it.Author == nil || it.Author.Handle != jane.Handle {
+		t.Errorf("Item must be the link %q by %s with score %d, received %q by %v with score %d", op.Data, jane.Handle, 1, it.URL, it.Author, it.Score)
+	}
+	if it.CommentsCount == nil || *it.CommentsCount != 2 {
+		t.Errorf("Item must have %d comments", 2)
+	}
+	if len(it.Children) != 1 || len(it.Children[0].Children) != 1 {
+		t.Fatalf("Comments must be threaded under their parents")
+	}
+	if it.Children[0].Children[0].Content != "reply to reply" {
+		t.Errorf("Nested comment must be %q, received %q", "reply to reply", it.Children[0].Children[0].Content)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+"/accounts/jane/items?maxItems=1", nil))
+	col := struct {
+		apiCollection
+		Items []apiItem `json:"items"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+		t.Fatalf("invalid response: %s", err)
+	}
+	if col.TotalItems != 2 || len(col.Items) != 1 || len(col.Next) == 0 {
+		t.Errorf("Listing must have a page of %d out of %d items and a next page, received %d out of %d", 1, 2, len(col.Items), col.TotalItems)
+	}
+}
+
+func Test_handler_APIListing_Ranked(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.VotingEnabled = true
+
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	now := time.Now().UTC()
+	best := mockItem(t, repo, Item{Title: "best", Data: "#test best", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-48 * time.Hour)})
+	mockItem(t, repo, Item{Title: "newest", Data: "#test newest", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-time.Hour)})
+	repo.SaveVote(Vote{SubmittedBy: &john, Item: &best, Weight: 1})
+
+	h := handler{storage: repo, logger: log.Dev(log.PanicLevel)}
+	mux := chi.NewRouter()
+	mux.Route(APIPath, h.APIRoutes())
+
+	for _, path := range []string{"/items", "/t/test"} {
+		col := struct {
+			apiCollection
+			Items []apiItem `json:"items"`
+		}{}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+path+"?sort=top&maxItems=1", nil))
+		if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+			t.Fatalf("invalid response: %s", err)
+		}
+		if col.TotalItems != 2 || len(col.Items) != 1 || col.Items[0].Title != best.Title {
+			t.Errorf("First page of %s must contain %q out of %d items, received %v out of %d", path, best.Title, 2, col.Items, col.TotalItems)
+		}
+	}
+}
+
+func Test_handler_APIAccountFollows(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+	for _, er := range []Account{john, bob} {
+		repo.FollowAccount(er, jane)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&jane, Filters{})
+	for _, req := range requests {
+		repo.SendFollowResponse(req, true)
+	}
+	it := mockItem(t, repo, Item{Data: "news", MimeType: MimeTypeText, SubmittedBy: &jane})
+	repo.SaveVote(Vote{SubmittedBy: &john, Item: &it, Weight: 1})
+
+	h := handler{storage: repo, logger: log.Dev(log.PanicLevel)}
+	mux := chi.NewRouter()
+	mux.Route(APIPath, h.APIRoutes())
+
+	col := struct {
+		apiCollection
+		Items []apiScoredAccountRef `json:"items"`
+	}{}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+"/accounts/jane/followers?maxItems=1", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+		t.Fatalf("invalid response: %s", err)
+	}
+	if col.TotalItems != 2 || len(col.Items) != 1 || len(col.Next) == 0 {
+		t.Fatalf("Followers must have a page of %d out of %d accounts and a next page, received %d out of %d", 1, 2, len(col.Items), col.TotalItems)
+	}
+	if col.Items[0].Handle != john.Handle || col.Items[0].Score != 1 {
+		t.Errorf("First follower must be %s with score %d, received %s with score %d", john.Handle, 1, col.Items[0].Handle, col.Items[0].Score)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+"/accounts/bob/following", nil))
+	col.Next = ""
+	if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+		t.Fatalf("invalid response: %s", err)
+	}
+	if col.TotalItems != 1 || len(col.Items) != 1 || col.Items[0].Handle != jane.Handle || len(col.Next) > 0 {
+		t.Errorf("Account %s must follow only %s, received %v", bob.Handle, jane.Handle, col.Items)
+	}
+}
+
+func Test_handler_APIListing_Private(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	mockItem(t, repo, Item{Title: "public", Data: "#test public", MimeType: MimeTypeText, SubmittedBy: &jane})
+	msg := Item{Data: "#test secret", MimeType: MimeTypeText, SubmittedBy: &jane, Metadata: &ItemMetadata{To: []*Account{&john}}}
+	msg.MakePrivate()
+	msg = mockItem(t, repo, msg)
+
+	h := handler{storage: repo, logger: log.Dev(log.PanicLevel)}
+	mux := chi.NewRouter()
+	mux.Route(APIPath, h.APIRoutes())
+
+	for _, path := range []string{"/items", "/t/test", "/accounts/jane/items", "/accounts/jane/items?private=true"} {
+		col := struct {
+			apiCollection
+			Items []apiItem `json:"items"`
+		}{}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+path, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+			t.Fatalf("invalid response: %s", err)
+		}
+		if col.TotalItems != 1 || len(col.Items) != 1 || col.Items[0].Title != "public" {
+			t.Errorf("Listing %s must contain only the public item, received %v out of %d", path, col.Items, col.TotalItems)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPath+"/items/"+msg.Hash.String(), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status of a private item must be %d, received %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// countingRepository counts the LoadItems and LoadMessages calls to the repository
+type countingRepository struct {
+	Repository
+	loads        int
+	messageLoads int
+}
+
+func (c *countingRepository) LoadItems(f Filters) (ItemCollection, uint, error) {
+	c.loads++
+	return c.Repository.LoadItems(f)
+}
+
+func (c *countingRepository) LoadMessages(acc Account, f Filters) (ItemCollection, uint, error) {
+	c.messageLoads++
+	return c.Repository.LoadMessages(acc, f)
+}
+
+func Test_handler_commentsCounts(t *testing.T) {
+	mem := InMemoryService(appConfig{})
+	jane := mockAccount(t, mem, "jane")
+	first := mockItem(t, mem, Item{Title: "first", Data: "first", MimeType: MimeTypeText, SubmittedBy: &jane})
+	second := mockItem(t, mem, Item{Title: "second", Data: "second", MimeType: MimeTypeText, SubmittedBy: &jane})
+	quiet := mockItem(t, mem, Item{Title: "quiet", Data: "quiet", MimeType: MimeTypeText, SubmittedBy: &jane})
+	reply := mockItem(t, mem, Item{Data: "reply", MimeType: MimeTypeText, SubmittedBy: &jane, Parent: &first, OP: &first})
+	mockItem(t, mem, Item{Data: "reply to reply", MimeType: MimeTypeText, SubmittedBy: &jane, Parent: &reply, OP: &first})
+	mockItem(t, mem, Item{Data: "other reply", MimeType: MimeTypeText, SubmittedBy: &jane, Parent: &second, OP: &second})
+
+	repo := &countingRepository{Repository: mem}
+	h := handler{storage: repo, logger: log.Dev(log.PanicLevel)}
+	counts := h.commentsCounts(loadComments(ItemCollection{first, reply, second, quiet}))
+
+	expected := []*uint{new(uint), nil, new(uint), new(uint)}
+	*expected[0], *expected[2] = 2, 1
+	for k, cnt := range counts {
+		if (cnt == nil) != (expected[k] == nil) || (cnt != nil && *cnt != *expected[k]) {
+			t.Errorf("Comments count of item %d must be %v, received %v", k, expected[k], cnt)
+		}
+	}
+	if repo.loads != 1 {
+		t.Errorf("Comments counts must be loaded with %d query, received %d", 1, repo.loads)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/mariusor/littr.go/internal/log"
+	"github.com/mariusor/littr.go/internal/search"
 )
 
 // Logger is the package default logger instance
@@ -82,6 +83,9 @@ type Configuration struct {
 	DownvotingEnabled          bool
 	UserCreatingEnabled        bool
 	UserFollowingEnabled       bool
+	DuplicateLinksWindow       time.Duration
+	Moderators                 []string
+	Admins                     []string
 }
 
 // Stats holds data for keeping compatibility with Mastodon instances
@@ -146,8 +150,21 @@ func (a *Application) Front(r chi.Router) {
 	}
 	a.front = &front
 
+	if idx, ok := front.index.(*search.Embedded); ok && idx.Len() == 0 && front.conf.StorageBackend != "memory" {
+		// NOTE(marius): a new embedded index gets filled with the existing items in the background
+		go func() {
+			cnt, err := BackfillIndex(front.storage, idx)
+			if err != nil {
+				a.Logger.Errorf("Unable to backfill the search index: %s", err)
+				return
+			}
+			a.Logger.WithContext(log.Ctx{"count": cnt}).Info("Backfilled the search index")
+		}()
+	}
+
 	// Frontend
 	r.With(front.Repository).Route("/", front.Routes())
+	r.With(front.Repository).Route(APIPath, front.APIRoutes())
 
 	// .well-known
 	cfg := NodeInfoConfig()
@@ -155,7 +172,8 @@ func (a *Application) Front(r chi.Router) {
 	// Web-Finger
 	r.Route("/.well-known", func(r chi.Router) {
 		r.Get("/webfinger", front.HandleWebFinger)
-		//r.Get("/host-meta", h.HandleHostMeta)
+		r.Get("/host-meta", front.HandleHostMeta)
+		r.Get("/host-meta.json", front.HandleHostMeta)
 		r.Get("/nodeinfo", ni.NodeInfoDiscover)
 		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 			errors.HandleError(errors.NotFoundf("%s", r.RequestURI)).ServeHTTP(w, r)
@@ -296,6 +314,12 @@ func loadEnv(l *Application) (bool, error) {
 	l.Config.DB.Port = os.Getenv("DB_PORT")
 	l.Config.DB.User = os.Getenv("DB_USER")
 
+	l.Config.ES.Host = os.Getenv("ES_HOST")
+	l.Config.ES.Port = os.Getenv("ES_PORT")
+	l.Config.ES.User = os.Getenv("ES_USER")
+	l.Config.ES.Pw = os.Getenv("ES_PASSWORD")
+	l.Config.ES.Name = os.Getenv("ES_INDEX")
+
 	l.Config.Redis.Host = os.Getenv("REDIS_HOST")
 	l.Config.Redis.Port = os.Getenv("REDIS_PORT")
 	l.Config.Redis.Pw = os.Getenv("REDIS_PASSWORD")
@@ -312,6 +336,20 @@ func loadEnv(l *Application) (bool, error) {
 	l.Config.AnonymousCommentingEnabled = !anonymousCommentingDisabled
 	userFollowingDisabled, _ := strconv.ParseBool(os.Getenv("DISABLE_USER_FOLLOWING"))
 	l.Config.UserFollowingEnabled = !userFollowingDisabled
+	l.Config.DuplicateLinksWindow = defaultDuplicateLinksWindow
+	if window, err := time.ParseDuration(os.Getenv("DUPLICATE_LINKS_WINDOW")); err == nil {
+		l.Config.DuplicateLinksWindow = window
+	}
+	for _, handle := range strings.Split(os.Getenv("MODERATORS"), ",") {
+		if handle = strings.TrimSpace(handle); len(handle) > 0 {
+			l.Config.Moderators = append(l.Config.Moderators, handle)
+		}
+	}
+	for _, handle := range strings.Split(os.Getenv("ADMINS"), ",") {
+		if handle = strings.TrimSpace(handle); len(handle) > 0 {
+			l.Config.Admins = append(l.Config.Admins, handle)
+		}
+	}
 
 	if l.APIURL = os.Getenv("API_URL"); l.APIURL == "" {
 		l.APIURL = fmt.Sprintf("%s/api", l.BaseURL)
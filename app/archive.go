@@ -0,0 +1,233 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/qstring"
+)
+
+// archivePageSize is the number of items loaded at a time when counting the items of an archive period
+const archivePageSize = 200
+
+// archiveDay is a day of an archive page, with the number of items submitted in it
+type archiveDay struct {
+	Date  time.Time
+	Count int
+}
+
+// Link returns the path of the day's listing
+func (d archiveDay) Link() string {
+	return dayArchiveLink(d.Date)
+}
+
+// archiveMonth is a month of an archive page, with the days in which items were submitted
+type archiveMonth struct {
+	Date  time.Time
+	Count int
+	Days  []archiveDay
+}
+
+// Link returns the path of the month's archive page
+func (m archiveMonth) Link() string {
+	return fmt.Sprintf("/%04d/%02d/", m.Date.Year(), m.Date.Month())
+}
+
+func dayArchiveLink(d time.Time) string {
+	return fmt.Sprintf("/%04d/%02d/%02d/", d.Year(), d.Month(), d.Day())
+}
+
+// archiveDate returns the date in the year, month and day URL parameters of the request and the time
+// span the path covers, which is a day, a month or a year depending on which of the parameters are present
+func archiveDate(r *http.Request) (time.Time, time.Time, error) {
+	year, err := strconv.Atoi(chi.URLParam(r, "year"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.NotFoundf("invalid year %q", chi.URLParam(r, "year"))
+	}
+	month, day := 1, 1
+	if m := chi.URLParam(r, "month"); len(m) > 0 {
+		if month, err = strconv.Atoi(m); err != nil || month < 1 || month > 12 {
+			return time.Time{}, time.Time{}, errors.NotFoundf("invalid month %q", m)
+		}
+	}
+	if d := chi.URLParam(r, "day"); len(d) > 0 {
+		if day, err = strconv.Atoi(d); err != nil || day < 1 {
+			return time.Time{}, time.Time{}, errors.NotFoundf("invalid day %q", d)
+		}
+	}
+	from := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if from.Day() != day {
+		// NOTE(marius): time.Date normalizes dates like 2019-02-30 to the following month
+		return time.Time{}, time.Time{}, errors.NotFoundf("invalid date %04d-%02d-%02d", year, month, day)
+	}
+	switch {
+	case len(chi.URLParam(r, "day")) > 0:
+		return from, from.AddDate(0, 0, 1), nil
+	case len(chi.URLParam(r, "month")) > 0:
+		return from, from.AddDate(0, 1, 0), nil
+	}
+	return from, from.AddDate(1, 0, 0), nil
+}
+
+// archiveFilter returns the filters for the items shown on the main page which were submitted before the to date.
+// We rely on the repositories returning the items newest first, so the ones submitted after the from date are
+// at the start of the collection.
+func archiveFilter(to time.Time) Filters {
+	return Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			InReplyTo:            []string{""},
+			Deleted:              []bool{false},
+			Federated:            []bool{false},
+			Private:              []bool{false},
+			SubmittedAt:          to,
+			SubmittedAtMatchType: MatchBefore,
+		},
+		Page:     1,
+		MaxItems: MaxContentItems,
+	}
+}
+
+func submittedBetween(it Item, from, to time.Time) bool {
+	return !it.SubmittedAt.Before(from) && it.SubmittedAt.Before(to)
+}
+
+// loadArchive returns the months between from and to, with the number of items submitted in each of their days
+func loadArchive(repo Repository, from, to time.Time) ([]archiveMonth, error) {
+	counts := make(map[time.Time]int)
+	f := archiveFilter(to)
+	f.MaxItems = archivePageSize
+	for {
+		items, _, err := repo.LoadItems(f)
+		if err != nil {
+			return nil, err
+		}
+		done := len(items) < f.MaxItems
+		for _, it := range items {
+			if !submittedBetween(it, from, to) {
+				done = done || it.SubmittedAt.Before(from)
+				continue
+			}
+			d := it.SubmittedAt.UTC()
+			counts[time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)]++
+		}
+		if done {
+			break
+		}
+		f.Page++
+	}
+
+	months := make([]archiveMonth, 0)
+	for m := from; m.Before(to); m = m.AddDate(0, 1, 0) {
+		month := archiveMonth{Date: m}
+		for d := m; d.Before(m.AddDate(0, 1, 0)) && d.Before(to); d = d.AddDate(0, 0, 1) {
+			if cnt := counts[d]; cnt > 0 {
+				month.Days = append(month.Days, archiveDay{Date: d, Count: cnt})
+				month.Count += cnt
+			}
+		}
+		months = append(months, month)
+	}
+	return months, nil
+}
+
+// HandleArchive serves /{year}/ and /{year}/{month}/ requests
+func (h *handler) HandleArchive(w http.ResponseWriter, r *http.Request) {
+	from, to, err := archiveDate(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	months, err := loadArchive(h.storage, from, to)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load items!"))
+		return
+	}
+	baseURL, _ := url.Parse(h.conf.BaseURL)
+	m := archiveModel{Months: months}
+	m.Title = fmt.Sprintf("%s: archive of %s", baseURL.Host, from.Format("2006"))
+	if len(chi.URLParam(r, "month")) > 0 {
+		m.Title = fmt.Sprintf("%s: archive of %s", baseURL.Host, from.Format("January 2006"))
+	}
+	for _, month := range months {
+		m.Total += month.Count
+	}
+	h.v.RenderTemplate(r, w, "archive", m)
+}
+
+// HandleDate serves /{year}/{month}/{day}/ requests
+func (h *handler) HandleDate(w http.ResponseWriter, r *http.Request) {
+	from, to, err := archiveDate(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	filter := archiveFilter(to)
+	if err := qstring.Unmarshal(r.URL.Query(), &filter); err != nil {
+		h.logger.Debug("unable to load url parameters")
+	}
+	if filter.MaxItems > MaxContentItems {
+		filter.MaxItems = MaxContentItems
+	}
+
+	baseURL, _ := url.Parse(h.conf.BaseURL)
+	m := itemListingModel{}
+	m.Title = fmt.Sprintf("%s: %s", baseURL.Host, from.Format("January 2, 2006"))
+	m.HideText = true
+	comments, err := loadItems(r.Context(), filter, account(r), h.logger)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load items!"))
+		return
+	}
+	full := len(comments) >= filter.MaxItems
+	for _, c := range comments {
+		if !submittedBetween(c.Item, from, to) {
+			full = false
+			continue
+		}
+		m.Items = append(m.Items, c)
+	}
+	if full {
+		m.nextPage = filter.Page + 1
+	}
+	if filter.Page > 1 {
+		m.prevPage = filter.Page - 1
+	}
+	h.v.RenderTemplate(r, w, "listing", m)
+}
+
+// HandleDateRedirect serves the /{year}/{month}/{day}/{hash} permalinks of the previous versions of littr,
+// by redirecting them to the current location of the item
+func (h *handler) HandleDateRedirect(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := archiveDate(r); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	it, err := h.storage.LoadItem(Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Key: Hashes{Hash(chi.URLParam(r, "hash"))},
+		},
+		MaxItems: 1,
+	})
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	u := ItemPermaLink(it)
+	switch action := chi.URLParam(r, "action"); action {
+	case "":
+	case "yay", "nay", "bad", "edit", "rm":
+		u = fmt.Sprintf("%s/%s", ItemLocalLink(it), action)
+	default:
+		h.v.HandleErrors(w, r, errors.NotFoundf("%q", r.RequestURI))
+		return
+	}
+	if len(r.URL.RawQuery) > 0 {
+		u = fmt.Sprintf("%s?%s", u, r.URL.RawQuery)
+	}
+	h.v.Redirect(w, r, u, http.StatusMovedPermanently)
+}
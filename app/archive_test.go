@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func Test_loadArchive(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+
+	for _, d := range []time.Time{
+		time.Date(2019, 2, 28, 23, 59, 0, 0, time.UTC),
+		time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2019, 3, 31, 12, 0, 0, 0, time.UTC),
+		time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		mockItem(t, repo, Item{Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: d})
+	}
+
+	from := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	months, err := loadArchive(repo, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(months) != 1 {
+		t.Fatalf("Months count must be %d, received %d", 1, len(months))
+	}
+	expected := []archiveDay{{Date: from, Count: 2}, {Date: from.AddDate(0, 0, 30), Count: 1}}
+	if len(months[0].Days) != len(expected) {
+		t.Fatalf("Days count must be %d, received %d", len(expected), len(months[0].Days))
+	}
+	for k, d := range months[0].Days {
+		if !d.Date.Equal(expected[k].Date) || d.Count != expected[k].Count {
+			t.Errorf("Day %d must be %s with %d items, received %s with %d", k, expected[k].Date, expected[k].Count, d.Date, d.Count)
+		}
+	}
+
+	months, _ = loadArchive(repo, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(months) != 12 || months[1].Count != 1 || months[2].Count != 3 || months[3].Count != 1 {
+		t.Errorf("the year archive must contain the counts of all the months")
+	}
+}
+
+func Test_HandleDateRedirect(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	it := mockItem(t, repo, Item{Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+
+	h := mockHandler(repo)
+	r := chi.NewRouter()
+	r.Route("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}", func(r chi.Router) {
+		r.Get("/{hash}", h.HandleDateRedirect)
+		r.Get("/{hash}/{action}", h.HandleDateRedirect)
+	})
+
+	tests := map[string]struct {
+		path     string
+		status   int
+		location string
+	}{
+		"permalink": {"/2019/03/01/" + it.Hash.String(), http.StatusMovedPermanently, ItemPermaLink(it)},
+		"action":    {"/2019/03/01/" + it.Hash.String() + "/yay", http.StatusMovedPermanently, ItemLocalLink(it) + "/yay"},
+		"query":     {"/2019/03/01/" + it.Hash.String() + "?page=2", http.StatusMovedPermanently, ItemPermaLink(it) + "?page=2"},
+		"not found": {"/2019/03/01/" + newHash().String(), http.StatusNotFound, ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if tt.status != http.StatusMovedPermanently {
+				if w.Code == http.StatusMovedPermanently {
+					t.Errorf("Status must not be a redirect, received %d", w.Code)
+				}
+				return
+			}
+			if w.Code != tt.status {
+				t.Fatalf("Status must be %d, received %d", tt.status, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.location {
+				t.Errorf("Redirect location must be %q, received %q", tt.location, loc)
+			}
+		})
+	}
+}
+
+func Test_archiveDate(t *testing.T) {
+	tests := map[string]struct {
+		year, month, day string
+		from, to         time.Time
+		valid            bool
+	}{
+		"day":         {"2019", "03", "01", time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 3, 2, 0, 0, 0, 0, time.UTC), true},
+		"month":       {"2019", "12", "", time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		"year":        {"2019", "", "", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		"invalid day": {"2019", "02", "30", time.Time{}, time.Time{}, false},
+		"month 13":    {"2019", "13", "", time.Time{}, time.Time{}, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("year", tt.year)
+			if len(tt.month) > 0 {
+				rctx.URLParams.Add("month", tt.month)
+			}
+			if len(tt.day) > 0 {
+				rctx.URLParams.Add("day", tt.day)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			from, to, err := archiveDate(r)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Validity must be %t, received error %v", tt.valid, err)
+			}
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("Time span must be %s - %s, received %s - %s", tt.from, tt.to, from, to)
+			}
+		})
+	}
+}
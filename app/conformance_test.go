@@ -0,0 +1,432 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// repositoryConformance are the checks every Repository implementation needs to pass for returning the same
+// results as the FedBOX one, see testRepositoryConformance
+var repositoryConformance = []struct {
+	name string
+	test func(*testing.T, Repository)
+}{
+	{name: "LoadItems", test: testRepositoryLoadItems},
+	{name: "LoadItemsFollowed", test: testRepositoryLoadItemsFollowed},
+	{name: "SaveVote", test: testRepositorySaveVote},
+	{name: "FollowAccount", test: testRepositoryFollowAccount},
+	{name: "BlockAccount", test: testRepositoryBlockAccount},
+	{name: "LoadMessages", test: testRepositoryLoadMessages},
+	{name: "ShareItem", test: testRepositoryShareItem},
+}
+
+// testRepositoryConformance runs the conformance checks against a new repository returned by mock for each of them,
+// the returned function cleans up after the check
+func testRepositoryConformance(t *testing.T, mock func(*testing.T) (Repository, func())) {
+	for _, tt := range repositoryConformance {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, cleanup := mock(t)
+			defer cleanup()
+			tt.test(t, repo)
+		})
+	}
+}
+
+func mockAccount(t *testing.T, repo Repository, handle string) Account {
+	a, err := repo.SaveAccount(Account{Handle: handle, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("unable to save account %s: %s", handle, err)
+	}
+	return a
+}
+
+func mockItem(t *testing.T, repo Repository, it Item) Item {
+	it, err := repo.SaveItem(it)
+	if err != nil {
+		t.Fatalf("unable to save item %q: %s", it.Title, err)
+	}
+	return it
+}
+
+// testRepositoryLoadItems checks the results of the Filters combinations the handlers use for loading items,
+// it's shared by the Repository implementations which need to return the same results as the FedBOX one
+func testRepositoryLoadItems(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+
+	now := time.Now().UTC()
+	link := mockItem(t, repo, Item{
+		Title:       "A link",
+		Data:        "https://example.com/article",
+		MimeType:    MimeTypeURL,
+		SubmittedBy: &jane,
+		SubmittedAt: now.Add(-2 * time.Hour),
+	})
+	text := mockItem(t, repo, Item{
+		Title:       "Some #text",
+		Data:        "Lorem ipsum #dolor",
+		MimeType:    MimeTypeMarkdown,
+		SubmittedBy: &john,
+		SubmittedAt: now.Add(-time.Hour),
+	})
+	reply := mockItem(t, repo, Item{
+		Data:        "a reply",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &john,
+		Parent:      &link,
+	})
+	private := Item{
+		Data:        "a secret",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &jane,
+		Metadata:    &ItemMetadata{To: []*Account{&john}},
+	}
+	private.MakePrivate()
+	private = mockItem(t, repo, private)
+	deleted := mockItem(t, repo, Item{Data: "oops", MimeType: MimeTypeText, SubmittedBy: &jane})
+	deleted.SubmittedBy = &jane
+	deleted.Delete()
+	if _, err := repo.SaveItem(deleted); err != nil {
+		t.Fatalf("unable to delete item: %s", err)
+	}
+
+	tests := map[string]struct {
+		f     Filters
+		items ItemCollection
+	}{
+		"index": {
+			f: Filters{LoadItemsFilter: LoadItemsFilter{
+				InReplyTo: []string{""},
+				Deleted:   []bool{false},
+				Federated: []bool{false},
+				Private:   []bool{false},
+			}},
+			items: ItemCollection{text, link},
+		},
+		"author": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{AttributedTo: Hashes{john.Hash}}},
+			items: ItemCollection{reply, text},
+		},
+		"thread": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Context: []string{link.Metadata.ID}}},
+			items: ItemCollection{reply},
+		},
+		"top level": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Context: []string{ContextNil}, Deleted: []bool{false}}},
+			items: ItemCollection{private, text, link},
+		},
+		"domain": {
+			f: Filters{
+				LoadItemsFilter: LoadItemsFilter{URL: "example.com"},
+				LoadVotesFilter: LoadVotesFilter{Type: pub.ActivityVocabularyTypes{pub.PageType}},
+			},
+			items: ItemCollection{link},
+		},
+		"tag": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Content: "#dolor", ContentMatchType: MatchFuzzy}},
+			items: ItemCollection{text},
+		},
+		"before": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{SubmittedAt: now.Add(-90 * time.Minute), SubmittedAtMatchType: MatchBefore}},
+			items: ItemCollection{link},
+		},
+		"followed": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{FollowedBy: john.Hash.String()}},
+			items: ItemCollection{private},
+		},
+		"second page": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Deleted: []bool{false}}, MaxItems: 2, Page: 2},
+			items: ItemCollection{text, link},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			items, _, err := repo.LoadItems(tt.f)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(items) != len(tt.items) {
+				t.Fatalf("Items count must be %d, received %d", len(tt.items), len(items))
+			}
+			for k, it := range items {
+				if !HashesEqual(it.Hash, tt.items[k].Hash) {
+					t.Errorf("Item %d must be %q, received %q", k, tt.items[k].Data, it.Data)
+				}
+			}
+		})
+	}
+}
+
+// testRepositoryLoadItemsFollowed checks that the FollowedBy filter is combined with the rest of the filters
+func testRepositoryLoadItemsFollowed(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+
+	if err := repo.FollowAccount(bob, jane); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&jane, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	now := time.Now().UTC()
+	link := mockItem(t, repo, Item{Title: "A link", Data: "https://example.com", MimeType: MimeTypeURL, SubmittedBy: &jane,
+		SubmittedAt: now.Add(-2 * time.Hour)})
+	note := mockItem(t, repo, Item{Data: "a note", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-time.Hour)})
+	mockItem(t, repo, Item{Data: "a reply", MimeType: MimeTypeText, SubmittedBy: &jane, Parent: &link})
+	mockItem(t, repo, Item{Data: "not followed", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	tests := map[string]struct {
+		f     Filters
+		items ItemCollection
+	}{
+		"type": {
+			f: Filters{
+				LoadItemsFilter: LoadItemsFilter{FollowedBy: bob.Hash.String(), InReplyTo: []string{""}},
+				LoadVotesFilter: LoadVotesFilter{Type: pub.ActivityVocabularyTypes{pub.NoteType}},
+			},
+			items: ItemCollection{note},
+		},
+		"media type": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{FollowedBy: bob.Hash.String(), MediaType: []MimeType{MimeTypeURL}}},
+			items: ItemCollection{link},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			items, _, err := repo.LoadItems(tt.f)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(items) != len(tt.items) {
+				t.Fatalf("Items count must be %d, received %d", len(tt.items), len(items))
+			}
+			for k, it := range items {
+				if !HashesEqual(it.Hash, tt.items[k].Hash) {
+					t.Errorf("Item %d must be %q, received %q", k, tt.items[k].Data, it.Data)
+				}
+			}
+		})
+	}
+}
+
+func testRepositorySaveVote(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	it := mockItem(t, repo, Item{Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+
+	for _, w := range []int{1, -1, -1} {
+		if _, err := repo.SaveVote(Vote{SubmittedBy: &jane, Item: &it, Weight: w}); err != nil {
+			t.Fatalf("unable to save vote: %s", err)
+		}
+	}
+	votes, cnt, _ := repo.LoadVotes(Filters{LoadVotesFilter: LoadVotesFilter{ItemKey: Hashes{it.Hash}}})
+	if cnt != 0 || len(votes) != 0 {
+		t.Errorf("Votes count must be 0 after undoing a vote, received %d", cnt)
+	}
+	repo.SaveVote(Vote{SubmittedBy: &jane, Item: &it, Weight: 1})
+	if loaded, _ := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{it.Hash}}}); loaded.Score != 1 {
+		t.Errorf("Item score must be %d, received %d", 1, loaded.Score)
+	}
+}
+
+func testRepositoryFollowAccount(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+
+	if err := repo.FollowAccount(john, jane); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, cnt, _ := repo.LoadFollowRequests(&jane, Filters{
+		LoadFollowRequestsFilter: LoadFollowRequestsFilter{Actor: Hashes{Hash(john.Metadata.ID)}},
+	})
+	if cnt != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, cnt)
+	}
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+	if _, cnt, _ := repo.LoadFollowRequests(&jane, Filters{}); cnt != 0 {
+		t.Errorf("Follow requests count must be %d, received %d", 0, cnt)
+	}
+	acc, _ := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{"jane"}}})
+	if !AccountIsFollowed(&acc, &john) {
+		t.Errorf("Account %s must be followed by %s", acc.Handle, john.Handle)
+	}
+}
+
+func testRepositoryBlockAccount(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	follow := func() {
+		if err := repo.FollowAccount(john, jane); err != nil {
+			t.Fatalf("unable to follow: %s", err)
+		}
+		requests, _, _ := repo.LoadFollowRequests(&jane, Filters{})
+		if len(requests) != 1 {
+			t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+		}
+		if err := repo.SendFollowResponse(requests[0], true); err != nil {
+			t.Fatalf("unable to accept follow request: %s", err)
+		}
+	}
+	followedBy := func(acc Account) bool {
+		a, _ := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{"jane"}}})
+		return AccountIsFollowed(&a, &acc)
+	}
+
+	follow()
+	if err := repo.UnfollowAccount(john, jane); err != nil {
+		t.Fatalf("unable to unfollow: %s", err)
+	}
+	if followedBy(john) {
+		t.Errorf("Account %s must not be followed by %s after the unfollow", jane.Handle, john.Handle)
+	}
+	if err := repo.UnfollowAccount(john, jane); err == nil {
+		t.Errorf("unfollowing an account which isn't followed must fail")
+	}
+
+	follow()
+	if err := repo.BlockAccount(jane, john); err != nil {
+		t.Fatalf("unable to block: %s", err)
+	}
+	if followedBy(john) {
+		t.Errorf("the blocked account %s must be removed from the followers of %s", john.Handle, jane.Handle)
+	}
+	blocked, cnt, _ := repo.LoadBlockedAccounts(jane)
+	if cnt != 1 || !HashesEqual(blocked[0].Hash, john.Hash) {
+		t.Fatalf("Account %s must have blocked %s, received %v", jane.Handle, john.Handle, blocked)
+	}
+	if _, cnt, _ := repo.LoadBlockedAccounts(john); cnt != 0 {
+		t.Errorf("Blocked accounts count of %s must be %d, received %d", john.Handle, 0, cnt)
+	}
+	if err := repo.UnblockAccount(jane, john); err != nil {
+		t.Fatalf("unable to unblock: %s", err)
+	}
+	if _, cnt, _ := repo.LoadBlockedAccounts(jane); cnt != 0 {
+		t.Errorf("Blocked accounts count must be %d after the unblock, received %d", 0, cnt)
+	}
+}
+
+func testRepositoryLoadMessages(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+
+	now := time.Now().UTC()
+	message := func(from, to Account, data string, submittedAt time.Time, parent *Item) Item {
+		it := Item{
+			Data:        data,
+			MimeType:    MimeTypeText,
+			SubmittedBy: &from,
+			SubmittedAt: submittedAt,
+			Parent:      parent,
+			Metadata:    &ItemMetadata{To: []*Account{&to}},
+		}
+		it.MakePrivate()
+		return mockItem(t, repo, it)
+	}
+	first := message(jane, john, "hello john", now.Add(-2*time.Hour), nil)
+	message(john, jane, "hello jane", now.Add(-time.Hour), &first)
+	message(jane, bob, "hello bob", now, nil)
+	mockItem(t, repo, Item{Data: "hello everyone", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now})
+
+	if _, cnt, _ := repo.LoadMessages(jane, Filters{}); cnt != 3 {
+		t.Errorf("Messages count of %s must be %d, received %d", jane.Handle, 3, cnt)
+	}
+	messages, cnt, err := repo.LoadMessages(john, Filters{})
+	if err != nil {
+		t.Fatalf("unable to load messages: %s", err)
+	}
+	if cnt != 2 {
+		t.Fatalf("Messages count of %s must be %d, received %d", john.Handle, 2, cnt)
+	}
+	if messages[0].Data != "hello jane" {
+		t.Errorf("the most recent message must be first, received %q", messages[0].Data)
+	}
+	public, _, _ := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{Private: []bool{false}}})
+	if len(public) != 1 {
+		t.Errorf("Public items count must be %d, received %d", 1, len(public))
+	}
+
+	convs, err := loadAccountConversations(repo, &john)
+	if err != nil {
+		t.Fatalf("unable to load conversations: %s", err)
+	}
+	if len(convs) != 1 {
+		t.Fatalf("Conversations count of %s must be %d, received %d", john.Handle, 1, len(convs))
+	}
+	if convs[0].Unread() != 1 {
+		t.Errorf("Unread messages count must be %d, received %d", 1, convs[0].Unread())
+	}
+	if err := repo.MarkMessagesRead(john, convs[0].unread...); err != nil {
+		t.Fatalf("unable to mark the messages as read: %s", err)
+	}
+	if err := repo.MarkMessagesRead(john, convs[0].unread...); err != nil {
+		t.Fatalf("unable to mark the messages as read twice: %s", err)
+	}
+	if read, _ := repo.LoadReadMessages(john); len(read) != 1 {
+		t.Errorf("Read messages count must be %d, received %d", 1, len(read))
+	}
+	if cnt := unreadMessagesCount(repo, &john); cnt != 0 {
+		t.Errorf("Unread messages count must be %d after reading them, received %d", 0, cnt)
+	}
+	if cnt := unreadMessagesCount(repo, &bob); cnt != 1 {
+		t.Errorf("Unread messages count of %s must be %d, received %d", bob.Handle, 1, cnt)
+	}
+}
+
+func testRepositoryShareItem(t *testing.T, repo Repository) {
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+
+	if err := repo.FollowAccount(bob, john); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&john, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	it := mockItem(t, repo, Item{Title: "news", Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+	for i := 0; i < 2; i++ {
+		if err := repo.ShareItem(john, it); err != nil {
+			t.Fatalf("unable to share item: %s", err)
+		}
+	}
+	loaded, err := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{it.Hash}}})
+	if err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	if loaded.Shares != 1 {
+		t.Errorf("Shares count must be %d, received %d", 1, loaded.Shares)
+	}
+
+	items, _, err := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{FollowedBy: bob.Hash.String()}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(items) != 1 || !HashesEqual(items[0].Hash, it.Hash) {
+		t.Fatalf("Items followed by %s must contain %q, received %v", bob.Handle, it.Title, items)
+	}
+	if !items[0].SharedBy.IsValid() || !HashesEqual(items[0].SharedBy.Hash, john.Hash) {
+		t.Errorf("Item must be shared by %s, received %v", john.Handle, items[0].SharedBy)
+	}
+
+	msg := Item{Data: "secret", MimeType: MimeTypeText, SubmittedBy: &jane, Metadata: &ItemMetadata{To: []*Account{&john}}}
+	msg.MakePrivate()
+	msg = mockItem(t, repo, msg)
+	if err := repo.ShareItem(john, msg); err == nil {
+		t.Errorf("sharing a private item must fail")
+	}
+}
@@ -41,7 +41,7 @@ func Markdown(data string) template.HTML {
 	)
 
 	h := md.RenderToString([]byte(data))
-	return template.HTML(h)
+	return template.HTML(sanitizeHTML(h))
 }
 
 // HasMetadata
@@ -119,6 +119,21 @@ func loadComments(items []Item) comments {
 	return all
 }
 
+// withoutBlocked returns the comments which weren't submitted by accounts that acc blocked
+func (c comments) withoutBlocked(acc *Account) comments {
+	if acc == nil || len(acc.Blocked) == 0 {
+		return c
+	}
+	all := make(comments, 0, len(c))
+	for _, com := range c {
+		if com.SubmittedBy != nil && AccountBlocks(acc, com.SubmittedBy) {
+			continue
+		}
+		all = append(all, com)
+	}
+	return all
+}
+
 func (c comments) Contains(cc comment) bool {
 	for _, com := range c {
 		if HashesEqual(com.Hash, cc.Hash) {
@@ -154,7 +169,8 @@ func mimeTypeTagReplace(m MimeType, t Tag) string {
 		cls = "mention"
 	}
 
-	return fmt.Sprintf("<a href='%s' class='%s'>%s</a>", t.URL, cls, t.Name)
+	return fmt.Sprintf(`<a href="%s" class="%s" rel="%s">%s</a>`, template.HTMLEscapeString(t.URL), cls, linkRel,
+		template.HTMLEscapeString(t.Name))
 }
 
 func inRange(n string, nn map[string]string) bool {
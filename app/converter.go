@@ -146,12 +146,6 @@ func (a *Account) FromActivityPub(it pub.Item) error {
 	default:
 		return errors.Newf("invalid actor type")
 	}
-
-	if a.HasMetadata() && a.Metadata.URL == a.Metadata.ID {
-		a.Metadata.URL = ""
-	}
-
-	return nil
 }
 
 func FromArticle(i *Item, a *pub.Object) error {
@@ -190,6 +184,9 @@ func FromArticle(i *Item, a *pub.Object) error {
 			i.Metadata.URL = a.URL.GetLink().String()
 		}
 	}
+	if a.Shares != nil {
+		i.Metadata.SharesURI = a.Shares.GetLink().String()
+	}
 	if a.Icon != nil {
 		if a.Icon.IsObject() {
 			if ic, ok := a.Icon.(*pub.Object); ok {
@@ -202,6 +199,22 @@ func FromArticle(i *Item, a *pub.Object) error {
 			}
 		}
 	}
+	if a.Type == pub.PageType {
+		i.Metadata.Description = a.Summary.First().Value
+		if a.Image != nil {
+			pub.OnObject(a.Image, func(o *pub.Object) error {
+				if o.URL == nil {
+					return nil
+				}
+				i.Metadata.Image.MimeType = string(o.MediaType)
+				i.Metadata.Image.URI = o.URL.GetLink().String()
+				return nil
+			})
+		}
+		if l, ok := a.Attachment.(*pub.Link); ok && l.Rel == "canonical" {
+			i.Metadata.Canonical = l.Href.String()
+		}
+	}
 	if a.Context != nil {
 		op := Item{}
 		op.FromActivityPub(a.Context)
@@ -338,6 +351,21 @@ func (i *Item) FromActivityPub(it pub.Item) error {
 			i.Metadata.AuthorURI = act.Actor.GetLink().String()
 			return err
 		})
+	case pub.AnnounceType:
+		// NOTE(marius): the boosts we receive from Mastodon and the shares of our own users
+		//  load the item they share, with the actor announcing it as the account sharing it
+		return pub.OnActivity(it, func(act *pub.Activity) error {
+			if act.Object == nil {
+				return errors.Newf("missing object for %s", act.Type)
+			}
+			err := i.FromActivityPub(act.Object)
+			if act.Actor != nil {
+				sharer := Account{Metadata: &AccountMetadata{}}
+				sharer.FromActivityPub(act.Actor)
+				i.SharedBy = &sharer
+			}
+			return err
+		})
 	case pub.ArticleType:
 		fallthrough
 	case pub.NoteType:
@@ -478,7 +506,10 @@ func (i *TagCollection) FromActivityPub(it pub.ItemCollection) error {
 	}
 	for _, t := range it {
 		if m, ok := t.(*pub.Mention); ok {
-			u := string(t.GetID())
+			u := string(m.Href)
+			if len(u) == 0 {
+				u = string(t.GetID())
+			}
 			// we have a link
 			lt := Tag{
 				URL:  u,
@@ -12,6 +12,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,11 +23,29 @@ const (
 	objects    = handlers.CollectionType("objects")
 )
 
+const (
+	// collectionCacheTTL is the time a collection loaded from FedBOX is kept in the cache
+	collectionCacheTTL = 30 * time.Second
+	// objectCacheTTL is the time an object, actor or activity loaded from FedBOX is kept in the cache
+	objectCacheTTL = 5 * time.Minute
+)
+
+// Cache is the storage used for the items loaded from FedBOX
+type Cache interface {
+	Load(key string) (interface{}, bool)
+	Store(key string, val interface{}, ttl time.Duration)
+	// Remove deletes the entries for the received keys, including the ones that only differ by their query string
+	Remove(keys ...string)
+}
+
 type fedbox struct {
 	baseURL *url.URL
 	client  client.HttpClient
-	infoFn  LogFn
-	errFn   LogFn
+	cache   Cache
+	// authorized is set when the requests are signed for an account
+	authorized bool
+	infoFn     LogFn
+	errFn      LogFn
 }
 
 type OptionFn func(*fedbox) error
@@ -73,10 +94,30 @@ func SetSignFn(signer client.RequestSignFn) OptionFn {
 	}
 }
 
+func SetCache(c Cache) OptionFn {
+	return func(f *fedbox) error {
+		f.cache = c
+		return nil
+	}
+}
+
 func (f *fedbox) SignFn(signer client.RequestSignFn) {
 	f.client.SignFn(signer)
 }
 
+// clone returns a copy of the client that can be authorized separately, it shares the cache with the original
+func (f fedbox) clone() *fedbox {
+	f.client = client.NewClient()
+	f.authorized = false
+	return &f
+}
+
+// Authorize sets the function signing the requests, authorized is true when it signs them for an account
+func (f *fedbox) Authorize(authorized bool, signer client.RequestSignFn) {
+	f.authorized = authorized
+	f.client.SignFn(signer)
+}
+
 func SetUA(s string) OptionFn {
 	return func(f *fedbox) error {
 		client.UserAgent = s
@@ -98,8 +139,38 @@ func NewClient(o ...OptionFn) (*fedbox, error) {
 	return &f, nil
 }
 
-func (f fedbox) collection(i pub.IRI) (pub.CollectionInterface, error) {
+// cacheable checks if the IRI can be stored in the cache.
+// FedBOX filters the responses by the account the request is authorized for, so we only cache the
+// anonymous requests. The actors' inboxes are excluded too, as they can't be loaded anonymously.
+func (f fedbox) cacheable(i pub.IRI) bool {
+	if f.cache == nil || f.authorized {
+		return false
+	}
+	u, err := i.URL()
+	if err != nil {
+		return false
+	}
+	return path.Base(u.Path) != string(handlers.Inbox) || strings.TrimSuffix(u.Path, "/inbox") == strings.TrimSuffix(f.baseURL.Path, "/")
+}
+
+func (f fedbox) load(i pub.IRI, ttl time.Duration) (pub.Item, error) {
+	cacheable := f.cacheable(i)
+	if cacheable {
+		if it, ok := f.cache.Load(i.String()); ok {
+			if item, ok := it.(pub.Item); ok {
+				return item, nil
+			}
+		}
+	}
 	it, err := f.client.LoadIRI(i)
+	if err == nil && cacheable {
+		f.cache.Store(i.String(), it, ttl)
+	}
+	return it, err
+}
+
+func (f fedbox) collection(i pub.IRI) (pub.CollectionInterface, error) {
+	it, err := f.load(i, collectionCacheTTL)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Unable to load IRI: %s", i)
 	}
@@ -126,7 +197,7 @@ func (f fedbox) collection(i pub.IRI) (pub.CollectionInterface, error) {
 }
 
 func (f fedbox) object(i pub.IRI) (pub.Item, error) {
-	return f.client.LoadIRI(i)
+	return f.load(i, objectCacheTTL)
 }
 func rawFilterQuery(f ...FilterFn) string {
 	if len(f) == 0 {
@@ -325,6 +396,65 @@ func postRequest(f fedbox, url pub.IRI, a pub.Item) (pub.IRI, pub.Item, error) {
 	return iri, it, err
 }
 
+// invalidate removes from the cache the entries that the activity could have modified.
+// The inboxes of the actors receiving the activity through a followers collection are not cached, so they are skipped.
+func (f fedbox) invalidate(a pub.Item) {
+	if f.cache == nil {
+		return
+	}
+	base := pub.IRI(f.baseURL.String())
+	keys := []pub.IRI{iri(base, activities), iri(base, handlers.Inbox)}
+	pub.OnActivity(a, func(act *pub.Activity) error {
+		if act.Actor != nil {
+			keys = append(keys, outbox(act.Actor))
+		}
+		if act.Object == nil {
+			return nil
+		}
+		ob := act.Object
+		switch act.Type {
+		case pub.CreateType, pub.UpdateType, pub.DeleteType:
+			keys = append(keys, ob.GetLink(), replies(ob), iri(base, objects), iri(base, actors))
+			pub.OnObject(ob, func(o *pub.Object) error {
+				for _, par := range []pub.Item{o.Context, o.InReplyTo} {
+					if col, ok := par.(pub.ItemCollection); ok {
+						for _, p := range col {
+							keys = append(keys, p.GetLink(), replies(p))
+						}
+					} else if par != nil {
+						keys = append(keys, par.GetLink(), replies(par))
+					}
+				}
+				return nil
+			})
+		case pub.LikeType, pub.DislikeType:
+			keys = append(keys, ob.GetLink(), likes(ob), liked(act.Actor))
+		case pub.AnnounceType:
+			keys = append(keys, shares(ob))
+		case pub.UndoType:
+			keys = append(keys, ob.GetLink(), liked(act.Actor), following(act.Actor))
+			if undone, err := f.Activity(ob.GetLink()); err == nil && undone.Object != nil {
+				keys = append(keys, undone.Object.GetLink(), likes(undone.Object), followers(undone.Object))
+			}
+		case pub.RemoveType:
+			if act.Target != nil {
+				keys = append(keys, act.Target.GetLink())
+			}
+		case pub.AcceptType, pub.RejectType:
+			keys = append(keys, followers(act.Actor))
+			if follow, err := f.Activity(ob.GetLink()); err == nil && follow.Actor != nil {
+				keys = append(keys, following(follow.Actor))
+			}
+		}
+		return nil
+	})
+	toRemove := make([]string, len(keys))
+	for i, k := range keys {
+		toRemove[i] = k.String()
+	}
+	f.cache.Remove(toRemove...)
+}
+
 func (f fedbox) ToOutbox(a pub.Item) (pub.IRI, pub.Item, error) {
 	url := pub.IRI("")
 	err := pub.OnActivity(a, func(a *pub.Activity) error {
@@ -337,7 +467,11 @@ func (f fedbox) ToOutbox(a pub.Item) (pub.IRI, pub.Item, error) {
 	if len(url) == 0 {
 		return "", nil, errors.Newf("Invalid URL to post to")
 	}
-	return postRequest(f, url, a)
+	iri, it, err := postRequest(f, url, a)
+	if err == nil {
+		f.invalidate(a)
+	}
+	return iri, it, err
 }
 
 func (f fedbox) ToInbox(a pub.Item) (pub.IRI, pub.Item, error) {
@@ -352,5 +486,9 @@ func (f fedbox) ToInbox(a pub.Item) (pub.IRI, pub.Item, error) {
 	if len(url) == 0 {
 		return "", nil, errors.Newf("Invalid URL to post to")
 	}
-	return postRequest(f, url, a)
+	iri, it, err := postRequest(f, url, a)
+	if err == nil {
+		f.invalidate(a)
+	}
+	return iri, it, err
 }
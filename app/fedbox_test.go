@@ -1,8 +1,15 @@
 package app
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/littr.go/internal/log"
 )
 
 func Test_RawFilterQuery(t *testing.T) {
@@ -47,3 +54,47 @@ func Test_RawFilterQuery(t *testing.T) {
 		}
 	}
 }
+
+func Test_fedbox_loadAuthorized(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// NOTE(marius): like FedBOX, the response depends on the account the request is authorized for
+		name := "public"
+		if len(r.Header.Get("Authorization")) > 0 {
+			name = "private"
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		fmt.Fprintf(w, `{"id":"http://%s%s","type":"Note","name":%q}`, r.Host, r.URL.Path, name)
+	}))
+	defer srv.Close()
+
+	repo := ActivityPubService(appConfig{APIURL: srv.URL, Logger: log.Dev(log.PanicLevel)})
+	jane := Account{Handle: "jane", Hash: Hash("jane"), CreatedAt: time.Now().UTC(),
+		Metadata: &AccountMetadata{OAuth: OAuth{Token: "jane-token"}}}
+	iri := pub.IRI(fmt.Sprintf("%s/objects/1", srv.URL))
+	name := func() string {
+		it, err := repo.fedbox.object(iri)
+		if err != nil {
+			t.Fatalf("unable to load %s: %s", iri, err)
+		}
+		ob, _ := pub.ToObject(it)
+		return ob.Name.First().Value
+	}
+
+	repo.WithAccount(&jane)
+	if n := name(); n != "private" {
+		t.Fatalf("Authorized response must be %q, received %q", "private", n)
+	}
+	repo.WithAccount(nil)
+	if n := name(); n != "public" {
+		t.Errorf("Anonymous response must be %q, received %q", "public", n)
+	}
+	if n := name(); n != "public" || requests != 2 {
+		t.Errorf("Anonymous response must be loaded from the cache, the server received %d requests instead of %d", requests, 2)
+	}
+	repo.WithAccount(&jane)
+	if n := name(); n != "private" {
+		t.Errorf("Authorized response must not be loaded from the cache, received %q", n)
+	}
+}
@@ -0,0 +1,387 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type FeedType string
+
+const (
+	FeedRSS  = FeedType("rss")
+	FeedAtom = FeedType("atom")
+)
+
+var FeedCtxtKey CtxtKey = "__feed"
+
+const (
+	atomNS  = "http://www.w3.org/2005/Atom"
+	littrNS = "https://littr.me/ns#"
+	dcNS    = "http://purl.org/dc/elements/1.1/"
+)
+
+// ContentType returns the mime type the feed gets served with
+func (f FeedType) ContentType() string {
+	switch f {
+	case FeedRSS:
+		return "application/rss+xml"
+	case FeedAtom:
+		return "application/atom+xml"
+	}
+	return ""
+}
+
+// feedTypeFromAccept returns the feed type the client prefers over HTML, if any
+func feedTypeFromAccept(accept string) (FeedType, bool) {
+	for _, mt := range strings.Split(accept, ",") {
+		if i := strings.Index(mt, ";"); i >= 0 {
+			mt = mt[:i]
+		}
+		switch strings.TrimSpace(mt) {
+		case FeedRSS.ContentType():
+			return FeedRSS, true
+		case FeedAtom.ContentType():
+			return FeedAtom, true
+		case "text/html", "application/xhtml+xml", "*/*":
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// Feeds checks if the request is for the RSS or Atom representation of a page, either through the ".rss"
+// and ".atom" extensions of the path, or through the Accept header, and stores the feed type in the context.
+// The extension gets removed from the path, so the request gets routed to the regular handler of the page.
+// As the pages are served as HTML or as feeds depending on the Accept header, all the responses vary by it.
+func (h *handler) Feeds(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		typ, ok := feedTypeFromAccept(r.Header.Get("Accept"))
+		for _, t := range []FeedType{FeedRSS, FeedAtom} {
+			ext := "." + string(t)
+			if !strings.HasSuffix(r.URL.Path, ext) {
+				continue
+			}
+			typ, ok = t, true
+			r.URL.Path = feedPagePath(strings.TrimSuffix(r.URL.Path, ext))
+			r.URL.RawPath = ""
+			if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && len(rctx.RoutePath) > 0 {
+				rctx.RoutePath = feedPagePath(strings.TrimSuffix(rctx.RoutePath, ext))
+			}
+			break
+		}
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), FeedCtxtKey, typ))
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// feedPagePath maps "/index", which is how we link to the feed of the main page, to "/"
+func feedPagePath(p string) string {
+	if p == "/index" || p == "" {
+		return "/"
+	}
+	return p
+}
+
+func requestedFeed(r *http.Request) (FeedType, bool) {
+	typ, ok := r.Context().Value(FeedCtxtKey).(FeedType)
+	return typ, ok
+}
+
+// feedLink returns the link to the t feed of the current page
+func feedLink(r *http.Request, t FeedType) string {
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	if p == "" {
+		p = "/index"
+	}
+	u := *r.URL
+	u.Path = fmt.Sprintf("%s.%s", p, t)
+	u.RawPath = ""
+	return u.RequestURI()
+}
+
+// feedModel is implemented by the models that can be rendered as RSS and Atom feeds
+type feedModel interface {
+	feedTitle() string
+	feedItems() []Item
+}
+
+func (i itemListingModel) feedTitle() string {
+	return i.Title
+}
+
+// feedItems returns the items of the listing, the private ones are never part of a feed
+func (i itemListingModel) feedItems() []Item {
+	items := make([]Item, 0)
+	for _, it := range i.Items {
+		if c, ok := it.(*comment); ok && !c.Private() {
+			items = append(items, c.Item)
+		}
+	}
+	return items
+}
+
+func (c contentModel) feedTitle() string {
+	return fmt.Sprintf("Comments on %s", c.Title)
+}
+
+// feedItems returns the comments of the item, the newest first
+func (c contentModel) feedItems() []Item {
+	all := make(comments, 0)
+	var walk func(cc comments)
+	walk = func(cc comments) {
+		for _, ch := range cc {
+			all = append(all, ch)
+			walk(ch.Children)
+		}
+	}
+	walk(c.Content.Children)
+	all.sortBy(SortNew, time.Now())
+	items := make([]Item, 0)
+	for _, ch := range all {
+		if ch.Private() {
+			continue
+		}
+		items = append(items, ch.Item)
+	}
+	return items
+}
+
+func absoluteLink(l string) string {
+	if strings.HasPrefix(l, "/") {
+		return Instance.BaseURL + l
+	}
+	return l
+}
+
+func feedItemTitle(i Item) string {
+	if len(i.Title) > 0 {
+		return i.Title
+	}
+	if i.SubmittedBy != nil {
+		return fmt.Sprintf("%s comment", genitive(i.SubmittedBy.Handle))
+	}
+	return "comment"
+}
+
+// feedItemLink returns the target of a link submission, or the item's permalink
+func feedItemLink(i Item) string {
+	if i.IsLink() {
+		return i.Data
+	}
+	return absoluteLink(ItemPermaLink(i))
+}
+
+func feedItemContent(i Item) string {
+	if i.Deleted() || i.IsLink() {
+		return ""
+	}
+	switch i.MimeType {
+	case MimeTypeHTML:
+		return sanitizeHTML(replaceTagsInItem(i))
+	case MimeTypeMarkdown:
+		return string(Markdown(replaceTagsInItem(i)))
+	}
+	return template.HTMLEscapeString(i.Data)
+}
+
+func feedItemUpdated(i Item) time.Time {
+	if i.UpdatedAt.After(i.SubmittedAt) {
+		return i.UpdatedAt
+	}
+	return i.SubmittedAt
+}
+
+func feedUpdated(items []Item) time.Time {
+	updated := time.Time{}
+	for _, it := range items {
+		if u := feedItemUpdated(it); u.After(updated) {
+			updated = u
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+	return updated
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Littr   string     `xml:"xmlns:littr,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Self          atomLink  `xml:"atom:link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Comments    string  `xml:"comments"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	PubDate     string  `xml:"pubDate"`
+	Updated     string  `xml:"atom:updated"`
+	Score       int     `xml:"littr:score"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	Littr   string      `xml:"xmlns:littr,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Links     []atomLink   `xml:"link"`
+	Author    *atomAuthor  `xml:"author,omitempty"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Score     int          `xml:"littr:score"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+func loadRSSFeed(title, link, self string, items []Item) rssFeed {
+	f := rssFeed{
+		Version: "2.0",
+		Atom:    atomNS,
+		DC:      dcNS,
+		Littr:   littrNS,
+		Channel: rssChannel{
+			Title:         title,
+			Link:          link,
+			Self:          atomLink{Href: self, Rel: "self", Type: FeedRSS.ContentType()},
+			Description:   title,
+			LastBuildDate: feedUpdated(items).Format(time.RFC1123Z),
+		},
+	}
+	for _, it := range items {
+		permaLink := absoluteLink(ItemPermaLink(it))
+		ri := rssItem{
+			Title:       feedItemTitle(it),
+			Link:        feedItemLink(it),
+			Comments:    permaLink,
+			GUID:        rssGUID{IsPermaLink: true, Value: permaLink},
+			PubDate:     it.SubmittedAt.Format(time.RFC1123Z),
+			Updated:     feedItemUpdated(it).Format(time.RFC3339),
+			Score:       it.Score,
+			Description: feedItemContent(it),
+		}
+		if it.SubmittedBy != nil {
+			ri.Creator = ShowAccountHandle(*it.SubmittedBy)
+		}
+		f.Channel.Items = append(f.Channel.Items, ri)
+	}
+	return f
+}
+
+func loadAtomFeed(title, link, self string, items []Item) atomFeed {
+	f := atomFeed{
+		NS:      atomNS,
+		Littr:   littrNS,
+		ID:      self,
+		Title:   title,
+		Updated: feedUpdated(items).Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: FeedAtom.ContentType()},
+			{Href: link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, it := range items {
+		permaLink := absoluteLink(ItemPermaLink(it))
+		e := atomEntry{
+			ID:    permaLink,
+			Title: feedItemTitle(it),
+			Links: []atomLink{
+				{Href: feedItemLink(it), Rel: "alternate"},
+				{Href: permaLink, Rel: "replies", Type: "text/html"},
+			},
+			Published: it.SubmittedAt.Format(time.RFC3339),
+			Updated:   feedItemUpdated(it).Format(time.RFC3339),
+			Score:     it.Score,
+		}
+		if it.SubmittedBy != nil {
+			e.Author = &atomAuthor{
+				Name: ShowAccountHandle(*it.SubmittedBy),
+				URI:  absoluteLink(AccountPermaLink(*it.SubmittedBy)),
+			}
+		}
+		if c := feedItemContent(it); len(c) > 0 {
+			e.Content = &atomContent{Type: "html", Value: c}
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+// RenderFeed serializes the items of the m model as a t feed
+func (h *view) RenderFeed(r *http.Request, w http.ResponseWriter, t FeedType, m feedModel) error {
+	u := *r.URL
+	link := absoluteLink(u.RequestURI())
+	self := absoluteLink(feedLink(r, t))
+
+	var f interface{}
+	switch t {
+	case FeedAtom:
+		f = loadAtomFeed(m.feedTitle(), link, self, m.feedItems())
+	default:
+		f = loadRSSFeed(m.feedTitle(), link, self, m.feedItems())
+	}
+	out, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		h.errFn(err.Error(), nil)
+		return err
+	}
+	w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", t.ContentType()))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	_, err = w.Write(out)
+	return err
+}
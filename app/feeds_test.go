@@ -0,0 +1,110 @@
+package app
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+func Test_handler_Feeds(t *testing.T) {
+	tests := map[string]struct {
+		path   string
+		accept string
+		typ    FeedType
+		page   string
+	}{
+		"rss":      {path: "/~jane.rss", typ: FeedRSS, page: "/~jane"},
+		"atom":     {path: "/t/go.atom", typ: FeedAtom, page: "/t/go"},
+		"index":    {path: "/index.rss", typ: FeedRSS, page: "/"},
+		"accept":   {path: "/federated", accept: "application/atom+xml", typ: FeedAtom, page: "/federated"},
+		"browsers": {path: "/federated", accept: "text/html,application/rss+xml", page: "/federated"},
+	}
+	h := handler{}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Accept", tt.accept)
+			var typ FeedType
+			var page string
+			w := httptest.NewRecorder()
+			h.Feeds(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				typ, _ = requestedFeed(r)
+				page = r.URL.Path
+			})).ServeHTTP(w, r)
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("Response must vary by %q, received %q", "Accept", vary)
+			}
+			if typ != tt.typ {
+				t.Errorf("Feed type must be %q, received %q", tt.typ, typ)
+			}
+			if page != tt.page {
+				t.Errorf("Page path must be %q, received %q", tt.page, page)
+			}
+		})
+	}
+}
+
+func Test_view_RenderFeed(t *testing.T) {
+	jane := Account{Handle: "jane", Hash: Hash("jane")}
+	now := time.Now().UTC()
+	m := itemListingModel{
+		Title: "littr.git: main page",
+		Items: []HasType{
+			&comment{Item: Item{Hash: Hash("link"), Title: "A link", MimeType: MimeTypeURL, Data: "https://example.com", SubmittedBy: &jane, SubmittedAt: now, Score: 3}},
+			&comment{Item: Item{Hash: Hash("text"), Title: "Some <text>", MimeType: MimeTypeText, Data: "a < b", SubmittedBy: &jane, SubmittedAt: now}},
+		},
+	}
+	noop := func(string, log.Ctx) {}
+	v := view{infoFn: noop, errFn: noop}
+
+	t.Run("rss", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		if err := v.RenderFeed(httptest.NewRequest(http.MethodGet, "/", nil), w, FeedRSS, m); err != nil {
+			t.Fatalf("unable to render feed: %s", err)
+		}
+		f := struct {
+			Items []struct {
+				Title    string `xml:"title"`
+				Link     string `xml:"link"`
+				Comments string `xml:"comments"`
+				Score    int    `xml:"score"`
+			} `xml:"channel>item"`
+		}{}
+		if err := xml.Unmarshal(w.Body.Bytes(), &f); err != nil {
+			t.Fatalf("invalid feed: %s", err)
+		}
+		if len(f.Items) != 2 {
+			t.Fatalf("Feed must have %d items, received %d", 2, len(f.Items))
+		}
+		if f.Items[0].Link != "https://example.com" || f.Items[0].Score != 3 {
+			t.Errorf("Link item must point to %q with score %d, received %q, %d", "https://example.com", 3, f.Items[0].Link, f.Items[0].Score)
+		}
+		if f.Items[1].Title != "Some <text>" || f.Items[1].Link != f.Items[1].Comments {
+			t.Errorf("Text item must link to its permalink %q, received %q", f.Items[1].Comments, f.Items[1].Link)
+		}
+	})
+	t.Run("atom", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		if err := v.RenderFeed(httptest.NewRequest(http.MethodGet, "/", nil), w, FeedAtom, m); err != nil {
+			t.Fatalf("unable to render feed: %s", err)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+			t.Errorf("Content type must be atom, received %q", ct)
+		}
+		f := struct {
+			Entries []struct {
+				Author string `xml:"author>name"`
+			} `xml:"entry"`
+		}{}
+		if err := xml.Unmarshal(w.Body.Bytes(), &f); err != nil {
+			t.Fatalf("invalid feed: %s", err)
+		}
+		if len(f.Entries) != 2 || f.Entries[0].Author != jane.Handle {
+			t.Errorf("Feed must have %d entries by %q", 2, jane.Handle)
+		}
+	})
+}
@@ -15,6 +15,8 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -22,13 +24,24 @@ const (
 	csrfName    = "_c"
 	templateDir = "templates/"
 	assetsDir   = "assets/"
+
+	// tokenExpiryDelta is how early we refresh an OAuth2 token, so it doesn't expire while we're using it
+	tokenExpiryDelta = time.Minute
+	// refreshedTokenGrace is how long we keep the token a refresh token was exchanged for, for the requests
+	// that were sent with the session from before the refresh
+	refreshedTokenGrace = time.Minute
 )
 
 type handler struct {
-	conf    appConfig
-	v       *view
-	logger  log.Logger
-	storage *repository
+	conf      appConfig
+	v         *view
+	logger    log.Logger
+	storage   Repository
+	index     Index
+	app       *Account
+	preview   *previewFetcher
+	tokens    *tokenRefreshes
+	suspended *suspensions
 }
 
 var defaultAccount = AnonymousAccount
@@ -42,13 +55,17 @@ type appConfig struct {
 	Secure          bool
 	SessionKeys     [][]byte
 	SessionsBackend string
+	StorageBackend  string
+	CacheBackend    string
+	SearchBackend   string
+	SearchIndexPath string
 	Logger          log.Logger
 }
 
 func Init(c appConfig) (handler, error) {
 	var err error
 
-	h := handler{}
+	h := handler{tokens: new(tokenRefreshes), suspended: new(suspensions)}
 
 	infoFn := func(string, log.Ctx) {}
 	errFn := func(string, log.Ctx) {}
@@ -69,20 +86,75 @@ func Init(c appConfig) (handler, error) {
 	c.SessionsBackend = strings.ToLower(c.SessionsBackend)
 	c.SessionKeys = loadEnvSessionKeys()
 	h.v, _ = ViewInit(c, infoFn, errFn)
+	h.preview = newPreviewFetcher(fmt.Sprintf("%s-%s", c.HostName, c.Version))
+
+	if c.StorageBackend = os.Getenv("STORAGE_BACKEND"); c.StorageBackend == "" {
+		c.StorageBackend = "fedbox"
+	}
+	c.StorageBackend = strings.ToLower(c.StorageBackend)
+	if c.CacheBackend = os.Getenv("CACHE_BACKEND"); c.CacheBackend == "" {
+		c.CacheBackend = "lru"
+	}
+	c.CacheBackend = strings.ToLower(c.CacheBackend)
+	if c.CacheBackend != "lru" && c.CacheBackend != "redis" && c.CacheBackend != "none" {
+		infoFn(fmt.Sprintf("Invalid cache backend %q, falling back to lru.", c.CacheBackend), nil)
+		c.CacheBackend = "lru"
+	}
+	if c.SearchBackend = os.Getenv("SEARCH_BACKEND"); c.SearchBackend == "" {
+		c.SearchBackend = "embedded"
+	}
+	c.SearchBackend = strings.ToLower(c.SearchBackend)
+	if c.SearchBackend != "embedded" && c.SearchBackend != "es" && c.SearchBackend != "none" {
+		infoFn(fmt.Sprintf("Invalid search backend %q, falling back to embedded.", c.SearchBackend), nil)
+		c.SearchBackend = "embedded"
+	}
+	if c.SearchIndexPath = os.Getenv("SEARCH_INDEX_PATH"); c.SearchIndexPath == "" {
+		c.SearchIndexPath = defaultSearchIndexPath
+	}
 	h.conf = c
 
-	h.storage = ActivityPubService(c)
+	if h.index, err = initIndex(c); err != nil {
+		errFn(fmt.Sprintf("Unable to initialize the %s search backend: %s", c.SearchBackend, err), nil)
+		h.index = nil
+	}
+
+	switch c.StorageBackend {
+	case "memory":
+		repo := InMemoryService(c)
+		repo.index = h.index
+		h.storage = repo
+		return h, nil
+	case "postgres":
+		repo, err := PostgresService(c)
+		if repo == nil {
+			return h, err
+		}
+		repo.index = h.index
+		h.storage = repo
+		return h, err
+	case "fedbox":
+		fallthrough
+	default:
+		if c.StorageBackend != "fedbox" {
+			infoFn(fmt.Sprintf("Invalid storage backend %q, falling back to fedbox.", c.StorageBackend), nil)
+		}
+	}
+
+	repo := ActivityPubService(c)
+	repo.index = h.index
+	h.storage = repo
 	key := os.Getenv("OAUTH2_KEY")
 	pw := os.Getenv("OAUTH2_SECRET")
 	if len(key) > 0 {
-		oIRI := pub.IRI(fmt.Sprintf("%s/actors/%s", h.storage.BaseURL, key))
-		oauth, err := h.storage.fedbox.Actor(oIRI)
+		oIRI := pub.IRI(fmt.Sprintf("%s/actors/%s", repo.BaseURL, key))
+		repo.app = oIRI
+		oauth, err := repo.fedbox.Actor(oIRI)
 		if err == nil {
-			h.storage.app = new(Account)
-			h.storage.app.FromActivityPub(oauth)
+			h.app = new(Account)
+			h.app.FromActivityPub(oauth)
 			config := GetOauth2Config("fedbox", h.conf.BaseURL)
 
-			handle := h.storage.app.Handle
+			handle := h.app.Handle
 			tok, err := config.PasswordCredentialsToken(context.Background(), handle, pw)
 			if err != nil {
 				return h, err
@@ -90,10 +162,10 @@ func Init(c appConfig) (handler, error) {
 			if tok == nil {
 				return h, err
 			}
-			h.storage.app.Metadata.OAuth.Provider = "fedbox"
-			h.storage.app.Metadata.OAuth.Token = tok.AccessToken
-			h.storage.app.Metadata.OAuth.TokenType = tok.TokenType
-			h.storage.app.Metadata.OAuth.RefreshToken = tok.RefreshToken
+			h.app.Metadata.OAuth.Provider = "fedbox"
+			h.app.Metadata.OAuth.Token = tok.AccessToken
+			h.app.Metadata.OAuth.TokenType = tok.TokenType
+			h.app.Metadata.OAuth.RefreshToken = tok.RefreshToken
 		}
 	}
 
@@ -130,6 +202,7 @@ type headerEl struct {
 	Auth      bool
 	Name      string
 	URL       string
+	Count     int
 }
 
 func account(r *http.Request) *Account {
@@ -279,7 +352,7 @@ func isInverted(r *http.Request) bool {
 	return false
 }
 
-func loadCurrentAccountFromSession(s *sessions.Session, r *repository, l log.Logger) Account {
+func loadCurrentAccountFromSession(s *sessions.Session, r Repository, l log.Logger) Account {
 	// load the current account from the session or setting it to anonymous
 	raw, ok := s.Values[SessionUserKey]
 	if !ok {
@@ -298,6 +371,7 @@ func loadCurrentAccountFromSession(s *sessions.Session, r *repository, l log.Log
 
 func SetSecurityHeaders(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		// NOTE(marius): the images of the link previews are served by us, from /preview, and they fall under 'self'
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline';")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-Xss-Protection", "1; mode=block")
@@ -327,6 +401,38 @@ func (h *handler) LoadSession(next http.Handler) http.Handler {
 			}
 		}
 		acc := loadCurrentAccountFromSession(s, h.storage, h.logger)
+		if acc.IsLogged() {
+			refreshed, err := h.refreshToken(r.Context(), &acc)
+			if err != nil {
+				h.logger.WithContext(log.Ctx{
+					"handle": acc.Handle,
+					"hash":   acc.Hash,
+					"err":    err,
+				}).Warn("unable to refresh OAuth2 token, logging out")
+				s.Values[SessionUserKey] = nil
+				h.v.addFlashMessage(Warning, r, "Your session has expired, please log in again.")
+				acc = defaultAccount
+			} else if refreshed {
+				s.Values[SessionUserKey] = acc
+			}
+			if err != nil || refreshed {
+				if err := h.v.s.save(w, r); err != nil {
+					h.logger.Error(err.Error())
+				}
+			}
+		}
+		if acc.IsLogged() && h.isSuspended(acc) {
+			h.logger.WithContext(log.Ctx{
+				"handle": acc.Handle,
+				"hash":   acc.Hash,
+			}).Warn("suspended account, logging out")
+			s.Values[SessionUserKey] = nil
+			if err := h.v.s.save(w, r); err != nil {
+				h.logger.Error(err.Error())
+			}
+			h.v.HandleErrors(w, r, errors.Forbiddenf("the account %s has been suspended", acc.Handle))
+			return
+		}
 		m := acc.Metadata
 		if acc.IsLogged() {
 			acc, err = h.storage.LoadAccount(Filters{
@@ -342,13 +448,14 @@ func (h *handler) LoadSession(next http.Handler) http.Handler {
 			if err != nil {
 				h.logger.WithContext(ctx).Warn(err.Error())
 			}
-			// TODO(marius): this needs to be moved to where we're handling all Inbox activities, not on page load
-			acc, err = h.storage.loadAccountsFollowers(acc)
-			if err != nil {
-				h.logger.WithContext(ctx).Warn(err.Error())
+			if repo, ok := h.storage.(*repository); ok {
+				// TODO(marius): this needs to be moved to where we're handling all Inbox activities, not on page load
+				acc, err = repo.loadAccountsFollowRefs(acc)
+				if err != nil {
+					h.logger.WithContext(ctx).Warn(err.Error())
+				}
 			}
-			acc, err = h.storage.loadAccountsFollowing(acc)
-			if err != nil {
+			if acc.Blocked, _, err = h.storage.LoadBlockedAccounts(acc); err != nil {
 				h.logger.WithContext(ctx).Warn(err.Error())
 			}
 			// TODO(marius): Fix this ugly hack where we need to not override OAuth2 metadata loaded at login
@@ -361,6 +468,97 @@ func (h *handler) LoadSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// refreshToken exchanges the refresh token of the account for a new OAuth2 token when the current one
+// has expired, or is about to. It returns true if the account's token was replaced.
+func (h *handler) refreshToken(ctx context.Context, acc *Account) (bool, error) {
+	if !acc.HasMetadata() {
+		return false, nil
+	}
+	o := acc.Metadata.OAuth
+	switch strings.ToLower(o.Provider) {
+	case "github", "gitlab", "facebook", "google":
+		// NOTE(marius): we only use the tokens issued by FedBOX
+		return false, nil
+	}
+	if o.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(o.Expiry) {
+		return false, nil
+	}
+	if len(o.RefreshToken) == 0 {
+		return false, errors.Unauthorizedf("OAuth2 token expired at %s", o.Expiry)
+	}
+	tok, err := h.tokens.exchange(o.RefreshToken, func() (*oauth2.Token, error) {
+		config := GetOauth2Config(o.Provider, h.conf.BaseURL)
+		return config.TokenSource(ctx, &oauth2.Token{RefreshToken: o.RefreshToken}).Token()
+	})
+	if err != nil {
+		return false, errors.Annotatef(err, "unable to refresh OAuth2 token")
+	}
+	acc.Metadata.OAuth.Token = tok.AccessToken
+	acc.Metadata.OAuth.TokenType = tok.TokenType
+	acc.Metadata.OAuth.Expiry = tok.Expiry
+	if len(tok.RefreshToken) > 0 {
+		acc.Metadata.OAuth.RefreshToken = tok.RefreshToken
+	}
+	return true, nil
+}
+
+// tokenRefreshes serializes the exchanges of the same refresh token, and keeps the tokens they returned for
+// a while. The concurrent requests of a session all carry its expired token, and when FedBOX rotates
+// the refresh tokens only the first of them can exchange it, the rest need to use the token it received.
+type tokenRefreshes struct {
+	mu     sync.Mutex
+	tokens map[string]*refreshedToken
+}
+
+type refreshedToken struct {
+	sync.Mutex
+	tok     *oauth2.Token
+	expires time.Time
+}
+
+// exchange returns the token the refresh token was exchanged for in the last refreshedTokenGrace,
+// or calls fn to exchange it, while the other callers for the same refresh token wait for the result
+func (t *tokenRefreshes) exchange(refresh string, fn func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	if t == nil {
+		return fn()
+	}
+	t.mu.Lock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]*refreshedToken)
+	}
+	now := time.Now()
+	for k, rt := range t.tokens {
+		if !rt.expires.IsZero() && now.After(rt.expires) {
+			delete(t.tokens, k)
+		}
+	}
+	rt, ok := t.tokens[refresh]
+	if !ok {
+		rt = new(refreshedToken)
+		t.tokens[refresh] = rt
+	}
+	t.mu.Unlock()
+
+	rt.Lock()
+	defer rt.Unlock()
+	if rt.tok != nil {
+		return rt.tok, nil
+	}
+	tok, err := fn()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		if t.tokens[refresh] == rt {
+			delete(t.tokens, refresh)
+		}
+		return nil, err
+	}
+	rt.tok = tok
+	rt.expires = time.Now().Add(refreshedTokenGrace)
+	return tok, nil
+}
+
 func (h *handler) addFlashErrors(r *http.Request, errs ...error) {
 	msg := ""
 	for _, err := range errs {
@@ -17,6 +17,8 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
 )
@@ -42,9 +44,11 @@ func (h *handler) ShowAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filter := Filters{
-		LoadItemsFilter: LoadItemsFilter{},
-		MaxItems:        MaxContentItems,
-		Page:            1,
+		LoadItemsFilter: LoadItemsFilter{
+			Private: []bool{false},
+		},
+		MaxItems: MaxContentItems,
+		Page:     1,
 	}
 	for _, a := range accounts {
 		filter.LoadItemsFilter.AttributedTo = append(filter.LoadItemsFilter.AttributedTo, a.Hash)
@@ -76,9 +80,8 @@ func (h *handler) ShowAccount(w http.ResponseWriter, r *http.Request) {
 
 // HandleSubmit handles POST /submit requests
 // HandleSubmit handles POST /~handler/hash requests
-// HandleSubmit handles POST /year/month/day/hash requests
 // HandleSubmit handles POST /~handler/hash/edit requests
-// HandleSubmit handles POST /year/month/day/hash/edit requests
+// HandleSubmit handles POST /messages/key requests
 func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 	acc := account(r)
 	n, err := ContentFromRequest(r, *acc)
@@ -104,19 +107,74 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		if len(n.Metadata.To) == 0 {
 			n.Metadata.To = make([]*Account, 0)
 		}
-		n.Metadata.To = append(n.Metadata.To, n.Parent.SubmittedBy)
 		if n.Parent.Private() {
+			if !isMessageParticipant(acc, *n.Parent) {
+				h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", n.Parent.Hash))
+				return
+			}
+			// NOTE(marius): the replies in a conversation are addressed to all its other participants
+			for _, p := range messageParticipants(*n.Parent) {
+				if HashesEqual(p.Hash, acc.Hash) {
+					continue
+				}
+				rec := p
+				n.Metadata.To = append(n.Metadata.To, &rec)
+			}
 			n.MakePrivate()
 			saveVote = false
+		} else {
+			n.Metadata.To = append(n.Metadata.To, n.Parent.SubmittedBy)
 		}
 	}
 
+	fetchPreview := n.IsLink()
 	if len(n.Hash) > 0 {
 		if p, err := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{n.Hash}}}); err == nil {
 			n.Title = p.Title
+			if p.Private() && p.HasMetadata() {
+				n.MakePrivate()
+				n.Metadata.To = p.Metadata.To
+				n.Metadata.CC = p.Metadata.CC
+			}
+			if p.IsLink() && p.Data == n.Data && p.HasMetadata() {
+				n.Metadata.Description = p.Metadata.Description
+				n.Metadata.Canonical = p.Metadata.Canonical
+				n.Metadata.Icon = p.Metadata.Icon
+				n.Metadata.Image = p.Metadata.Image
+				fetchPreview = false
+			}
 		}
 		saveVote = false
 	}
+	if window := Instance.Config.DuplicateLinksWindow; window > 0 && n.IsLink() && n.Public() && len(n.Hash) == 0 && !n.Parent.IsValid() {
+		if prev, ok := loadLinkSubmission(repo, n.Data, time.Now().UTC().Add(-window)); ok {
+			h.v.addFlashMessage(Info, r, fmt.Sprintf("This link was already submitted, it can be submitted again after %s.",
+				prev.SubmittedAt.Add(window).Format("2006-01-02")))
+			h.v.Redirect(w, r, ItemPermaLink(prev), http.StatusSeeOther)
+			return
+		}
+	}
+	if fetchPreview && h.preview != nil {
+		if lp, err := h.preview.Fetch(n.Data); err == nil {
+			lp.Apply(&n)
+		} else {
+			h.logger.WithContext(log.Ctx{
+				"err": err,
+				"url": n.Data,
+			}).Warn("unable to load link preview")
+		}
+	}
+	if n.IsLink() && len(strings.TrimSpace(n.Title)) == 0 {
+		n.Title = n.Data
+	}
+	if n.Public() && !n.Parent.IsValid() && len(n.Hash) == 0 && len(strings.TrimSpace(n.Title)) == 0 {
+		h.v.HandleErrors(w, r, errors.BadRequestf("missing title"))
+		return
+	}
+	redirect := ""
+	if n.Private() {
+		redirect = ConversationLink(n)
+	}
 	n, err = repo.SaveItem(n)
 	if err != nil {
 		h.logger.WithContext(log.Ctx{
@@ -125,6 +183,9 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		h.v.HandleErrors(w, r, err)
 		return
 	}
+	if n.Private() {
+		h.v.unread.forget(messageParticipants(n)...)
+	}
 
 	if saveVote {
 		v := Vote{
@@ -140,7 +201,10 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 			}).Error(err.Error())
 		}
 	}
-	h.v.Redirect(w, r, ItemPermaLink(n), http.StatusSeeOther)
+	if len(redirect) == 0 {
+		redirect = ItemPermaLink(n)
+	}
+	h.v.Redirect(w, r, redirect, http.StatusSeeOther)
 }
 
 func genitive(name string) string {
@@ -154,8 +218,7 @@ func genitive(name string) string {
 	return name + "'"
 }
 
-// HandleDelete serves /{year}/{month}/{day}/{hash}/rm POST request
-// HandleDelete serves /~{handle}/rm GET request
+// HandleDelete serves /~{handle}/{hash}/rm GET request
 func (h *handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	hash := chi.URLParam(r, "hash")
 
@@ -180,22 +243,233 @@ func (h *handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	h.v.Redirect(w, r, url, http.StatusFound)
 }
 
-// HandleReport serves /{year}/{month}/{day}/{hash}/report POST request
-// HandleReport serves /~{handle}/report request
+// HandleReport serves /~{handle}/{hash}/bad POST request
 func (h *handler) HandleReport(w http.ResponseWriter, r *http.Request) {
-	m := contentModel{}
-	h.v.RenderTemplate(r, w, "new", m)
+	hash := chi.URLParam(r, "hash")
+	acc := account(r)
+
+	repo := h.storage
+	p, err := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil {
+		h.logger.Error(err.Error())
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	if p.Private() && !isMessageParticipant(acc, p) {
+		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
+		return
+	}
+	reason := ReportReason(r.PostFormValue("reason"))
+	if !reason.IsValid() {
+		h.v.HandleErrors(w, r, errors.BadRequestf("invalid report reason %q", reason))
+		return
+	}
+	rep := ItemReport{
+		SubmittedBy: acc,
+		Item:        &p,
+		Reason:      reason,
+		Text:        strings.TrimSpace(r.PostFormValue("text")),
+	}
+	if _, err := repo.SaveReport(rep); err != nil {
+		h.logger.WithContext(log.Ctx{
+			"hash":   p.Hash,
+			"author": acc.Handle,
+		}).Error(err.Error())
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if len(r.PostFormValue("forward")) > 0 && p.IsFederated() {
+		h.forwardReport(rep)
+	}
+	h.v.addFlashMessage(Success, r, "Thank you, your report will be reviewed by the moderators.")
+	h.v.Redirect(w, r, ItemPermaLink(p), http.StatusSeeOther)
 }
 
-// ShowReport serves /{year}/{month}/{day}/{hash}/Report GET request
-// ShowReport serves /~{handle}/Report request
+// forwardReport sends a copy of the report to the instance the reported item originates from.
+// The copy is submitted by the instance account, so the identity of the reporter isn't disclosed.
+func (h *handler) forwardReport(rep ItemReport) {
+	if !h.app.IsValid() {
+		h.logger.Warn("unable to forward report, the instance account is not loaded")
+		return
+	}
+	rep.SubmittedBy = h.app
+	rep.Forward = true
+
+	if _, err := asAccount(h.storage, h.app).SaveReport(rep); err != nil {
+		h.logger.WithContext(log.Ctx{
+			"hash": rep.Item.Hash,
+		}).Error(err.Error())
+	}
+}
+
+// ShowReport serves /~{handle}/{hash}/bad GET request
 func (h *handler) ShowReport(w http.ResponseWriter, r *http.Request) {
-	m := contentModel{}
-	h.v.RenderTemplate(r, w, "new", m)
+	hash := chi.URLParam(r, "hash")
+
+	p, err := h.storage.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil {
+		h.logger.Error(err.Error())
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	if p.Private() && !isMessageParticipant(account(r), p) {
+		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
+		return
+	}
+	m := reportModel{
+		Content: comment{Item: p},
+		Reasons: ValidReportReasons,
+	}
+	switch {
+	case len(p.Title) > 0:
+		m.Title = fmt.Sprintf("Report %s", p.Title)
+	case p.SubmittedBy.IsValid():
+		m.Title = fmt.Sprintf("Report %s comment", genitive(p.SubmittedBy.Handle))
+	default:
+		m.Title = "Report comment"
+	}
+	h.v.RenderTemplate(r, w, "report", m)
+}
+
+// ShowModeration serves GET /mod request
+func (h *handler) ShowModeration(w http.ResponseWriter, r *http.Request) {
+	filter := Filters{
+		Page:     1,
+		MaxItems: MaxContentItems,
+	}
+	if err := qstring.Unmarshal(r.URL.Query(), &filter); err != nil {
+		h.logger.Debug("unable to load url parameters")
+	}
+	reports, _, err := h.storage.LoadReports(filter)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load reports!"))
+		return
+	}
+	m := moderationModel{Title: "Moderation"}
+	if h.app.IsValid() {
+		m.Actions, _, err = h.storage.LoadModerations(Filters{
+			LoadReportsFilter: LoadReportsFilter{
+				Actor: Hashes{h.app.Hash},
+			},
+		})
+		if err != nil {
+			h.logger.Error(err.Error())
+		}
+	}
+	for _, rep := range reports {
+		resolved := rep.Item != nil && rep.Item.Deleted()
+		for _, op := range m.Actions {
+			resolved = resolved || op.Resolves(rep)
+		}
+		if !resolved {
+			m.Reports = append(m.Reports, rep)
+		}
+	}
+	if len(reports) >= filter.MaxItems {
+		m.nextPage = filter.Page + 1
+	}
+	if filter.Page > 1 {
+		m.prevPage = filter.Page - 1
+	}
+	h.v.RenderTemplate(r, w, "moderation", m)
+}
+
+// HandleModeration serves POST /mod/{hash}/{action} request
+func (h *handler) HandleModeration(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	action := ModerationAction(chi.URLParam(r, "action"))
+	acc := account(r)
+	if !action.IsValid() {
+		h.v.HandleErrors(w, r, errors.BadRequestf("invalid moderation action %q", action))
+		return
+	}
+
+	reports, _, err := h.storage.LoadReports(Filters{
+		LoadReportsFilter: LoadReportsFilter{
+			Key: Hashes{Hash(hash)},
+		},
+	})
+	if err != nil || len(reports) == 0 {
+		h.v.HandleErrors(w, r, errors.NotFoundf("report %s", hash))
+		return
+	}
+	if !h.app.IsValid() {
+		h.v.HandleErrors(w, r, errors.Errorf("unable to moderate, the instance account is not loaded"))
+		return
+	}
+	rep := reports[0]
+	if action != ModerationDismiss && rep.Item == nil {
+		h.v.HandleErrors(w, r, errors.NotFoundf("the item of report %s", hash))
+		return
+	}
+	op := ModerationOp{
+		SubmittedBy: h.app,
+		Moderator:   acc,
+		Action:      action,
+		Report:      &rep,
+		Item:        rep.Item,
+	}
+	if action == ModerationSuspend {
+		if !rep.Item.SubmittedBy.IsValid() {
+			h.v.HandleErrors(w, r, errors.NotFoundf("the author of the item of report %s", hash))
+			return
+		}
+		op.Account = rep.Item.SubmittedBy
+	}
+
+	if _, err = asAccount(h.storage, h.app).SaveModeration(op); err != nil {
+		h.logger.WithContext(log.Ctx{
+			"report": rep.Hash,
+			"action": action,
+		}).Error(err.Error())
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if action == ModerationSuspend {
+		h.suspended.set(op.Account.Hash, true)
+	}
+	h.v.Redirect(w, r, "/mod", http.StatusSeeOther)
+}
+
+// HandleRole serves POST /~{handle}/role requests
+func (h *handler) HandleRole(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+	role := Role(r.PostFormValue("role"))
+	if !role.IsValid() {
+		h.v.HandleErrors(w, r, errors.BadRequestf("invalid role %q", role))
+		return
+	}
+	a, err := h.storage.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{handle}}})
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NotFoundf("account %q not found", handle))
+		return
+	}
+	if !a.IsLocal() {
+		h.v.HandleErrors(w, r, errors.BadRequestf("roles can only be set for local accounts"))
+		return
+	}
+	if !h.app.IsValid() {
+		h.v.HandleErrors(w, r, errors.Errorf("unable to update account, the instance account is not loaded"))
+		return
+	}
+	a.Role = role
+	if a.CreatedBy == nil {
+		a.CreatedBy = h.app
+	}
+
+	if a, err = asAccount(h.storage, h.app).SaveAccount(a); err != nil {
+		h.logger.WithContext(log.Ctx{
+			"handle": handle,
+			"role":   role,
+		}).Error(err.Error())
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, r, fmt.Sprintf("%s is now %s", a.Handle, role))
+	h.v.Redirect(w, r, AccountPermaLink(a), http.StatusSeeOther)
 }
 
-// HandleVoting serves /{year}/{month}/{day}/{hash}/{direction} request
-// HandleVoting serves /~{handle}/{direction} request
+// HandleVoting serves /~{handle}/{hash}/{direction} request
 func (h *handler) HandleVoting(w http.ResponseWriter, r *http.Request) {
 	hash := chi.URLParam(r, "hash")
 
@@ -243,10 +517,52 @@ func (h *handler) HandleVoting(w http.ResponseWriter, r *http.Request) {
 	h.v.Redirect(w, r, url, http.StatusFound)
 }
 
+// ShowShare serves GET /~{handle}/{hash}/share requests, with the form for sharing the item
+func (h *handler) ShowShare(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	it, err := h.storage.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil || it.Private() {
+		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
+		return
+	}
+	m := shareModel{Content: comment{Item: it}}
+	switch {
+	case len(it.Title) > 0:
+		m.Title = fmt.Sprintf("Share %s", it.Title)
+	case it.SubmittedBy.IsValid():
+		m.Title = fmt.Sprintf("Share %s comment", genitive(it.SubmittedBy.Handle))
+	default:
+		m.Title = "Share comment"
+	}
+	h.v.RenderTemplate(r, w, "share", m)
+}
+
+// HandleShare serves POST /~{handle}/{hash}/share requests
+func (h *handler) HandleShare(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	it, err := h.storage.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil || it.Private() {
+		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
+		return
+	}
+	url := ItemPermaLink(it)
+	if backURL := r.Header.Get("Referer"); !strings.Contains(backURL, url) && strings.Contains(backURL, Instance.BaseURL) {
+		url = fmt.Sprintf("%s#item-%s", backURL, it.Hash)
+	}
+	acc := account(r)
+	if err := h.storage.ShareItem(*acc, it); err != nil {
+		h.logger.WithContext(log.Ctx{
+			"hash":    it.Hash,
+			"account": acc.Handle,
+			"error":   err,
+		}).Error("Unable to share item")
+		h.v.addFlashMessage(Error, r, err.Error())
+	}
+	h.v.Redirect(w, r, url, http.StatusFound)
+}
+
 // ShowItem serves /~{handle}/{hash} request
 // ShowItem serves /~{handle}/{hash}/edit request
-// ShowItem serves /{year}/{month}/{day}/{hash} request
-// ShowItem serves /{year}/{month}/{day}/{hash}/edit request
 func (h *handler) ShowItem(w http.ResponseWriter, r *http.Request) {
 	items := make([]Item, 0)
 
@@ -288,11 +604,15 @@ func (h *handler) ShowItem(w http.ResponseWriter, r *http.Request) {
 		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
 		return
 	}
+	account := account(r)
+	if i.Private() && !isMessageParticipant(account, i) {
+		h.v.HandleErrors(w, r, errors.NotFoundf("Item %q", hash))
+		return
+	}
 	m.Content = comment{Item: i}
 	url := r.URL
 	maybeEdit := path.Base(url.Path)
 
-	account := account(r)
 	if maybeEdit != hash && maybeEdit == Edit {
 		if !HashesEqual(m.Content.SubmittedBy.Hash, account.Hash) {
 			url.Path = path.Dir(url.Path)
@@ -325,6 +645,9 @@ func (h *handler) ShowItem(w http.ResponseWriter, r *http.Request) {
 	if filter.Context == nil {
 		filter.Context = []string{m.Content.Hash.String()}
 	}
+	if !i.Private() {
+		filter.Private = []bool{false}
+	}
 	contentItems, _, err := repo.LoadItems(filter)
 	if len(contentItems) >= filter.MaxItems {
 		m.nextPage = filter.Page + 1
@@ -337,7 +660,12 @@ func (h *handler) ShowItem(w http.ResponseWriter, r *http.Request) {
 		h.v.HandleErrors(w, r, errors.NewNotFound(err, "" /*, errors.ErrorStack(err)*/))
 		return
 	}
-	allComments = append(allComments, loadComments(contentItems)...)
+	for _, c := range loadComments(contentItems).withoutBlocked(account) {
+		if c.Private() && !isMessageParticipant(account, c.Item) {
+			continue
+		}
+		allComments = append(allComments, c)
+	}
 
 	if i.Parent.IsValid() && i.Parent.SubmittedAt.IsZero() {
 		if p, err := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{i.Parent.Hash}}}); err == nil {
@@ -462,6 +790,349 @@ func (h *handler) HandleFollowRequest(w http.ResponseWriter, r *http.Request) {
 	h.v.Redirect(w, r, backUrl, http.StatusSeeOther)
 }
 
+// ShowFollow serves GET /follow requests, it shows the form for following accounts by their fediverse address
+// and the follow requests of the logged account which didn't get a response yet
+func (h *handler) ShowFollow(w http.ResponseWriter, r *http.Request) {
+	acc := account(r)
+	m := followModel{
+		Title:   "Follow someone elsewhere",
+		Address: strings.TrimSpace(r.URL.Query().Get("address")),
+	}
+	var err error
+	m.Pending, _, err = h.storage.LoadFollowRequests(nil, Filters{
+		LoadFollowRequestsFilter: LoadFollowRequestsFilter{
+			Actor: Hashes{acc.Hash},
+		},
+	})
+	if err != nil {
+		h.logger.Error(err.Error())
+	}
+	h.v.RenderTemplate(r, w, "follow", m)
+}
+
+// HandleFollow serves POST /follow requests, the address can belong to an account of this instance
+// or of any other instance which supports WebFinger
+func (h *handler) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	acc := account(r)
+	addr := r.PostFormValue("address")
+	name, host, err := splitAccountAddress(addr)
+	if err != nil {
+		h.v.addFlashMessage(Error, r, err.Error())
+		h.v.Redirect(w, r, "/follow", http.StatusSeeOther)
+		return
+	}
+	toFollow, err := h.loadAccountByAddress(name, host)
+	if err != nil {
+		h.logger.WithContext(log.Ctx{
+			"address": addr,
+		}).Error(err.Error())
+		h.v.addFlashMessage(Error, r, fmt.Sprintf("Unable to find account %s@%s", name, host))
+		h.v.Redirect(w, r, fmt.Sprintf("/follow?address=%s", url.QueryEscape(addr)), http.StatusSeeOther)
+		return
+	}
+	if err := h.storage.FollowAccount(*acc, toFollow); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, r, fmt.Sprintf("Follow request sent to %s@%s.", name, host))
+	h.v.Redirect(w, r, "/follow", http.StatusSeeOther)
+}
+
+// loadAccountByAddress loads the account with the name received from this instance, or, when the host
+// is a different one, through the storage if it supports accounts of other instances
+func (h *handler) loadAccountByAddress(name, host string) (Account, error) {
+	if u, err := url.Parse(h.conf.BaseURL); err == nil && strings.EqualFold(u.Host, host) {
+		return h.storage.LoadAccount(Filters{
+			LoadAccountsFilter: LoadAccountsFilter{
+				Handle:  []string{name},
+				Deleted: []bool{false},
+			},
+		})
+	}
+	remote, ok := h.storage.(remoteAccountLoader)
+	if !ok {
+		return AnonymousAccount, errors.NotImplementedf("unable to load accounts of other instances")
+	}
+	return remote.LoadRemoteAccount(name, host)
+}
+
+// loadHandleAccount loads the account with the handle in the URL of the request
+func (h *handler) loadHandleAccount(r *http.Request) (Account, error) {
+	handle := chi.URLParam(r, "handle")
+	accounts, cnt, err := h.storage.LoadAccounts(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{handle}}})
+	if err != nil {
+		return AnonymousAccount, err
+	}
+	if cnt == 0 {
+		return AnonymousAccount, errors.NotFoundf("account %q not found", handle)
+	}
+	if cnt > 1 {
+		return AnonymousAccount, errors.NotFoundf("too many %q accounts found", handle)
+	}
+	acc, _ := accounts.First()
+	return *acc, nil
+}
+
+// UnfollowAccount serves POST /~{handle}/unfollow requests
+func (h *handler) UnfollowAccount(w http.ResponseWriter, r *http.Request) {
+	loggedAccount := account(r)
+	ed, err := h.loadHandleAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if err := h.storage.UnfollowAccount(*loggedAccount, ed); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, r, fmt.Sprintf("You are no longer following %s.", ed.Handle))
+	h.v.Redirect(w, r, AccountPermaLink(ed), http.StatusSeeOther)
+}
+
+// BlockAccount serves POST /~{handle}/block requests
+func (h *handler) BlockAccount(w http.ResponseWriter, r *http.Request) {
+	loggedAccount := account(r)
+	ed, err := h.loadHandleAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if err := h.storage.BlockAccount(*loggedAccount, ed); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, r, fmt.Sprintf("%s is blocked, you won't see their submissions and comments anymore.", ed.Handle))
+	h.v.Redirect(w, r, AccountPermaLink(ed), http.StatusSeeOther)
+}
+
+// UnblockAccount serves POST /~{handle}/unblock requests
+func (h *handler) UnblockAccount(w http.ResponseWriter, r *http.Request) {
+	loggedAccount := account(r)
+	ed, err := h.loadHandleAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if err := h.storage.UnblockAccount(*loggedAccount, ed); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	backURL := r.Header.Get("Referer")
+	if len(backURL) == 0 {
+		backURL = AccountPermaLink(ed)
+	}
+	h.v.addFlashMessage(Success, r, fmt.Sprintf("%s is no longer blocked.", ed.Handle))
+	h.v.Redirect(w, r, backURL, http.StatusSeeOther)
+}
+
+// ShowSettings serves GET /settings requests
+func (h *handler) ShowSettings(w http.ResponseWriter, r *http.Request) {
+	acc := account(r)
+	m := settingsModel{Title: "Settings"}
+	var err error
+	if m.Blocked, _, err = h.storage.LoadBlockedAccounts(*acc); err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load the blocked accounts"))
+		return
+	}
+	h.v.RenderTemplate(r, w, "settings", m)
+}
+
+// accountFollows loads the f.Page page of the followers, or of the accounts followed, of the account with the
+// handle in the URL of the request, depending on the last element of its path.
+// It returns the account, the accounts in the page with their scores, and the total number of accounts.
+func (h *handler) accountFollows(r *http.Request, f Filters) (Account, AccountCollection, uint, error) {
+	a, err := h.loadHandleAccount(r)
+	if err != nil {
+		return a, nil, 0, err
+	}
+	following := path.Base(r.URL.Path) == "following"
+	if repo, ok := h.storage.(*repository); ok {
+		if following {
+			a, err = repo.loadAccountsFollowing(a)
+		} else {
+			a, err = repo.loadAccountsFollowers(a)
+		}
+		if err != nil {
+			return a, nil, 0, err
+		}
+	}
+	accounts := a.Followers
+	if following {
+		accounts = a.Following
+	}
+	start, end := pageBounds(f, len(accounts))
+	page := accounts[start:end]
+	if len(page) == 0 {
+		return a, page, uint(len(accounts)), nil
+	}
+
+	sf := Filters{MaxItems: len(page)}
+	for _, acc := range page {
+		sf.LoadAccountsFilter.Key = append(sf.LoadAccountsFilter.Key, acc.Hash)
+	}
+	scored, _, err := h.storage.LoadAccounts(sf)
+	if err != nil {
+		h.logger.WithContext(log.Ctx{
+			"handle": a.Handle,
+		}).Warn(err.Error())
+	}
+	res := make(AccountCollection, len(page))
+	for k, acc := range page {
+		for _, sc := range scored {
+			if HashesEqual(sc.Hash, acc.Hash) {
+				acc.Score = sc.Score
+			}
+		}
+		res[k] = acc
+	}
+	return a, res, uint(len(accounts)), nil
+}
+
+// ShowAccountFollows serves /~handler/followers and /~handler/following requests
+func (h *handler) ShowAccountFollows(w http.ResponseWriter, r *http.Request) {
+	f := Filters{
+		MaxItems: MaxContentItems,
+		Page:     1,
+	}
+	if err := qstring.Unmarshal(r.URL.Query(), &f); err != nil {
+		h.logger.Debug("unable to load url parameters")
+	}
+	a, accounts, cnt, err := h.accountFollows(r, f)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	baseURL, _ := url.Parse(h.conf.BaseURL)
+	m := accountsModel{User: &a, Accounts: accounts, Total: int(cnt)}
+	m.Title = fmt.Sprintf("%s: %s %s", baseURL.Host, genitive(a.Handle), path.Base(r.URL.Path))
+	if uint(f.Page*f.MaxItems) < cnt {
+		m.nextPage = f.Page + 1
+	}
+	if f.Page > 1 {
+		m.prevPage = f.Page - 1
+	}
+	h.v.RenderTemplate(r, w, "accounts", m)
+}
+
+// loadConversationsParticipants fills in the handles and the scores of the participants of the convs conversations
+func (h *handler) loadConversationsParticipants(convs ...*conversation) {
+	f := Filters{}
+	for _, c := range convs {
+		for _, p := range c.Participants {
+			if !Hashes(f.LoadAccountsFilter.Key).Contains(p.Hash) {
+				f.LoadAccountsFilter.Key = append(f.LoadAccountsFilter.Key, p.Hash)
+			}
+		}
+	}
+	if len(f.LoadAccountsFilter.Key) == 0 {
+		return
+	}
+	f.MaxItems = len(f.LoadAccountsFilter.Key)
+	accounts, _, err := h.storage.LoadAccounts(f)
+	if err != nil {
+		h.logger.Warn(err.Error())
+		return
+	}
+	for _, c := range convs {
+		for k, p := range c.Participants {
+			for _, a := range accounts {
+				if HashesEqual(a.Hash, p.Hash) {
+					c.Participants[k] = a
+				}
+			}
+		}
+	}
+}
+
+// ShowMessages serves GET /messages requests
+func (h *handler) ShowMessages(w http.ResponseWriter, r *http.Request) {
+	acc := account(r)
+	f := Filters{
+		MaxItems: MaxContentItems,
+		Page:     1,
+	}
+	if err := qstring.Unmarshal(r.URL.Query(), &f); err != nil {
+		h.logger.Debug("unable to load url parameters")
+	}
+	convs, err := loadAccountConversations(h.storage, acc)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load the messages"))
+		return
+	}
+	start, end := pageBounds(f, len(convs))
+	m := messagesModel{Title: "Messages", Conversations: convs[start:end], Total: len(convs)}
+	h.loadConversationsParticipants(m.Conversations...)
+	if end < len(convs) {
+		m.nextPage = f.Page + 1
+	}
+	if f.Page > 1 {
+		m.prevPage = f.Page - 1
+	}
+	h.v.RenderTemplate(r, w, "messages", m)
+}
+
+// ShowConversation serves GET /messages/{key} requests
+func (h *handler) ShowConversation(w http.ResponseWriter, r *http.Request) {
+	acc := account(r)
+	key := chi.URLParam(r, "key")
+	convs, err := loadAccountConversations(h.storage, acc)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load the messages"))
+		return
+	}
+	var conv *conversation
+	for _, c := range convs {
+		if c.Key == key {
+			conv = c
+			break
+		}
+	}
+	if conv == nil {
+		h.v.HandleErrors(w, r, errors.NotFoundf("conversation %q not found", key))
+		return
+	}
+	if len(conv.unread) > 0 {
+		if err := h.storage.MarkMessagesRead(*acc, conv.unread...); err != nil {
+			h.logger.WithContext(log.Ctx{
+				"key": key,
+			}).Warn(err.Error())
+		}
+		h.v.unread.forget(*acc)
+	}
+	h.loadConversationsParticipants(conv)
+
+	m := conversationModel{Conversation: *conv}
+	handles := make([]string, 0)
+	for _, p := range conv.Others(acc) {
+		handles = append(handles, p.Handle)
+	}
+	m.Title = fmt.Sprintf("Messages with %s", strings.Join(handles, ", "))
+	// NOTE(marius): the replies are sent to the most recent message of the conversation
+	m.Content = comment{Item: conv.Messages[0].Item}
+	h.v.RenderTemplate(r, w, "conversation", m)
+}
+
+// sortType returns the ranking mode for listings received in the "sort" URL parameter
+func sortType(r *http.Request) SortType {
+	return SortType(strings.ToLower(r.URL.Query().Get("sort")))
+}
+
+// period returns the time window for listings received in the {period} route parameter, or in the "period" URL parameter
+func period(r *http.Request) Period {
+	if p := chi.URLParam(r, "period"); len(p) > 0 {
+		return Period(strings.ToLower(p))
+	}
+	return Period(strings.ToLower(r.URL.Query().Get("period")))
+}
+
+// withPeriod restricts the items loaded with the f filter to the ones submitted in the p time window
+func withPeriod(f *Filters, p Period, now time.Time) {
+	if since := p.Since(now); !since.IsZero() {
+		f.LoadItemsFilter.SubmittedAt = since
+		f.LoadItemsFilter.SubmittedAtMatchType = MatchAfter
+	}
+}
+
 // HandleIndex serves / request
 func (h *handler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	filter := Filters{
@@ -482,6 +1153,7 @@ func (h *handler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	title := fmt.Sprintf("%s: main page", baseURL.Host)
 
 	acct := account(r)
+	rank := sortType(r)
 	base := path.Base(r.URL.Path)
 	switch strings.ToLower(base) {
 	case "self":
@@ -491,12 +1163,30 @@ func (h *handler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 		title = fmt.Sprintf("%s: federated", baseURL.Host)
 		h.logger.Debug("showing federated posts")
 		filter.Federated = []bool{true}
+	case string(SortHot), string(SortNew), string(SortTop), string(SortControversial):
+		rank = SortType(strings.ToLower(base))
+		title = fmt.Sprintf("%s: %s", baseURL.Host, rank)
 	default:
 	}
+	now := time.Now().UTC()
+	p := period(r)
+	if len(chi.URLParam(r, "period")) > 0 {
+		if !p.IsValid() {
+			h.v.HandleErrors(w, r, errors.NotFoundf("invalid period %q", p))
+			return
+		}
+		rank = SortTop
+		title = fmt.Sprintf("%s: top of the %s", baseURL.Host, p)
+		if p == PeriodAll {
+			title = fmt.Sprintf("%s: top of all time", baseURL.Host)
+		}
+	}
+	withPeriod(&filter, p, now)
+
 	m := itemListingModel{}
 	m.Title = title
 	m.HideText = true
-	comments, err := loadItems(r.Context(), filter, acct, h.logger)
+	comments, err := loadRankedItems(r.Context(), filter, rank, now, acct, h.logger)
 	if err != nil {
 		h.v.HandleErrors(w, r, errors.NewNotValid(err, "Unable to load items!"))
 	}
@@ -514,11 +1204,11 @@ func (h *handler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 
 // HandleIndex serves / request
 func (h *handler) HandleInbox(w http.ResponseWriter, r *http.Request) {
+	// NOTE(marius): the followed accounts can be on other instances, so we don't filter the federated items
 	filter := Filters{
 		LoadItemsFilter: LoadItemsFilter{
 			InReplyTo: []string{""},
 			Deleted:   []bool{false},
-			Federated: []bool{false},
 			Private:   []bool{false},
 		},
 		Page:     1,
@@ -573,6 +1263,9 @@ func (h *handler) HandleInbox(w http.ResponseWriter, r *http.Request) {
 func (h *handler) HandleTags(w http.ResponseWriter, r *http.Request) {
 	tag := chi.URLParam(r, "tag")
 	filter := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Private: []bool{false},
+		},
 		MaxItems: MaxContentItems,
 		Page:     1,
 	}
@@ -585,10 +1278,12 @@ func (h *handler) HandleTags(w http.ResponseWriter, r *http.Request) {
 	if err := qstring.Unmarshal(r.URL.Query(), &filter); err != nil {
 		h.logger.Debug("unable to load url parameters")
 	}
+	now := time.Now().UTC()
+	withPeriod(&filter, period(r), now)
 	baseURL, _ := url.Parse(h.conf.BaseURL)
 	m := itemListingModel{}
 	m.Title = fmt.Sprintf("%s: tagged as #%s", baseURL.Host, tag)
-	comments, err := loadItems(r.Context(), filter, acct, h.logger)
+	comments, err := loadRankedItems(r.Context(), filter, sortType(r), now, acct, h.logger)
 	if err != nil {
 		h.v.HandleErrors(w, r, errors.NewNotValid(err, "oops!"))
 	}
@@ -612,12 +1307,13 @@ func (h *handler) HandleDomains(w http.ResponseWriter, r *http.Request) {
 	filter := Filters{
 		LoadItemsFilter: LoadItemsFilter{
 			Context: []string{"0"},
+			Private: []bool{false},
 		},
 		MaxItems: MaxContentItems,
 		Page:     1,
 	}
 	if len(domain) > 0 {
-		filter.LoadItemsFilter.URL = domain
+		filter.LoadItemsFilter.URL = normalizeDomain(domain)
 		filter.Type = pub.ActivityVocabularyTypes{pub.PageType}
 	} else {
 		filter.MediaType = []MimeType{MimeTypeMarkdown, MimeTypeText, MimeTypeHTML}
@@ -625,11 +1321,13 @@ func (h *handler) HandleDomains(w http.ResponseWriter, r *http.Request) {
 	if err := qstring.Unmarshal(r.URL.Query(), &filter); err != nil {
 		h.logger.Debug("unable to load url parameters")
 	}
+	now := time.Now().UTC()
+	withPeriod(&filter, period(r), now)
 	baseURL, _ := url.Parse(h.conf.BaseURL)
 	m := itemListingModel{}
 	m.Title = fmt.Sprintf("%s: from %s", baseURL.Host, domain)
 	m.HideText = true
-	comments, err := loadItems(r.Context(), filter, acct, h.logger)
+	comments, err := loadRankedItems(r.Context(), filter, sortType(r), now, acct, h.logger)
 	if err != nil {
 		h.v.HandleErrors(w, r, errors.NewNotValid(err, "oops!"))
 	}
@@ -671,6 +1369,28 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		h.v.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
+	if h.isSuspended(acct) {
+		h.v.addFlashMessage(Error, r, "Login failed: the account has been suspended")
+		h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if auth, ok := h.storage.(passwordAuthenticator); ok {
+		// NOTE(marius): the storage keeps the passwords itself, there's no OAuth2 provider to ask for a token
+		if err := auth.Authenticate(acct, pw); err != nil {
+			h.logger.WithContext(logrus.Fields{
+				"handle": handle,
+				"state":  state,
+				"error": err,
+			}).Error("login failed")
+			h.v.addFlashMessage(Error, r, "Login failed: invalid username or password")
+			h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		s, _ := h.v.s.get(r)
+		s.Values[SessionUserKey] = acct
+		h.v.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	tok, err := config.PasswordCredentialsToken(r.Context(), handle, pw)
 	if err != nil {
@@ -698,6 +1418,7 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	acct.Metadata.OAuth.Token = tok.AccessToken
 	acct.Metadata.OAuth.TokenType = tok.TokenType
 	acct.Metadata.OAuth.RefreshToken = tok.RefreshToken
+	acct.Metadata.OAuth.Expiry = tok.Expiry
 	s, _ := h.v.s.get(r)
 	s.Values[SessionUserKey] = acct
 	h.v.Redirect(w, r, "/", http.StatusSeeOther)
@@ -732,19 +1453,111 @@ func (h *handler) ShowSubmit(w http.ResponseWriter, r *http.Request) {
 	h.v.RenderTemplate(r, w, "new", contentModel{Title: "New submission"})
 }
 
+// ValidatePermissions checks if the current account's role allows all the actions
 func (h *handler) ValidatePermissions(actions ...string) func(http.Handler) http.Handler {
 	if len(actions) == 0 {
 		return h.ValidateItemAuthor
 	}
-	// @todo(marius): implement permission logic
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			acc := account(r)
+			for _, action := range actions {
+				if acc.Can(action) {
+					continue
+				}
+				var err error
+				if acc.IsLogged() {
+					err = errors.Forbiddenf("you are not allowed to %s", action)
+				} else {
+					err = errors.Unauthorizedf("Please login to perform this action")
+				}
+				h.logger.WithContext(log.Ctx{
+					"handle": acc.Handle,
+					"action": action,
+				}).Warn(err.Error())
+				h.v.HandleErrors(w, r, err)
+				return
+			}
 			next.ServeHTTP(w, r)
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
+// suspensionsTTL is how long we keep the suspension state of an account before loading it again
+const suspensionsTTL = 5 * time.Minute
+
+// suspensions keeps the suspension state of the accounts, so we don't load it from the storage on every request
+type suspensions struct {
+	mu       sync.RWMutex
+	accounts map[string]suspension
+}
+
+type suspension struct {
+	suspended bool
+	expires   time.Time
+}
+
+// get returns the suspension state of the account, and if we have a current one
+func (s *suspensions) get(h Hash) (bool, bool) {
+	if s == nil {
+		return false, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sus, ok := s.accounts[h.String()]
+	if !ok || time.Now().After(sus.expires) {
+		return false, false
+	}
+	return sus.suspended, true
+}
+
+func (s *suspensions) set(h Hash, suspended bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.accounts == nil {
+		s.accounts = make(map[string]suspension)
+	}
+	for k, sus := range s.accounts {
+		if now.After(sus.expires) {
+			delete(s.accounts, k)
+		}
+	}
+	s.accounts[h.String()] = suspension{suspended: suspended, expires: now.Add(suspensionsTTL)}
+}
+
+// isSuspended checks if the instance account blocked the a account
+func (h *handler) isSuspended(a Account) bool {
+	if !h.app.IsValid() || !a.IsValid() {
+		return false
+	}
+	if suspended, ok := h.suspended.get(a.Hash); ok {
+		return suspended
+	}
+	_, cnt, err := h.storage.LoadModerations(Filters{
+		LoadVotesFilter: LoadVotesFilter{
+			Type: pub.ActivityVocabularyTypes{pub.BlockType},
+		},
+		LoadReportsFilter: LoadReportsFilter{
+			Actor: Hashes{h.app.Hash},
+			On:    Hashes{a.Hash},
+		},
+		MaxItems: 1,
+	})
+	if err != nil {
+		h.logger.WithContext(log.Ctx{
+			"handle": a.Handle,
+		}).Warn(err.Error())
+		return false
+	}
+	h.suspended.set(a.Hash, cnt > 0)
+	return cnt > 0
+}
+
 func (h *handler) RedirectToLogin(w http.ResponseWriter, r *http.Request, errs ...error) {
 	h.v.Redirect(w, r, "/login", http.StatusMovedPermanently)
 }
@@ -840,7 +1653,7 @@ func (h *handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 
 	acc := account(r)
 	if !acc.IsLogged() {
-		acc = h.storage.app
+		acc = h.app
 	}
 	a.CreatedBy = acc
 	h.storage.WithAccount(acc)
@@ -854,6 +1667,13 @@ func (h *handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	repo, ok := h.storage.(*repository)
+	if !ok {
+		// only FedBOX needs the OAuth2 dance for setting the password of the new actor
+		h.v.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	// TODO(marius): Start oauth2 authorize session
 	config := GetOauth2Config("fedbox", h.conf.BaseURL)
 	config.Scopes = []string{scopeAnonymousUserCreate}
@@ -883,7 +1703,7 @@ func (h *handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// pos
-	pwChURL := fmt.Sprintf("%s/oauth/pw", h.storage.BaseURL)
+	pwChURL := fmt.Sprintf("%s/oauth/pw", repo.BaseURL)
 	u, _ := url.Parse(pwChURL)
 	q := u.Query()
 	q.Set("s", d.Code)
@@ -903,7 +1723,7 @@ func (h *handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if pwChRes.StatusCode != http.StatusOK {
-		h.v.HandleErrors(w, r, h.storage.handlerErrorResponse(body))
+		h.v.HandleErrors(w, r, repo.handlerErrorResponse(body))
 		return
 	}
 	h.v.Redirect(w, r, "/", http.StatusSeeOther)
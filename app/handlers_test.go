@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/gorilla/sessions"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+// mockHandler returns a handler using the repo storage, which keeps the sessions in cookies
+func mockHandler(repo Repository) handler {
+	return handler{
+		storage: repo,
+		logger:  log.Dev(log.PanicLevel),
+		v: &view{
+			s:      &session{s: sessions.NewCookieStore([]byte("test"))},
+			infoFn: func(string, log.Ctx) {},
+			errFn:  func(string, log.Ctx) {},
+		},
+	}
+}
+
+// mockFormRequest returns a request for target, with the form values encoded in its body
+func mockFormRequest(method, target string, form url.Values) *http.Request {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	r := httptest.NewRequest(method, target, body)
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return r
+}
+
+// withHandlerContext returns r with the context the router and the middlewares set up for the handlers:
+// the URL parameters, received as name and value pairs, the repository and the account of the logged user
+func withHandlerContext(r *http.Request, repo Repository, acc *Account, params ...string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for i := 0; i+1 < len(params); i += 2 {
+		rctx.URLParams.Add(params[i], params[i+1])
+	}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, RepositoryCtxtKey, repo)
+	if acc != nil {
+		ctx = context.WithValue(ctx, AccountCtxtKey, acc)
+	}
+	return r.WithContext(ctx)
+}
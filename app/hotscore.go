@@ -2,6 +2,7 @@ package app
 
 import (
 	"math"
+	"sort"
 	"time"
 )
 
@@ -22,7 +23,7 @@ func Wilson(ups, downs int64) float64 {
 
 	n1 := float64(n)
 	z := StatisticalConfidence
-	p := float64(ups / n)
+	p := float64(ups) / n1
 	zzfn := z * z / (4 * n1)
 	w := (p + 2.0*zzfn - z*math.Sqrt((zzfn/n1+p*(1.0-p))/n1)) / (1 + 4*zzfn)
 
@@ -42,5 +43,158 @@ func Reddit(ups, downs int64, date time.Duration) float64 {
 	decay := 45000.0
 	s := float64(ups - downs)
 	order := math.Log(math.Max(math.Abs(s), 1)) / math.Ln10
-	return order - date.Seconds()/float64(decay)
+	sign := 0.0
+	if s > 0 {
+		sign = 1
+	} else if s < 0 {
+		sign = -1
+	}
+	return sign*order - date.Seconds()/float64(decay)
+}
+
+// reddit's controversial sort, items with many votes evenly split between ups and downs come first
+// https://github.com/reddit-archive/reddit/blob/master/r2/r2/lib/db/_sorts.pyx
+func Controversy(ups, downs int64) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+type SortType string
+
+const (
+	SortHot           = SortType("hot")
+	SortNew           = SortType("new")
+	SortTop           = SortType("top")
+	SortControversial = SortType("controversial")
+)
+
+// ValidSortTypes are the ranking modes that can be used for listings
+var ValidSortTypes = []SortType{SortHot, SortNew, SortTop, SortControversial}
+
+func (s SortType) IsValid() bool {
+	for _, t := range ValidSortTypes {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Rank returns the score of the item for the s sort type, higher ranking items are shown first
+func (s SortType) Rank(it Item, now time.Time) float64 {
+	switch s {
+	case SortHot:
+		return Reddit(int64(it.Ups), int64(it.Downs), now.Sub(it.SubmittedAt))
+	case SortTop:
+		return Wilson(int64(it.Ups), int64(it.Downs))
+	case SortControversial:
+		return Controversy(int64(it.Ups), int64(it.Downs))
+	case SortNew:
+		return float64(it.SubmittedAt.UnixNano())
+	}
+	return 0
+}
+
+// sortBy orders the comments by their rank, comments with the same rank keep their initial order
+func (c comments) sortBy(s SortType, now time.Time) {
+	if !s.IsValid() {
+		return
+	}
+	sort.SliceStable(c, func(i, j int) bool {
+		return s.Rank(c[i].Item, now) > s.Rank(c[j].Item, now)
+	})
+}
+
+const (
+	// rankBatchSize is the number of items loaded at once from the storage when ranking a listing
+	rankBatchSize = 200
+	// rankMaxItems is the maximum number of items ranked for a listing, the most recent ones matching its filters
+	rankMaxItems = 1000
+)
+
+// DefaultPeriod returns the time window of the listings using the s sort type that don't ask for one
+func (s SortType) DefaultPeriod() Period {
+	switch s {
+	case SortHot, SortControversial:
+		return PeriodWeek
+	}
+	return PeriodAll
+}
+
+// rankItems returns the page of f from the items matching it ordered by the s sort type, and their count.
+// The storage only orders the items by their submission date, so for the other sort types we load the
+// items matching f and rank them before getting the page. When f doesn't have a time window we use
+// the default period of the sort type, and we rank at most rankMaxItems of the most recent items.
+func rankItems(repo Repository, f Filters, s SortType, now time.Time) (comments, uint, error) {
+	if !s.IsValid() || s == SortNew {
+		items, cnt, err := repo.LoadItems(f)
+		return loadComments(items), cnt, err
+	}
+	all := make(ItemCollection, 0)
+	batch := f
+	if batch.LoadItemsFilter.SubmittedAt.IsZero() {
+		withPeriod(&batch, s.DefaultPeriod(), now)
+	}
+	batch.MaxItems = rankBatchSize
+	for batch.Page = 1; ; batch.Page++ {
+		items, cnt, err := repo.LoadItems(batch)
+		if err != nil {
+			return nil, 0, err
+		}
+		all = append(all, items...)
+		if len(items) < rankBatchSize || uint(len(all)) >= cnt || len(all) >= rankMaxItems {
+			break
+		}
+	}
+	if len(all) > rankMaxItems {
+		all = all[:rankMaxItems]
+	}
+	ranked := loadComments(all)
+	ranked.sortBy(s, now)
+	start, end := pageBounds(f, len(ranked))
+	return ranked[start:end], uint(len(ranked)), nil
+}
+
+type Period string
+
+const (
+	PeriodDay   = Period("day")
+	PeriodWeek  = Period("week")
+	PeriodMonth = Period("month")
+	PeriodYear  = Period("year")
+	PeriodAll   = Period("all")
+)
+
+// ValidPeriods are the time windows that can be used for listings
+var ValidPeriods = []Period{PeriodDay, PeriodWeek, PeriodMonth, PeriodYear, PeriodAll}
+
+func (p Period) IsValid() bool {
+	for _, v := range ValidPeriods {
+		if p == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Since returns the start of the time window ending at now, for PeriodAll it returns the zero time
+func (p Period) Since(now time.Time) time.Time {
+	switch p {
+	case PeriodDay:
+		return now.AddDate(0, 0, -1)
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	case PeriodYear:
+		return now.AddDate(-1, 0, 0)
+	}
+	return time.Time{}
 }
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_Wilson(t *testing.T) {
+	if w := Wilson(0, 0); w != 0 {
+		t.Errorf("Score must be %f, received %f", 0.0, w)
+	}
+	if Wilson(9, 1) <= Wilson(1, 9) {
+		t.Errorf("Score for mostly up votes must be greater than the one for mostly down votes")
+	}
+	if Wilson(90, 10) <= Wilson(9, 1) {
+		t.Errorf("Score for more votes with the same ratio must be greater")
+	}
+}
+
+func Test_comments_sortBy(t *testing.T) {
+	now := time.Now().UTC()
+	old := &comment{Item: Item{Hash: Hash("old"), Ups: 40, Downs: 2, SubmittedAt: now.Add(-72 * time.Hour)}}
+	fresh := &comment{Item: Item{Hash: Hash("fresh"), Ups: 3, SubmittedAt: now.Add(-time.Hour)}}
+	split := &comment{Item: Item{Hash: Hash("split"), Ups: 10, Downs: 9, SubmittedAt: now.Add(-2 * time.Hour)}}
+	buried := &comment{Item: Item{Hash: Hash("buried"), Downs: 5, SubmittedAt: now.Add(-30 * time.Minute)}}
+
+	tests := map[SortType]comments{
+		SortNew:           {buried, fresh, split, old},
+		SortHot:           {fresh, split, buried, old},
+		SortTop:           {old, fresh, split, buried},
+		SortControversial: {split, old, fresh, buried},
+		SortType("bogus"): {old, fresh, split, buried},
+	}
+	for typ, expected := range tests {
+		t.Run(string(typ), func(t *testing.T) {
+			c := comments{old, fresh, split, buried}
+			c.sortBy(typ, now)
+			for k, it := range c {
+				if !HashesEqual(it.Hash, expected[k].Hash) {
+					t.Errorf("Item %d must be %q, received %q", k, expected[k].Hash, it.Hash)
+				}
+			}
+		})
+	}
+}
+
+func Test_rankItems(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.VotingEnabled = true
+
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	now := time.Now().UTC()
+	best := mockItem(t, repo, Item{Title: "best", Data: "best", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-72 * time.Hour)})
+	good := mockItem(t, repo, Item{Title: "good", Data: "good", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-48 * time.Hour)})
+	newest := mockItem(t, repo, Item{Title: "newest", Data: "newest", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-time.Hour)})
+	for i := 0; i < 5; i++ {
+		voter := mockAccount(t, repo, fmt.Sprintf("voter-%d", i))
+		repo.SaveVote(Vote{SubmittedBy: &voter, Item: &best, Weight: 1})
+		if i < 2 {
+			repo.SaveVote(Vote{SubmittedBy: &voter, Item: &good, Weight: 1})
+		}
+	}
+
+	tests := map[int]Item{1: best, 2: good, 3: newest}
+	for page, expected := range tests {
+		c, cnt, err := rankItems(repo, Filters{MaxItems: 1, Page: page}, SortTop, now)
+		if err != nil {
+			t.Fatalf("unable to rank items: %s", err)
+		}
+		if cnt != 3 || len(c) != 1 {
+			t.Fatalf("Page %d must contain %d out of %d items, received %d out of %d", page, 1, 3, len(c), cnt)
+		}
+		if !HashesEqual(c[0].Hash, expected.Hash) {
+			t.Errorf("Item on page %d must be %q, received %q", page, expected.Title, c[0].Title)
+		}
+	}
+}
+
+func Test_rankItems_DefaultPeriod(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	now := time.Now().UTC()
+	mockItem(t, repo, Item{Title: "recent", Data: "recent", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.Add(-time.Hour)})
+	mockItem(t, repo, Item{Title: "old", Data: "old", MimeType: MimeTypeText, SubmittedBy: &jane, SubmittedAt: now.AddDate(0, 0, -10)})
+
+	tests := map[SortType]uint{SortHot: 1, SortControversial: 1, SortTop: 2}
+	for s, count := range tests {
+		if _, cnt, _ := rankItems(repo, Filters{MaxItems: 10, Page: 1}, s, now); cnt != count {
+			t.Errorf("The %s listing must rank %d items, received %d", s, count, cnt)
+		}
+	}
+	month := Filters{MaxItems: 10, Page: 1}
+	withPeriod(&month, PeriodMonth, now)
+	if _, cnt, _ := rankItems(repo, month, SortHot, now); cnt != 2 {
+		t.Errorf("The %s listing of the %s must rank %d items, received %d", SortHot, PeriodMonth, 2, cnt)
+	}
+}
+
+func Test_Period_Since(t *testing.T) {
+	now := time.Date(2019, time.March, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[Period]time.Time{
+		PeriodDay:      time.Date(2019, time.March, 14, 12, 0, 0, 0, time.UTC),
+		PeriodWeek:     time.Date(2019, time.March, 8, 12, 0, 0, 0, time.UTC),
+		PeriodMonth:    time.Date(2019, time.February, 15, 12, 0, 0, 0, time.UTC),
+		PeriodYear:     time.Date(2018, time.March, 15, 12, 0, 0, 0, time.UTC),
+		PeriodAll:      {},
+		Period("ever"): {},
+	}
+	for p, since := range tests {
+		if s := p.Since(now); !s.Equal(since) {
+			t.Errorf("Start of the %s period must be %s, received %s", p, since, s)
+		}
+	}
+}
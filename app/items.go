@@ -29,7 +29,7 @@ type TagCollection []Tag
 
 type ItemMetadata struct {
 	To         []*Account    `json:"to,omitempty"`
-	CC         []*Account    `json:"to,omitempty"`
+	CC         []*Account    `json:"cc,omitempty"`
 	Tags       TagCollection `json:"tags,omitempty"`
 	Mentions   TagCollection `json:"mentions,omitempty"`
 	ID         string        `json:"id,omitempty"`
@@ -39,6 +39,11 @@ type ItemMetadata struct {
 	SharesURI  string        `json:"shares,omitempty"`
 	AuthorURI  string        `json:"author,omitempty"`
 	Icon       ImageMetadata `json:"icon,omitempty"`
+
+	// Description, Canonical and Image are loaded from the page of the link items
+	Description string        `json:"description,omitempty"`
+	Canonical   string        `json:"canonical,omitempty"`
+	Image       ImageMetadata `json:"image,omitempty"`
 }
 
 type Identifiable interface {
@@ -60,6 +65,9 @@ type Item struct {
 	MimeType    MimeType      `json:"-"`
 	Data        string        `json:"-"`
 	Score       int           `json:"-"`
+	Ups         int           `json:"-"`
+	Downs       int           `json:"-"`
+	Shares      int           `json:"-"`
 	SubmittedAt time.Time     `json:"-"`
 	SubmittedBy *Account      `json:"-"`
 	UpdatedAt   time.Time     `json:"-"`
@@ -71,6 +79,18 @@ type Item struct {
 	IsTop       bool          `json:"-"`
 	Parent      *Item         `json:"-"`
 	OP          *Item         `json:"-"`
+	SharedBy    *Account      `json:"-"`
+}
+
+// AddVote adds the vote weight to the item's score, and counts it as an up or a down vote
+func (i *Item) AddVote(v Vote) {
+	i.Score += v.Weight
+	if v.Weight > 0 {
+		i.Ups++
+	}
+	if v.Weight < 0 {
+		i.Downs++
+	}
 }
 
 func (i *Item) IsValid() bool {
@@ -139,17 +159,22 @@ const (
 )
 
 func loadItems(c context.Context, filter Filters, acc *Account, l log.Logger) (comments, error) {
+	return loadRankedItems(c, filter, SortNew, time.Now().UTC(), acc, l)
+}
+
+// loadRankedItems loads the page of filter from the items ordered by the rank sort type
+func loadRankedItems(c context.Context, filter Filters, rank SortType, now time.Time, acc *Account, l log.Logger) (comments, error) {
 	repo, ok := ContextRepository(c)
 	if !ok {
 		err := errors.Errorf("could not load item repository from Context")
 		return nil, err
 	}
-	contentItems, _, err := repo.LoadItems(filter)
+	ranked, _, err := rankItems(repo, filter, rank, now)
 
 	if err != nil {
 		return nil, err
 	}
-	comments := loadComments(contentItems)
+	comments := ranked.withoutBlocked(acc)
 	if acc.IsLogged() {
 		acc.Votes, _, err = repo.LoadVotes(Filters{
 			LoadVotesFilter: LoadVotesFilter{
@@ -173,6 +198,8 @@ func detectMimeType(data string) MimeType {
 	return "text/plain"
 }
 
+// getTagFromBytes returns the tag or the mention in d. The IRIs of the mentions of remote accounts are only
+// guesses, the repository replaces them with the IRIs of the actors it resolves through WebFinger.
 func getTagFromBytes(d []byte) Tag {
 	var name, host []byte
 	t := Tag{}
@@ -199,6 +226,25 @@ func getTagFromBytes(d []byte) Tag {
 	return t
 }
 
+// mentionHost returns the host of the instance of the account a mention refers to
+func mentionHost(t Tag) string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// isLocalMention checks if the mention refers to an account of this instance
+func isLocalMention(t Tag) bool {
+	host := mentionHost(t)
+	if len(host) == 0 {
+		return true
+	}
+	u, err := url.Parse(Instance.BaseURL)
+	return err == nil && strings.EqualFold(host, u.Host)
+}
+
 func loadTags(data string) (TagCollection, TagCollection) {
 	if !strings.ContainsAny(data, "#@~") {
 		return nil, nil
@@ -230,11 +276,15 @@ func ContentFromRequest(r *http.Request, acc Account) (Item, error) {
 	var err error
 	i := Item{}
 	i.Metadata = &ItemMetadata{}
-	if receiver, err = accountFromRequestHandle(r); err == nil && chi.URLParam(r, "hash") == "" {
-		i.MakePrivate()
-		to := Account{}
-		to.FromActivityPub(pub.IRI(receiver.Metadata.ID))
-		i.Metadata.To = []*Account{&to,}
+	// NOTE(marius): only the POST /~{handle} requests have a receiver, the replies to conversations
+	// get their recipients from the message they reply to
+	if len(chi.URLParam(r, "handle")) > 0 && chi.URLParam(r, "hash") == "" {
+		if receiver, err = accountFromRequestHandle(r); err == nil {
+			i.MakePrivate()
+			to := Account{}
+			to.FromActivityPub(pub.IRI(receiver.Metadata.ID))
+			i.Metadata.To = []*Account{&to,}
+		}
 	}
 
 	tit := r.PostFormValue("title")
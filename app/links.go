@@ -0,0 +1,201 @@
+package app
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultDuplicateLinksWindow is the period in which a link can't be submitted again
+	defaultDuplicateLinksWindow = 30 * 24 * time.Hour
+	// duplicateLinksBatchSize is the number of submissions of a link we load with each request when we check for duplicates
+	duplicateLinksBatchSize = 100
+)
+
+// trackingParams are the query parameters that the links get for tracking their visitors,
+// they are ignored when comparing links
+var trackingParams = map[string]bool{
+	"_ga":     true,
+	"dclid":   true,
+	"fbclid":  true,
+	"gclid":   true,
+	"gclsrc":  true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"msclkid": true,
+	"ref_src": true,
+	"ref_url": true,
+	"yclid":   true,
+}
+
+func isTrackingParam(k string) bool {
+	k = strings.ToLower(k)
+	return trackingParams[k] || strings.HasPrefix(k, "utm_")
+}
+
+// normalizeDomain returns the host name in lower case, without the default ports and the "www." prefix
+func normalizeDomain(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		host = h
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// normalizeURL returns the form of the link we use to find the submissions of the same page.
+// It ignores the scheme, the "www." prefix, the default ports, the trailing slash, the fragment and
+// the tracking parameters, and it sorts the rest of the query parameters.
+func normalizeURL(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	q := u.Query()
+	for k := range q {
+		if isTrackingParam(k) {
+			q.Del(k)
+		}
+	}
+	n := linkPath(u)
+	if enc := q.Encode(); len(enc) > 0 {
+		n += "?" + enc
+	}
+	return n
+}
+
+// linkPath returns the host and the path of the u link, in their normalized form, without the query
+func linkPath(u *url.URL) string {
+	return normalizeDomain(u.Host) + strings.TrimRight(u.EscapedPath(), "/")
+}
+
+// linkPathMatches checks if the link points to the page at path, which is a host and path returned by linkPath
+func linkPathMatches(link, path string) bool {
+	u, err := url.Parse(link)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	return linkPath(u) == path
+}
+
+// linkPathPattern returns the regular expression matching the links to the page at path, which is a host and path
+// returned by linkPath, with any scheme, port, query or fragment, the optional "www." prefix and the optional trailing slash
+func linkPathPattern(path string) string {
+	host, p := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		host, p = path[:i], path[i:]
+	}
+	return `^[a-z][a-z0-9+.-]*://(www\.)?` + regexp.QuoteMeta(host) + `(:[0-9]+)?` + regexp.QuoteMeta(p) + `/?([?#]|$)`
+}
+
+// linkPathURLs returns the parts that the links to the page at path contain, for the repositories that match the links
+// containing any of them. They match other links too, like the ones to the pages below path, so the items loaded
+// with them need to be checked with linkPathMatches.
+func linkPathURLs(path string) []string {
+	host, p := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		host, p = path[:i], path[i:]
+	}
+	urls := make([]string, 0, 6)
+	for _, h := range []string{host, "www." + host} {
+		for _, port := range []string{"", ":80", ":443"} {
+			urls = append(urls, "://"+h+port+p)
+		}
+	}
+	return urls
+}
+
+// linkDomainMatches checks if the link points to a page on the domain, both in their normalized form
+func linkDomainMatches(link, domain string) bool {
+	u, err := url.Parse(link)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	return normalizeDomain(u.Host) == normalizeDomain(domain)
+}
+
+// linkDomainPattern returns the regular expression matching the links to the pages of the domain,
+// with any scheme or port and with the optional "www." prefix
+func linkDomainPattern(domain string) string {
+	return `^[a-z][a-z0-9+.-]*://(www\.)?` + regexp.QuoteMeta(normalizeDomain(domain)) + `(:[0-9]+)?([/?#]|$)`
+}
+
+// linkDomainURLs returns the parts that the links to the pages of the domain contain, with any scheme or port
+// and with the optional "www." prefix, for the repositories that match the links containing any of them.
+// NOTE(marius): the links to the root of the domain without a trailing slash don't contain any of them, so the domain
+// listings miss them. The duplicate links check doesn't use these, it matches the pages with linkPathURLs.
+func linkDomainURLs(domain string) []string {
+	domain = normalizeDomain(domain)
+	urls := make([]string, 0, 8)
+	for _, host := range []string{domain, "www." + domain} {
+		for _, sep := range []string{"/", "?", "#", ":"} {
+			urls = append(urls, "://"+host+sep)
+		}
+	}
+	return urls
+}
+
+// sameLink checks if the item links to the same page as the normalized link, either through
+// its URL or through the canonical URL of the page
+func sameLink(it Item, normalized string) bool {
+	if !it.IsLink() {
+		return false
+	}
+	if normalizeURL(it.Data) == normalized {
+		return true
+	}
+	return it.HasMetadata() && len(it.Metadata.Canonical) > 0 && normalizeURL(it.Metadata.Canonical) == normalized
+}
+
+// loadLinkSubmission returns the most recent submission of the link made after the since time.
+// The repository loads all the submissions of the page the link points to, the same host and path, and we compare
+// their links, or their canonical URLs, to the link, in their normalized forms.
+func loadLinkSubmission(repo Repository, link string, since time.Time) (Item, bool) {
+	u, err := url.Parse(link)
+	if err != nil || len(u.Host) == 0 {
+		return Item{}, false
+	}
+	f := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Link:                 linkPath(u),
+			Context:              []string{"0"},
+			Deleted:              []bool{false},
+			Private:              []bool{false},
+			SubmittedAt:          since,
+			SubmittedAtMatchType: MatchAfter,
+		},
+		MaxItems: duplicateLinksBatchSize,
+	}
+	normalized := normalizeURL(link)
+	var found *Item
+	loaded := uint(0)
+	for f.Page = 1; ; f.Page++ {
+		items, cnt, err := repo.LoadItems(f)
+		if err != nil {
+			return Item{}, false
+		}
+		for k, it := range items {
+			if !sameLink(it, normalized) {
+				continue
+			}
+			if found == nil || it.SubmittedAt.After(found.SubmittedAt) {
+				found = &items[k]
+			}
+		}
+		loaded += uint(len(items))
+		if len(items) < duplicateLinksBatchSize || loaded >= cnt {
+			break
+		}
+	}
+	if found == nil {
+		return Item{}, false
+	}
+	return *found, true
+}
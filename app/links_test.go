@@ -0,0 +1,121 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func Test_normalizeURL(t *testing.T) {
+	want := "example.com/article?id=1&page=2"
+	tests := []string{
+		"https://example.com/article?id=1&page=2",
+		"http://www.example.com/article/?page=2&id=1",
+		"HTTPS://WWW.Example.COM:443/article?id=1&page=2#comments",
+		"https://example.com/article?utm_source=feed&id=1&fbclid=abc&page=2&UTM_MEDIUM=rss",
+		"example.com/article?id=1&page=2",
+	}
+	for _, u := range tests {
+		if n := normalizeURL(u); n != want {
+			t.Errorf("Normalized URL of %q must be %q, received %q", u, want, n)
+		}
+	}
+	different := []string{
+		"https://example.com/Article?id=1&page=2",
+		"https://example.com/article?id=2&page=2",
+		"https://blog.example.com/article?id=1&page=2",
+		"https://example.com:8080/article?id=1&page=2",
+	}
+	for _, u := range different {
+		if n := normalizeURL(u); n == want {
+			t.Errorf("Normalized URL of %q must be different from %q", u, want)
+		}
+	}
+}
+
+func Test_linkDomainMatches(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/article":          true,
+		"http://www.example.com":               true,
+		"https://EXAMPLE.com:443/?q=1":         true,
+		"https://notexample.com/article":       false,
+		"https://blog.example.com/article":     false,
+		"https://other.com/?url=example.com/a": false,
+	}
+	pattern := regexp.MustCompile("(?i)" + linkDomainPattern("www.example.com"))
+	for link, match := range tests {
+		if linkDomainMatches(link, "www.example.com") != match {
+			t.Errorf("Link %s matching the domain must be %t", link, match)
+		}
+		if pattern.MatchString(link) != match {
+			t.Errorf("Link %s matching the domain pattern must be %t", link, match)
+		}
+	}
+}
+
+func Test_linkPathMatches(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/article":              true,
+		"http://www.example.com:80/article/":       true,
+		"https://EXAMPLE.com/article?q=1#top":      true,
+		"https://example.com/article/comments":     false,
+		"https://example.com/articles":             false,
+		"https://example.com.au/article":           false,
+		"https://other.com/?u=example.com/article": false,
+	}
+	path := linkPath(&url.URL{Host: "www.example.com", Path: "/article/"})
+	pattern := regexp.MustCompile("(?i)" + linkPathPattern(path))
+	for link, match := range tests {
+		if linkPathMatches(link, path) != match {
+			t.Errorf("Link %s matching the page must be %t", link, match)
+		}
+		if pattern.MatchString(link) != match {
+			t.Errorf("Link %s matching the page pattern must be %t", link, match)
+		}
+	}
+}
+
+func Test_HandleSubmit_DuplicateLink(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.DuplicateLinksWindow = 24 * time.Hour
+
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	old := mockItem(t, repo, Item{Title: "old", Data: "https://example.com/old", MimeType: MimeTypeURL, SubmittedBy: &jane,
+		SubmittedAt: time.Now().UTC().Add(-48 * time.Hour)})
+	recent := mockItem(t, repo, Item{Title: "recent", Data: "https://www.example.com/recent/?utm_source=rss", MimeType: MimeTypeURL,
+		SubmittedBy: &jane, SubmittedAt: time.Now().UTC().Add(-time.Hour)})
+	root := mockItem(t, repo, Item{Title: "root", Data: "https://example.com", MimeType: MimeTypeURL,
+		SubmittedBy: &jane, SubmittedAt: time.Now().UTC().Add(-time.Hour)})
+
+	h := mockHandler(repo)
+	submit := func(link string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("data", link)
+		form.Set("title", "resubmission")
+		w := httptest.NewRecorder()
+		h.HandleSubmit(w, withHandlerContext(mockFormRequest(http.MethodPost, "/submit", form), repo, &john))
+		return w
+	}
+
+	w := submit("http://example.com/recent#top")
+	if loc := w.Header().Get("Location"); loc != ItemPermaLink(recent) {
+		t.Errorf("Duplicate submission must redirect to %q, received %q", ItemPermaLink(recent), loc)
+	}
+	w = submit("http://www.example.com/")
+	if loc := w.Header().Get("Location"); loc != ItemPermaLink(root) {
+		t.Errorf("Duplicate submission must redirect to %q, received %q", ItemPermaLink(root), loc)
+	}
+	w = submit("https://example.com/old")
+	if loc := w.Header().Get("Location"); w.Code != http.StatusSeeOther || loc == ItemPermaLink(old) {
+		t.Errorf("Submission after the window must be saved, received %d to %q", w.Code, loc)
+	}
+	if items, _, _ := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{URL: "www.example.com"}}); len(items) != 4 {
+		t.Errorf("Items count from domain %s must be %d, received %d", "www.example.com", 4, len(items))
+	}
+}
@@ -6,6 +6,8 @@ import (
 	as "github.com/go-ap/activitypub"
 	"github.com/mariusor/qstring"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -41,6 +43,9 @@ const (
 	ContextNil  = "0"
 )
 
+// placeholderRe matches the ?N placeholders of the clauses returned by GetWhereClauses
+var placeholderRe = regexp.MustCompile(`\?(\d+)`)
+
 type WebInfo struct {
 	Title       string   `json:"title"`
 	Email       string   `json:"email"`
@@ -117,6 +122,8 @@ type LoadItemsFilter struct {
 	Deleted              []bool     `qstring:"-"` // used as an array to allow for it to be missing
 	IRI                  string     `qstring:"id,omitempty"`
 	URL                  string     `qstring:"url,omitempty"`
+	// Link is the host and the path of a link, as returned by linkPath, for loading the submissions of the page
+	Link                 string     `qstring:"-"`
 	Depth                int        `qstring:"depth,omitempty"`
 	Federated            []bool     `qstring:"-"` // used as an array to allow for it to be missing
 	Private              []bool     `qstring:"-"` // used as an array to allow for it to be missing
@@ -131,6 +138,7 @@ type Filters struct {
 	LoadItemsFilter
 	LoadVotesFilter
 	LoadFollowRequestsFilter
+	LoadReportsFilter
 	Page     int `qstring:"page,omitempty"`
 	MaxItems int `qstring:"maxItems,omitempty"`
 }
@@ -141,6 +149,12 @@ type LoadFollowRequestsFilter struct {
 	On    []Hash `qstring:"object,omitempty"`
 }
 
+type LoadReportsFilter struct {
+	Key   []Hash `qstring:"iri,omitempty"`
+	Actor []Hash `qstring:"actor,omitempty"`
+	On    []Hash `qstring:"object,omitempty"`
+}
+
 type LoadAccountsFilter struct {
 	Key      []Hash   `qstring:"iri,omitempty"`
 	Handle   []string `qstring:"name,omitempty"`
@@ -173,6 +187,11 @@ func query(f Filterable) string {
 	return res
 }
 
+// keyClause matches the key or the IRI of the rows of the table aliased as alias with the value of placeholder ?counter
+func keyClause(alias string, counter int) string {
+	return fmt.Sprintf(`("%s"."key" = ?%d OR "%s"."iri" = ?%d)`, alias, counter, alias, counter)
+}
+
 // @todo(marius) the GetWhereClauses methods should be moved to the db package into a different format
 func (f LoadVotesFilter) GetWhereClauses() ([]string, []interface{}) {
 	wheres := make([]string, 0)
@@ -181,29 +200,25 @@ func (f LoadVotesFilter) GetWhereClauses() ([]string, []interface{}) {
 	if len(f.AttributedTo) > 0 {
 		whereColumns := make([]string, 0)
 		for _, v := range f.AttributedTo {
-			whereColumns = append(whereColumns, fmt.Sprintf(`"voter"."key" ~* ?%d`, counter))
-			whereValues = append(whereValues, interface{}(v))
+			whereColumns = append(whereColumns, keyClause("voter", counter))
+			whereValues = append(whereValues, interface{}(v.String()))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
 	}
 	if len(f.Type) > 0 {
+		// NOTE(marius): votes with a zero weight are removed, so only the Like and Dislike types can match
 		whereColumns := make([]string, 0)
-		for _, typ := range f.Type {
-			switch strings.ToLower(string(typ)) {
-			case string(TypeLike):
-				whereColumns = append(whereColumns, fmt.Sprintf(`"vote"."weight" > ?%d`, counter))
-			case string(TypeDislike):
-				whereColumns = append(whereColumns, fmt.Sprintf(`"vote"."weight" < ?%d`, counter))
-			case string(TypeUndo):
-				whereColumns = append(whereColumns, fmt.Sprintf(`"vote"."weight" = ?%d`, counter))
-			}
-			whereValues = append(whereValues, interface{}(0))
-			counter++
+		if f.Type.Contains(as.LikeType) {
+			whereColumns = append(whereColumns, `"vote"."weight" > 0`)
 		}
-		if len(whereColumns) > 0 && len(whereColumns) < 3 {
-			wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+		if f.Type.Contains(as.DislikeType) {
+			whereColumns = append(whereColumns, `"vote"."weight" < 0`)
+		}
+		if len(whereColumns) == 0 {
+			whereColumns = append(whereColumns, "false")
 		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
 	}
 	if len(f.ItemKey) > 0 {
 		whereColumns := make([]string, 0)
@@ -212,11 +227,13 @@ func (f LoadVotesFilter) GetWhereClauses() ([]string, []interface{}) {
 			if len(h) == 0 {
 				continue
 			}
-			whereColumns = append(whereColumns, fmt.Sprintf(`"item"."key" ~* ?%d`, counter))
-			whereValues = append(whereValues, interface{}(h))
+			whereColumns = append(whereColumns, keyClause("item", counter))
+			whereValues = append(whereValues, interface{}(h.String()))
 			counter++
 		}
-		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+		if len(whereColumns) > 0 {
+			wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+		}
 	}
 	return wheres, whereValues
 }
@@ -254,8 +271,8 @@ func (f LoadItemsFilter) GetWhereClauses() ([]string, []interface{}) {
 	if len(f.Key) > 0 {
 		keyWhere := make([]string, 0)
 		for _, hash := range f.Key {
-			keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."key" ~* ?%d`, it, counter))
-			whereValues = append(whereValues, interface{}(hash))
+			keyWhere = append(keyWhere, keyClause(it, counter))
+			whereValues = append(whereValues, interface{}(hash.String()))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(keyWhere, " OR ")))
@@ -263,9 +280,8 @@ func (f LoadItemsFilter) GetWhereClauses() ([]string, []interface{}) {
 	if len(f.AttributedTo) > 0 {
 		attrWhere := make([]string, 0)
 		for _, v := range f.AttributedTo {
-			attrWhere = append(attrWhere, fmt.Sprintf(`"%s"."key" ~* ?%d`, acc, counter))
-			attrWhere = append(attrWhere, fmt.Sprintf(`"%s"."handle" = ?%d`, acc, counter))
-			whereValues = append(whereValues, interface{}(v))
+			attrWhere = append(attrWhere, keyClause(acc, counter))
+			whereValues = append(whereValues, interface{}(v.String()))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(attrWhere, " OR ")))
@@ -275,16 +291,10 @@ func (f LoadItemsFilter) GetWhereClauses() ([]string, []interface{}) {
 		ctxtWhere := make([]string, 0)
 		for _, ctxtHash := range f.Context {
 			if ctxtHash == ContextNil || ctxtHash == "" {
-				ctxtWhere = append(ctxtWhere, fmt.Sprintf(`"%s"."path" is NULL OR nlevel("%s"."path") = 0`, it, it))
-				break
-			}
-			ctxtWhere = append(ctxtWhere, fmt.Sprintf(`("%s"."path" <@ (SELECT
-CASE WHEN "path" IS NULL THEN "key"::ltree ELSE ltree_addltree("path", "key"::ltree) END
-FROM "items" WHERE "key" ~* ?%d) AND "%s"."path" IS NOT NULL)`, it, counter, it))
-			if f.Depth > 0 {
-				wheres = append(wheres, fmt.Sprintf(`nlevel("%s"."path") <= (SELECT CASE WHEN "path" IS NULL THEN 0 ELSE nlevel("path")::INT END FROM "items" WHERE "key" ~* ?%d) + %d`, it, counter, f.Depth))
-				f.Depth = 0
+				ctxtWhere = append(ctxtWhere, fmt.Sprintf(`"%s"."parent_id" IS NULL`, it))
+				continue
 			}
+			ctxtWhere = append(ctxtWhere, fmt.Sprintf(`"%s"."op_id" IN (SELECT "id" FROM "items" WHERE "key" = ?%d OR "iri" = ?%d)`, it, counter, counter))
 			whereValues = append(whereValues, interface{}(ctxtHash))
 			counter++
 		}
@@ -294,33 +304,38 @@ FROM "items" WHERE "key" ~* ?%d) AND "%s"."path" IS NOT NULL)`, it, counter, it)
 		whereColumns := make([]string, 0)
 		for _, hash := range f.InReplyTo {
 			if len(hash) == 0 {
+				whereColumns = append(whereColumns, fmt.Sprintf(`"%s"."parent_id" IS NULL`, it))
 				continue
 			}
-			whereColumns = append(whereColumns, fmt.Sprintf(`("%s"."path" = (SELECT
-CASE WHEN "path" IS NULL THEN "key"::ltree ELSE ltree_addltree("path", "key"::ltree) END
-FROM "items" WHERE "key" ~* ?%d) AND "%s"."path" IS NOT NULL)`, it, counter, it))
-			if f.Depth > 0 {
-				wheres = append(wheres, fmt.Sprintf(`nlevel("%s"."path") <= (SELECT CASE WHEN "path" IS NULL THEN 0 ELSE nlevel("path")::INT END FROM "items" WHERE "key" ~* ?%d) + %d`, it, counter, f.Depth))
-				f.Depth = 0
-			}
+			whereColumns = append(whereColumns, fmt.Sprintf(`"%s"."parent_id" IN (SELECT "id" FROM "items" WHERE "key" = ?%d OR "iri" = ?%d)`, it, counter, counter))
 			whereValues = append(whereValues, interface{}(hash))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
 	}
-	if len(f.Content) > 0 {
-		contentWhere := make([]string, 0)
+	if !f.SubmittedAt.IsZero() {
 		var operator string
-		if f.ContentMatchType == MatchFuzzy {
-			operator = "~"
-		}
-		if f.ContentMatchType == MatchEquals {
+		switch f.SubmittedAtMatchType {
+		case MatchBefore:
+			operator = "<"
+		case MatchAfter:
+			operator = ">"
+		default:
 			operator = "="
 		}
-		contentWhere = append(contentWhere, fmt.Sprintf(`"%s"."title" %s ?%d`, it, operator, counter))
-		whereValues = append(whereValues, interface{}(f.Content))
+		wheres = append(wheres, fmt.Sprintf(`"%s"."submitted_at" %s ?%d`, it, operator, counter))
+		whereValues = append(whereValues, interface{}(f.SubmittedAt))
 		counter++
-		contentWhere = append(contentWhere, fmt.Sprintf(`"%s"."data" %s ?%d`, it, operator, counter))
+	}
+	if len(f.Content) > 0 {
+		contentWhere := make([]string, 0)
+		if f.ContentMatchType == MatchFuzzy {
+			contentWhere = append(contentWhere, fmt.Sprintf(`strpos(lower("%s"."title"), lower(?%d)) > 0`, it, counter))
+			contentWhere = append(contentWhere, fmt.Sprintf(`strpos(lower("%s"."data"), lower(?%d)) > 0`, it, counter))
+		} else {
+			contentWhere = append(contentWhere, fmt.Sprintf(`"%s"."title" = ?%d`, it, counter))
+			contentWhere = append(contentWhere, fmt.Sprintf(`"%s"."data" = ?%d`, it, counter))
+		}
 		whereValues = append(whereValues, interface{}(f.Content))
 		counter++
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(contentWhere, " OR ")))
@@ -329,55 +344,57 @@ FROM "items" WHERE "key" ~* ?%d) AND "%s"."path" IS NOT NULL)`, it, counter, it)
 		mediaWhere := make([]string, 0)
 		for _, v := range f.MediaType {
 			mediaWhere = append(mediaWhere, fmt.Sprintf(`"%s"."mime_type" = ?%d`, it, counter))
-			whereValues = append(whereValues, interface{}(v))
+			whereValues = append(whereValues, interface{}(string(v)))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(mediaWhere, " OR ")))
 	}
 	if len(f.Deleted) > 0 {
-		delWhere := make([]string, 0)
-		for _, del := range f.Deleted {
-			var eqOp string
-			if del {
-				eqOp = "="
-			} else {
-				eqOp = "!="
-			}
-			delWhere = append(delWhere, fmt.Sprintf(`"%s"."flags" & 1::bit(8) %s 1::bit(8)`, it, eqOp))
-		}
-		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(delWhere, " OR ")))
+		wheres = append(wheres, flagsClause(it, FlagsDeleted, f.Deleted))
+	}
+	if len(f.Private) > 0 {
+		wheres = append(wheres, flagsClause(it, FlagsPrivate, f.Private))
 	}
 	if len(f.FollowedBy) > 0 {
+		// NOTE(marius): like the FedBOX inbox, we show the items of the accounts followed by FollowedBy,
+		//  the items they shared, and the items addressed to it
 		keyWhere := make([]string, 0)
-		hash := f.FollowedBy
-		keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."id" in (SELECT "votes"."item_id" FROM "votes" WHERE "votes"."submitted_by" = (SELECT "id" FROM "accounts" where "key" ~* ?%d OR "handle" = ?%d) AND "votes"."weight" != 0)
-			OR
-"%s"."key" IN (SELECT subpath("path", 0, 1)::varchar FROM "items" WHERE "submitted_by" = (SELECT "id" FROM "accounts" where "key" ~* ?%d OR "handle" = ?%d) AND nlevel("path") > 1)`, it, counter, counter, it, counter, counter))
-		whereValues = append(whereValues, interface{}(hash))
+		keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."submitted_by" IN (SELECT "follow_requests"."object_id" FROM "follow_requests"
+INNER JOIN "accounts" ON "accounts"."id" = "follow_requests"."submitted_by"
+WHERE "follow_requests"."accepted" AND "accounts"."key" = ?%d)`, it, counter))
+		keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."id" IN (SELECT "shares"."item_id" FROM "shares"
+INNER JOIN "follow_requests" ON "follow_requests"."object_id" = "shares"."submitted_by"
+INNER JOIN "accounts" ON "accounts"."id" = "follow_requests"."submitted_by"
+WHERE "follow_requests"."accepted" AND "accounts"."key" = ?%d)`, it, counter))
+		for _, rec := range []string{"to", "cc"} {
+			keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."metadata"->'%s' @> jsonb_build_array(jsonb_build_object('hash', ?%d::text))`, it, rec, counter))
+			keyWhere = append(keyWhere, fmt.Sprintf(`"%s"."metadata"->'%s' @> jsonb_build_array(jsonb_build_object('id', ?%d::text))`, it, rec, counter))
+		}
+		whereValues = append(whereValues, interface{}(f.FollowedBy))
 		counter++
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(keyWhere, " OR ")))
 	}
-	if len(f.Federated) > 0 && len(f.Federated) < 2 {
+	if len(f.Federated) > 0 {
+		fWheres := make([]string, 0)
 		for _, fed := range f.Federated {
-			fWheres := make([]string, 0)
-			if fed {
-				// TODO(marius) "attributedTo" should be more than not null,
-				//              it shouldn't contain the current instance's base URL
-				fWheres = append(fWheres, fmt.Sprintf(`"%s"."metadata"->>'attributedTo' IS NOT NULL`, it))
-			} else {
-				fWheres = append(fWheres, fmt.Sprintf(`"%s"."metadata"->>'attributedTo' IS NULL`, it))
-			}
-			wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(fWheres, " OR ")))
+			fWheres = append(fWheres, fmt.Sprintf(`"%s"."local" = %t`, it, !fed))
 		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(fWheres, " OR ")))
 	}
 	if len(f.IRI) > 0 {
-		wheres = append(wheres, fmt.Sprintf(`"%s"."metadata"->>'id' ~* ?%d`, it, counter))
+		wheres = append(wheres, fmt.Sprintf(`strpos("%s"."iri", ?%d) > 0`, it, counter))
 		whereValues = append(whereValues, interface{}(f.IRI))
 		counter++
 	}
-	if f.Depth > 0 {
-		wheres = append(wheres, fmt.Sprintf(`nlevel("%s"."path") <= ?%d`, it, counter))
-		whereValues = append(whereValues, interface{}(f.Depth))
+	if len(f.URL) > 0 {
+		wheres = append(wheres, fmt.Sprintf(`("%s"."mime_type" = ?%d AND "%s"."data" ~* ?%d)`, it, counter, it, counter+1))
+		whereValues = append(whereValues, interface{}(string(MimeTypeURL)), interface{}(linkDomainPattern(f.URL)))
+		counter += 2
+	}
+	if len(f.Link) > 0 {
+		wheres = append(wheres, fmt.Sprintf(`("%s"."mime_type" = ?%d AND "%s"."data" ~* ?%d)`, it, counter, it, counter+1))
+		whereValues = append(whereValues, interface{}(string(MimeTypeURL)), interface{}(linkPathPattern(f.Link)))
+		counter += 2
 	}
 	return wheres, whereValues
 }
@@ -453,13 +470,13 @@ func (f Filters) GetWhereClauses() ([]string, []interface{}) {
 	var values []interface{}
 
 	iCl, iVal := f.LoadItemsFilter.GetWhereClauses()
-	clauses = append(clauses, iCl...)
+	clauses = append(clauses, shiftPlaceholders(iCl, len(values))...)
 	values = append(values, iVal...)
 	aCl, aVal := f.LoadAccountsFilter.GetWhereClauses()
-	clauses = append(clauses, aCl...)
+	clauses = append(clauses, shiftPlaceholders(aCl, len(values))...)
 	values = append(values, aVal...)
 	vCl, vVal := f.LoadVotesFilter.GetWhereClauses()
-	clauses = append(clauses, vCl...)
+	clauses = append(clauses, shiftPlaceholders(vCl, len(values))...)
 	values = append(values, vVal...)
 	return clauses, values
 }
@@ -473,8 +490,8 @@ func (f LoadAccountsFilter) GetWhereClauses() ([]string, []interface{}) {
 	if len(f.Key) > 0 {
 		whereColumns := make([]string, 0)
 		for _, hash := range f.Key {
-			whereColumns = append(whereColumns, fmt.Sprintf(`"accounts"."key" ~* ?%d`, counter))
-			whereValues = append(whereValues, interface{}(hash))
+			whereColumns = append(whereColumns, keyClause("accounts", counter))
+			whereValues = append(whereValues, interface{}(hash.String()))
 			counter++
 		}
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
@@ -489,37 +506,95 @@ func (f LoadAccountsFilter) GetWhereClauses() ([]string, []interface{}) {
 		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
 	}
 	if len(f.Email) > 0 {
-		wheres = append(wheres, fmt.Sprintf(`"accounts"."email"  ~* ?%d`, counter))
-		whereValues = append(whereValues, interface{}(f.Email))
-		counter++
+		whereColumns := make([]string, 0)
+		for _, email := range f.Email {
+			whereColumns = append(whereColumns, fmt.Sprintf(`"accounts"."email" = ?%d`, counter))
+			whereValues = append(whereValues, interface{}(email))
+			counter++
+		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
 	}
 	if len(f.InboxIRI) > 0 {
-		wheres = append(wheres, fmt.Sprintf(`"accounts"."metadata"->>'inbox' ~* ?%d`, counter))
+		wheres = append(wheres, fmt.Sprintf(`strpos("accounts"."metadata"->>'inbox', ?%d) > 0`, counter))
 		whereValues = append(whereValues, interface{}(f.InboxIRI))
 		counter++
 	}
 	if len(f.IRI) > 0 {
-		wheres = append(wheres, fmt.Sprintf(`"accounts"."metadata"->>'id' ~* ?%d`, counter))
+		wheres = append(wheres, fmt.Sprintf(`strpos("accounts"."iri", ?%d) > 0`, counter))
 		whereValues = append(whereValues, interface{}(f.IRI))
 		counter++
 	}
 	if len(f.Deleted) > 0 {
-		delWhere := make([]string, 0)
-		for _, del := range f.Deleted {
-			var eqOp string
-			if del {
-				eqOp = "="
-			} else {
-				eqOp = "!="
-			}
-			delWhere = append(delWhere, fmt.Sprintf(`"flags" & 1::bit(8) %s 1::bit(8)`, eqOp))
-		}
-		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(delWhere, " OR ")))
+		wheres = append(wheres, flagsClause("accounts", FlagsDeleted, f.Deleted))
 	}
 
 	return wheres, whereValues
 }
 
+// GetWhereClauses returns the clauses matching the follow requests, aliased as "follow",
+// with their actors and objects aliased as "actor" and "object"
+func (f LoadFollowRequestsFilter) GetWhereClauses() ([]string, []interface{}) {
+	return activityWhereClauses("follow", "actor", "object", f.Key, f.Actor, f.On)
+}
+
+// GetWhereClauses returns the clauses matching the reports, aliased as "report",
+// with their actors and items aliased as "reporter" and "reported"
+func (f LoadReportsFilter) GetWhereClauses() ([]string, []interface{}) {
+	return activityWhereClauses("report", "reporter", "reported", f.Key, f.Actor, f.On)
+}
+
+func activityWhereClauses(act, actor, object string, keys, actors, objects Hashes) ([]string, []interface{}) {
+	wheres := make([]string, 0)
+	whereValues := make([]interface{}, 0)
+	counter := 0
+
+	for _, f := range []struct {
+		alias  string
+		hashes Hashes
+	}{{act, keys}, {actor, actors}, {object, objects}} {
+		if len(f.hashes) == 0 {
+			continue
+		}
+		whereColumns := make([]string, 0)
+		for _, hash := range f.hashes {
+			whereColumns = append(whereColumns, keyClause(f.alias, counter))
+			whereValues = append(whereValues, interface{}(hash.String()))
+			counter++
+		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+	}
+	return wheres, whereValues
+}
+
+// flagsClause matches the rows of the table aliased as alias which have, or don't have, the flag set
+func flagsClause(alias string, flag FlagBits, values []bool) string {
+	whereColumns := make([]string, 0)
+	for _, v := range values {
+		eqOp := "!="
+		if v {
+			eqOp = "="
+		}
+		whereColumns = append(whereColumns, fmt.Sprintf(`("%s"."flags" & %d) %s %d`, alias, flag, eqOp, flag))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR "))
+}
+
+// shiftPlaceholders adds offset to the numbers of the ?N placeholders of the clauses,
+// so the clauses of multiple filters can share the same list of values
+func shiftPlaceholders(clauses []string, offset int) []string {
+	if offset == 0 {
+		return clauses
+	}
+	shifted := make([]string, len(clauses))
+	for i, cl := range clauses {
+		shifted[i] = placeholderRe.ReplaceAllStringFunc(cl, func(p string) string {
+			n, _ := strconv.Atoi(p[1:])
+			return fmt.Sprintf("?%d", n+offset)
+		})
+	}
+	return shifted
+}
+
 func copyFilters(a *Filters, b Filters) {
 	copyAccountFilters(&a.LoadAccountsFilter, b.LoadAccountsFilter)
 	copyItemsFilters(&a.LoadItemsFilter, b.LoadItemsFilter)
@@ -537,9 +612,9 @@ func copyAccountFilters(a *LoadAccountsFilter, b LoadAccountsFilter) {
 	a.IRI = b.IRI
 }
 
-func ContextRepository(ctx context.Context) (*repository, bool) {
+func ContextRepository(ctx context.Context) (Repository, bool) {
 	ctxVal := ctx.Value(RepositoryCtxtKey)
-	l, ok := ctxVal.(*repository)
+	l, ok := ctxVal.(Repository)
 	return l, ok
 }
 
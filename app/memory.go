@@ -0,0 +1,1157 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/pborman/uuid"
+)
+
+// memRepository is a Repository implementation that keeps everything in memory.
+// It's used for running littr without a FedBOX instance and for testing the handlers.
+type memRepository struct {
+	m        sync.RWMutex
+	items    ItemCollection
+	votes    VoteCollection
+	shares   []itemShare
+	accounts AccountCollection
+	requests FollowRequests
+	follows  FollowRequests
+	blocks   FollowRequests
+	read     map[string]Hashes
+	reports  ItemReports
+	ops      ModerationOps
+	// passwords are the keys derived from the account passwords, with their salts
+	passwords map[string]memPassword
+	account   *Account
+	index     Index
+}
+
+// itemShare is an item shared by an account, the equivalent of an Announce activity
+type itemShare struct {
+	Item        Hash
+	SubmittedBy *Account
+	SubmittedAt time.Time
+}
+
+// InMemoryService returns a new, empty, in memory Repository
+func InMemoryService(c appConfig) *memRepository {
+	if len(c.APIURL) > 0 {
+		setAPIURL(c.APIURL)
+	}
+	return &memRepository{
+		items:     make(ItemCollection, 0),
+		votes:     make(VoteCollection, 0),
+		shares:    make([]itemShare, 0),
+		accounts:  make(AccountCollection, 0),
+		requests:  make(FollowRequests, 0),
+		follows:   make(FollowRequests, 0),
+		blocks:    make(FollowRequests, 0),
+		read:      make(map[string]Hashes),
+		reports:   make(ItemReports, 0),
+		ops:       make(ModerationOps, 0),
+		passwords: make(map[string]memPassword),
+	}
+}
+
+func newHash() Hash {
+	return Hash(uuid.New())
+}
+
+// hashMatches checks if the h filter value corresponds to an object's key or to its IRI
+func hashMatches(h Hash, key Hash, iri string) bool {
+	if len(key) > 0 && HashesEqual(h, key) {
+		return true
+	}
+	return len(iri) > 0 && h.String() == iri
+}
+
+func hashesMatch(hashes Hashes, key Hash, iri string) bool {
+	for _, h := range hashes {
+		if hashMatches(h, key, iri) {
+			return true
+		}
+	}
+	return false
+}
+
+func boolsContain(bb []bool, b bool) bool {
+	for _, v := range bb {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
+
+func itemID(i *Item) string {
+	if !i.HasMetadata() {
+		return ""
+	}
+	return i.Metadata.ID
+}
+
+func accountID(a *Account) string {
+	if !a.HasMetadata() {
+		return ""
+	}
+	return a.Metadata.ID
+}
+
+func itemStub(i *Item) *Item {
+	if !i.IsValid() {
+		return nil
+	}
+	return &Item{Hash: i.Hash, Metadata: &ItemMetadata{ID: itemID(i)}}
+}
+
+func accountStub(a *Account) *Account {
+	if !a.IsValid() {
+		return a
+	}
+	return &Account{Hash: a.Hash, Handle: a.Handle, Metadata: &AccountMetadata{ID: accountID(a)}}
+}
+
+func accountStubs(accounts []*Account) []*Account {
+	if len(accounts) == 0 {
+		return nil
+	}
+	stubs := make([]*Account, 0, len(accounts))
+	for _, a := range accounts {
+		stubs = append(stubs, accountStub(a))
+	}
+	return stubs
+}
+
+// pageBounds returns the slice bounds corresponding to the Page and MaxItems values of f
+func pageBounds(f Filters, l int) (int, int) {
+	if f.MaxItems <= 0 {
+		return 0, l
+	}
+	page := f.Page
+	if page < 1 {
+		page = 1
+	}
+	start := f.MaxItems * (page - 1)
+	if start > l {
+		start = l
+	}
+	end := start + f.MaxItems
+	if end > l {
+		end = l
+	}
+	return start, end
+}
+
+func (m *memRepository) itemIndex(h Hash) int {
+	if len(h) == 0 {
+		return -1
+	}
+	for k, it := range m.items {
+		if hashMatches(h, it.Hash, itemID(&it)) {
+			return k
+		}
+	}
+	return -1
+}
+
+func (m *memRepository) accountIndex(h Hash) int {
+	if len(h) == 0 {
+		return -1
+	}
+	for k, a := range m.accounts {
+		if hashMatches(h, a.Hash, accountID(&a)) {
+			return k
+		}
+	}
+	return -1
+}
+
+func (m *memRepository) loadAccount(a *Account) *Account {
+	if !a.IsValid() {
+		return a
+	}
+	if k := m.accountIndex(a.Hash); k >= 0 {
+		acc := m.accounts[k]
+		return &acc
+	}
+	return a
+}
+
+func (m *memRepository) following(h Hash) Hashes {
+	following := make(Hashes, 0)
+	for _, f := range m.follows {
+		if f.SubmittedBy.IsValid() && HashesEqual(f.SubmittedBy.Hash, h) {
+			following = append(following, f.Object.Hash)
+		}
+	}
+	return following
+}
+
+func (m *memRepository) itemMatches(i Item, f Filters, following Hashes) bool {
+	lf := f.LoadItemsFilter
+	if len(lf.Key) > 0 && !hashesMatch(lf.Key, i.Hash, itemID(&i)) {
+		return false
+	}
+	if len(lf.MediaType) > 0 {
+		found := false
+		for _, typ := range lf.MediaType {
+			found = found || typ == i.MimeType
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(lf.AttributedTo) > 0 {
+		if !i.SubmittedBy.IsValid() || !hashesMatch(lf.AttributedTo, i.SubmittedBy.Hash, accountID(i.SubmittedBy)) {
+			return false
+		}
+	}
+	if len(lf.Context) > 0 {
+		found := false
+		for _, ctxt := range lf.Context {
+			if ctxt == ContextNil || ctxt == "" {
+				found = found || !i.Parent.IsValid()
+				continue
+			}
+			found = found || (i.OP.IsValid() && hashMatches(Hash(ctxt), i.OP.Hash, itemID(i.OP)))
+		}
+		if !found {
+			return false
+		}
+	}
+	if !lf.SubmittedAt.IsZero() {
+		switch lf.SubmittedAtMatchType {
+		case MatchBefore:
+			if !i.SubmittedAt.Before(lf.SubmittedAt) {
+				return false
+			}
+		case MatchAfter:
+			if !i.SubmittedAt.After(lf.SubmittedAt) {
+				return false
+			}
+		default:
+			if !i.SubmittedAt.Equal(lf.SubmittedAt) {
+				return false
+			}
+		}
+	}
+	if len(lf.Content) > 0 {
+		if lf.ContentMatchType == MatchFuzzy {
+			content := strings.ToLower(lf.Content)
+			if !strings.Contains(strings.ToLower(i.Title), content) && !strings.Contains(strings.ToLower(i.Data), content) {
+				return false
+			}
+		} else if i.Title != lf.Content && i.Data != lf.Content {
+			return false
+		}
+	}
+	if len(lf.Deleted) > 0 && !boolsContain(lf.Deleted, i.Deleted()) {
+		return false
+	}
+	if len(lf.Private) > 0 && !boolsContain(lf.Private, i.Private()) {
+		return false
+	}
+	if len(lf.IRI) > 0 && !strings.Contains(itemID(&i), lf.IRI) {
+		return false
+	}
+	if len(lf.URL) > 0 && (!i.IsLink() || !linkDomainMatches(i.Data, lf.URL)) {
+		return false
+	}
+	if len(lf.Link) > 0 && (!i.IsLink() || !linkPathMatches(i.Data, lf.Link)) {
+		return false
+	}
+	if len(lf.FollowedBy) > 0 {
+		// NOTE(marius): like the FedBOX inbox, we show items from the followed accounts, the ones they shared
+		//  and items addressed to us
+		found := i.SubmittedBy.IsValid() && following.Contains(i.SubmittedBy.Hash)
+		found = found || m.sharedBy(i, following) != nil
+		if !found && i.HasMetadata() {
+			for _, rec := range append(i.Metadata.To, i.Metadata.CC...) {
+				found = found || (rec.IsValid() && hashMatches(Hash(lf.FollowedBy), rec.Hash, accountID(rec)))
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(lf.InReplyTo) > 0 {
+		found := false
+		for _, par := range lf.InReplyTo {
+			if par == "" {
+				found = found || !i.Parent.IsValid()
+				continue
+			}
+			found = found || (i.Parent.IsValid() && hashMatches(Hash(par), i.Parent.Hash, itemID(i.Parent)))
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(lf.Federated) > 0 && !boolsContain(lf.Federated, i.IsFederated()) {
+		return false
+	}
+	if len(f.Type) > 0 && !f.Type.Contains(loadAPItem(i).GetType()) {
+		return false
+	}
+	return true
+}
+
+// loadItem replaces the account stubs of the item with the accounts we have stored
+func (m *memRepository) loadItem(i Item, withVotes bool) Item {
+	i.SubmittedBy = m.loadAccount(i.SubmittedBy)
+	if i.UpdatedBy.IsValid() {
+		i.UpdatedBy = m.loadAccount(i.UpdatedBy)
+	}
+	if i.HasMetadata() {
+		md := *i.Metadata
+		md.To = make([]*Account, 0, len(i.Metadata.To))
+		for _, to := range i.Metadata.To {
+			md.To = append(md.To, m.loadAccount(to))
+		}
+		md.CC = make([]*Account, 0, len(i.Metadata.CC))
+		for _, cc := range i.Metadata.CC {
+			md.CC = append(md.CC, m.loadAccount(cc))
+		}
+		i.Metadata = &md
+	}
+	if withVotes {
+		for _, v := range m.votes {
+			if HashesEqual(v.Item.Hash, i.Hash) {
+				i.AddVote(v)
+			}
+		}
+	}
+	for _, sh := range m.shares {
+		if HashesEqual(sh.Item, i.Hash) {
+			i.Shares++
+		}
+	}
+	return i
+}
+
+// sharedBy returns the most recent of the accounts which shared the it item
+func (m *memRepository) sharedBy(it Item, accounts Hashes) *Account {
+	var last *itemShare
+	for k, sh := range m.shares {
+		if !HashesEqual(sh.Item, it.Hash) || !accounts.Contains(sh.SubmittedBy.Hash) {
+			continue
+		}
+		if last == nil || sh.SubmittedAt.After(last.SubmittedAt) {
+			last = &m.shares[k]
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return m.loadAccount(last.SubmittedBy)
+}
+
+func (m *memRepository) LoadItem(f Filters) (Item, error) {
+	if len(f.LoadItemsFilter.Key) == 0 {
+		return Item{}, errors.Newf("invalid item hash")
+	}
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	k := m.itemIndex(f.LoadItemsFilter.Key[0])
+	if k < 0 {
+		return Item{}, errors.NotFoundf("item %s", f.LoadItemsFilter.Key[0])
+	}
+	return m.loadItem(m.items[k], true), nil
+}
+
+func (m *memRepository) LoadItems(f Filters) (ItemCollection, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	var following Hashes
+	if len(f.FollowedBy) > 0 {
+		following = m.following(Hash(f.FollowedBy))
+	}
+	items := make(ItemCollection, 0)
+	for _, it := range m.items {
+		if m.itemMatches(it, f, following) {
+			i := m.loadItem(it, Instance.Config.VotingEnabled)
+			if len(f.FollowedBy) > 0 && !following.Contains(i.SubmittedBy.Hash) {
+				i.SharedBy = m.sharedBy(i, following)
+			}
+			items = append(items, i)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].SubmittedAt.After(items[j].SubmittedAt)
+	})
+	start, end := pageBounds(f, len(items))
+	return items[start:end], uint(len(items)), nil
+}
+
+// LoadMessages loads the private items submitted by acc, or addressed to them, the newest first
+func (m *memRepository) LoadMessages(acc Account, f Filters) (ItemCollection, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	items := make(ItemCollection, 0)
+	for _, it := range m.items {
+		if !it.Private() || it.Deleted() || !isMessageParticipant(&acc, it) {
+			continue
+		}
+		items = append(items, m.loadItem(it, false))
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].SubmittedAt.After(items[j].SubmittedAt)
+	})
+	start, end := pageBounds(f, len(items))
+	return items[start:end], uint(len(items)), nil
+}
+
+// LoadReadMessages loads the hashes of the private items acc has read
+func (m *memRepository) LoadReadMessages(acc Account) (Hashes, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	read := make(Hashes, 0)
+	return append(read, m.read[acc.Hash.String()]...), nil
+}
+
+// MarkMessagesRead marks the items as read by acc
+func (m *memRepository) MarkMessagesRead(acc Account, items ...Item) error {
+	if !acc.IsValid() {
+		return errors.Newf("invalid account")
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	read := m.read[acc.Hash.String()]
+	for _, it := range items {
+		if !read.Contains(it.Hash) {
+			read = append(read, it.Hash)
+		}
+	}
+	m.read[acc.Hash.String()] = read
+	return nil
+}
+
+// SaveItem saves the item and updates its entry of the search index
+func (m *memRepository) SaveItem(it Item) (Item, error) {
+	it, err := m.saveItem(it)
+	if err != nil {
+		return it, err
+	}
+	// NOTE(marius): the item was saved, failing to index it shouldn't fail the request
+	updateIndex(m.index, it)
+	return it, nil
+}
+
+func (m *memRepository) saveItem(it Item) (Item, error) {
+	if !it.SubmittedBy.IsValid() || !it.SubmittedBy.HasMetadata() {
+		return Item{}, errors.Newf("Invalid item submitter")
+	}
+	if !accountValidForC2S(it.SubmittedBy) {
+		return it, errors.Unauthorizedf("invalid account %s", it.SubmittedBy.Handle)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	now := time.Now().UTC()
+	k := m.itemIndex(it.Hash)
+	if len(it.Hash) > 0 && k < 0 {
+		return it, errors.NotFoundf("item %s", it.Hash)
+	}
+	if it.Deleted() {
+		if k < 0 {
+			return it, errors.NotFoundf("item hash is empty, can not delete")
+		}
+		old := m.items[k]
+		// NOTE(marius): this mimics what a Tombstone loaded from FedBOX contains
+		m.items[k] = Item{
+			Hash:        old.Hash,
+			Flags:       FlagsDeleted,
+			SubmittedAt: old.SubmittedAt,
+			SubmittedBy: &AnonymousAccount,
+			UpdatedAt:   now,
+			Metadata:    &ItemMetadata{ID: itemID(&old)},
+			Parent:      old.Parent,
+			OP:          old.OP,
+		}
+		return m.loadItem(m.items[k], true), nil
+	}
+
+	md := ItemMetadata{}
+	if it.HasMetadata() {
+		md = *it.Metadata
+	}
+	md.To = accountStubs(md.To)
+	md.CC = accountStubs(md.CC)
+	if len(md.Mentions) > 0 {
+		for _, men := range md.Mentions {
+			if !isLocalMention(men) {
+				continue
+			}
+			for _, a := range m.accounts {
+				if a.Handle == men.Name {
+					md.CC = append(md.CC, accountStub(&a))
+				}
+			}
+		}
+	}
+
+	if k >= 0 {
+		old := m.items[k]
+		old.Title = it.Title
+		old.Data = it.Data
+		old.MimeType = it.MimeType
+		old.UpdatedAt = now
+		old.UpdatedBy = accountStub(it.SubmittedBy)
+		md.ID = itemID(&old)
+		old.Metadata = &md
+		m.items[k] = old
+		return m.loadItem(old, true), nil
+	}
+
+	it.Hash = newHash()
+	md.ID = fmt.Sprintf("%s/%s", ObjectsURL, it.Hash)
+	it.Metadata = &md
+	it.SubmittedBy = accountStub(it.SubmittedBy)
+	if it.SubmittedAt.IsZero() {
+		it.SubmittedAt = now
+	}
+	it.UpdatedAt = it.SubmittedAt
+	if it.Parent.IsValid() {
+		if p := m.itemIndex(it.Parent.Hash); p >= 0 {
+			par := m.items[p]
+			it.Parent = itemStub(&par)
+			if par.OP.IsValid() {
+				it.OP = par.OP
+			} else {
+				it.OP = itemStub(&par)
+			}
+		}
+	}
+	if !it.OP.IsValid() && it.Parent.IsValid() {
+		it.OP = it.Parent
+	}
+	m.items = append(m.items, it)
+	return m.loadItem(it, true), nil
+}
+
+func (m *memRepository) LoadVotes(f Filters) (VoteCollection, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	lf := f.LoadVotesFilter
+	votes := make(VoteCollection, 0)
+	for _, v := range m.votes {
+		if len(lf.ItemKey) > 0 && !hashesMatch(lf.ItemKey, v.Item.Hash, itemID(v.Item)) {
+			continue
+		}
+		if len(lf.AttributedTo) > 0 && !hashesMatch(lf.AttributedTo, v.SubmittedBy.Hash, accountID(v.SubmittedBy)) {
+			continue
+		}
+		if len(lf.Type) > 0 {
+			if v.Weight > 0 && !lf.Type.Contains(pub.LikeType) {
+				continue
+			}
+			if v.Weight < 0 && !lf.Type.Contains(pub.DislikeType) {
+				continue
+			}
+		}
+		votes = append(votes, v)
+	}
+	start, end := pageBounds(f, len(votes))
+	return votes[start:end], uint(len(votes)), nil
+}
+
+func (m *memRepository) SaveVote(v Vote) (Vote, error) {
+	if !v.SubmittedBy.IsValid() || !v.SubmittedBy.HasMetadata() {
+		return Vote{}, errors.Newf("Invalid vote submitter")
+	}
+	if !v.Item.IsValid() || !v.Item.HasMetadata() {
+		return Vote{}, errors.Newf("Invalid vote item")
+	}
+	if !accountValidForC2S(v.SubmittedBy) {
+		return v, errors.Unauthorizedf("invalid account %s", v.SubmittedBy.Handle)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	weight := 0
+	if v.Weight > 0 {
+		weight = 1
+	}
+	if v.Weight < 0 {
+		weight = -1
+	}
+	for k, vot := range m.votes {
+		if !HashesEqual(vot.SubmittedBy.Hash, v.SubmittedBy.Hash) || !HashesEqual(vot.Item.Hash, v.Item.Hash) {
+			continue
+		}
+		m.votes = append(m.votes[:k], m.votes[k+1:]...)
+		if vot.Weight == weight {
+			// voting the same way twice undoes the existing vote
+			weight = 0
+		}
+		break
+	}
+
+	now := time.Now().UTC()
+	vot := Vote{
+		SubmittedBy: accountStub(v.SubmittedBy),
+		SubmittedAt: now,
+		UpdatedAt:   now,
+		Weight:      weight,
+		Item:        itemStub(v.Item),
+		Metadata: &VoteMetadata{
+			IRI: fmt.Sprintf("%s/activities/%s", BaseURL, newHash()),
+		},
+	}
+	if weight != 0 {
+		m.votes = append(m.votes, vot)
+	}
+	return vot, nil
+}
+
+// ShareItem stores the share of the it item by acc, sharing an item twice doesn't change anything
+func (m *memRepository) ShareItem(acc Account, it Item) error {
+	if !accountValidForC2S(&acc) {
+		return errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	if !it.IsValid() || it.Private() || it.Deleted() {
+		return errors.Newf("invalid item to share")
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.itemIndex(it.Hash) < 0 {
+		return errors.NotFoundf("item %s", it.Hash)
+	}
+	for _, sh := range m.shares {
+		if HashesEqual(sh.Item, it.Hash) && HashesEqual(sh.SubmittedBy.Hash, acc.Hash) {
+			return nil
+		}
+	}
+	m.shares = append(m.shares, itemShare{
+		Item:        it.Hash,
+		SubmittedBy: accountStub(&acc),
+		SubmittedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+func (m *memRepository) loadAccountRelations(a Account) Account {
+	a.Score = 0
+	for _, v := range m.votes {
+		if HashesEqual(v.SubmittedBy.Hash, a.Hash) {
+			a.Score += v.Weight
+		}
+	}
+	a.Followers = make(AccountCollection, 0)
+	a.Following = make(AccountCollection, 0)
+	for _, f := range m.follows {
+		if HashesEqual(f.Object.Hash, a.Hash) {
+			a.Followers = append(a.Followers, *m.loadAccount(f.SubmittedBy))
+		}
+		if HashesEqual(f.SubmittedBy.Hash, a.Hash) {
+			a.Following = append(a.Following, *m.loadAccount(f.Object))
+		}
+	}
+	return a
+}
+
+func (m *memRepository) LoadAccounts(f Filters) (AccountCollection, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	lf := f.LoadAccountsFilter
+	accounts := make(AccountCollection, 0)
+	for _, a := range m.accounts {
+		if len(lf.Key) > 0 && !hashesMatch(lf.Key, a.Hash, accountID(&a)) {
+			continue
+		}
+		if len(lf.Handle) > 0 {
+			found := false
+			for _, handle := range lf.Handle {
+				found = found || handle == a.Handle
+			}
+			if !found {
+				continue
+			}
+		}
+		if len(lf.Email) > 0 {
+			found := false
+			for _, email := range lf.Email {
+				found = found || email == a.Email
+			}
+			if !found {
+				continue
+			}
+		}
+		if len(lf.Deleted) > 0 && !boolsContain(lf.Deleted, a.Deleted()) {
+			continue
+		}
+		if len(lf.IRI) > 0 && !strings.Contains(accountID(&a), lf.IRI) {
+			continue
+		}
+		if len(lf.InboxIRI) > 0 && (!a.HasMetadata() || !strings.Contains(a.Metadata.InboxIRI, lf.InboxIRI)) {
+			continue
+		}
+		accounts = append(accounts, m.loadAccountRelations(a))
+	}
+	start, end := pageBounds(f, len(accounts))
+	return accounts[start:end], uint(len(accounts)), nil
+}
+
+func (m *memRepository) LoadAccount(f Filters) (Account, error) {
+	accounts, _, err := m.LoadAccounts(f)
+	if err != nil {
+		return AnonymousAccount, err
+	}
+	ac, err := accounts.First()
+	if err != nil {
+		var id string
+		if len(f.LoadAccountsFilter.Key) > 0 {
+			id = f.LoadAccountsFilter.Key[0].String()
+		}
+		if len(f.Handle) > 0 {
+			id = f.Handle[0]
+		}
+		return AnonymousAccount, errors.NotFoundf("account %s", id)
+	}
+	return *ac, nil
+}
+
+func (m *memRepository) SaveAccount(a Account) (Account, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	now := time.Now().UTC()
+	k := m.accountIndex(a.Hash)
+	if a.Deleted() {
+		if k < 0 {
+			return a, errors.NotFoundf("item hash is empty, can not delete")
+		}
+		m.accounts[k].Flags |= FlagsDeleted
+		m.accounts[k].UpdatedAt = now
+		return m.accounts[k], nil
+	}
+
+	md := AccountMetadata{}
+	if a.HasMetadata() {
+		md = *a.Metadata
+	}
+	pw := md.Password
+	// NOTE(marius): like FedBOX, we don't give out the password or the OAuth2 credentials
+	md.Password = nil
+	md.Salt = nil
+	md.OAuth = OAuth{}
+	a.Metadata = &md
+	a.Votes = nil
+	a.Followers = nil
+	a.Following = nil
+	a.Blocked = nil
+	a.CreatedBy = accountStub(a.CreatedBy)
+	a.UpdatedAt = now
+
+	if k >= 0 {
+		a.Hash = m.accounts[k].Hash
+		a.CreatedAt = m.accounts[k].CreatedAt
+		md.ID = accountID(&m.accounts[k])
+		m.accounts[k] = a
+		return a, m.setPassword(a, pw)
+	}
+
+	a.Hash = newHash()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = now
+	}
+	md.ID = fmt.Sprintf("%s/%s", ActorsURL, a.Hash)
+	md.InboxIRI = fmt.Sprintf("%s/inbox", md.ID)
+	md.OutboxIRI = fmt.Sprintf("%s/outbox", md.ID)
+	md.LikedIRI = fmt.Sprintf("%s/liked", md.ID)
+	md.FollowersIRI = fmt.Sprintf("%s/followers", md.ID)
+	md.FollowingIRI = fmt.Sprintf("%s/following", md.ID)
+	m.accounts = append(m.accounts, a)
+	return a, m.setPassword(a, pw)
+}
+
+// memPassword is the key derived from the password of an account, with the salt used for deriving it
+type memPassword struct {
+	key  []byte
+	salt []byte
+}
+
+// setPassword keeps the key derived from the password of the account, an empty password leaves the current one
+func (m *memRepository) setPassword(a Account, pw []byte) error {
+	if len(pw) == 0 {
+		return nil
+	}
+	salt := make([]byte, pwSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.Annotatef(err, "unable to save the password of account %s", a.Handle)
+	}
+	m.passwords[a.Hash.String()] = memPassword{key: passwordKey(pw, salt), salt: salt}
+	return nil
+}
+
+// Authenticate checks the password of the account
+func (m *memRepository) Authenticate(a Account, pw string) error {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	if m.accountIndex(a.Hash) < 0 {
+		return errors.NotFoundf("account %s", a.Handle)
+	}
+	p, ok := m.passwords[a.Hash.String()]
+	if !ok || !hmac.Equal(passwordKey([]byte(pw), p.salt), p.key) {
+		return errors.Unauthorizedf("invalid password for account %s", a.Handle)
+	}
+	return nil
+}
+
+func (m *memRepository) LoadFollowRequests(ed *Account, f Filters) (FollowRequests, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	lf := f.LoadFollowRequestsFilter
+	requests := make(FollowRequests, 0)
+	for _, req := range m.requests {
+		if ed != nil && !HashesEqual(req.Object.Hash, ed.Hash) {
+			continue
+		}
+		if len(lf.Key) > 0 && !hashesMatch(lf.Key, req.Hash, req.Metadata.ID) {
+			continue
+		}
+		if len(lf.Actor) > 0 && !hashesMatch(lf.Actor, req.SubmittedBy.Hash, accountID(req.SubmittedBy)) {
+			continue
+		}
+		if len(lf.On) > 0 && !hashesMatch(lf.On, req.Object.Hash, accountID(req.Object)) {
+			continue
+		}
+		req.SubmittedBy = m.loadAccount(req.SubmittedBy)
+		req.Object = m.loadAccount(req.Object)
+		requests = append(requests, req)
+	}
+	return requests, uint(len(requests)), nil
+}
+
+func (m *memRepository) FollowAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	if !ed.IsValid() {
+		return errors.Newf("invalid account to follow")
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	for _, f := range append(m.requests, m.follows...) {
+		if HashesEqual(f.SubmittedBy.Hash, er.Hash) && HashesEqual(f.Object.Hash, ed.Hash) {
+			return nil
+		}
+	}
+	h := newHash()
+	m.requests = append(m.requests, FollowRequest{
+		Hash:        h,
+		SubmittedAt: time.Now().UTC(),
+		SubmittedBy: accountStub(&er),
+		Object:      accountStub(&ed),
+		Metadata: &FollowMetadata{
+			ID: fmt.Sprintf("%s/activities/%s", BaseURL, h),
+		},
+	})
+	return nil
+}
+
+func (m *memRepository) SendFollowResponse(f FollowRequest, accept bool) error {
+	if !accountValidForC2S(f.Object) {
+		return errors.Unauthorizedf("invalid account %s", f.Object.Handle)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	for k, req := range m.requests {
+		if !HashesEqual(req.Hash, f.Hash) {
+			continue
+		}
+		m.requests = append(m.requests[:k], m.requests[k+1:]...)
+		if accept {
+			m.follows = append(m.follows, req)
+		}
+		return nil
+	}
+	return errors.NotFoundf("follow request %s", f.Hash)
+}
+
+// UnfollowAccount removes the follow of ed by er, or the follow request if ed didn't respond yet
+func (m *memRepository) UnfollowAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	var requested, followed bool
+	m.requests, requested = removeFollows(m.requests, er, ed)
+	m.follows, followed = removeFollows(m.follows, er, ed)
+	if !requested && !followed {
+		return errors.NotFoundf("account %s is not followed by %s", ed.Handle, er.Handle)
+	}
+	return nil
+}
+
+// removeFollows returns the follows without the ones of ed by er, and if any were found
+func removeFollows(follows FollowRequests, er, ed Account) (FollowRequests, bool) {
+	kept := make(FollowRequests, 0, len(follows))
+	for _, f := range follows {
+		if HashesEqual(f.SubmittedBy.Hash, er.Hash) && HashesEqual(f.Object.Hash, ed.Hash) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, len(kept) != len(follows)
+}
+
+// LoadBlockedAccounts returns the accounts blocked by er, the blocks are kept as actor/object pairs, like the follows
+func (m *memRepository) LoadBlockedAccounts(er Account) (AccountCollection, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	blocked := make(AccountCollection, 0)
+	for _, b := range m.blocks {
+		if HashesEqual(b.SubmittedBy.Hash, er.Hash) {
+			blocked = append(blocked, *m.loadAccount(b.Object))
+		}
+	}
+	return blocked, uint(len(blocked)), nil
+}
+
+// BlockAccount blocks ed for er, which also removes ed from er's followers
+func (m *memRepository) BlockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	if !ed.IsValid() || HashesEqual(er.Hash, ed.Hash) {
+		return errors.Newf("invalid account to block")
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.requests, _ = removeFollows(m.requests, ed, er)
+	m.follows, _ = removeFollows(m.follows, ed, er)
+	for _, b := range m.blocks {
+		if HashesEqual(b.SubmittedBy.Hash, er.Hash) && HashesEqual(b.Object.Hash, ed.Hash) {
+			return nil
+		}
+	}
+	h := newHash()
+	m.blocks = append(m.blocks, FollowRequest{
+		Hash:        h,
+		SubmittedAt: time.Now().UTC(),
+		SubmittedBy: accountStub(&er),
+		Object:      accountStub(&ed),
+		Metadata: &FollowMetadata{
+			ID: fmt.Sprintf("%s/activities/%s", BaseURL, h),
+		},
+	})
+	return nil
+}
+
+func (m *memRepository) UnblockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	var found bool
+	if m.blocks, found = removeFollows(m.blocks, er, ed); !found {
+		return errors.NotFoundf("account %s is not blocked by %s", ed.Handle, er.Handle)
+	}
+	return nil
+}
+
+func (m *memRepository) LoadReports(f Filters) (ItemReports, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	lf := f.LoadReportsFilter
+	reports := make(ItemReports, 0)
+	for i := len(m.reports) - 1; i >= 0; i-- {
+		rep := m.reports[i]
+		// NOTE(marius): forwarded reports are delivered to other instances, they don't show up in our queue
+		if rep.Forward {
+			continue
+		}
+		if len(lf.Key) > 0 && !hashesMatch(lf.Key, rep.Hash, rep.Metadata.ID) {
+			continue
+		}
+		if len(lf.Actor) > 0 && (rep.SubmittedBy == nil || !hashesMatch(lf.Actor, rep.SubmittedBy.Hash, accountID(rep.SubmittedBy))) {
+			continue
+		}
+		if len(lf.On) > 0 && (rep.Item == nil || !hashesMatch(lf.On, rep.Item.Hash, itemID(rep.Item))) {
+			continue
+		}
+		rep.SubmittedBy = m.loadAccount(rep.SubmittedBy)
+		if rep.Item != nil {
+			if k := m.itemIndex(rep.Item.Hash); k >= 0 {
+				it := m.loadItem(m.items[k], true)
+				rep.Item = &it
+			}
+		}
+		reports = append(reports, rep)
+	}
+	start, end := pageBounds(f, len(reports))
+	return reports[start:end], uint(len(reports)), nil
+}
+
+func (m *memRepository) SaveReport(rep ItemReport) (ItemReport, error) {
+	if !accountValidForC2S(rep.SubmittedBy) {
+		return rep, errors.Unauthorizedf("invalid account %s", rep.SubmittedBy.Handle)
+	}
+	if !rep.Item.IsValid() {
+		return rep, errors.Newf("Invalid reported item")
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.itemIndex(rep.Item.Hash) < 0 {
+		return rep, errors.NotFoundf("item %s", rep.Item.Hash)
+	}
+	rep.Hash = newHash()
+	rep.SubmittedAt = time.Now().UTC()
+	rep.SubmittedBy = accountStub(rep.SubmittedBy)
+	rep.Item = itemStub(rep.Item)
+	rep.Metadata = &ReportMetadata{
+		ID: fmt.Sprintf("%s/activities/%s", BaseURL, rep.Hash),
+	}
+	m.reports = append(m.reports, rep)
+	return rep, nil
+}
+
+// moderationType returns the type of the activity FedBOX uses for recording the moderation action
+func moderationType(a ModerationAction) pub.ActivityVocabularyType {
+	switch a {
+	case ModerationDelete:
+		return pub.DeleteType
+	case ModerationDismiss:
+		return pub.IgnoreType
+	case ModerationSuspend:
+		return pub.BlockType
+	}
+	return ""
+}
+
+func (m *memRepository) LoadModerations(f Filters) (ModerationOps, uint, error) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	lf := f.LoadReportsFilter
+	ops := make(ModerationOps, 0)
+	for i := len(m.ops) - 1; i >= 0; i-- {
+		op := m.ops[i]
+		if len(f.Type) > 0 && !f.Type.Contains(moderationType(op.Action)) {
+			continue
+		}
+		if len(lf.Key) > 0 && !hashesMatch(lf.Key, op.Hash, op.Metadata.ID) {
+			continue
+		}
+		if len(lf.Actor) > 0 && !hashesMatch(lf.Actor, op.SubmittedBy.Hash, accountID(op.SubmittedBy)) {
+			continue
+		}
+		if len(lf.On) > 0 {
+			var key Hash
+			var iri string
+			switch op.Action {
+			case ModerationDelete:
+				key, iri = op.Item.Hash, itemID(op.Item)
+			case ModerationDismiss:
+				key, iri = op.Report.Hash, op.Report.Metadata.ID
+			case ModerationSuspend:
+				key, iri = op.Account.Hash, accountID(op.Account)
+			}
+			if !hashesMatch(lf.On, key, iri) {
+				continue
+			}
+		}
+		ops = append(ops, op)
+	}
+	start, end := pageBounds(f, len(ops))
+	return ops[start:end], uint(len(ops)), nil
+}
+
+func (m *memRepository) SaveModeration(op ModerationOp) (ModerationOp, error) {
+	if !accountValidForC2S(op.SubmittedBy) {
+		return op, errors.Unauthorizedf("invalid account %s", op.SubmittedBy.Handle)
+	}
+	switch op.Action {
+	case ModerationDelete:
+		if !op.Item.IsValid() {
+			return op, errors.Newf("Invalid item to delete")
+		}
+		it := *op.Item
+		it.SubmittedBy = op.SubmittedBy
+		it.Delete()
+		if _, err := m.SaveItem(it); err != nil {
+			return op, err
+		}
+		op.Item = itemStub(op.Item)
+	case ModerationDismiss:
+		if !op.Report.HasMetadata() {
+			return op, errors.Newf("Invalid report")
+		}
+	case ModerationSuspend:
+		if !op.Report.HasMetadata() {
+			return op, errors.Newf("Invalid report")
+		}
+		if !op.Account.IsValid() {
+			return op, errors.Newf("Invalid account to suspend")
+		}
+		op.Account = accountStub(op.Account)
+	default:
+		return op, errors.NotValidf("invalid moderation action %q", op.Action)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	op.Hash = newHash()
+	op.SubmittedAt = time.Now().UTC()
+	op.SubmittedBy = accountStub(op.SubmittedBy)
+	op.Moderator = accountStub(op.Moderator)
+	if op.Report != nil {
+		op.Report = &ItemReport{Hash: op.Report.Hash, Metadata: op.Report.Metadata}
+	}
+	op.Metadata = &ModerationMetadata{
+		ID: fmt.Sprintf("%s/activities/%s", BaseURL, op.Hash),
+	}
+	m.ops = append(m.ops, op)
+	return op, nil
+}
+
+func (m *memRepository) WithAccount(a *Account) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.account = a
+	return nil
+}
+
+func (m *memRepository) LoadInfo() (WebInfo, error) {
+	return Instance.NodeInfo(), nil
+}
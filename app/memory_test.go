@@ -0,0 +1,342 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+func Test_memRepository_Conformance(t *testing.T) {
+	testRepositoryConformance(t, func(*testing.T) (Repository, func()) {
+		return InMemoryService(appConfig{}), func() {}
+	})
+}
+
+func Test_loadItems(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	it := mockItem(t, repo, Item{Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+	repo.SaveVote(Vote{SubmittedBy: &jane, Item: &it, Weight: 1})
+
+	ctx := context.WithValue(context.Background(), RepositoryCtxtKey, Repository(repo))
+	comments, err := loadItems(ctx, Filters{}, &jane, log.Dev(log.PanicLevel))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(comments) != 1 {
+		t.Fatalf("Items count must be %d, received %d", 1, len(comments))
+	}
+	if v := jane.VotedOn(comments[0].Item); !isYay(v) {
+		t.Errorf("Account %s must have voted on %s", jane.Handle, it.Hash)
+	}
+}
+
+func Test_loadItems_Blocked(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	mockItem(t, repo, Item{Data: "by jane", MimeType: MimeTypeText, SubmittedBy: &jane})
+	mockItem(t, repo, Item{Data: "by john", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	jane.Blocked = AccountCollection{john}
+	ctx := context.WithValue(context.Background(), RepositoryCtxtKey, Repository(repo))
+	comments, err := loadItems(ctx, Filters{}, &jane, log.Dev(log.PanicLevel))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(comments) != 1 || comments[0].Data != "by jane" {
+		t.Errorf("the items of the accounts blocked by %s must not be loaded", jane.Handle)
+	}
+}
+
+func Test_HandleSubmit(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+
+	h := mockHandler(repo)
+
+	form := url.Values{}
+	form.Set("title", "Test submission")
+	form.Set("data", "Lorem ipsum")
+	form.Set("mime-type", string(MimeTypeText))
+	r := mockFormRequest(http.MethodPost, "/submit", form)
+
+	w := httptest.NewRecorder()
+	h.HandleSubmit(w, withHandlerContext(r, repo, &jane))
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Status must be %d, received %d", http.StatusSeeOther, w.Code)
+	}
+	items, _, _ := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{AttributedTo: Hashes{jane.Hash}}})
+	it, err := items.First()
+	if err != nil {
+		t.Fatalf("submitted item was not saved")
+	}
+	if loc := w.Header().Get("Location"); loc != ItemPermaLink(*it) {
+		t.Errorf("Redirect location must be %q, received %q", ItemPermaLink(*it), loc)
+	}
+	if votes, _, _ := repo.LoadVotes(Filters{LoadVotesFilter: LoadVotesFilter{ItemKey: Hashes{it.Hash}}}); len(votes) != 1 {
+		t.Errorf("Submitted item must have the author's vote")
+	}
+}
+
+func Test_HandleSubmit_Conversation(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+
+	msg := Item{
+		Data:        "hello",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &jane,
+		SubmittedAt: time.Now().UTC(),
+		Metadata:    &ItemMetadata{To: []*Account{&john, &bob}},
+	}
+	msg.MakePrivate()
+	msg = mockItem(t, repo, msg)
+	key := conversationKey(messageParticipants(msg))
+
+	h := mockHandler(repo)
+	h.v.unread = new(unreadCounts)
+	if cnt := h.v.unread.load(repo, &bob); cnt != 1 {
+		t.Fatalf("Unread messages count of %s must be %d, received %d", bob.Handle, 1, cnt)
+	}
+	form := url.Values{}
+	form.Set("data", "hello to you too")
+	form.Set("mime-type", string(MimeTypeText))
+	form.Set("parent", msg.Hash.String())
+	r := mockFormRequest(http.MethodPost, "/messages/"+key, form)
+
+	w := httptest.NewRecorder()
+	h.HandleSubmit(w, withHandlerContext(r, repo, &john, "key", key))
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Status must be %d, received %d", http.StatusSeeOther, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/messages/"+key {
+		t.Errorf("Redirect location must be %q, received %q", "/messages/"+key, loc)
+	}
+	items, _, _ := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{AttributedTo: Hashes{john.Hash}}})
+	reply, err := items.First()
+	if err != nil {
+		t.Fatalf("the reply was not saved")
+	}
+	if !reply.Private() {
+		t.Errorf("the reply to a private message must be private")
+	}
+	if key != conversationKey(messageParticipants(*reply)) {
+		t.Errorf("the reply must be addressed to the participants of the conversation, received %v", reply.Metadata.To)
+	}
+	if cnt := h.v.unread.load(repo, &bob); cnt != 2 {
+		t.Errorf("Unread messages count of %s must be %d, received %d", bob.Handle, 2, cnt)
+	}
+}
+
+func Test_unreadCounts(t *testing.T) {
+	mem := InMemoryService(appConfig{})
+	jane := mockAccount(t, mem, "jane")
+	john := mockAccount(t, mem, "john")
+	msg := Item{Data: "hello", MimeType: MimeTypeText, SubmittedBy: &jane, Metadata: &ItemMetadata{To: []*Account{&john}}}
+	msg.MakePrivate()
+	msg = mockItem(t, mem, msg)
+
+	repo := &countingRepository{Repository: mem}
+	unread := new(unreadCounts)
+	for i := 0; i < 3; i++ {
+		if cnt := unread.load(repo, &john); cnt != 1 {
+			t.Errorf("Unread messages count of %s must be %d, received %d", john.Handle, 1, cnt)
+		}
+	}
+	if repo.messageLoads != 1 {
+		t.Errorf("Messages must be loaded %d time while the count is current, received %d", 1, repo.messageLoads)
+	}
+	if err := mem.MarkMessagesRead(john, msg); err != nil {
+		t.Fatalf("unable to mark the message as read: %s", err)
+	}
+	unread.forget(john)
+	if cnt := unread.load(repo, &john); cnt != 0 {
+		t.Errorf("Unread messages count of %s must be %d after reading it, received %d", john.Handle, 0, cnt)
+	}
+}
+
+func Test_HandleModeration(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	instance := mockAccount(t, repo, "instance")
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+
+	// the item of the report is not in storage anymore, so it doesn't get loaded with its author
+	anonymous := Item{Hash: newHash(), Title: "no author", Data: "lorem ipsum", MimeType: MimeTypeText}
+	repo.reports = append(repo.reports,
+		ItemReport{Hash: newHash(), SubmittedBy: &john, Reason: ReasonSpam, Metadata: &ReportMetadata{ID: "missing-item"}},
+		ItemReport{Hash: newHash(), SubmittedBy: &john, Item: &anonymous, Reason: ReasonSpam, Metadata: &ReportMetadata{ID: "missing-author"}},
+	)
+	missingItem, missingAuthor := repo.reports[0], repo.reports[1]
+
+	h := mockHandler(repo)
+	h.app = &instance
+	tests := []struct {
+		name   string
+		hash   Hash
+		action string
+		status int
+		saved  bool
+	}{
+		{name: "invalid action", hash: missingAuthor.Hash, action: "ban", status: http.StatusFound},
+		{name: "delete missing item", hash: missingItem.Hash, action: "delete", status: http.StatusFound},
+		{name: "suspend missing author", hash: missingAuthor.Hash, action: "suspend", status: http.StatusFound},
+		{name: "dismiss missing item", hash: missingItem.Hash, action: "dismiss", status: http.StatusSeeOther, saved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(repo.ops)
+			r := mockFormRequest(http.MethodPost, "/mod/"+tt.hash.String()+"/"+tt.action, nil)
+
+			w := httptest.NewRecorder()
+			h.HandleModeration(w, withHandlerContext(r, repo, &jane, "hash", tt.hash.String(), "action", tt.action))
+
+			if w.Code != tt.status {
+				t.Errorf("Status must be %d, received %d", tt.status, w.Code)
+			}
+			if saved := len(repo.ops) > before; saved != tt.saved {
+				t.Errorf("Moderation saved must be %t, received %t", tt.saved, saved)
+			}
+		})
+	}
+}
+
+func Test_HandleReport_Private(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	bob := mockAccount(t, repo, "bob")
+
+	msg := Item{Data: "secret", MimeType: MimeTypeText, SubmittedBy: &jane, Metadata: &ItemMetadata{To: []*Account{&john}}}
+	msg.MakePrivate()
+	msg = mockItem(t, repo, msg)
+
+	h := mockHandler(repo)
+	request := func(method string, acc *Account) *http.Request {
+		form := url.Values{}
+		form.Set("reason", string(ReasonSpam))
+		r := mockFormRequest(method, ItemPermaLink(msg)+"/bad", form)
+		return withHandlerContext(r, repo, acc, "hash", msg.Hash.String())
+	}
+
+	w := httptest.NewRecorder()
+	h.ShowReport(w, request(http.MethodGet, &bob))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status of the report form for a message %s doesn't participate in must be %d, received %d", bob.Handle, http.StatusNotFound, w.Code)
+	}
+
+	h.HandleReport(httptest.NewRecorder(), request(http.MethodPost, &bob))
+	if len(repo.reports) != 0 {
+		t.Errorf("%s must not be able to report a message they don't participate in", bob.Handle)
+	}
+	h.HandleReport(httptest.NewRecorder(), request(http.MethodPost, &john))
+	if len(repo.reports) != 1 {
+		t.Errorf("%s must be able to report a message they participate in", john.Handle)
+	}
+}
+
+func Test_memRepository_Authenticate(t *testing.T) {
+	repo := InMemoryService(appConfig{})
+	h := mockHandler(repo)
+	noop := func(string, log.Ctx) {}
+	h.v, _ = ViewInit(appConfig{SessionKeys: [][]byte{[]byte("0123456789abcdef")}}, noop, noop)
+
+	form := url.Values{}
+	form.Set("handle", "jane")
+	form.Set("pw", "secret")
+	form.Set("pw-confirm", "secret")
+	h.HandleRegister(httptest.NewRecorder(), withHandlerContext(mockFormRequest(http.MethodPost, "/register", form), repo, nil))
+
+	jane, err := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Handle: []string{"jane"}}})
+	if err != nil {
+		t.Fatalf("the registered account was not saved: %s", err)
+	}
+	if len(jane.Metadata.Password) > 0 || len(jane.Metadata.Salt) > 0 {
+		t.Errorf("the password of the account must not be given out")
+	}
+	tests := map[string]struct {
+		pw     string
+		logged bool
+	}{
+		"valid":   {pw: "secret", logged: true},
+		"invalid": {pw: "wrong", logged: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{}
+			form.Set("handle", "jane")
+			form.Set("pw", tt.pw)
+			w := httptest.NewRecorder()
+			h.HandleLogin(w, mockFormRequest(http.MethodPost, "/login", form))
+
+			next := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range w.Result().Cookies() {
+				next.AddCookie(c)
+			}
+			s, _ := h.v.s.get(next)
+			if acc, ok := s.Values[SessionUserKey].(Account); ok != tt.logged || (ok && acc.Handle != "jane") {
+				t.Errorf("Session account must be present: %t, received %v", tt.logged, s.Values[SessionUserKey])
+			}
+		})
+	}
+}
+
+func Test_LoadSession_Suspended(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.SessionsEnabled = true
+
+	repo := InMemoryService(appConfig{})
+	instance := mockAccount(t, repo, "instance")
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	rep := ItemReport{Hash: newHash(), SubmittedBy: &john, Reason: ReasonSpam, Metadata: &ReportMetadata{ID: "report"}}
+	if _, err := repo.SaveModeration(ModerationOp{SubmittedBy: &instance, Action: ModerationSuspend, Account: &jane, Report: &rep}); err != nil {
+		t.Fatalf("unable to suspend %s: %s", jane.Handle, err)
+	}
+
+	h := mockHandler(repo)
+	h.app = &instance
+	h.suspended = new(suspensions)
+	noop := func(string, log.Ctx) {}
+	h.v, _ = ViewInit(appConfig{SessionKeys: [][]byte{[]byte("0123456789abcdef")}}, noop, noop)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, _ := h.v.s.get(r)
+	s.Values[SessionUserKey] = jane
+	w := httptest.NewRecorder()
+	h.v.s.save(w, r)
+
+	served := false
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served = true })
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.LoadSession(next).ServeHTTP(w, r)
+
+	if served || w.Code != http.StatusForbidden {
+		t.Errorf("Request of a suspended account must not be served, received status %d", w.Code)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	if s, _ := h.v.s.get(r); s.Values[SessionUserKey] != nil {
+		t.Errorf("Session of a suspended account must be cleared")
+	}
+	if suspended, ok := h.suspended.get(jane.Hash); !ok || !suspended {
+		t.Errorf("Suspension of %s must be cached", jane.Handle)
+	}
+}
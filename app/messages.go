@@ -0,0 +1,224 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conversation holds the private items exchanged by the same group of accounts
+type conversation struct {
+	Key          string
+	Participants AccountCollection
+	Messages     comments
+	unread       ItemCollection
+}
+
+// Unread returns the number of messages of the conversation which haven't been read yet
+func (c conversation) Unread() int {
+	return len(c.unread)
+}
+
+// UpdatedAt returns the time of the most recent message of the conversation
+func (c conversation) UpdatedAt() time.Time {
+	if len(c.Messages) == 0 {
+		return time.Time{}
+	}
+	return c.Messages[0].SubmittedAt
+}
+
+// Others returns the participants of the conversation besides the acc account
+func (c conversation) Others(acc *Account) AccountCollection {
+	others := make(AccountCollection, 0, len(c.Participants))
+	for _, p := range c.Participants {
+		if acc != nil && HashesEqual(p.Hash, acc.Hash) {
+			continue
+		}
+		others = append(others, p)
+	}
+	return others
+}
+
+// Threads returns the messages of the conversation arranged by the ones they reply to,
+// the threads and the replies in them in the order they were sent
+func (c conversation) Threads() comments {
+	all := make(comments, 0, len(c.Messages))
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		m := *c.Messages[i]
+		m.Parent = nil
+		m.Children = nil
+		all = append(all, &m)
+	}
+	threads := make(comments, 0)
+	for _, m := range all {
+		for _, par := range all {
+			if m.Item.Parent.IsValid() && HashesEqual(m.Item.Parent.Hash, par.Hash) {
+				m.Parent = par
+				par.Children = append(par.Children, m)
+				break
+			}
+		}
+		if m.Parent == nil {
+			threads = append(threads, m)
+		}
+	}
+	addLevelComments(threads)
+	return threads
+}
+
+// messageParticipants returns the author and the recipients of the it private item
+func messageParticipants(it Item) AccountCollection {
+	participants := make(AccountCollection, 0)
+	add := func(a *Account) {
+		if !a.IsValid() || accountInCollection(*a, participants) {
+			return
+		}
+		participants = append(participants, *a)
+	}
+	add(it.SubmittedBy)
+	if it.HasMetadata() {
+		for _, rec := range it.Metadata.To {
+			add(rec)
+		}
+		for _, rec := range it.Metadata.CC {
+			add(rec)
+		}
+	}
+	return participants
+}
+
+// isMessageParticipant checks if acc submitted the it private item, or if it was addressed to them
+func isMessageParticipant(acc *Account, it Item) bool {
+	return acc.IsValid() && accountInCollection(*acc, messageParticipants(it))
+}
+
+// conversationKey identifies the conversation between the participants, regardless of their order
+func conversationKey(participants AccountCollection) string {
+	hashes := make([]string, 0, len(participants))
+	for _, p := range participants {
+		hashes = append(hashes, p.Hash.String())
+	}
+	sort.Strings(hashes)
+	sum := sha1.Sum([]byte(strings.Join(hashes, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ConversationLink returns the link to the conversation the it private item is part of
+func ConversationLink(it Item) string {
+	return "/messages/" + conversationKey(messageParticipants(it))
+}
+
+// loadConversations groups the messages of acc by their participants, the conversations with the most recent
+// messages first. The messages which acc didn't submit and are missing from read count as unread.
+func loadConversations(messages ItemCollection, read Hashes, acc *Account) []*conversation {
+	sorted := make(ItemCollection, len(messages))
+	copy(sorted, messages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].SubmittedAt.After(sorted[j].SubmittedAt)
+	})
+
+	convs := make([]*conversation, 0)
+	byKey := make(map[string]*conversation)
+	for _, m := range loadComments(sorted).withoutBlocked(acc) {
+		if !m.Private() || m.Deleted() {
+			continue
+		}
+		participants := messageParticipants(m.Item)
+		key := conversationKey(participants)
+		c, ok := byKey[key]
+		if !ok {
+			c = &conversation{Key: key, Participants: participants}
+			byKey[key] = c
+			convs = append(convs, c)
+		}
+		c.Messages = append(c.Messages, m)
+		if !HashesEqual(m.SubmittedBy.Hash, acc.Hash) && !read.Contains(m.Hash) {
+			c.unread = append(c.unread, m.Item)
+		}
+	}
+	return convs
+}
+
+// loadAccountConversations loads the conversations of the acc account from the repo storage
+func loadAccountConversations(repo Repository, acc *Account) ([]*conversation, error) {
+	messages, _, err := repo.LoadMessages(*acc, Filters{})
+	if err != nil {
+		return nil, err
+	}
+	read, err := repo.LoadReadMessages(*acc)
+	if err != nil {
+		return nil, err
+	}
+	return loadConversations(messages, read, acc), nil
+}
+
+// unreadMessagesCount returns the number of messages addressed to acc which they haven't read yet
+func unreadMessagesCount(repo Repository, acc *Account) int {
+	convs, err := loadAccountConversations(repo, acc)
+	if err != nil {
+		return 0
+	}
+	cnt := 0
+	for _, c := range convs {
+		cnt += c.Unread()
+	}
+	return cnt
+}
+
+// unreadCountsTTL is how long we keep the number of unread messages of an account before loading it again
+const unreadCountsTTL = time.Minute
+
+// unreadCounts keeps the numbers of unread messages of the accounts, so we don't load all their messages
+// for the header menu of every page
+type unreadCounts struct {
+	mu       sync.RWMutex
+	accounts map[string]unreadCount
+}
+
+type unreadCount struct {
+	count   int
+	expires time.Time
+}
+
+// load returns the number of unread messages of acc, from the repo storage if we don't have a current one
+func (u *unreadCounts) load(repo Repository, acc *Account) int {
+	if u == nil {
+		return unreadMessagesCount(repo, acc)
+	}
+	u.mu.RLock()
+	c, ok := u.accounts[acc.Hash.String()]
+	u.mu.RUnlock()
+	now := time.Now()
+	if ok && now.Before(c.expires) {
+		return c.count
+	}
+	cnt := unreadMessagesCount(repo, acc)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.accounts == nil {
+		u.accounts = make(map[string]unreadCount)
+	}
+	for k, c := range u.accounts {
+		if now.After(c.expires) {
+			delete(u.accounts, k)
+		}
+	}
+	u.accounts[acc.Hash.String()] = unreadCount{count: cnt, expires: now.Add(unreadCountsTTL)}
+	return cnt
+}
+
+// forget removes the numbers of unread messages of the accounts, after they read or received messages
+func (u *unreadCounts) forget(accounts ...Account) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, a := range accounts {
+		delete(u.accounts, a.Hash.String())
+	}
+}
@@ -32,6 +32,106 @@ func (c contentModel) PrevPage() int {
 	return c.prevPage
 }
 
+type searchModel struct {
+	Title    string
+	Query    string
+	Total    int
+	Items    []HasType
+	nextPage int
+	prevPage int
+}
+
+func (s searchModel) NextPage() int {
+	return s.nextPage
+}
+
+func (s searchModel) PrevPage() int {
+	return s.prevPage
+}
+
+type archiveModel struct {
+	Title  string
+	Total  int
+	Months []archiveMonth
+}
+
+type followModel struct {
+	Title   string
+	Address string
+	Pending FollowRequests
+}
+
+type accountsModel struct {
+	Title    string
+	User     *Account
+	Accounts AccountCollection
+	Total    int
+	nextPage int
+	prevPage int
+}
+
+func (a accountsModel) NextPage() int {
+	return a.nextPage
+}
+
+func (a accountsModel) PrevPage() int {
+	return a.prevPage
+}
+
+type messagesModel struct {
+	Title         string
+	Conversations []*conversation
+	Total         int
+	nextPage      int
+	prevPage      int
+}
+
+func (m messagesModel) NextPage() int {
+	return m.nextPage
+}
+
+func (m messagesModel) PrevPage() int {
+	return m.prevPage
+}
+
+type conversationModel struct {
+	Title        string
+	Conversation conversation
+	Content      comment
+}
+
+type settingsModel struct {
+	Title   string
+	Blocked AccountCollection
+}
+
+type reportModel struct {
+	Title   string
+	Content comment
+	Reasons []ReportReason
+}
+
+type shareModel struct {
+	Title   string
+	Content comment
+}
+
+type moderationModel struct {
+	Title    string
+	Reports  ItemReports
+	Actions  ModerationOps
+	nextPage int
+	prevPage int
+}
+
+func (m moderationModel) NextPage() int {
+	return m.nextPage
+}
+
+func (m moderationModel) PrevPage() int {
+	return m.prevPage
+}
+
 type loginModel struct {
 	Title   string
 	Account Account
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+type ModerationAction string
+
+const (
+	ModerationDelete  = ModerationAction("delete")
+	ModerationDismiss = ModerationAction("dismiss")
+	ModerationSuspend = ModerationAction("suspend")
+)
+
+// ValidModerationActions are the actions a moderator can take on a report
+var ValidModerationActions = []ModerationAction{ModerationDelete, ModerationDismiss, ModerationSuspend}
+
+func (a ModerationAction) IsValid() bool {
+	for _, v := range ValidModerationActions {
+		if a == v {
+			return true
+		}
+	}
+	return false
+}
+
+type ModerationOps []ModerationOp
+
+// ModerationOp represents an action taken by a moderator on a report. It's submitted by the instance account
+// as a Delete of the reported item, an Ignore of the Flag activity for dismissing the report, or a Block of
+// the item's author, having the Flag activity as context, for suspending them.
+type ModerationOp struct {
+	Hash        Hash                `json:"hash"`
+	SubmittedAt time.Time           `json:"-"`
+	SubmittedBy *Account            `json:"-"`
+	Moderator   *Account            `json:"-"`
+	Action      ModerationAction    `json:"action"`
+	Report      *ItemReport         `json:"-"`
+	Item        *Item               `json:"-"`
+	Account     *Account            `json:"-"`
+	Metadata    *ModerationMetadata `json:"-"`
+}
+
+type ModerationMetadata struct {
+	ID string `json:"-"`
+}
+
+func (m ModerationOp) HasMetadata() bool {
+	return m.Metadata != nil
+}
+
+// Resolves checks if the moderation action resolved the rep report
+func (m ModerationOp) Resolves(rep ItemReport) bool {
+	if m.Report == nil || !rep.HasMetadata() {
+		return false
+	}
+	if m.Report.HasMetadata() && m.Report.Metadata.ID == rep.Metadata.ID {
+		return true
+	}
+	return HashesEqual(m.Report.Hash, rep.Hash)
+}
+
+func (m *ModerationOp) FromActivityPub(it pub.Item) error {
+	if m == nil {
+		return nil
+	}
+	if it == nil {
+		return errors.Newf("nil item received")
+	}
+	return pub.OnActivity(it, func(a *pub.Activity) error {
+		if a.Object == nil {
+			return errors.NotValidf("missing %s object", a.Type)
+		}
+		m.Hash.FromActivityPub(a)
+		m.SubmittedAt = a.Published
+		instance := Account{}
+		instance.FromActivityPub(a.Actor)
+		m.SubmittedBy = &instance
+		if a.AttributedTo != nil {
+			mod := Account{}
+			mod.FromActivityPub(a.AttributedTo)
+			m.Moderator = &mod
+		}
+		m.Metadata = &ModerationMetadata{
+			ID: string(a.ID),
+		}
+		switch a.Type {
+		case pub.DeleteType:
+			m.Action = ModerationDelete
+			it := Item{}
+			it.FromActivityPub(a.Object.GetLink())
+			m.Item = &it
+		case pub.IgnoreType:
+			m.Action = ModerationDismiss
+			rep := ItemReport{}
+			rep.FromActivityPub(a.Object.GetLink())
+			m.Report = &rep
+		case pub.BlockType:
+			m.Action = ModerationSuspend
+			acc := Account{}
+			acc.FromActivityPub(a.Object.GetLink())
+			m.Account = &acc
+		default:
+			return errors.NotValidf("%s is not a moderation activity", a.Type)
+		}
+		if a.Context != nil {
+			rep := ItemReport{}
+			rep.FromActivityPub(a.Context.GetLink())
+			m.Report = &rep
+		}
+		return nil
+	})
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	pub "github.com/go-ap/activitypub"
+)
+
+type Role string
+
+const (
+	RoleUser      = Role("user")
+	RoleModerator = Role("moderator")
+	RoleAdmin     = Role("admin")
+)
+
+// ValidRoles are the roles an account can have, in ascending order of their privileges
+var ValidRoles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+const (
+	ActionSubmit   = "submit"
+	ActionComment  = "comment"
+	ActionVote     = "vote"
+	ActionDownvote = "downvote"
+	ActionFollow   = "follow"
+	ActionShare    = "share"
+	ActionModerate = "moderate"
+	ActionAdmin    = "admin"
+)
+
+// RolePermissions maps the roles to the actions accounts having them are allowed to perform
+var RolePermissions = map[Role][]string{
+	RoleUser:      {ActionSubmit, ActionComment, ActionVote, ActionDownvote, ActionFollow, ActionShare},
+	RoleModerator: {ActionSubmit, ActionComment, ActionVote, ActionDownvote, ActionFollow, ActionShare, ActionModerate},
+	RoleAdmin:     {ActionSubmit, ActionComment, ActionVote, ActionDownvote, ActionFollow, ActionShare, ActionModerate, ActionAdmin},
+}
+
+// roleIRI identifies the tags the instance actor uses to store the roles of the local actors
+const roleIRI = pub.IRI("https://littr.me/ns#role")
+
+func (r Role) IsValid() bool {
+	return r.rank() >= 0
+}
+
+func (r Role) rank() int {
+	for k, v := range ValidRoles {
+		if r == v {
+			return k
+		}
+	}
+	return -1
+}
+
+// Can checks if the role allows the action
+func (r Role) Can(action string) bool {
+	for _, a := range RolePermissions[r] {
+		if a == action {
+			return actionEnabled(action)
+		}
+	}
+	return false
+}
+
+// actionEnabled checks if the instance configuration allows the action for everybody
+func actionEnabled(action string) bool {
+	switch action {
+	case ActionVote:
+		return Instance.Config.VotingEnabled
+	case ActionDownvote:
+		return Instance.Config.VotingEnabled && Instance.Config.DownvotingEnabled
+	case ActionFollow:
+		return Instance.Config.UserFollowingEnabled
+	}
+	return true
+}
+
+func hasHandle(handles []string, handle string) bool {
+	for _, h := range handles {
+		if h == handle {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRole returns the role of the account. The local accounts listed in the ADMINS and MODERATORS
+// environment variables get the corresponding role even if it's not stored on their actors.
+func (a *Account) GetRole() Role {
+	if !a.IsLogged() {
+		return ""
+	}
+	role := RoleUser
+	if a.Role.IsValid() {
+		role = a.Role
+	}
+	if !a.IsLocal() {
+		return role
+	}
+	if hasHandle(Instance.Config.Admins, a.Handle) {
+		return RoleAdmin
+	}
+	if hasHandle(Instance.Config.Moderators, a.Handle) && role.rank() < RoleModerator.rank() {
+		return RoleModerator
+	}
+	return role
+}
+
+// Can checks if the account is allowed to perform the action
+func (a *Account) Can(action string) bool {
+	if !a.IsLogged() {
+		// NOTE(marius): anonymous users can only submit content, and only if the instance allows it
+		return (action == ActionSubmit || action == ActionComment) && Instance.Config.AnonymousCommentingEnabled
+	}
+	return a.GetRole().Can(action)
+}
+
+// tag returns the tag the instance actor uses for storing the role of the actor
+func (r Role) tag(actor pub.IRI) pub.Item {
+	t := pub.ObjectNew(pub.ObjectType)
+	t.ID = pub.ID(roleIRI)
+	t.Name = pub.NaturalLanguageValuesNew()
+	t.Name.Set(pub.NilLangRef, string(r))
+	t.Context = actor
+	return t
+}
+
+// rolesFromTags loads the roles of the local actors from the tags of the instance actor.
+// NOTE(marius): the actors can update their own tags, so we don't trust any role they store themselves
+func rolesFromTags(tags pub.ItemCollection) map[pub.IRI]Role {
+	roles := make(map[pub.IRI]Role)
+	for _, t := range tags {
+		if t == nil || t.GetLink() != roleIRI {
+			continue
+		}
+		pub.OnObject(t, func(o *pub.Object) error {
+			if role := Role(o.Name.First().Value); role.IsValid() && o.Context != nil {
+				roles[o.Context.GetLink()] = role
+			}
+			return nil
+		})
+	}
+	return roles
+}
+
+// withRoleTag returns the tags of the instance actor with the role of the actor replaced
+func withRoleTag(tags pub.ItemCollection, actor pub.IRI, r Role) pub.ItemCollection {
+	result := make(pub.ItemCollection, 0, len(tags)+1)
+	for _, t := range tags {
+		if t == nil {
+			continue
+		}
+		if t.GetLink() == roleIRI {
+			var ctxt pub.IRI
+			pub.OnObject(t, func(o *pub.Object) error {
+				if o.Context != nil {
+					ctxt = o.Context.GetLink()
+				}
+				return nil
+			})
+			if ctxt == actor {
+				continue
+			}
+		}
+		result = append(result, t)
+	}
+	if r.IsValid() {
+		result = append(result, r.tag(actor))
+	}
+	return result
+}
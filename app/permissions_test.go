@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Account_Can(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+
+	Instance.Config = Configuration{
+		VotingEnabled:        true,
+		UserFollowingEnabled: true,
+		Moderators:           []string{"jane"},
+	}
+	anonymous := &Account{Handle: Anonymous, Hash: AnonymousHash}
+	user := &Account{Handle: "john", Hash: Hash("john"), CreatedAt: time.Now()}
+	moderator := &Account{Handle: "jane", Hash: Hash("jane"), CreatedAt: time.Now()}
+	admin := &Account{Handle: "joe", Hash: Hash("joe"), CreatedAt: time.Now(), Role: RoleAdmin}
+
+	tests := []struct {
+		acc     *Account
+		allowed []string
+		denied  []string
+	}{
+		{anonymous, nil, []string{ActionSubmit, ActionComment, ActionVote, ActionShare, ActionModerate}},
+		{user, []string{ActionSubmit, ActionComment, ActionVote, ActionFollow, ActionShare}, []string{ActionDownvote, ActionModerate, ActionAdmin}},
+		{moderator, []string{ActionSubmit, ActionModerate}, []string{ActionDownvote, ActionAdmin}},
+		{admin, []string{ActionVote, ActionModerate, ActionAdmin}, []string{ActionDownvote}},
+	}
+	for _, test := range tests {
+		for _, action := range test.allowed {
+			if !test.acc.Can(action) {
+				t.Errorf("Account %s must be allowed to %s", test.acc.Handle, action)
+			}
+		}
+		for _, action := range test.denied {
+			if test.acc.Can(action) {
+				t.Errorf("Account %s must not be allowed to %s", test.acc.Handle, action)
+			}
+		}
+	}
+
+	Instance.Config.AnonymousCommentingEnabled = true
+	if !anonymous.Can(ActionComment) {
+		t.Errorf("Anonymous account must be allowed to %s when the instance allows it", ActionComment)
+	}
+}
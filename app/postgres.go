@@ -0,0 +1,1497 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/lib/pq"
+	"github.com/mariusor/littr.go/internal/log"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	defaultPostgresPort = "5432"
+	// migrationsLockID is the key of the advisory lock held while applying the schema migrations,
+	// so multiple instances starting at the same time don't apply them twice
+	migrationsLockID = 0x6c69747472
+	pwSaltLength     = 16
+	pwKeyLength      = 32
+	// pwIterations is the PBKDF2 iteration count OWASP recommends for HMAC-SHA256
+	pwIterations = 600000
+)
+
+// postgresRepository is a Repository implementation backed by a PostgreSQL database.
+// It's used for running littr without a FedBOX instance, it loads the same results as the in memory
+// Repository, which mimics the FedBOX one, and it keeps the passwords of the accounts itself.
+type postgresRepository struct {
+	db      *sql.DB
+	index   Index
+	account *Account
+	infoFn  LogFn
+	errFn   LogFn
+}
+
+// postgresDSN returns the connection string for the database in the configuration.
+// The settings missing from it, like the SSL mode, are loaded by the driver from the PG* environment variables.
+func postgresDSN(c backendConfig) string {
+	host := c.Host
+	if len(host) == 0 {
+		host = "localhost"
+	}
+	port := c.Port
+	if len(port) == 0 {
+		port = defaultPostgresPort
+	}
+	dsn := []string{"host=" + dsnValue(host), "port=" + dsnValue(port)}
+	if len(c.User) > 0 {
+		dsn = append(dsn, "user="+dsnValue(c.User))
+	}
+	if len(c.Pw) > 0 {
+		dsn = append(dsn, "password="+dsnValue(c.Pw))
+	}
+	if len(c.Name) > 0 {
+		dsn = append(dsn, "dbname="+dsnValue(c.Name))
+	}
+	return strings.Join(dsn, " ")
+}
+
+func dsnValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// PostgresService returns a Repository for the database in the DB configuration, after applying
+// the schema migrations. The repository is returned even when the database can't be reached.
+func PostgresService(c appConfig) (*postgresRepository, error) {
+	if len(c.APIURL) > 0 {
+		setAPIURL(c.APIURL)
+	}
+	infoFn := func(s string, ctx log.Ctx) {}
+	errFn := func(s string, ctx log.Ctx) {}
+	if c.Logger != nil {
+		infoFn = func(s string, ctx log.Ctx) {
+			c.Logger.WithContext(ctx).Info(s)
+		}
+		errFn = func(s string, ctx log.Ctx) {
+			c.Logger.WithContext(ctx).Error(s)
+		}
+	}
+	return newPostgresRepository(postgresDSN(Instance.Config.DB), infoFn, errFn)
+}
+
+func newPostgresRepository(dsn string, infoFn, errFn LogFn) (*postgresRepository, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to open the database")
+	}
+	p := &postgresRepository{db: db, infoFn: infoFn, errFn: errFn}
+	return p, p.Migrate()
+}
+
+// Migrate applies the schema migrations which weren't applied yet
+func (p *postgresRepository) Migrate() error {
+	_, err := p.db.Exec(`CREATE TABLE IF NOT EXISTS "schema_migrations" (
+	"version" INT PRIMARY KEY,
+	"applied_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return errors.Annotatef(err, "unable to create the schema migrations table")
+	}
+	for k, m := range migrations {
+		if err := p.migrate(k+1, m); err != nil {
+			return errors.Annotatef(err, "unable to apply the schema migration %d", k+1)
+		}
+	}
+	return nil
+}
+
+func (p *postgresRepository) migrate(version int, m string) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+		return err
+	}
+	applied := false
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM "schema_migrations" WHERE "version" = $1)`, version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.Exec(m); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO "schema_migrations" ("version") VALUES ($1)`, version); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	p.infoFn("Applied schema migration", log.Ctx{"version": version})
+	return nil
+}
+
+// pgWhere joins the clauses returned by the GetWhereClauses methods of multiple filters
+type pgWhere struct {
+	clauses []string
+	values  []interface{}
+}
+
+func (w *pgWhere) add(clauses []string, values []interface{}) {
+	w.clauses = append(w.clauses, shiftPlaceholders(clauses, len(w.values))...)
+	w.values = append(w.values, values...)
+}
+
+// String returns the WHERE clause, with the ?N placeholders replaced by the PostgreSQL $N+1 ones
+func (w pgWhere) String() string {
+	if len(w.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + placeholderRe.ReplaceAllStringFunc(strings.Join(w.clauses, " AND "), func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		return fmt.Sprintf("$%d", n+1)
+	})
+}
+
+// typesClause matches the items having one of the ActivityPub types
+func typesClause(alias string, types pub.ActivityVocabularyTypes) ([]string, []interface{}) {
+	placeholders := make([]string, 0, len(types))
+	values := make([]interface{}, 0, len(types))
+	for k, typ := range types {
+		placeholders = append(placeholders, fmt.Sprintf("?%d", k))
+		values = append(values, string(typ))
+	}
+	return []string{fmt.Sprintf(`"%s"."type" IN (%s)`, alias, strings.Join(placeholders, ", "))}, values
+}
+
+// itemType returns the ActivityPub type of the object FedBOX stores for the item
+func itemType(it Item) string {
+	return string(loadAPItem(Item{MimeType: it.MimeType, Data: it.Data, Flags: it.Flags}).GetType())
+}
+
+// accountRef is how the accounts are referenced in the metadata of the items
+type accountRef struct {
+	Hash   string `json:"hash"`
+	Handle string `json:"handle,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+// itemMetadata is how the metadata of the items is stored, with the recipients
+// replaced by references to their accounts
+type itemMetadata struct {
+	ItemMetadata
+	To []accountRef `json:"to,omitempty"`
+	CC []accountRef `json:"cc,omitempty"`
+}
+
+func accountRefs(accounts []*Account) []accountRef {
+	refs := make([]accountRef, 0, len(accounts))
+	for _, a := range accounts {
+		if !a.IsValid() {
+			continue
+		}
+		refs = append(refs, accountRef{Hash: a.Hash.String(), Handle: a.Handle, ID: accountID(a)})
+	}
+	return refs
+}
+
+func nullString(s sql.NullString) string {
+	return s.String
+}
+
+func accountFromColumns(key, handle, iri sql.NullString) *Account {
+	if !key.Valid {
+		return nil
+	}
+	return &Account{Hash: Hash(key.String), Handle: handle.String, Metadata: &AccountMetadata{ID: iri.String}}
+}
+
+func itemFromColumns(key, iri sql.NullString) *Item {
+	if !key.Valid {
+		return nil
+	}
+	return &Item{Hash: Hash(key.String), Metadata: &ItemMetadata{ID: iri.String}}
+}
+
+// rowID returns the id of the row of table having the key or the IRI h
+func (p *postgresRepository) rowID(table string, h Hash) (int64, error) {
+	var id int64
+	err := p.db.QueryRow(fmt.Sprintf(`SELECT "id" FROM "%s" WHERE "key" = $1 OR "iri" = $1`, table), h.String()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errors.NotFoundf("%s %s", strings.TrimSuffix(table, "s"), h)
+	}
+	if err != nil {
+		return 0, errors.Annotatef(err, "unable to load %s %s", strings.TrimSuffix(table, "s"), h)
+	}
+	return id, nil
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id > 0}
+}
+
+const accountsSelect = `SELECT "accounts"."id", "accounts"."key", "accounts"."iri", "accounts"."handle", "accounts"."email",
+"accounts"."role", "accounts"."created_at", "accounts"."updated_at", "accounts"."flags", "accounts"."metadata",
+"creator"."key", "creator"."handle", "creator"."iri"
+FROM "accounts" LEFT JOIN "accounts" AS "creator" ON "creator"."id" = "accounts"."created_by"`
+
+// queryAccounts returns the accounts loaded by the query, and their ids
+func (p *postgresRepository) queryAccounts(query string, values ...interface{}) ([]int64, AccountCollection, error) {
+	rows, err := p.db.Query(query, values...)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "unable to load accounts")
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	accounts := make(AccountCollection, 0)
+	for rows.Next() {
+		var id int64
+		var key, iri, role string
+		var md []byte
+		var creatorKey, creatorHandle, creatorIRI sql.NullString
+		a := Account{Metadata: &AccountMetadata{}}
+		err := rows.Scan(&id, &key, &iri, &a.Handle, &a.Email, &role, &a.CreatedAt, &a.UpdatedAt, &a.Flags, &md,
+			&creatorKey, &creatorHandle, &creatorIRI)
+		if err != nil {
+			return nil, nil, errors.Annotatef(err, "unable to load accounts")
+		}
+		if err := json.Unmarshal(md, a.Metadata); err != nil {
+			return nil, nil, errors.Annotatef(err, "invalid metadata for account %s", key)
+		}
+		a.Hash = Hash(key)
+		a.Role = Role(role)
+		a.Metadata.ID = iri
+		a.CreatedBy = accountFromColumns(creatorKey, creatorHandle, creatorIRI)
+		ids = append(ids, id)
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Annotatef(err, "unable to load accounts")
+	}
+	return ids, accounts, nil
+}
+
+// accountsByID returns the accounts with the ids, indexed by them
+func (p *postgresRepository) accountsByID(ids []int64) (map[int64]Account, error) {
+	accounts := make(map[int64]Account)
+	if len(ids) == 0 {
+		return accounts, nil
+	}
+	loadedIDs, loaded, err := p.queryAccounts(accountsSelect+` WHERE "accounts"."id" = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for k, id := range loadedIDs {
+		accounts[id] = loaded[k]
+	}
+	return accounts, nil
+}
+
+// accountsByRef returns the accounts referenced in the metadata of items, the references for
+// which we don't have an account are returned as they are
+func (p *postgresRepository) accountsByRef(refs []accountRef) ([]*Account, error) {
+	accounts := make([]*Account, 0, len(refs))
+	if len(refs) == 0 {
+		return accounts, nil
+	}
+	keys := make([]string, 0, len(refs))
+	for _, r := range refs {
+		keys = append(keys, r.Hash)
+	}
+	_, loaded, err := p.queryAccounts(accountsSelect+` WHERE "accounts"."key" = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		a := &Account{Hash: Hash(r.Hash), Handle: r.Handle, Metadata: &AccountMetadata{ID: r.ID}}
+		for _, l := range loaded {
+			if HashesEqual(l.Hash, a.Hash) {
+				acc := l
+				a = &acc
+				break
+			}
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+const itemsSelect = `SELECT "item"."id", "item"."key", "item"."iri", "item"."mime_type", "item"."title", "item"."data",
+"item"."submitted_at", "item"."submitted_by", "item"."updated_at", "item"."updated_by", "item"."flags", "item"."metadata",
+"parent"."key", "parent"."iri", "op"."key", "op"."iri"`
+
+const itemsFrom = ` FROM "items" AS "item"
+LEFT JOIN "accounts" AS "author" ON "author"."id" = "item"."submitted_by"
+LEFT JOIN "items" AS "parent" ON "parent"."id" = "item"."parent_id"
+LEFT JOIN "items" AS "op" ON "op"."id" = "item"."op_id"`
+
+// queryItems returns the items loaded by the query, with their authors, recipients and, if withVotes is true, votes
+func (p *postgresRepository) queryItems(withVotes bool, query string, values ...interface{}) (ItemCollection, error) {
+	rows, err := p.db.Query(query, values...)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load items")
+	}
+	defer rows.Close()
+
+	items := make(ItemCollection, 0)
+	ids := make([]int64, 0)
+	authors := make([]sql.NullInt64, 0)
+	editors := make([]sql.NullInt64, 0)
+	accountIDs := make([]int64, 0)
+	metadata := make([]itemMetadata, 0)
+	for rows.Next() {
+		var id int64
+		var key, iri, mimeType string
+		var author, editor sql.NullInt64
+		var md []byte
+		var parentKey, parentIRI, opKey, opIRI sql.NullString
+		it := Item{}
+		err := rows.Scan(&id, &key, &iri, &mimeType, &it.Title, &it.Data, &it.SubmittedAt, &author, &it.UpdatedAt,
+			&editor, &it.Flags, &md, &parentKey, &parentIRI, &opKey, &opIRI)
+		if err != nil {
+			return nil, errors.Annotatef(err, "unable to load items")
+		}
+		m := itemMetadata{}
+		if err := json.Unmarshal(md, &m); err != nil {
+			return nil, errors.Annotatef(err, "invalid metadata for item %s", key)
+		}
+		m.ID = iri
+		it.Hash = Hash(key)
+		it.MimeType = MimeType(mimeType)
+		it.Parent = itemFromColumns(parentKey, parentIRI)
+		it.OP = itemFromColumns(opKey, opIRI)
+		for _, acc := range []sql.NullInt64{author, editor} {
+			if acc.Valid {
+				accountIDs = append(accountIDs, acc.Int64)
+			}
+		}
+		ids = append(ids, id)
+		authors = append(authors, author)
+		editors = append(editors, editor)
+		metadata = append(metadata, m)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Annotatef(err, "unable to load items")
+	}
+	rows.Close()
+
+	accounts, err := p.accountsByID(accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	for k := range items {
+		it := &items[k]
+		// NOTE(marius): like the Tombstones loaded from FedBOX, the deleted items don't have an author
+		it.SubmittedBy = &AnonymousAccount
+		if a, ok := accounts[authors[k].Int64]; ok && authors[k].Valid {
+			it.SubmittedBy = &a
+		}
+		if a, ok := accounts[editors[k].Int64]; ok && editors[k].Valid {
+			it.UpdatedBy = &a
+		}
+		md := metadata[k].ItemMetadata
+		if md.To, err = p.accountsByRef(metadata[k].To); err != nil {
+			return nil, err
+		}
+		if md.CC, err = p.accountsByRef(metadata[k].CC); err != nil {
+			return nil, err
+		}
+		for i := range md.Tags {
+			md.Tags[i].Type = TagTag
+		}
+		for i := range md.Mentions {
+			md.Mentions[i].Type = TagMention
+		}
+		it.Metadata = &md
+	}
+	if withVotes && len(ids) > 0 {
+		if err := p.loadItemsVotes(items, ids); err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) > 0 {
+		if err := p.loadItemsShares(items, ids); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (p *postgresRepository) loadItemsShares(items ItemCollection, ids []int64) error {
+	rows, err := p.db.Query(`SELECT "item_id", COUNT(*) FROM "shares" WHERE "item_id" = ANY($1) GROUP BY "item_id"`, pq.Array(ids))
+	if err != nil {
+		return errors.Annotatef(err, "unable to load shares")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var cnt int
+		if err := rows.Scan(&id, &cnt); err != nil {
+			return errors.Annotatef(err, "unable to load shares")
+		}
+		for k, itemID := range ids {
+			if itemID == id {
+				items[k].Shares = cnt
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// loadItemsSharedBy sets the most recent of the accounts followed by the follower account which shared the items,
+// for the ones which weren't submitted by an account it follows
+func (p *postgresRepository) loadItemsSharedBy(items ItemCollection, follower string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(items))
+	for _, it := range items {
+		keys = append(keys, it.Hash.String())
+	}
+	rows, err := p.db.Query(`WITH "followed" AS (SELECT "follow_requests"."object_id" FROM "follow_requests"
+INNER JOIN "accounts" ON "accounts"."id" = "follow_requests"."submitted_by"
+WHERE "follow_requests"."accepted" AND "accounts"."key" = $2)
+SELECT DISTINCT ON ("item"."key") "item"."key", "sharer"."key" FROM "shares"
+INNER JOIN "items" AS "item" ON "item"."id" = "shares"."item_id"
+INNER JOIN "accounts" AS "sharer" ON "sharer"."id" = "shares"."submitted_by"
+WHERE "item"."key" = ANY($1) AND "shares"."submitted_by" IN (SELECT "object_id" FROM "followed")
+AND ("item"."submitted_by" IS NULL OR "item"."submitted_by" NOT IN (SELECT "object_id" FROM "followed"))
+ORDER BY "item"."key", "shares"."submitted_at" DESC`, pq.Array(keys), follower)
+	if err != nil {
+		return errors.Annotatef(err, "unable to load the accounts sharing the items")
+	}
+	defer rows.Close()
+	sharers := make(map[string]Hash)
+	f := Filters{}
+	for rows.Next() {
+		var itemKey, sharerKey string
+		if err := rows.Scan(&itemKey, &sharerKey); err != nil {
+			return errors.Annotatef(err, "unable to load the accounts sharing the items")
+		}
+		sharers[itemKey] = Hash(sharerKey)
+		f.LoadAccountsFilter.Key = append(f.LoadAccountsFilter.Key, Hash(sharerKey))
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Annotatef(err, "unable to load the accounts sharing the items")
+	}
+	rows.Close()
+	if len(sharers) == 0 {
+		return nil
+	}
+
+	accounts, _, err := p.LoadAccounts(f)
+	if err != nil {
+		return err
+	}
+	for k, it := range items {
+		h, ok := sharers[it.Hash.String()]
+		if !ok {
+			continue
+		}
+		for i, a := range accounts {
+			if HashesEqual(a.Hash, h) {
+				items[k].SharedBy = &accounts[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (p *postgresRepository) loadItemsVotes(items ItemCollection, ids []int64) error {
+	rows, err := p.db.Query(`SELECT "item_id", "weight" FROM "votes" WHERE "item_id" = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return errors.Annotatef(err, "unable to load votes")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		v := Vote{}
+		if err := rows.Scan(&id, &v.Weight); err != nil {
+			return errors.Annotatef(err, "unable to load votes")
+		}
+		for k, itemID := range ids {
+			if itemID == id {
+				items[k].AddVote(v)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresRepository) loadItemByID(id int64) (Item, error) {
+	items, err := p.queryItems(true, itemsSelect+itemsFrom+` WHERE "item"."id" = $1`, id)
+	if err != nil {
+		return Item{}, err
+	}
+	if len(items) == 0 {
+		return Item{}, errors.NotFoundf("item %d", id)
+	}
+	return items[0], nil
+}
+
+func (p *postgresRepository) LoadItem(f Filters) (Item, error) {
+	if len(f.LoadItemsFilter.Key) == 0 {
+		return Item{}, errors.Newf("invalid item hash")
+	}
+	key := f.LoadItemsFilter.Key[0]
+	items, err := p.queryItems(true, itemsSelect+itemsFrom+` WHERE "item"."key" = $1 OR "item"."iri" = $1`, key.String())
+	if err != nil {
+		return Item{}, err
+	}
+	if len(items) == 0 {
+		return Item{}, errors.NotFoundf("item %s", key)
+	}
+	return items[0], nil
+}
+
+func (p *postgresRepository) LoadItems(f Filters) (ItemCollection, uint, error) {
+	lf := f.LoadItemsFilter
+	lf.WithContentAlias("item").WithAuthorAlias("author")
+
+	w := pgWhere{}
+	w.add(lf.GetWhereClauses())
+	if len(f.Type) > 0 {
+		w.add(typesClause("item", f.Type))
+	}
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*)`+itemsFrom+w.String(), w.values...).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load items")
+	}
+	query := itemsSelect + itemsFrom + w.String() + ` ORDER BY "item"."submitted_at" DESC, "item"."id"` + f.GetLimit()
+	items, err := p.queryItems(Instance.Config.VotingEnabled, query, w.values...)
+	if err == nil && len(lf.FollowedBy) > 0 {
+		err = p.loadItemsSharedBy(items, lf.FollowedBy)
+	}
+	return items, count, err
+}
+
+// SaveItem saves the item and updates its entry of the search index
+func (p *postgresRepository) SaveItem(it Item) (Item, error) {
+	it, err := p.saveItem(it)
+	if err != nil {
+		return it, err
+	}
+	if err := updateIndex(p.index, it); err != nil {
+		p.errFn("unable to update the search index", log.Ctx{"err": err, "item": it.Hash})
+	}
+	return it, nil
+}
+
+func (p *postgresRepository) saveItem(it Item) (Item, error) {
+	if !it.SubmittedBy.IsValid() || !it.SubmittedBy.HasMetadata() {
+		return Item{}, errors.Newf("Invalid item submitter")
+	}
+	if !accountValidForC2S(it.SubmittedBy) {
+		return it, errors.Unauthorizedf("invalid account %s", it.SubmittedBy.Handle)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	var id int64
+	var iri string
+	if len(it.Hash) > 0 {
+		err := p.db.QueryRow(`SELECT "id", "iri" FROM "items" WHERE "key" = $1 OR "iri" = $1`, it.Hash.String()).Scan(&id, &iri)
+		if err == sql.ErrNoRows {
+			return it, errors.NotFoundf("item %s", it.Hash)
+		}
+		if err != nil {
+			return it, errors.Annotatef(err, "unable to load item %s", it.Hash)
+		}
+	}
+	if it.Deleted() {
+		if id == 0 {
+			return it, errors.NotFoundf("item hash is empty, can not delete")
+		}
+		// NOTE(marius): this mimics what a Tombstone loaded from FedBOX contains
+		md, _ := json.Marshal(itemMetadata{})
+		_, err := p.db.Exec(`UPDATE "items" SET "type" = $2, "mime_type" = '', "title" = '', "data" = '', "submitted_by" = NULL,
+"updated_at" = $3, "updated_by" = NULL, "flags" = $4, "metadata" = $5 WHERE "id" = $1`,
+			id, itemType(Item{Flags: FlagsDeleted}), now, FlagsDeleted, md)
+		if err != nil {
+			return it, errors.Annotatef(err, "unable to delete item %s", it.Hash)
+		}
+		return p.loadItemByID(id)
+	}
+
+	authorID, err := p.rowID("accounts", it.SubmittedBy.Hash)
+	if err != nil {
+		return it, err
+	}
+	md := itemMetadata{}
+	if it.HasMetadata() {
+		md.ItemMetadata = *it.Metadata
+	}
+	md.To = accountRefs(md.ItemMetadata.To)
+	md.CC = accountRefs(md.ItemMetadata.CC)
+	for _, men := range md.Mentions {
+		if !isLocalMention(men) {
+			continue
+		}
+		_, mentioned, err := p.queryAccounts(accountsSelect+` WHERE "accounts"."handle" = $1`, men.Name)
+		if err != nil {
+			return it, err
+		}
+		for k := range mentioned {
+			md.CC = append(md.CC, accountRefs([]*Account{&mentioned[k]})...)
+		}
+	}
+	md.ItemMetadata.To = nil
+	md.ItemMetadata.CC = nil
+
+	if id > 0 {
+		md.ID = iri
+		data, _ := json.Marshal(md)
+		_, err := p.db.Exec(`UPDATE "items" SET "type" = $2, "mime_type" = $3, "title" = $4, "data" = $5, "updated_at" = $6,
+"updated_by" = $7, "metadata" = $8 WHERE "id" = $1`,
+			id, itemType(it), string(it.MimeType), it.Title, it.Data, now, authorID, data)
+		if err != nil {
+			return it, errors.Annotatef(err, "unable to save item %s", it.Hash)
+		}
+		return p.loadItemByID(id)
+	}
+
+	var parentID, opID sql.NullInt64
+	if it.Parent.IsValid() {
+		err := p.db.QueryRow(`SELECT "id", COALESCE("op_id", "id") FROM "items" WHERE "key" = $1 OR "iri" = $1`,
+			it.Parent.Hash.String()).Scan(&parentID, &opID)
+		if err == sql.ErrNoRows {
+			return it, errors.NotFoundf("item %s", it.Parent.Hash)
+		}
+		if err != nil {
+			return it, errors.Annotatef(err, "unable to load item %s", it.Parent.Hash)
+		}
+	}
+	hash := newHash()
+	md.ID = fmt.Sprintf("%s/%s", ObjectsURL, hash)
+	submittedAt := it.SubmittedAt.UTC().Truncate(time.Microsecond)
+	if it.SubmittedAt.IsZero() {
+		submittedAt = now
+	}
+	data, _ := json.Marshal(md)
+	err = p.db.QueryRow(`INSERT INTO "items" ("key", "iri", "type", "mime_type", "title", "data", "submitted_at", "submitted_by",
+"updated_at", "flags", "local", "metadata", "parent_id", "op_id") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $7, $9, $10, $11, $12, $13)
+RETURNING "id"`,
+		hash.String(), md.ID, itemType(it), string(it.MimeType), it.Title, it.Data, submittedAt, authorID, it.Flags,
+		Item{Metadata: &md.ItemMetadata}.IsLocal(), data, parentID, opID).Scan(&id)
+	if err != nil {
+		return it, errors.Annotatef(err, "unable to save item")
+	}
+	return p.loadItemByID(id)
+}
+
+const votesSelect = `SELECT "vote"."submitted_at", "vote"."updated_at", "vote"."weight", "vote"."flags", "vote"."iri",
+"voter"."key", "voter"."handle", "voter"."iri", "item"."key", "item"."iri"`
+
+const votesFrom = ` FROM "votes" AS "vote"
+INNER JOIN "accounts" AS "voter" ON "voter"."id" = "vote"."submitted_by"
+INNER JOIN "items" AS "item" ON "item"."id" = "vote"."item_id"`
+
+func (p *postgresRepository) LoadVotes(f Filters) (VoteCollection, uint, error) {
+	w := pgWhere{}
+	w.add(f.LoadVotesFilter.GetWhereClauses())
+
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*)`+votesFrom+w.String(), w.values...).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load votes")
+	}
+	rows, err := p.db.Query(votesSelect+votesFrom+w.String()+` ORDER BY "vote"."id"`+f.GetLimit(), w.values...)
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load votes")
+	}
+	defer rows.Close()
+
+	votes := make(VoteCollection, 0)
+	for rows.Next() {
+		var voterKey, voterHandle, voterIRI, itemKey, itemIRI sql.NullString
+		v := Vote{Metadata: &VoteMetadata{}}
+		err := rows.Scan(&v.SubmittedAt, &v.UpdatedAt, &v.Weight, &v.Flags, &v.Metadata.IRI, &voterKey, &voterHandle, &voterIRI,
+			&itemKey, &itemIRI)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "unable to load votes")
+		}
+		v.SubmittedBy = accountFromColumns(voterKey, voterHandle, voterIRI)
+		v.Item = itemFromColumns(itemKey, itemIRI)
+		votes = append(votes, v)
+	}
+	return votes, count, rows.Err()
+}
+
+func (p *postgresRepository) SaveVote(v Vote) (Vote, error) {
+	if !v.SubmittedBy.IsValid() || !v.SubmittedBy.HasMetadata() {
+		return Vote{}, errors.Newf("Invalid vote submitter")
+	}
+	if !v.Item.IsValid() || !v.Item.HasMetadata() {
+		return Vote{}, errors.Newf("Invalid vote item")
+	}
+	if !accountValidForC2S(v.SubmittedBy) {
+		return v, errors.Unauthorizedf("invalid account %s", v.SubmittedBy.Handle)
+	}
+	voterID, err := p.rowID("accounts", v.SubmittedBy.Hash)
+	if err != nil {
+		return v, err
+	}
+	itemID, err := p.rowID("items", v.Item.Hash)
+	if err != nil {
+		return v, err
+	}
+
+	weight := 0
+	if v.Weight > 0 {
+		weight = 1
+	}
+	if v.Weight < 0 {
+		weight = -1
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return v, errors.Annotatef(err, "unable to save vote")
+	}
+	defer tx.Rollback()
+
+	var old int
+	err = tx.QueryRow(`DELETE FROM "votes" WHERE "submitted_by" = $1 AND "item_id" = $2 RETURNING "weight"`, voterID, itemID).Scan(&old)
+	if err != nil && err != sql.ErrNoRows {
+		return v, errors.Annotatef(err, "unable to save vote")
+	}
+	if err == nil && old == weight {
+		// voting the same way twice undoes the existing vote
+		weight = 0
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	h := newHash()
+	vot := Vote{
+		SubmittedBy: accountStub(v.SubmittedBy),
+		SubmittedAt: now,
+		UpdatedAt:   now,
+		Weight:      weight,
+		Item:        itemStub(v.Item),
+		Metadata: &VoteMetadata{
+			IRI: fmt.Sprintf("%s/activities/%s", BaseURL, h),
+		},
+	}
+	if weight != 0 {
+		_, err := tx.Exec(`INSERT INTO "votes" ("key", "iri", "submitted_at", "submitted_by", "updated_at", "item_id", "weight")
+VALUES ($1, $2, $3, $4, $3, $5, $6)`, h.String(), vot.Metadata.IRI, now, voterID, itemID, weight)
+		if err != nil {
+			return v, errors.Annotatef(err, "unable to save vote")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return v, errors.Annotatef(err, "unable to save vote")
+	}
+	return vot, nil
+}
+
+// ShareItem stores the share of the it item by acc, sharing an item twice doesn't change anything
+func (p *postgresRepository) ShareItem(acc Account, it Item) error {
+	if !accountValidForC2S(&acc) {
+		return errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	if !it.IsValid() || it.Private() || it.Deleted() {
+		return errors.Newf("invalid item to share")
+	}
+	accID, err := p.rowID("accounts", acc.Hash)
+	if err != nil {
+		return err
+	}
+	itemID, err := p.rowID("items", it.Hash)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	if _, err := p.db.Exec(`INSERT INTO "shares" ("key", "iri", "submitted_at", "submitted_by", "item_id")
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT ("submitted_by", "item_id") DO NOTHING`,
+		h.String(), fmt.Sprintf("%s/activities/%s", BaseURL, h), time.Now().UTC(), accID, itemID); err != nil {
+		return errors.Annotatef(err, "unable to share item %s", it.Hash)
+	}
+	return nil
+}
+
+func (p *postgresRepository) loadAccountRelations(id int64, a *Account) error {
+	if err := p.db.QueryRow(`SELECT COALESCE(SUM("weight"), 0) FROM "votes" WHERE "submitted_by" = $1`, id).Scan(&a.Score); err != nil {
+		return errors.Annotatef(err, "unable to load the score of account %s", a.Hash)
+	}
+	_, followers, err := p.queryAccounts(accountsSelect+` INNER JOIN "follow_requests" AS "follow" ON "follow"."submitted_by" = "accounts"."id"
+WHERE "follow"."accepted" AND "follow"."object_id" = $1 ORDER BY "follow"."id"`, id)
+	if err != nil {
+		return err
+	}
+	_, following, err := p.queryAccounts(accountsSelect+` INNER JOIN "follow_requests" AS "follow" ON "follow"."object_id" = "accounts"."id"
+WHERE "follow"."accepted" AND "follow"."submitted_by" = $1 ORDER BY "follow"."id"`, id)
+	if err != nil {
+		return err
+	}
+	a.Followers = followers
+	a.Following = following
+	return nil
+}
+
+func (p *postgresRepository) LoadAccounts(f Filters) (AccountCollection, uint, error) {
+	w := pgWhere{}
+	w.add(f.LoadAccountsFilter.GetWhereClauses())
+
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM "accounts"`+w.String(), w.values...).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load accounts")
+	}
+	ids, accounts, err := p.queryAccounts(accountsSelect+w.String()+` ORDER BY "accounts"."id"`+f.GetLimit(), w.values...)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k := range accounts {
+		if err := p.loadAccountRelations(ids[k], &accounts[k]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return accounts, count, nil
+}
+
+func (p *postgresRepository) LoadAccount(f Filters) (Account, error) {
+	accounts, _, err := p.LoadAccounts(f)
+	if err != nil {
+		return AnonymousAccount, err
+	}
+	ac, err := accounts.First()
+	if err != nil {
+		var id string
+		if len(f.LoadAccountsFilter.Key) > 0 {
+			id = f.LoadAccountsFilter.Key[0].String()
+		}
+		if len(f.Handle) > 0 {
+			id = f.Handle[0]
+		}
+		return AnonymousAccount, errors.NotFoundf("account %s", id)
+	}
+	return *ac, nil
+}
+
+func (p *postgresRepository) SaveAccount(a Account) (Account, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	var id int64
+	var key, iri string
+	var createdAt time.Time
+	if len(a.Hash) > 0 {
+		err := p.db.QueryRow(`SELECT "id", "key", "iri", "created_at" FROM "accounts" WHERE "key" = $1 OR "iri" = $1`,
+			a.Hash.String()).Scan(&id, &key, &iri, &createdAt)
+		if err != nil && err != sql.ErrNoRows {
+			return a, errors.Annotatef(err, "unable to load account %s", a.Hash)
+		}
+	}
+	if a.Deleted() {
+		if id == 0 {
+			return a, errors.NotFoundf("account hash is empty, can not delete")
+		}
+		_, err := p.db.Exec(`UPDATE "accounts" SET "flags" = "flags" | $2, "updated_at" = $3 WHERE "id" = $1`, id, FlagsDeleted, now)
+		if err != nil {
+			return a, errors.Annotatef(err, "unable to delete account %s", a.Hash)
+		}
+		_, accounts, err := p.queryAccounts(accountsSelect+` WHERE "accounts"."id" = $1`, id)
+		if err != nil {
+			return a, err
+		}
+		return accounts[0], nil
+	}
+
+	md := AccountMetadata{}
+	if a.HasMetadata() {
+		md = *a.Metadata
+	}
+	pw := md.Password
+	// NOTE(marius): like FedBOX, we don't give out the password or the OAuth2 credentials
+	md.Password = nil
+	md.Salt = nil
+	md.OAuth = OAuth{}
+	a.Metadata = &md
+	a.Votes = nil
+	a.Followers = nil
+	a.Following = nil
+	a.Blocked = nil
+	a.CreatedBy = accountStub(a.CreatedBy)
+	a.UpdatedAt = now
+
+	var createdBy sql.NullInt64
+	if a.CreatedBy.IsValid() {
+		creatorID, _ := p.rowID("accounts", a.CreatedBy.Hash)
+		createdBy = nullID(creatorID)
+	}
+
+	if id > 0 {
+		a.Hash = Hash(key)
+		a.CreatedAt = createdAt
+		md.ID = iri
+		data, _ := json.Marshal(md)
+		_, err := p.db.Exec(`UPDATE "accounts" SET "handle" = $2, "email" = $3, "role" = $4, "created_by" = $5, "updated_at" = $6,
+"flags" = $7, "metadata" = $8 WHERE "id" = $1`,
+			id, a.Handle, a.Email, string(a.Role), createdBy, now, a.Flags, data)
+		if err != nil {
+			return a, errors.Annotatef(err, "unable to save account %s", a.Handle)
+		}
+	} else {
+		a.Hash = newHash()
+		if a.CreatedAt.IsZero() {
+			a.CreatedAt = now
+		}
+		a.CreatedAt = a.CreatedAt.UTC().Truncate(time.Microsecond)
+		md.ID = fmt.Sprintf("%s/%s", ActorsURL, a.Hash)
+		md.InboxIRI = fmt.Sprintf("%s/inbox", md.ID)
+		md.OutboxIRI = fmt.Sprintf("%s/outbox", md.ID)
+		md.LikedIRI = fmt.Sprintf("%s/liked", md.ID)
+		md.FollowersIRI = fmt.Sprintf("%s/followers", md.ID)
+		md.FollowingIRI = fmt.Sprintf("%s/following", md.ID)
+		data, _ := json.Marshal(md)
+		err := p.db.QueryRow(`INSERT INTO "accounts" ("key", "iri", "handle", "email", "role", "created_at", "created_by", "updated_at",
+"flags", "metadata") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING "id"`,
+			a.Hash.String(), md.ID, a.Handle, a.Email, string(a.Role), a.CreatedAt, createdBy, now, a.Flags, data).Scan(&id)
+		if err != nil {
+			return a, errors.Annotatef(err, "unable to save account %s", a.Handle)
+		}
+	}
+	if len(pw) > 0 {
+		if err := p.setPassword(id, pw); err != nil {
+			return a, errors.Annotatef(err, "unable to save the password of account %s", a.Handle)
+		}
+	}
+	return a, nil
+}
+
+// passwordKey derives the key stored for the password, using PBKDF2 with HMAC-SHA256
+func passwordKey(pw, salt []byte) []byte {
+	return pbkdf2.Key(pw, salt, pwIterations, pwKeyLength, sha256.New)
+}
+
+func (p *postgresRepository) setPassword(id int64, pw []byte) error {
+	salt := make([]byte, pwSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	_, err := p.db.Exec(`UPDATE "accounts" SET "pw" = $2, "salt" = $3 WHERE "id" = $1`, id,
+		passwordKey(pw, salt), salt)
+	return err
+}
+
+// Authenticate checks the password of the account
+func (p *postgresRepository) Authenticate(a Account, pw string) error {
+	var key, salt []byte
+	err := p.db.QueryRow(`SELECT "pw", "salt" FROM "accounts" WHERE "key" = $1`, a.Hash.String()).Scan(&key, &salt)
+	if err == sql.ErrNoRows {
+		return errors.NotFoundf("account %s", a.Handle)
+	}
+	if err != nil {
+		return errors.Annotatef(err, "unable to load account %s", a.Handle)
+	}
+	if len(key) == 0 || !hmac.Equal(passwordKey([]byte(pw), salt), key) {
+		return errors.Unauthorizedf("invalid password for account %s", a.Handle)
+	}
+	return nil
+}
+
+const followsFrom = ` FROM "follow_requests" AS "follow"
+INNER JOIN "accounts" AS "actor" ON "actor"."id" = "follow"."submitted_by"
+INNER JOIN "accounts" AS "object" ON "object"."id" = "follow"."object_id"`
+
+func (p *postgresRepository) LoadFollowRequests(ed *Account, f Filters) (FollowRequests, uint, error) {
+	w := pgWhere{}
+	w.add([]string{`NOT "follow"."accepted"`}, nil)
+	if ed != nil {
+		w.add([]string{`"object"."key" = ?0`}, []interface{}{ed.Hash.String()})
+	}
+	w.add(f.LoadFollowRequestsFilter.GetWhereClauses())
+
+	rows, err := p.db.Query(`SELECT "follow"."key", "follow"."iri", "follow"."submitted_at", "follow"."flags", "follow"."submitted_by",
+"follow"."object_id"`+followsFrom+w.String()+` ORDER BY "follow"."id"`, w.values...)
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load follow requests")
+	}
+	defer rows.Close()
+
+	requests := make(FollowRequests, 0)
+	actors := make([]int64, 0)
+	objects := make([]int64, 0)
+	for rows.Next() {
+		var key string
+		var actor, object int64
+		req := FollowRequest{Metadata: &FollowMetadata{}}
+		if err := rows.Scan(&key, &req.Metadata.ID, &req.SubmittedAt, &req.Flags, &actor, &object); err != nil {
+			return nil, 0, errors.Annotatef(err, "unable to load follow requests")
+		}
+		req.Hash = Hash(key)
+		actors = append(actors, actor)
+		objects = append(objects, object)
+		requests = append(requests, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load follow requests")
+	}
+	rows.Close()
+
+	accounts, err := p.accountsByID(append(append([]int64{}, actors...), objects...))
+	if err != nil {
+		return nil, 0, err
+	}
+	for k := range requests {
+		er, ed := accounts[actors[k]], accounts[objects[k]]
+		requests[k].SubmittedBy = &er
+		requests[k].Object = &ed
+	}
+	return requests, uint(len(requests)), nil
+}
+
+func (p *postgresRepository) FollowAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	if !ed.IsValid() {
+		return errors.Newf("invalid account to follow")
+	}
+	erID, err := p.rowID("accounts", er.Hash)
+	if err != nil {
+		return err
+	}
+	edID, err := p.rowID("accounts", ed.Hash)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	_, err = p.db.Exec(`INSERT INTO "follow_requests" ("key", "iri", "submitted_at", "submitted_by", "object_id")
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT ("submitted_by", "object_id") DO NOTHING`,
+		h.String(), fmt.Sprintf("%s/activities/%s", BaseURL, h), time.Now().UTC(), erID, edID)
+	if err != nil {
+		return errors.Annotatef(err, "unable to follow account %s", ed.Handle)
+	}
+	return nil
+}
+
+func (p *postgresRepository) SendFollowResponse(f FollowRequest, accept bool) error {
+	if !accountValidForC2S(f.Object) {
+		return errors.Unauthorizedf("invalid account %s", f.Object.Handle)
+	}
+	query := `DELETE FROM "follow_requests" WHERE "key" = $1 AND NOT "accepted"`
+	if accept {
+		query = `UPDATE "follow_requests" SET "accepted" = true WHERE "key" = $1 AND NOT "accepted"`
+	}
+	res, err := p.db.Exec(query, f.Hash.String())
+	if err != nil {
+		return errors.Annotatef(err, "unable to respond to follow request %s", f.Hash)
+	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return errors.NotFoundf("follow request %s", f.Hash)
+	}
+	return nil
+}
+
+func (p *postgresRepository) UnfollowAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	res, err := p.db.Exec(`DELETE FROM "follow_requests" WHERE "submitted_by" = (SELECT "id" FROM "accounts" WHERE "key" = $1)
+AND "object_id" = (SELECT "id" FROM "accounts" WHERE "key" = $2)`, er.Hash.String(), ed.Hash.String())
+	if err != nil {
+		return errors.Annotatef(err, "unable to unfollow account %s", ed.Handle)
+	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return errors.NotFoundf("account %s is not followed by %s", ed.Handle, er.Handle)
+	}
+	return nil
+}
+
+func (p *postgresRepository) LoadBlockedAccounts(er Account) (AccountCollection, uint, error) {
+	_, accounts, err := p.queryAccounts(accountsSelect+` INNER JOIN "blocks" ON "blocks"."object_id" = "accounts"."id"
+WHERE "blocks"."submitted_by" = (SELECT "id" FROM "accounts" WHERE "key" = $1) ORDER BY "blocks"."id"`, er.Hash.String())
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load the accounts blocked by %s", er.Handle)
+	}
+	return accounts, uint(len(accounts)), nil
+}
+
+// BlockAccount blocks ed for er, which also removes ed from er's followers
+func (p *postgresRepository) BlockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	if !ed.IsValid() || HashesEqual(er.Hash, ed.Hash) {
+		return errors.Newf("invalid account to block")
+	}
+	erID, err := p.rowID("accounts", er.Hash)
+	if err != nil {
+		return err
+	}
+	edID, err := p.rowID("accounts", ed.Hash)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return errors.Annotatef(err, "unable to block account %s", ed.Handle)
+	}
+	defer tx.Rollback()
+
+	h := newHash()
+	if _, err := tx.Exec(`INSERT INTO "blocks" ("key", "iri", "submitted_at", "submitted_by", "object_id")
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT ("submitted_by", "object_id") DO NOTHING`,
+		h.String(), fmt.Sprintf("%s/activities/%s", BaseURL, h), time.Now().UTC(), erID, edID); err != nil {
+		return errors.Annotatef(err, "unable to block account %s", ed.Handle)
+	}
+	if _, err := tx.Exec(`DELETE FROM "follow_requests" WHERE "submitted_by" = $1 AND "object_id" = $2`, edID, erID); err != nil {
+		return errors.Annotatef(err, "unable to remove follower %s", ed.Handle)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Annotatef(err, "unable to block account %s", ed.Handle)
+	}
+	return nil
+}
+
+func (p *postgresRepository) UnblockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	res, err := p.db.Exec(`DELETE FROM "blocks" WHERE "submitted_by" = (SELECT "id" FROM "accounts" WHERE "key" = $1)
+AND "object_id" = (SELECT "id" FROM "accounts" WHERE "key" = $2)`, er.Hash.String(), ed.Hash.String())
+	if err != nil {
+		return errors.Annotatef(err, "unable to unblock account %s", ed.Handle)
+	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return errors.NotFoundf("account %s is not blocked by %s", ed.Handle, er.Handle)
+	}
+	return nil
+}
+
+// LoadMessages loads the private items submitted by acc, or addressed to them, the newest first
+func (p *postgresRepository) LoadMessages(acc Account, f Filters) (ItemCollection, uint, error) {
+	rec, _ := json.Marshal([]accountRef{{Hash: acc.Hash.String()}})
+	where := ` WHERE ` + flagsClause("item", FlagsPrivate, []bool{true}) + ` AND ` + flagsClause("item", FlagsDeleted, []bool{false}) +
+		` AND ("author"."key" = $1 OR "item"."metadata"->'to' @> $2 OR "item"."metadata"->'cc' @> $2)`
+
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*)`+itemsFrom+where, acc.Hash.String(), string(rec)).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load the messages of %s", acc.Handle)
+	}
+	query := itemsSelect + itemsFrom + where + ` ORDER BY "item"."submitted_at" DESC, "item"."id"` + f.GetLimit()
+	items, err := p.queryItems(false, query, acc.Hash.String(), string(rec))
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load the messages of %s", acc.Handle)
+	}
+	return items, count, nil
+}
+
+func (p *postgresRepository) LoadReadMessages(acc Account) (Hashes, error) {
+	rows, err := p.db.Query(`SELECT "item"."key" FROM "messages_read" INNER JOIN "items" AS "item" ON "item"."id" = "messages_read"."item_id"
+WHERE "messages_read"."account_id" = (SELECT "id" FROM "accounts" WHERE "key" = $1)`, acc.Hash.String())
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load the messages read by %s", acc.Handle)
+	}
+	defer rows.Close()
+
+	read := make(Hashes, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, errors.Annotatef(err, "unable to load the messages read by %s", acc.Handle)
+		}
+		read = append(read, Hash(key))
+	}
+	return read, rows.Err()
+}
+
+func (p *postgresRepository) MarkMessagesRead(acc Account, items ...Item) error {
+	accID, err := p.rowID("accounts", acc.Hash)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if _, err := p.db.Exec(`INSERT INTO "messages_read" ("account_id", "item_id")
+SELECT $1, "id" FROM "items" WHERE "key" = $2 ON CONFLICT DO NOTHING`, accID, it.Hash.String()); err != nil {
+			return errors.Annotatef(err, "unable to mark message %s as read", it.Hash)
+		}
+	}
+	return nil
+}
+
+const reportsFrom = ` FROM "reports" AS "report"
+INNER JOIN "accounts" AS "reporter" ON "reporter"."id" = "report"."submitted_by"
+INNER JOIN "items" AS "reported" ON "reported"."id" = "report"."item_id"`
+
+func (p *postgresRepository) LoadReports(f Filters) (ItemReports, uint, error) {
+	w := pgWhere{}
+	// NOTE(marius): forwarded reports are delivered to other instances, they don't show up in our queue
+	w.add([]string{`NOT "report"."forward"`}, nil)
+	w.add(f.LoadReportsFilter.GetWhereClauses())
+
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*)`+reportsFrom+w.String(), w.values...).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load reports")
+	}
+	rows, err := p.db.Query(`SELECT "report"."key", "report"."iri", "report"."submitted_at", "report"."reason", "report"."text",
+"report"."submitted_by", "report"."item_id"`+reportsFrom+w.String()+` ORDER BY "report"."id" DESC`+f.GetLimit(), w.values...)
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load reports")
+	}
+	defer rows.Close()
+
+	reports := make(ItemReports, 0)
+	reporters := make([]int64, 0)
+	items := make([]int64, 0)
+	for rows.Next() {
+		var key, reason string
+		var reporter, item int64
+		rep := ItemReport{Metadata: &ReportMetadata{}}
+		if err := rows.Scan(&key, &rep.Metadata.ID, &rep.SubmittedAt, &reason, &rep.Text, &reporter, &item); err != nil {
+			return nil, 0, errors.Annotatef(err, "unable to load reports")
+		}
+		rep.Hash = Hash(key)
+		rep.Reason = ReportReason(reason)
+		reporters = append(reporters, reporter)
+		items = append(items, item)
+		reports = append(reports, rep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load reports")
+	}
+	rows.Close()
+
+	accounts, err := p.accountsByID(reporters)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k := range reports {
+		a := accounts[reporters[k]]
+		reports[k].SubmittedBy = &a
+		it, err := p.loadItemByID(items[k])
+		if err != nil {
+			return nil, 0, err
+		}
+		reports[k].Item = &it
+	}
+	return reports, count, nil
+}
+
+func (p *postgresRepository) SaveReport(rep ItemReport) (ItemReport, error) {
+	if !accountValidForC2S(rep.SubmittedBy) {
+		return rep, errors.Unauthorizedf("invalid account %s", rep.SubmittedBy.Handle)
+	}
+	if !rep.Item.IsValid() {
+		return rep, errors.Newf("Invalid reported item")
+	}
+	itemID, err := p.rowID("items", rep.Item.Hash)
+	if err != nil {
+		return rep, err
+	}
+	reporterID, err := p.rowID("accounts", rep.SubmittedBy.Hash)
+	if err != nil {
+		return rep, err
+	}
+	rep.Hash = newHash()
+	rep.SubmittedAt = time.Now().UTC().Truncate(time.Microsecond)
+	rep.SubmittedBy = accountStub(rep.SubmittedBy)
+	rep.Item = itemStub(rep.Item)
+	rep.Metadata = &ReportMetadata{
+		ID: fmt.Sprintf("%s/activities/%s", BaseURL, rep.Hash),
+	}
+	_, err = p.db.Exec(`INSERT INTO "reports" ("key", "iri", "submitted_at", "submitted_by", "item_id", "reason", "text", "forward")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		rep.Hash.String(), rep.Metadata.ID, rep.SubmittedAt, reporterID, itemID, string(rep.Reason), rep.Text, rep.Forward)
+	if err != nil {
+		return rep, errors.Annotatef(err, "unable to save report")
+	}
+	return rep, nil
+}
+
+const moderationsFrom = ` FROM "moderations" AS "op"
+INNER JOIN "accounts" AS "actor" ON "actor"."id" = "op"."submitted_by"
+LEFT JOIN "accounts" AS "moderator" ON "moderator"."id" = "op"."moderator_id"
+LEFT JOIN "reports" AS "report" ON "report"."id" = "op"."report_id"
+LEFT JOIN "items" AS "item" ON "item"."id" = "op"."item_id"
+LEFT JOIN "accounts" AS "account" ON "account"."id" = "op"."account_id"`
+
+// moderationsWhereClauses returns the clauses matching the moderation operations, the On filter matches the object of
+// the operation: the item for deletions, the report for dismissals and the account for suspensions
+func moderationsWhereClauses(f Filters) ([]string, []interface{}) {
+	wheres := make([]string, 0)
+	whereValues := make([]interface{}, 0)
+	counter := 0
+
+	if len(f.Type) > 0 {
+		actions := make([]string, 0)
+		for _, a := range []ModerationAction{ModerationDelete, ModerationDismiss, ModerationSuspend} {
+			if f.Type.Contains(moderationType(a)) {
+				actions = append(actions, fmt.Sprintf(`"op"."action" = '%s'`, a))
+			}
+		}
+		if len(actions) == 0 {
+			actions = append(actions, "false")
+		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(actions, " OR ")))
+	}
+	lf := f.LoadReportsFilter
+	for _, h := range []struct {
+		alias  string
+		hashes Hashes
+	}{{"op", lf.Key}, {"actor", lf.Actor}} {
+		if len(h.hashes) == 0 {
+			continue
+		}
+		whereColumns := make([]string, 0)
+		for _, hash := range h.hashes {
+			whereColumns = append(whereColumns, keyClause(h.alias, counter))
+			whereValues = append(whereValues, interface{}(hash.String()))
+			counter++
+		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+	}
+	if len(lf.On) > 0 {
+		whereColumns := make([]string, 0)
+		for _, hash := range lf.On {
+			whereColumns = append(whereColumns, fmt.Sprintf(`("op"."action" = '%s' AND %s)`, ModerationDelete, keyClause("item", counter)))
+			whereColumns = append(whereColumns, fmt.Sprintf(`("op"."action" = '%s' AND %s)`, ModerationDismiss, keyClause("report", counter)))
+			whereColumns = append(whereColumns, fmt.Sprintf(`("op"."action" = '%s' AND %s)`, ModerationSuspend, keyClause("account", counter)))
+			whereValues = append(whereValues, interface{}(hash.String()))
+			counter++
+		}
+		wheres = append(wheres, fmt.Sprintf("(%s)", strings.Join(whereColumns, " OR ")))
+	}
+	return wheres, whereValues
+}
+
+func (p *postgresRepository) LoadModerations(f Filters) (ModerationOps, uint, error) {
+	w := pgWhere{}
+	w.add(moderationsWhereClauses(f))
+
+	var count uint
+	if err := p.db.QueryRow(`SELECT COUNT(*)`+moderationsFrom+w.String(), w.values...).Scan(&count); err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load moderations")
+	}
+	rows, err := p.db.Query(`SELECT "op"."key", "op"."iri", "op"."submitted_at", "op"."action",
+"actor"."key", "actor"."handle", "actor"."iri", "moderator"."key", "moderator"."handle", "moderator"."iri",
+"report"."key", "report"."iri", "item"."key", "item"."iri", "account"."key", "account"."handle", "account"."iri"`+
+		moderationsFrom+w.String()+` ORDER BY "op"."id" DESC`+f.GetLimit(), w.values...)
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "unable to load moderations")
+	}
+	defer rows.Close()
+
+	ops := make(ModerationOps, 0)
+	for rows.Next() {
+		var key, action string
+		var actorKey, actorHandle, actorIRI, modKey, modHandle, modIRI sql.NullString
+		var reportKey, reportIRI, itemKey, itemIRI, accKey, accHandle, accIRI sql.NullString
+		op := ModerationOp{Metadata: &ModerationMetadata{}}
+		err := rows.Scan(&key, &op.Metadata.ID, &op.SubmittedAt, &action, &actorKey, &actorHandle, &actorIRI,
+			&modKey, &modHandle, &modIRI, &reportKey, &reportIRI, &itemKey, &itemIRI, &accKey, &accHandle, &accIRI)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "unable to load moderations")
+		}
+		op.Hash = Hash(key)
+		op.Action = ModerationAction(action)
+		op.SubmittedBy = accountFromColumns(actorKey, actorHandle, actorIRI)
+		op.Moderator = accountFromColumns(modKey, modHandle, modIRI)
+		if reportKey.Valid {
+			op.Report = &ItemReport{Hash: Hash(reportKey.String), Metadata: &ReportMetadata{ID: nullString(reportIRI)}}
+		}
+		op.Item = itemFromColumns(itemKey, itemIRI)
+		op.Account = accountFromColumns(accKey, accHandle, accIRI)
+		ops = append(ops, op)
+	}
+	return ops, count, rows.Err()
+}
+
+func (p *postgresRepository) SaveModeration(op ModerationOp) (ModerationOp, error) {
+	if !accountValidForC2S(op.SubmittedBy) {
+		return op, errors.Unauthorizedf("invalid account %s", op.SubmittedBy.Handle)
+	}
+	switch op.Action {
+	case ModerationDelete:
+		if !op.Item.IsValid() {
+			return op, errors.Newf("Invalid item to delete")
+		}
+		it := *op.Item
+		it.SubmittedBy = op.SubmittedBy
+		it.Delete()
+		if _, err := p.SaveItem(it); err != nil {
+			return op, err
+		}
+		op.Item = itemStub(op.Item)
+	case ModerationDismiss:
+		if !op.Report.HasMetadata() {
+			return op, errors.Newf("Invalid report")
+		}
+	case ModerationSuspend:
+		if !op.Report.HasMetadata() {
+			return op, errors.Newf("Invalid report")
+		}
+		if !op.Account.IsValid() {
+			return op, errors.Newf("Invalid account to suspend")
+		}
+		op.Account = accountStub(op.Account)
+	default:
+		return op, errors.NotValidf("invalid moderation action %q", op.Action)
+	}
+
+	actorID, err := p.rowID("accounts", op.SubmittedBy.Hash)
+	if err != nil {
+		return op, err
+	}
+	var moderatorID, reportID, itemID, accountID int64
+	if op.Moderator.IsValid() {
+		if moderatorID, err = p.rowID("accounts", op.Moderator.Hash); err != nil {
+			return op, err
+		}
+	}
+	if op.Report != nil && len(op.Report.Hash) > 0 {
+		if reportID, err = p.rowID("reports", op.Report.Hash); err != nil {
+			return op, err
+		}
+	}
+	if op.Item.IsValid() {
+		if itemID, err = p.rowID("items", op.Item.Hash); err != nil {
+			return op, err
+		}
+	}
+	if op.Account.IsValid() {
+		if accountID, err = p.rowID("accounts", op.Account.Hash); err != nil {
+			return op, err
+		}
+	}
+
+	op.Hash = newHash()
+	op.SubmittedAt = time.Now().UTC().Truncate(time.Microsecond)
+	op.SubmittedBy = accountStub(op.SubmittedBy)
+	op.Moderator = accountStub(op.Moderator)
+	if op.Report != nil {
+		op.Report = &ItemReport{Hash: op.Report.Hash, Metadata: op.Report.Metadata}
+	}
+	op.Metadata = &ModerationMetadata{
+		ID: fmt.Sprintf("%s/activities/%s", BaseURL, op.Hash),
+	}
+	_, err = p.db.Exec(`INSERT INTO "moderations" ("key", "iri", "submitted_at", "submitted_by", "moderator_id", "action",
+"report_id", "item_id", "account_id") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		op.Hash.String(), op.Metadata.ID, op.SubmittedAt, actorID, nullID(moderatorID), string(op.Action),
+		nullID(reportID), nullID(itemID), nullID(accountID))
+	if err != nil {
+		return op, errors.Annotatef(err, "unable to save moderation")
+	}
+	return op, nil
+}
+
+func (p *postgresRepository) WithAccount(a *Account) error {
+	p.account = a
+	return nil
+}
+
+func (p *postgresRepository) LoadInfo() (WebInfo, error) {
+	return Instance.NodeInfo(), nil
+}
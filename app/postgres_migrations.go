@@ -0,0 +1,126 @@
+package app
+
+// migrations holds the changes to the database schema of the postgres storage backend, in the order
+// they get applied. A released migration never changes, changing the schema means adding a new one.
+var migrations = []string{
+	// 1: the initial schema
+	`CREATE TABLE "accounts" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"handle" VARCHAR NOT NULL,
+	"email" VARCHAR NOT NULL DEFAULT '',
+	"role" VARCHAR NOT NULL DEFAULT '',
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"created_by" INT REFERENCES "accounts" ("id"),
+	"updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"flags" SMALLINT NOT NULL DEFAULT 0,
+	"metadata" JSONB NOT NULL DEFAULT '{}',
+	"pw" BYTEA,
+	"salt" BYTEA
+);
+CREATE INDEX "accounts_iri_idx" ON "accounts" ("iri");
+CREATE INDEX "accounts_handle_idx" ON "accounts" ("handle");
+
+CREATE TABLE "items" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"type" VARCHAR NOT NULL DEFAULT '',
+	"mime_type" VARCHAR NOT NULL DEFAULT '',
+	"title" VARCHAR NOT NULL DEFAULT '',
+	"data" TEXT NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT REFERENCES "accounts" ("id"),
+	"updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"updated_by" INT REFERENCES "accounts" ("id"),
+	"flags" SMALLINT NOT NULL DEFAULT 0,
+	"local" BOOLEAN NOT NULL DEFAULT true,
+	"metadata" JSONB NOT NULL DEFAULT '{}',
+	"parent_id" INT REFERENCES "items" ("id"),
+	"op_id" INT REFERENCES "items" ("id")
+);
+CREATE INDEX "items_iri_idx" ON "items" ("iri");
+CREATE INDEX "items_submitted_at_idx" ON "items" ("submitted_at");
+CREATE INDEX "items_submitted_by_idx" ON "items" ("submitted_by");
+CREATE INDEX "items_parent_id_idx" ON "items" ("parent_id");
+CREATE INDEX "items_op_id_idx" ON "items" ("op_id");
+
+CREATE TABLE "votes" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"item_id" INT NOT NULL REFERENCES "items" ("id"),
+	"weight" INT NOT NULL,
+	"flags" SMALLINT NOT NULL DEFAULT 0,
+	UNIQUE ("submitted_by", "item_id")
+);
+CREATE INDEX "votes_item_id_idx" ON "votes" ("item_id");
+
+CREATE TABLE "follow_requests" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"object_id" INT NOT NULL REFERENCES "accounts" ("id"),
+	"accepted" BOOLEAN NOT NULL DEFAULT false,
+	"flags" SMALLINT NOT NULL DEFAULT 0,
+	UNIQUE ("submitted_by", "object_id")
+);
+
+CREATE TABLE "reports" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"item_id" INT NOT NULL REFERENCES "items" ("id"),
+	"reason" VARCHAR NOT NULL DEFAULT '',
+	"text" TEXT NOT NULL DEFAULT '',
+	"forward" BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE "moderations" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"moderator_id" INT REFERENCES "accounts" ("id"),
+	"action" VARCHAR NOT NULL,
+	"report_id" INT REFERENCES "reports" ("id"),
+	"item_id" INT REFERENCES "items" ("id"),
+	"account_id" INT REFERENCES "accounts" ("id")
+);`,
+	// 2: the accounts blocked by the users
+	`CREATE TABLE "blocks" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"object_id" INT NOT NULL REFERENCES "accounts" ("id"),
+	UNIQUE ("submitted_by", "object_id")
+);`,
+	// 3: the private messages the users have read
+	`CREATE TABLE "messages_read" (
+	"account_id" INT NOT NULL REFERENCES "accounts" ("id"),
+	"item_id" INT NOT NULL REFERENCES "items" ("id"),
+	"read_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY ("account_id", "item_id")
+);`,
+	// 4: the items shared by the users, the equivalent of the Announce activities
+	`CREATE TABLE "shares" (
+	"id" SERIAL PRIMARY KEY,
+	"key" VARCHAR(64) NOT NULL UNIQUE,
+	"iri" VARCHAR NOT NULL DEFAULT '',
+	"submitted_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"submitted_by" INT NOT NULL REFERENCES "accounts" ("id"),
+	"item_id" INT NOT NULL REFERENCES "items" ("id"),
+	UNIQUE ("submitted_by", "item_id")
+);`,
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+// postgresMock returns a repository using a new schema of the database in the DB_TEST_DSN environment variable,
+// which needs to be a key/value connection string, eg: "host=localhost user=littr dbname=littr_test sslmode=disable".
+// The returned function drops the schema.
+func postgresMock(t *testing.T) (*postgresRepository, func()) {
+	dsn := os.Getenv("DB_TEST_DSN")
+	if len(dsn) == 0 {
+		t.Skip("DB_TEST_DSN is not set, skipping the postgres tests")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("unable to open the test database: %s", err)
+	}
+	schema := fmt.Sprintf("littr_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec(fmt.Sprintf(`CREATE SCHEMA "%s"`, schema)); err != nil {
+		t.Fatalf("unable to create the test schema: %s", err)
+	}
+	drop := func() {
+		db.Exec(fmt.Sprintf(`DROP SCHEMA "%s" CASCADE`, schema))
+		db.Close()
+	}
+	noop := func(string, log.Ctx) {}
+	repo, err := newPostgresRepository(fmt.Sprintf("%s search_path=%s", dsn, schema), noop, noop)
+	if err != nil {
+		drop()
+		t.Fatalf("unable to migrate the test schema: %s", err)
+	}
+	return repo, func() {
+		repo.db.Close()
+		drop()
+	}
+}
+
+func Test_postgresRepository_Conformance(t *testing.T) {
+	testRepositoryConformance(t, func(t *testing.T) (Repository, func()) {
+		return postgresMock(t)
+	})
+}
+
+func Test_postgresRepository_Authenticate(t *testing.T) {
+	repo, cleanup := postgresMock(t)
+	defer cleanup()
+
+	jane, err := repo.SaveAccount(Account{Handle: "jane", Metadata: &AccountMetadata{Password: []byte("secret")}})
+	if err != nil {
+		t.Fatalf("unable to save account: %s", err)
+	}
+	if len(jane.Metadata.Password) > 0 {
+		t.Errorf("the saved account must not contain the password")
+	}
+	if err := repo.Authenticate(jane, "secret"); err != nil {
+		t.Errorf("unable to authenticate with the correct password: %s", err)
+	}
+	if err := repo.Authenticate(jane, "guess"); err == nil {
+		t.Errorf("the authentication with a wrong password must fail")
+	}
+}
+
+func Test_postgresRepository_Migrate(t *testing.T) {
+	repo, cleanup := postgresMock(t)
+	defer cleanup()
+
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("applying the migrations again must not fail: %s", err)
+	}
+	var cnt int
+	repo.db.QueryRow(`SELECT COUNT(*) FROM "schema_migrations"`).Scan(&cnt)
+	if cnt != len(migrations) {
+		t.Errorf("Applied migrations count must be %d, received %d", len(migrations), cnt)
+	}
+}
+
+func Test_pgWhere(t *testing.T) {
+	w := pgWhere{}
+	w.add(LoadAccountsFilter{Handle: []string{"jane", "john"}}.GetWhereClauses())
+	w.add([]string{`"accounts"."role" = ?0`}, []interface{}{"admin"})
+
+	expected := ` WHERE ("accounts"."handle" = $1 OR "accounts"."handle" = $2) AND "accounts"."role" = $3`
+	if w.String() != expected {
+		t.Errorf("WHERE clause must be %q, received %q", expected, w.String())
+	}
+	if len(w.values) != 3 || w.values[2] != "admin" {
+		t.Errorf("the values must follow the order of the placeholders, received %v", w.values)
+	}
+	if (pgWhere{}).String() != "" {
+		t.Errorf("an empty WHERE clause must be empty")
+	}
+}
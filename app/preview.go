@@ -0,0 +1,439 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/littr.go/internal/cache"
+	"github.com/mariusor/littr.go/internal/log"
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	// previewTimeout is the maximum time we wait for the page of a submitted link, including redirects
+	previewTimeout = 5 * time.Second
+	// previewMaxSize is the maximum size of the page we read, the metadata we're interested in is in its head
+	previewMaxSize = 512 * 1024
+	// previewMaxRedirects is the number of redirects we follow before giving up
+	previewMaxRedirects = 5
+	// previewMaxDescription is the number of characters of the description we keep
+	previewMaxDescription = 300
+	// previewImageMaxSize is the maximum size of the preview images and icons we serve
+	previewImageMaxSize = 1024 * 1024
+	// previewImagesCacheSize is the number of preview images we keep in memory
+	previewImagesCacheSize = 256
+	// previewImageTTL is how long we keep a preview image before loading it again
+	previewImageTTL = 24 * time.Hour
+	// previewImageErrTTL is how long we wait before trying again to load a preview image that failed
+	previewImageErrTTL = 10 * time.Minute
+)
+
+// linkPreview is the metadata we extract from the page of a submitted link
+type linkPreview struct {
+	Title       string
+	Description string
+	Canonical   string
+	Icon        ImageMetadata
+	Image       ImageMetadata
+}
+
+// previewImage is an image or icon of a link preview, which we serve from our own origin, so the
+// browsers of our visitors don't connect to the hosts of the links
+type previewImage struct {
+	MimeType string
+	Data     []byte
+}
+
+// previewFetcher loads the pages of the submitted links and extracts their preview metadata
+type previewFetcher struct {
+	client *http.Client
+	images *cache.LRU
+	ua     string
+}
+
+// privateNetworks are the address ranges we refuse to connect to, so the users can't make
+// us send requests to the services on our own network
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, _ := net.ParseCIDR(c)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPrivateIP checks if the address is part of a private, loopback, link local or otherwise reserved range
+func isPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// denyPrivateAddresses is used as the control function of the dialer, it gets called with the
+// resolved address, so the host names pointing to private addresses are refused too
+func denyPrivateAddresses(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return errors.Forbiddenf("address %s is not allowed", host)
+	}
+	return nil
+}
+
+// publicTransport returns a transport which refuses to connect to private addresses, for the requests
+// to the URLs the users give us
+func publicTransport(timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: denyPrivateAddresses,
+	}
+	return &http.Transport{
+		// the proxy from the environment is not used, it would be the one connecting to the private addresses
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+func newPreviewFetcher(ua string) *previewFetcher {
+	return &previewFetcher{
+		client: &http.Client{
+			Transport:     publicTransport(previewTimeout),
+			Timeout:       previewTimeout,
+			CheckRedirect: checkPreviewRedirect,
+		},
+		images: cache.New(previewImagesCacheSize),
+		ua:     ua,
+	}
+}
+
+func checkPreviewRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= previewMaxRedirects {
+		return errors.Newf("stopped after %d redirects", previewMaxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return errors.Forbiddenf("invalid redirect to %s", req.URL)
+	}
+	return nil
+}
+
+// Fetch loads the page at the u URL and returns its preview
+func (p *previewFetcher) Fetch(u string) (linkPreview, error) {
+	lp := linkPreview{}
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return lp, errors.NewBadRequest(err, "invalid link %s", u)
+	}
+	if pu.Scheme != "http" && pu.Scheme != "https" {
+		return lp, errors.BadRequestf("invalid link %s", u)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, pu.String(), nil)
+	if err != nil {
+		return lp, errors.Annotatef(err, "invalid request for %s", u)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/html, application/xhtml+xml")
+	if len(p.ua) > 0 {
+		req.Header.Set("User-Agent", p.ua)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return lp, errors.Annotatef(err, "unable to load %s", u)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return lp, errors.Newf("unable to load %s: %s", u, resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		return lp, errors.NotValidf("%s is not a HTML page", u)
+	}
+	// NOTE(marius): the relative URLs of the page are resolved against where we ended up after the redirects
+	return parsePreview(io.LimitReader(resp.Body, previewMaxSize), resp.Request.URL), nil
+}
+
+// Image loads the image at the u URL of a link preview, the images are kept in memory for previewImageTTL
+// and the failures for previewImageErrTTL.
+// We only serve raster images: the SVG ones can contain scripts, which would run on our origin.
+func (p *previewFetcher) Image(u string) (previewImage, error) {
+	if p.images != nil {
+		if img, ok := p.images.Load(u); ok {
+			if img, ok := img.(previewImage); ok && len(img.Data) > 0 {
+				return img, nil
+			}
+			return previewImage{}, errors.NotFoundf("image %s", u)
+		}
+	}
+	img, err := p.loadImage(u)
+	if p.images != nil {
+		ttl := previewImageTTL
+		if err != nil {
+			ttl = previewImageErrTTL
+		}
+		p.images.Store(u, img, ttl)
+	}
+	return img, err
+}
+
+func (p *previewFetcher) loadImage(u string) (previewImage, error) {
+	img := previewImage{}
+	pu, err := url.Parse(u)
+	if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") {
+		return img, errors.BadRequestf("invalid image %s", u)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, pu.String(), nil)
+	if err != nil {
+		return img, errors.Annotatef(err, "invalid request for %s", u)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "image/*")
+	if len(p.ua) > 0 {
+		req.Header.Set("User-Agent", p.ua)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return img, errors.Annotatef(err, "unable to load %s", u)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return img, errors.Newf("unable to load %s: %s", u, resp.Status)
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mt, "image/") || mt == "image/svg+xml" {
+		return img, errors.NotValidf("%s is not a supported image", u)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, previewImageMaxSize+1))
+	if err != nil {
+		return img, errors.Annotatef(err, "unable to load %s", u)
+	}
+	if len(data) > previewImageMaxSize {
+		return img, errors.NotValidf("%s is larger than %d bytes", u, previewImageMaxSize)
+	}
+	img.MimeType = mt
+	img.Data = data
+	return img, nil
+}
+
+// parsePreview extracts the preview metadata from the head of the HTML page, the OpenGraph values take
+// precedence over the regular title and description
+func parsePreview(r io.Reader, base *url.URL) linkPreview {
+	lp := linkPreview{}
+
+	var title, description, ogTitle, ogDescription string
+	inTitle := false
+	z := nethtml.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case nethtml.ErrorToken:
+			break loop
+		case nethtml.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case nethtml.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = len(title) == 0
+			case "body":
+				break loop
+			case "meta":
+				content := attrs["content"]
+				switch strings.ToLower(attrs["property"]) {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if len(lp.Image.URI) == 0 {
+						lp.Image.URI = resolvePreviewURL(base, content)
+					}
+				case "og:image:type":
+					lp.Image.MimeType = content
+				case "og:url":
+					if len(lp.Canonical) == 0 {
+						lp.Canonical = resolvePreviewURL(base, content)
+					}
+				}
+				if strings.ToLower(attrs["name"]) == "description" {
+					description = content
+				}
+			case "link":
+				href := resolvePreviewURL(base, attrs["href"])
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					switch rel {
+					case "canonical":
+						lp.Canonical = href
+					case "icon":
+						if len(lp.Icon.URI) == 0 {
+							lp.Icon = ImageMetadata{URI: href, MimeType: attrs["type"]}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	lp.Title = previewText(title, 0)
+	if len(ogTitle) > 0 {
+		lp.Title = previewText(ogTitle, 0)
+	}
+	lp.Description = previewText(description, previewMaxDescription)
+	if len(ogDescription) > 0 {
+		lp.Description = previewText(ogDescription, previewMaxDescription)
+	}
+	if len(lp.Image.URI) == 0 {
+		lp.Image.MimeType = ""
+	}
+	return lp
+}
+
+// resolvePreviewURL returns the absolute URL of the ref, it only accepts http(s) URLs, the pages can
+// contain links with any scheme, and we render these in the listings
+func resolvePreviewURL(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || len(ref) == 0 {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// previewText collapses the white space of s and truncates it to max characters, when max is not 0
+func previewText(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); max > 0 && len(r) > max {
+		s = strings.TrimSpace(string(r[:max])) + "…"
+	}
+	return s
+}
+
+// Apply copies the preview to the metadata of the item, the title is used only when the item doesn't have one
+func (lp linkPreview) Apply(it *Item) {
+	if it.Metadata == nil {
+		it.Metadata = &ItemMetadata{}
+	}
+	if len(strings.TrimSpace(it.Title)) == 0 {
+		it.Title = lp.Title
+	}
+	it.Metadata.Description = lp.Description
+	it.Metadata.Canonical = lp.Canonical
+	it.Metadata.Icon = lp.Icon
+	it.Metadata.Image = lp.Image
+}
+
+// previewLink returns the link to the image or the icon, depending on kind, of the preview of the it link,
+// which we serve from our own origin
+func previewLink(it Item, kind string) string {
+	return fmt.Sprintf("/preview/%s/%s", it.Hash, kind)
+}
+
+// ShowPreviewImage serves GET /preview/{hash}/{kind} requests, with the image or the icon of the preview
+// of a link. We load them ourselves, so the browsers of the visitors don't connect to the hosts of the links.
+func (h *handler) ShowPreviewImage(w http.ResponseWriter, r *http.Request) {
+	if h.preview == nil {
+		http.NotFound(w, r)
+		return
+	}
+	hash := chi.URLParam(r, "hash")
+	it, err := h.storage.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{Hash(hash)}}})
+	if err != nil || !it.IsLink() || !it.Public() || it.Deleted() || !it.HasMetadata() {
+		http.NotFound(w, r)
+		return
+	}
+	var u string
+	switch chi.URLParam(r, "kind") {
+	case "image":
+		u = it.Metadata.Image.URI
+	case "icon":
+		u = it.Metadata.Icon.URI
+	}
+	if len(u) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	img, err := h.preview.Image(u)
+	if err != nil {
+		h.logger.WithContext(log.Ctx{
+			"hash": it.Hash,
+			"url":  u,
+		}).Debug(err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", img.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(previewImageTTL.Seconds())))
+	w.Write(img.Data)
+}
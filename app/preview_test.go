@@ -0,0 +1,261 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>  The   page
+title </title>
+<meta name="description" content="A page about things.">
+<meta property="og:image" content="/images/cover.png">
+<meta property="og:image:type" content="image/png">
+<link rel="canonical" href="https://example.com/page">
+<link rel="shortcut icon" href="/favicon.png" type="image/png">
+<link rel="stylesheet" href="javascript:alert(1)">
+</head>
+<body><title>not the title</title></body>
+</html>`
+
+func previewMock(t *testing.T, requests *int) (*httptest.Server, *previewFetcher) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(previewPage))
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		case "/images/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("cover"))
+		case "/images/icon.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+		case "/images/huge.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, previewImageMaxSize+1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	p := newPreviewFetcher("test")
+	// the stand-in server listens on the loopback interface, so we don't use the dialer refusing it
+	p.client.Transport = srv.Client().Transport
+	return srv, p
+}
+
+func Test_previewFetcher_Fetch(t *testing.T) {
+	requests := 0
+	srv, p := previewMock(t, &requests)
+	defer srv.Close()
+
+	lp, err := p.Fetch(srv.URL + "/moved")
+	if err != nil {
+		t.Fatalf("unable to load the preview: %s", err)
+	}
+	want := linkPreview{
+		Title:       "The page title",
+		Description: "A page about things.",
+		Canonical:   "https://example.com/page",
+		Icon:        ImageMetadata{URI: srv.URL + "/favicon.png", MimeType: "image/png"},
+		Image:       ImageMetadata{URI: srv.URL + "/images/cover.png", MimeType: "image/png"},
+	}
+	if lp != want {
+		t.Errorf("Preview must be %#v, received %#v", want, lp)
+	}
+
+	if _, err := p.Fetch(srv.URL + "/data.json"); err == nil {
+		t.Errorf("loading a non HTML document must fail")
+	}
+	if _, err := p.Fetch(srv.URL + "/missing"); err == nil {
+		t.Errorf("loading a missing page must fail")
+	}
+	requests = 0
+	if _, err := p.Fetch("file:///etc/passwd"); err == nil || requests > 0 {
+		t.Errorf("loading a non HTTP link must fail without a request")
+	}
+}
+
+func Test_previewFetcher_FetchPrivate(t *testing.T) {
+	requests := 0
+	srv, _ := previewMock(t, &requests)
+	defer srv.Close()
+
+	if _, err := newPreviewFetcher("test").Fetch(srv.URL + "/page"); err == nil {
+		t.Errorf("loading a page from a private address must fail")
+	}
+	if requests > 0 {
+		t.Errorf("Requests count to a private address must be %d, received %d", 0, requests)
+	}
+}
+
+func Test_previewFetcher_Image(t *testing.T) {
+	requests := 0
+	srv, p := previewMock(t, &requests)
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		img, err := p.Image(srv.URL + "/images/cover.png")
+		if err != nil {
+			t.Fatalf("unable to load the image: %s", err)
+		}
+		if img.MimeType != "image/png" || string(img.Data) != "cover" {
+			t.Errorf("Image must be the %q %s, received %q %s", "cover", "image/png", img.Data, img.MimeType)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Requests count must be %d for a cached image, received %d", 1, requests)
+	}
+	for _, path := range []string{"/images/icon.svg", "/images/huge.png", "/page", "/missing.png"} {
+		if _, err := p.Image(srv.URL + path); err == nil {
+			t.Errorf("loading %s as a preview image must fail", path)
+		}
+	}
+}
+
+func Test_ShowPreviewImage(t *testing.T) {
+	requests := 0
+	srv, p := previewMock(t, &requests)
+	defer srv.Close()
+
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	it := Item{Title: "page", Data: srv.URL + "/page", MimeType: MimeTypeURL, SubmittedBy: &jane, Metadata: &ItemMetadata{
+		Image: ImageMetadata{URI: srv.URL + "/images/cover.png", MimeType: "image/png"},
+	}}
+	it = mockItem(t, repo, it)
+	private := it
+	private.Hash = Hash{}
+	private.MakePrivate()
+	private = mockItem(t, repo, private)
+
+	h := mockHandler(repo)
+	h.preview = p
+	tests := []struct {
+		item   Item
+		kind   string
+		status int
+	}{
+		{item: it, kind: "image", status: http.StatusOK},
+		{item: it, kind: "icon", status: http.StatusNotFound},
+		{item: it, kind: "bogus", status: http.StatusNotFound},
+		{item: private, kind: "image", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, previewLink(tt.item, tt.kind), nil)
+		w := httptest.NewRecorder()
+		h.ShowPreviewImage(w, withHandlerContext(r, repo, nil, "hash", tt.item.Hash.String(), "kind", tt.kind))
+		if w.Code != tt.status {
+			t.Errorf("Status of %s must be %d, received %d", r.URL.Path, tt.status, w.Code)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, previewLink(it, "image"), nil)
+	w := httptest.NewRecorder()
+	h.ShowPreviewImage(w, withHandlerContext(r, repo, nil, "hash", it.Hash.String(), "kind", "image"))
+	if w.Header().Get("Content-Type") != "image/png" || w.Body.String() != "cover" {
+		t.Errorf("Preview image must be served from our origin, received %q %s", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
+
+func Test_isPrivateIP(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.20.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"0.0.0.0":          true,
+		"::1":              true,
+		"fd00::1":          true,
+		"::ffff:127.0.0.1": true,
+		"93.184.216.34":    false,
+		"2606:4700::1111":  false,
+	}
+	for addr, private := range tests {
+		if isPrivateIP(net.ParseIP(addr)) != private {
+			t.Errorf("Address %s private must be %t", addr, private)
+		}
+	}
+}
+
+func Test_parsePreview_OpenGraph(t *testing.T) {
+	page := `<html><head><title>Title</title>
+<meta property="og:title" content="OpenGraph title">
+<meta property="og:description" content="` + strings.Repeat("word ", 100) + `">
+<meta property="og:url" content="https://example.com/og">
+</head></html>`
+	base, _ := url.Parse("https://example.com/article?id=1")
+	lp := parsePreview(strings.NewReader(page), base)
+	if lp.Title != "OpenGraph title" {
+		t.Errorf("Title must be %q, received %q", "OpenGraph title", lp.Title)
+	}
+	if len([]rune(lp.Description)) > previewMaxDescription+1 {
+		t.Errorf("Description must be truncated to %d characters, received %d", previewMaxDescription, len(lp.Description))
+	}
+	if lp.Canonical != "https://example.com/og" {
+		t.Errorf("Canonical URL must be %q, received %q", "https://example.com/og", lp.Canonical)
+	}
+	if len(lp.Icon.URI) > 0 {
+		t.Errorf("Icon must be empty when the page doesn't declare one, received %q", lp.Icon.URI)
+	}
+}
+
+func Test_HandleSubmit_LinkPreview(t *testing.T) {
+	requests := 0
+	srv, p := previewMock(t, &requests)
+	defer srv.Close()
+
+	repo := InMemoryService(appConfig{})
+	jane := mockAccount(t, repo, "jane")
+	h := mockHandler(repo)
+	h.preview = p
+	form := url.Values{}
+	form.Set("data", srv.URL+"/page")
+	form.Set("title", "")
+	r := mockFormRequest(http.MethodPost, "/submit", form)
+
+	w := httptest.NewRecorder()
+	h.HandleSubmit(w, withHandlerContext(r, repo, &jane))
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Status must be %d, received %d", http.StatusSeeOther, w.Code)
+	}
+	items, _, _ := repo.LoadItems(Filters{})
+	it, err := items.First()
+	if err != nil {
+		t.Fatalf("the item was not saved")
+	}
+	if it.Title != "The page title" {
+		t.Errorf("Title must be pre-filled with %q, received %q", "The page title", it.Title)
+	}
+	if it.Metadata.Description != "A page about things." || it.Metadata.Icon.URI != srv.URL+"/favicon.png" {
+		t.Errorf("Item metadata must contain the preview, received %#v", it.Metadata)
+	}
+}
+
+func Test_FromArticle_ImageWithoutURL(t *testing.T) {
+	page := pub.ObjectNew(pub.PageType)
+	page.URL = pub.IRI("https://example.com/page")
+	page.Image = &pub.Object{Type: pub.ImageType, MediaType: "image/png"}
+
+	it := Item{}
+	if err := FromArticle(&it, page); err != nil {
+		t.Fatalf("the page must be loaded: %s", err)
+	}
+	if it.Data != "https://example.com/page" || len(it.Metadata.Image.URI) > 0 {
+		t.Errorf("Item must be the link without an image, received %q with image %q", it.Data, it.Metadata.Image.URI)
+	}
+}
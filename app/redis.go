@@ -0,0 +1,270 @@
+package app
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	j "github.com/go-ap/jsonld"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+const (
+	defaultRedisPort      = "6379"
+	redisSessionPrefix    = "littr:session:"
+	redisCachePrefix      = "littr:cache:"
+	redisCacheIndexPrefix = "littr:cache-index:"
+	defaultSessionAge     = 86400 * 30
+	redisMaxIdle          = 8
+	redisIdleTimeout      = 5 * time.Minute
+)
+
+// redisClient returns a pool of connections to the Redis server in the configuration
+func redisClient(c backendConfig) *redis.Pool {
+	host := c.Host
+	if len(host) == 0 {
+		host = "localhost"
+	}
+	port := c.Port
+	if len(port) == 0 {
+		port = defaultRedisPort
+	}
+	return redisPool(fmt.Sprintf("%s:%s", host, port), c.Pw)
+}
+
+func redisPool(addr, pw string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     redisMaxIdle,
+		IdleTimeout: redisIdleTimeout,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialPassword(pw))
+		},
+	}
+}
+
+// redisDo runs a single command on a connection from the pool
+func redisDo(p *redis.Pool, cmd string, args ...interface{}) (interface{}, error) {
+	c := p.Get()
+	defer c.Close()
+	return c.Do(cmd, args...)
+}
+
+// redisSet runs SET for key, a zero ttl means the key never expires
+func redisSet(p *redis.Pool, key string, val []byte, ttl time.Duration) error {
+	args := []interface{}{key, val}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	_, err := redisDo(p, "SET", args...)
+	return err
+}
+
+// redisStore keeps the session values in Redis, the cookie holds only the session ID.
+// The values expire together with the session cookie, so every replica of the frontend sees the same sessions.
+type redisStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	client  *redis.Pool
+}
+
+func initRedisSession(c *redis.Pool, h string, secure bool, k ...[]byte) (sessions.Store, error) {
+	ss := &redisStore{
+		Codecs: securecookie.CodecsFromPairs(k...),
+		Options: &sessions.Options{
+			Domain:   h,
+			Path:     "/",
+			MaxAge:   defaultSessionAge,
+			HttpOnly: true,
+			Secure:   secure,
+		},
+		client: c,
+	}
+	for _, codec := range ss.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			// NOTE(marius): the values don't need to fit in a cookie
+			sc.MaxLength(0)
+			sc.MaxAge(ss.Options.MaxAge)
+		}
+	}
+	return ss, nil
+}
+
+func (s *redisStore) key(id string) string {
+	return redisSessionPrefix + id
+}
+
+// Get returns a session for the given name after adding it to the registry
+func (s *redisStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+// A session which expired from Redis is returned as a new one.
+func (s *redisStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+	data, err := redis.Bytes(redisDo(s.client, "GET", s.key(session.ID)))
+	if err == redis.ErrNil {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := securecookie.DecodeMulti(name, string(data), &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session values in Redis, for as long as the session's MaxAge, and sets the session cookie.
+// If MaxAge is <= 0 the session gets deleted.
+func (s *redisStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if len(session.ID) > 0 {
+			if _, err := redisDo(s.client, "DEL", s.key(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if err := redisSet(s.client, s.key(session.ID), []byte(encoded), ttl); err != nil {
+		return err
+	}
+	id, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), id, session.Options))
+	return nil
+}
+
+// redisCache is a Cache shared by all the replicas of the frontend. It stores the ActivityPub items
+// loaded from FedBOX as JSON.
+// The keys of the entries which have a query string are indexed in a set for the key without it, so
+// Remove doesn't need to scan the key space for finding them.
+type redisCache struct {
+	client *redis.Pool
+	errFn  LogFn
+}
+
+// redisIndexScript adds a key to an index set, keeping the set for at least as long as the key it adds.
+// The set is loaded with PTTL before adding to it, as a missing set and one without an expiry both return a negative value.
+var redisIndexScript = redis.NewScript(1, `
+local ttl = tonumber(ARGV[2])
+local cur = redis.call('PTTL', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif cur == -2 or (cur >= 0 and cur < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// cacheIndexKey returns the key of the set indexing the entries which only differ from key by their query string
+func cacheIndexKey(key string) (string, bool) {
+	i := strings.Index(key, "?")
+	if i < 0 {
+		return "", false
+	}
+	return redisCacheIndexPrefix + key[:i], true
+}
+
+// Load returns the item stored for key, if it exists and it hasn't expired
+func (c redisCache) Load(key string) (interface{}, bool) {
+	data, err := redis.Bytes(redisDo(c.client, "GET", redisCachePrefix+key))
+	if err != nil {
+		if err != redis.ErrNil {
+			c.errFn("unable to load cache entry", log.Ctx{"key": key, "err": err})
+		}
+		return nil, false
+	}
+	it, err := pub.UnmarshalJSON(data)
+	if err != nil || it == nil {
+		return nil, false
+	}
+	return it, true
+}
+
+// Store saves the item for key, a zero ttl means the entry never expires
+func (c redisCache) Store(key string, val interface{}, ttl time.Duration) {
+	it, ok := val.(pub.Item)
+	if !ok {
+		return
+	}
+	data, err := j.Marshal(it)
+	if err != nil {
+		return
+	}
+	if err := redisSet(c.client, redisCachePrefix+key, data, ttl); err != nil {
+		c.errFn("unable to store cache entry", log.Ctx{"key": key, "err": err})
+		return
+	}
+	if index, ok := cacheIndexKey(key); ok {
+		conn := c.client.Get()
+		defer conn.Close()
+		if _, err := redisIndexScript.Do(conn, index, redisCachePrefix+key, int64(ttl/time.Millisecond)); err != nil {
+			c.errFn("unable to index cache entry", log.Ctx{"key": key, "err": err})
+		}
+	}
+}
+
+// Remove deletes the entries for the received keys, including the ones that only differ by their query string
+func (c redisCache) Remove(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	conn := c.client.Get()
+	defer conn.Close()
+
+	toRemove := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		index := redisCacheIndexPrefix + key
+		toRemove = append(toRemove, redisCachePrefix+key, index)
+		conn.Send("SMEMBERS", index)
+	}
+	if err := conn.Flush(); err != nil {
+		c.errFn("unable to load cache entries", log.Ctx{"keys": keys, "err": err})
+		return
+	}
+	for range keys {
+		found, err := redis.Strings(conn.Receive())
+		if err != nil {
+			c.errFn("unable to load cache entries", log.Ctx{"keys": keys, "err": err})
+			continue
+		}
+		for _, k := range found {
+			toRemove = append(toRemove, k)
+		}
+	}
+	if _, err := conn.Do("DEL", toRemove...); err != nil {
+		c.errFn("unable to remove cache entries", log.Ctx{"keys": keys, "err": err})
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	pub "github.com/go-ap/activitypub"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+func redisMock(t *testing.T) (*miniredis.Miniredis, *redis.Pool) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("unable to start redis server: %s", err)
+	}
+	srv.RequireAuth("secret")
+	return srv, redisPool(srv.Addr(), "secret")
+}
+
+func Test_redisStore(t *testing.T) {
+	srv, client := redisMock(t)
+	defer srv.Close()
+
+	gob.Register(Account{})
+	store, _ := initRedisSession(client, "", false, []byte("0123456789abcdef"), []byte("0123456789abcdef"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, err := store.New(r, sessionName)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !s.IsNew {
+		t.Errorf("a request without a cookie must have a new session")
+	}
+	s.Values[SessionUserKey] = Account{Handle: "jane"}
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, s); err != nil {
+		t.Fatalf("unable to save session: %s", err)
+	}
+	keys := srv.Keys()
+	if len(keys) != 1 || keys[0] != redisSessionPrefix+s.ID {
+		t.Fatalf("the session must be saved under %q, found %v", redisSessionPrefix+s.ID, keys)
+	}
+	if ttl := srv.TTL(keys[0]); ttl <= 0 || ttl > time.Duration(defaultSessionAge)*time.Second {
+		t.Errorf("the session must expire after %ds, its ttl is %s", defaultSessionAge, ttl)
+	}
+
+	cookies := w.Result().Cookies()
+	load := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		return r
+	}
+	s, err = store.New(load(), sessionName)
+	if err != nil {
+		t.Fatalf("unable to load session: %s", err)
+	}
+	if s.IsNew {
+		t.Errorf("the session must be loaded from redis")
+	}
+	if a, ok := s.Values[SessionUserKey].(Account); !ok || a.Handle != "jane" {
+		t.Errorf("the session must contain the account, found %#v", s.Values[SessionUserKey])
+	}
+
+	// a different store, like the one of another replica, sees the same session
+	other, _ := initRedisSession(redisPool(srv.Addr(), "secret"), "", false, []byte("0123456789abcdef"), []byte("0123456789abcdef"))
+	if s, _ := other.New(load(), sessionName); s.IsNew {
+		t.Errorf("the session must be visible to all the stores using the same server")
+	}
+
+	srv.FastForward(time.Duration(defaultSessionAge+1) * time.Second)
+	s, err = store.New(load(), sessionName)
+	if err != nil {
+		t.Fatalf("an expired session must not return an error: %s", err)
+	}
+	if !s.IsNew || len(s.Values) > 0 {
+		t.Errorf("an expired session must be new and empty")
+	}
+}
+
+func Test_redisStore_Delete(t *testing.T) {
+	srv, client := redisMock(t)
+	defer srv.Close()
+
+	store, _ := initRedisSession(client, "", false, []byte("0123456789abcdef"))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s, _ := store.New(r, sessionName)
+	s.Values["key"] = "value"
+	store.Save(r, httptest.NewRecorder(), s)
+
+	s.Options.MaxAge = -1
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, s); err != nil {
+		t.Fatalf("unable to delete session: %s", err)
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Errorf("the session must be removed from redis, found %v", keys)
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("the session cookie must be expired, received %v", c)
+	}
+}
+
+func Test_redisCache(t *testing.T) {
+	srv, client := redisMock(t)
+	defer srv.Close()
+
+	pub.ItemTyperFunc = pub.JSONGetItemByType
+	c := redisCache{client: client, errFn: func(s string, ctx log.Ctx) { t.Errorf("%s: %v", s, ctx) }}
+
+	ob := pub.ObjectNew(pub.NoteType)
+	ob.ID = "http://example.com/objects/1"
+	ob.Content = pub.NaturalLanguageValuesNew()
+	ob.Content.Set(pub.NilLangRef, "Lorem ipsum")
+	c.Store("http://example.com/objects/1", ob, time.Minute)
+	c.Store("http://example.com/objects/1?page=2", ob, time.Minute)
+	c.Store("http://example.com/objects/10", ob, time.Minute)
+
+	it, ok := c.Load("http://example.com/objects/1")
+	if !ok {
+		t.Fatalf("the item must be loaded from the cache")
+	}
+	if it.(pub.Item).GetLink() != ob.GetLink() {
+		t.Errorf("the cached item must have ID %s, received %s", ob.ID, it.(pub.Item).GetLink())
+	}
+
+	c.Remove("http://example.com/objects/1")
+	if _, ok := c.Load("http://example.com/objects/1?page=2"); ok {
+		t.Errorf("the entries differing by their query string must be removed")
+	}
+	if _, ok := c.Load("http://example.com/objects/10"); !ok {
+		t.Errorf("the entries only sharing a prefix must not be removed")
+	}
+	if keys := srv.Keys(); len(keys) != 1 || keys[0] != redisCachePrefix+"http://example.com/objects/10" {
+		t.Errorf("the removed entries must not leave their index behind, found %v", keys)
+	}
+
+	srv.FastForward(2 * time.Minute)
+	if _, ok := c.Load("http://example.com/objects/10"); ok {
+		t.Errorf("the expired entries must not be loaded")
+	}
+
+	// the index is kept for as long as its longest lived entry
+	c.Store("http://example.com/objects/2?page=1", ob, 2*time.Minute)
+	c.Store("http://example.com/objects/2?page=2", ob, time.Minute)
+	srv.FastForward(90 * time.Second)
+	c.Remove("http://example.com/objects/2")
+	if _, ok := c.Load("http://example.com/objects/2?page=1"); ok {
+		t.Errorf("the entries outliving the other entries of their index must be removed")
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+type ReportReason string
+
+const (
+	ReasonSpam     = ReportReason("spam")
+	ReasonAbuse    = ReportReason("abuse")
+	ReasonIllegal  = ReportReason("illegal")
+	ReasonOffTopic = ReportReason("off-topic")
+	ReasonOther    = ReportReason("other")
+)
+
+// ValidReportReasons are the categories a report can be filed under
+var ValidReportReasons = []ReportReason{ReasonSpam, ReasonAbuse, ReasonIllegal, ReasonOffTopic, ReasonOther}
+
+func (r ReportReason) IsValid() bool {
+	for _, v := range ValidReportReasons {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Label returns the text shown for the reason in the report form
+func (r ReportReason) Label() string {
+	switch r {
+	case ReasonSpam:
+		return "Spam or advertising"
+	case ReasonAbuse:
+		return "Harassment or hate speech"
+	case ReasonIllegal:
+		return "Illegal content"
+	case ReasonOffTopic:
+		return "Off-topic or low quality"
+	}
+	return "Something else"
+}
+
+type ItemReports []ItemReport
+
+// ItemReport represents a Flag activity submitted by an account about an item
+type ItemReport struct {
+	Hash        Hash            `json:"hash"`
+	SubmittedAt time.Time       `json:"-"`
+	SubmittedBy *Account        `json:"-"`
+	Item        *Item           `json:"-"`
+	Reason      ReportReason    `json:"reason"`
+	Text        string          `json:"text,omitempty"`
+	Metadata    *ReportMetadata `json:"-"`
+	// Forward is set for the copy of the report that gets delivered to the instance the item originates from
+	Forward bool `json:"-"`
+}
+
+type ReportMetadata struct {
+	ID string `json:"-"`
+}
+
+func (r ItemReport) HasMetadata() bool {
+	return r.Metadata != nil
+}
+
+func (r *ItemReport) FromActivityPub(it pub.Item) error {
+	if r == nil {
+		return nil
+	}
+	if it == nil {
+		return errors.Newf("nil item received")
+	}
+	if it.IsLink() {
+		iri := it.GetLink()
+		r.Hash.FromActivityPub(iri)
+		r.Metadata = &ReportMetadata{
+			ID: iri.String(),
+		}
+		return nil
+	}
+	return pub.OnActivity(it, func(a *pub.Activity) error {
+		if a.Type != pub.FlagType {
+			return errors.NotValidf("%s is not a %s activity", a.Type, pub.FlagType)
+		}
+		r.Hash.FromActivityPub(a)
+		reporter := Account{}
+		reporter.FromActivityPub(a.Actor)
+		r.SubmittedBy = &reporter
+		r.SubmittedAt = a.Published
+		r.Reason = ReportReason(a.Summary.First().Value)
+		r.Text = a.Content.First().Value
+		r.Metadata = &ReportMetadata{
+			ID: string(a.ID),
+		}
+
+		objects := pub.ItemCollection{a.Object}
+		if col, ok := a.Object.(pub.ItemCollection); ok {
+			objects = col
+		}
+		// NOTE(marius): the object of a Flag can also contain the author of the reported item, we skip it
+		for _, ob := range objects {
+			if ob == nil || pub.ActorTypes.Contains(ob.GetType()) {
+				continue
+			}
+			it := Item{}
+			if err := it.FromActivityPub(ob); err == nil {
+				r.Item = &it
+				break
+			}
+		}
+		return nil
+	})
+}
@@ -11,21 +11,85 @@ import (
 	"github.com/go-ap/errors"
 	"github.com/go-ap/handlers"
 	j "github.com/go-ap/jsonld"
+	"github.com/mariusor/littr.go/internal/cache"
 	"github.com/mariusor/littr.go/internal/log"
 	"github.com/mariusor/qstring"
 	"github.com/spacemonkeygo/httpsig"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Repository is the interface the handlers use for loading and saving littr content
+type Repository interface {
+	LoadItem(f Filters) (Item, error)
+	LoadItems(f Filters) (ItemCollection, uint, error)
+	SaveItem(it Item) (Item, error)
+	LoadVotes(f Filters) (VoteCollection, uint, error)
+	SaveVote(v Vote) (Vote, error)
+	ShareItem(acc Account, it Item) error
+	LoadAccount(f Filters) (Account, error)
+	LoadAccounts(f Filters) (AccountCollection, uint, error)
+	SaveAccount(a Account) (Account, error)
+	LoadFollowRequests(ed *Account, f Filters) (FollowRequests, uint, error)
+	FollowAccount(er, ed Account) error
+	UnfollowAccount(er, ed Account) error
+	SendFollowResponse(f FollowRequest, accept bool) error
+	LoadBlockedAccounts(er Account) (AccountCollection, uint, error)
+	BlockAccount(er, ed Account) error
+	UnblockAccount(er, ed Account) error
+	LoadMessages(acc Account, f Filters) (ItemCollection, uint, error)
+	LoadReadMessages(acc Account) (Hashes, error)
+	MarkMessagesRead(acc Account, items ...Item) error
+	LoadReports(f Filters) (ItemReports, uint, error)
+	SaveReport(r ItemReport) (ItemReport, error)
+	LoadModerations(f Filters) (ModerationOps, uint, error)
+	SaveModeration(m ModerationOp) (ModerationOp, error)
+	WithAccount(a *Account) error
+	LoadInfo() (WebInfo, error)
+}
+
+// passwordAuthenticator is implemented by the Repository types which keep the account passwords
+// themselves, instead of delegating the login to the FedBOX OAuth2 provider
+type passwordAuthenticator interface {
+	Authenticate(a Account, pw string) error
+}
+
+// remoteAccountLoader is implemented by the Repository types which can load the accounts of other instances,
+// the ones that can't only know about the accounts they store themselves
+type remoteAccountLoader interface {
+	LoadRemoteAccount(name, host string) (Account, error)
+}
+
+// accountAuthorizer is implemented by the Repository types which authorize their requests for an account,
+// withAccount returns a copy of the repository authorized for a, leaving the credentials of the shared one unchanged
+type accountAuthorizer interface {
+	withAccount(a *Account) Repository
+}
+
+// asAccount returns the repository to use for the operations done on behalf of a, like the ones of the
+// instance account. Unlike WithAccount, it's safe to use while other requests use the shared repository.
+func asAccount(repo Repository, a *Account) Repository {
+	if aa, ok := repo.(accountAuthorizer); ok {
+		return aa.withAccount(a)
+	}
+	return repo
+}
+
+// repository is the Repository implementation backed by a FedBOX instance
 type repository struct {
-	BaseURL string
-	app     *Account
-	fedbox  *fedbox
-	infoFn  LogFn
-	errFn   LogFn
+	BaseURL   string
+	fedbox    *fedbox
+	index     Index
+	webfinger *webFingerResolver
+	// app is the IRI of the instance actor, which stores the roles of the local actors
+	app    pub.IRI
+	roles  *rolesCache
+	infoFn LogFn
+	errFn  LogFn
 }
 
 // Repository middleware
@@ -37,27 +101,44 @@ func (h handler) Repository(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// defaultCacheSize is the maximum number of FedBOX responses kept in the in-process cache
+const defaultCacheSize = 1024
+
+// activitiesBatchSize is the number of activities we load with each request when we need all the pages of a collection
+const activitiesBatchSize = 100
+
 func ActivityPubService(c appConfig) *repository {
 	pub.ItemTyperFunc = pub.JSONGetItemByType
 
-	BaseURL = c.APIURL
-	ActorsURL = fmt.Sprintf("%s/actors", BaseURL)
-	ObjectsURL = fmt.Sprintf("%s/objects", BaseURL)
+	setAPIURL(c.APIURL)
 
 	infoFn := func(s string, ctx log.Ctx) {}
 	errFn := func(s string, ctx log.Ctx) {
+		if ctx == nil {
+			ctx = log.Ctx{}
+		}
 		ctx["client"] = "api"
 		c.Logger.WithContext(ctx).Error(s)
 	}
 	ua := fmt.Sprintf("%s-%s", Instance.HostName, Instance.Version)
 
-	f, _ := NewClient(SetURL(BaseURL), SetInfoLogger(infoFn), SetErrorLogger(errFn), SetUA(ua))
+	opts := []OptionFn{SetURL(BaseURL), SetInfoLogger(infoFn), SetErrorLogger(errFn), SetUA(ua)}
+	switch c.CacheBackend {
+	case "none":
+	case "redis":
+		opts = append(opts, SetCache(redisCache{client: redisClient(Instance.Config.Redis), errFn: errFn}))
+	default:
+		opts = append(opts, SetCache(cache.New(defaultCacheSize)))
+	}
+	f, _ := NewClient(opts...)
 
 	return &repository{
-		BaseURL: c.APIURL,
-		fedbox:  f,
-		infoFn: infoFn,
-		errFn: errFn,
+		BaseURL:   c.APIURL,
+		fedbox:    f,
+		webfinger: newWebFingerResolver(),
+		roles:     new(rolesCache),
+		infoFn:    infoFn,
+		errFn:     errFn,
 	}
 }
 
@@ -94,6 +175,12 @@ var BaseURL = "http://fedbox.git"
 var ActorsURL = fmt.Sprintf("%s/actors", BaseURL)
 var ObjectsURL = fmt.Sprintf("%s/objects", BaseURL)
 
+func setAPIURL(u string) {
+	BaseURL = u
+	ActorsURL = fmt.Sprintf("%s/actors", BaseURL)
+	ObjectsURL = fmt.Sprintf("%s/objects", BaseURL)
+}
+
 func apAccountID(a Account) pub.ID {
 	if len(a.Hash) >= 8 {
 		return pub.ID(fmt.Sprintf("%s/%s", ActorsURL, a.Hash.String()))
@@ -125,6 +212,24 @@ func BuildActorID(a Account) pub.ID {
 	return pub.ID(fmt.Sprintf("%s/%s", ActorsURL, url.PathEscape(a.Hash.String())))
 }
 
+// loadAPPreview sets the preview of the page a link item points to, the description goes in the summary
+// and the canonical URL in a link attachment
+func loadAPPreview(o *pub.Object, m ItemMetadata) {
+	if len(m.Description) > 0 {
+		o.Summary = pub.NaturalLanguageValuesNew()
+		o.Summary.Set(pub.NilLangRef, m.Description)
+	}
+	if len(m.Canonical) > 0 {
+		o.Attachment = &pub.Link{Type: pub.LinkType, Rel: "canonical", Href: pub.IRI(m.Canonical)}
+	}
+	if len(m.Icon.URI) > 0 {
+		o.Icon = &pub.Image{Type: pub.ImageType, MediaType: pub.MimeType(m.Icon.MimeType), URL: pub.IRI(m.Icon.URI)}
+	}
+	if len(m.Image.URI) > 0 {
+		o.Image = &pub.Image{Type: pub.ImageType, MediaType: pub.MimeType(m.Image.MimeType), URL: pub.IRI(m.Image.URI)}
+	}
+}
+
 func loadAPItem(item Item) pub.Item {
 	o := pub.Object{}
 
@@ -134,6 +239,9 @@ func loadAPItem(item Item) pub.Item {
 	if item.MimeType == MimeTypeURL {
 		o.Type = pub.PageType
 		o.URL = pub.IRI(item.Data)
+		if item.HasMetadata() {
+			loadAPPreview(&o, *item.Metadata)
+		}
 	} else {
 		wordCount := strings.Count(item.Data, " ") +
 			strings.Count(item.Data, "\t") +
@@ -258,10 +366,9 @@ func loadAPItem(item Item) pub.Item {
 		if m.Mentions != nil || m.Tags != nil {
 			o.Tag = make(pub.ItemCollection, 0)
 			for _, men := range m.Mentions {
-				// todo(marius): retrieve object ids of each mention and add it to the CC of the object
-				t := pub.Object{
-					ID:   pub.ID(men.URL),
+				t := pub.Mention{
 					Type: pub.MentionType,
+					Href: pub.IRI(men.URL),
 					Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: men.Name}},
 				}
 				o.Tag.Append(t)
@@ -286,7 +393,7 @@ func loadAPItem(item Item) pub.Item {
 func anonymousActor() *pub.Actor {
 	p := pub.Actor{}
 	name := pub.NaturalLanguageValues{
-		{pub.NilLangRef, Anonymous},
+		{Ref: pub.NilLangRef, Value: Anonymous},
 	}
 	p.ID = pub.ID(pub.PublicNS)
 	p.Type = pub.PersonType
@@ -388,7 +495,7 @@ func getSigner(pubKeyID pub.ID, key crypto.PrivateKey) *httpsig.Signer {
 }
 
 func (r *repository) WithAccount(a *Account) error {
-	r.fedbox.SignFn(func(req *http.Request) error {
+	r.fedbox.Authorize(a.IsValid() && a.IsLogged(), func(req *http.Request) error {
 		// TODO(marius): this needs to be added to the federated requests, which we currently don't support
 		if !a.IsValid() || !a.IsLogged() {
 			return nil
@@ -408,6 +515,14 @@ func (r *repository) WithAccount(a *Account) error {
 	return nil
 }
 
+// withAccount returns a copy of the repository with its own FedBOX client, authorized for a
+func (r *repository) withAccount(a *Account) Repository {
+	scoped := *r
+	scoped.fedbox = r.fedbox.clone()
+	scoped.WithAccount(a)
+	return &scoped
+}
+
 func (r *repository) withAccountS2S(a *Account) error {
 	// TODO(marius): this needs to be added to the federated requests, which we currently don't support
 	if !a.IsValid() || !a.IsLogged() {
@@ -435,7 +550,7 @@ func (r *repository) withAccountS2S(a *Account) error {
 	}
 	p := *loadAPPerson(*a)
 	s := getSigner(p.PublicKey.ID, prv)
-	r.fedbox.SignFn(s.Sign)
+	r.fedbox.Authorize(true, s.Sign)
 
 	return nil
 }
@@ -458,6 +573,7 @@ func (r *repository) LoadItem(f Filters) (Item, error) {
 		var items ItemCollection
 		items, err = r.loadItemsAuthors(item)
 		items, err = r.loadItemsVotes(items...)
+		items, err = r.loadItemsShares(items...)
 		if len(items) > 0 {
 			item = items[0]
 		}
@@ -527,58 +643,123 @@ func (r *repository) loadAccountsFollowers(acc Account) (Account, error) {
 	if !acc.HasMetadata() || len(acc.Metadata.FollowersIRI) == 0 {
 		return acc, nil
 	}
-	it, err := r.fedbox.Collection(pub.IRI(acc.Metadata.FollowersIRI))
+	followers, err := r.loadCollectionAccounts(pub.IRI(acc.Metadata.FollowersIRI))
 	if err != nil {
 		r.errFn(err.Error(), nil)
-		return acc, nil
 	}
-	if !pub.CollectionTypes.Contains(it.GetType()) {
-		return acc, nil
-	}
-	pub.OnOrderedCollection(it, func(o *pub.OrderedCollection) error {
-		for _, fol := range o.Collection() {
-			if !pub.ActorTypes.Contains(fol.GetType()) {
-				continue
-			}
-			p := Account{}
-			p.FromActivityPub(fol)
-			if p.IsValid() {
-				acc.Followers = append(acc.Followers, p)
-			}
-		}
-		return nil
-	})
-
+	acc.Followers = followers
 	return acc, nil
 }
 
 func (r *repository) loadAccountsFollowing(acc Account) (Account, error) {
-	if !acc.HasMetadata() || len(acc.Metadata.FollowersIRI) == 0 {
+	if !acc.HasMetadata() || len(acc.Metadata.FollowingIRI) == 0 {
 		return acc, nil
 	}
-	it, err := r.fedbox.Collection(pub.IRI(acc.Metadata.FollowingIRI))
+	following, err := r.loadCollectionAccounts(pub.IRI(acc.Metadata.FollowingIRI))
 	if err != nil {
 		r.errFn(err.Error(), nil)
-		return acc, nil
 	}
-	if !pub.CollectionTypes.Contains(it.GetType()) {
+	acc.Following = following
+	return acc, nil
+}
+
+// loadAccountsFollowRefs loads the followers of acc and the accounts it follows, like loadAccountsFollowers and
+// loadAccountsFollowing, without dereferencing them: the accounts only have their hash and IRI.
+// It's what the session needs for checking the follows of the logged account.
+func (r *repository) loadAccountsFollowRefs(acc Account) (Account, error) {
+	if !acc.HasMetadata() {
 		return acc, nil
 	}
-	pub.OnOrderedCollection(it, func(o *pub.OrderedCollection) error {
-		for _, fol := range o.Collection() {
-			if !pub.ActorTypes.Contains(fol.GetType()) {
-				continue
-			}
-			p := Account{}
-			p.FromActivityPub(fol)
-			if p.IsValid() {
-				acc.Following = append(acc.Following, p)
+	var err error
+	if len(acc.Metadata.FollowersIRI) > 0 {
+		if acc.Followers, err = r.loadCollectionRefs(pub.IRI(acc.Metadata.FollowersIRI)); err != nil {
+			r.errFn(err.Error(), nil)
+		}
+	}
+	if len(acc.Metadata.FollowingIRI) > 0 {
+		if acc.Following, err = r.loadCollectionRefs(pub.IRI(acc.Metadata.FollowingIRI)); err != nil {
+			r.errFn(err.Error(), nil)
+		}
+	}
+	return acc, nil
+}
+
+// loadCollectionAccounts loads the actors of the collection at the i IRI, following its pages when it has any.
+// The actors which are only referenced by their IRI get dereferenced.
+func (r *repository) loadCollectionAccounts(i pub.IRI) (AccountCollection, error) {
+	accounts := make(AccountCollection, 0)
+	err := r.collectionPages(i, func(it pub.Item) {
+		if it.IsLink() {
+			act, err := r.fedbox.Actor(it.GetLink())
+			if err != nil {
+				r.errFn(err.Error(), log.Ctx{"iri": it.GetLink()})
+				return
 			}
+			it = act
+		}
+		if !pub.ActorTypes.Contains(it.GetType()) {
+			return
+		}
+		p := Account{}
+		p.FromActivityPub(it)
+		if p.IsValid() {
+			accounts = append(accounts, p)
 		}
-		return nil
 	})
+	return accounts, err
+}
 
-	return acc, nil
+// loadCollectionRefs loads the IRIs of the actors of the collection at the i IRI, following its pages when
+// it has any. The accounts only have their hash and IRI.
+func (r *repository) loadCollectionRefs(i pub.IRI) (AccountCollection, error) {
+	accounts := make(AccountCollection, 0)
+	err := r.collectionPages(i, func(it pub.Item) {
+		iri := it.GetLink()
+		if len(iri) == 0 {
+			return
+		}
+		p := Account{Metadata: &AccountMetadata{ID: iri.String()}}
+		p.Hash.FromActivityPub(iri)
+		if p.IsValid() {
+			accounts = append(accounts, p)
+		}
+	})
+	return accounts, err
+}
+
+// collectionPages calls fn for the items of the collection at the i IRI and of all its pages
+func (r *repository) collectionPages(i pub.IRI, fn func(pub.Item)) error {
+	seen := make(map[pub.IRI]bool)
+	for len(i) > 0 && !seen[i] {
+		seen[i] = true
+		col, err := r.fedbox.Collection(i)
+		if err != nil {
+			return err
+		}
+		for _, it := range col.Collection() {
+			fn(it)
+		}
+		i = ""
+		var next pub.Item
+		switch c := col.(type) {
+		case *pub.OrderedCollection:
+			if len(c.OrderedItems) == 0 {
+				next = c.First
+			}
+		case *pub.Collection:
+			if len(c.Items) == 0 {
+				next = c.First
+			}
+		case *pub.OrderedCollectionPage:
+			next = c.Next
+		case *pub.CollectionPage:
+			next = c.Next
+		}
+		if next != nil {
+			i = next.GetLink()
+		}
+	}
+	return nil
 }
 
 func (r *repository) loadItemsReplies(items ...Item) (ItemCollection, error) {
@@ -625,7 +806,7 @@ func (r *repository) loadItemsVotes(items ...Item) (ItemCollection, error) {
 	for k, it := range items {
 		for _, vot := range votes {
 			if bytes.Equal(vot.Item.Hash, it.Hash) {
-				it.Score += vot.Weight
+				it.AddVote(vot)
 			}
 		}
 		col[k] = it
@@ -633,6 +814,80 @@ func (r *repository) loadItemsVotes(items ...Item) (ItemCollection, error) {
 	return col, nil
 }
 
+// loadItemsObjects replaces the items we only know the IRI of, like the objects of the activities in the inboxes,
+// with the objects loaded from FedBOX
+func (r *repository) loadItemsObjects(items ...Item) (ItemCollection, error) {
+	toLoad := make(Hashes, 0)
+	for _, i := range items {
+		if i.IsValid() && !i.Deleted() && i.SubmittedAt.IsZero() {
+			toLoad = append(toLoad, Hash(i.Metadata.ID))
+		}
+	}
+	if len(toLoad) == 0 {
+		return items, nil
+	}
+	f := Filters{LoadItemsFilter: LoadItemsFilter{Key: toLoad}}
+	col, err := r.fedbox.Collection(pub.IRI(fmt.Sprintf("%s/objects", r.BaseURL)), Values(f))
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return items, err
+	}
+	loaded := make(ItemCollection, 0)
+	for _, it := range col.Collection() {
+		i := Item{}
+		if err := i.FromActivityPub(it); err != nil {
+			r.errFn(err.Error(), nil)
+			continue
+		}
+		loaded = append(loaded, i)
+	}
+	res := make(ItemCollection, 0, len(items))
+	for _, i := range items {
+		if !i.SubmittedAt.IsZero() || i.Deleted() {
+			res = append(res, i)
+			continue
+		}
+		for _, l := range loaded {
+			if HashesEqual(l.Hash, i.Hash) {
+				l.SharedBy = i.SharedBy
+				res = append(res, l)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// loadItemsShares counts the Announce activities of the items from the instance's inbox, where the shares
+// of our users and the ones from other instances end up
+func (r *repository) loadItemsShares(items ...Item) (ItemCollection, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+	f := Filters{}
+	f.Type = pub.ActivityVocabularyTypes{pub.AnnounceType}
+	for _, it := range items {
+		f.LoadVotesFilter.ItemKey = append(f.LoadVotesFilter.ItemKey, it.Hash)
+	}
+	f.LoadVotesFilter.ItemKey = hashesUnique(f.LoadVotesFilter.ItemKey)
+	col, err := r.fedbox.Collection(pub.IRI(fmt.Sprintf("%s/inbox", r.BaseURL)), Values(f))
+	if err != nil {
+		return items, errors.Annotatef(err, "unable to load items shares")
+	}
+	for _, it := range col.Collection() {
+		shared := Item{}
+		if err := shared.FromActivityPub(it); err != nil {
+			continue
+		}
+		for k := range items {
+			if HashesEqual(items[k].Hash, shared.Hash) {
+				items[k].Shares++
+			}
+		}
+	}
+	return items, nil
+}
+
 func (r *repository) loadAuthors(items ...FollowRequest) ([]FollowRequest, error) {
 	if len(items) == 0 {
 		return items, nil
@@ -682,6 +937,9 @@ func (r *repository) loadItemsAuthors(items ...Item) (ItemCollection, error) {
 				}
 			}
 		}
+		if it.SharedBy.IsValid() && it.SharedBy.HasMetadata() && len(it.SharedBy.Metadata.ID) > 0 {
+			fActors.LoadAccountsFilter.Key = append(fActors.LoadAccountsFilter.Key, Hash(it.SharedBy.Metadata.ID))
+		}
 		if !it.SubmittedBy.IsValid() {
 			continue
 		}
@@ -711,6 +969,9 @@ func (r *repository) loadItemsAuthors(items ...Item) (ItemCollection, error) {
 			if it.UpdatedBy.IsValid() && accountsEqual(*it.UpdatedBy, auth) {
 				it.UpdatedBy = &(authors[a])
 			}
+			if it.SharedBy.IsValid() && accountsEqual(*it.SharedBy, auth) {
+				it.SharedBy = &(authors[a])
+			}
 			if !it.HasMetadata() {
 				continue
 			}
@@ -747,6 +1008,7 @@ func (r *repository) LoadItems(f Filters) (ItemCollection, uint, error) {
 		f.InReplyTo = nil
 		f.Type = pub.ActivityVocabularyTypes{
 			pub.CreateType,
+			pub.AnnounceType,
 		}
 	}
 	filterLocal := false
@@ -787,7 +1049,7 @@ func (r *repository) LoadItems(f Filters) (ItemCollection, uint, error) {
 		"url": url,
 	}
 
-	it, err := r.fedbox.Collection(pub.IRI(url), Values(f))
+	it, err := r.fedbox.Collection(pub.IRI(url), itemsValues(f))
 	if err != nil {
 		r.errFn(err.Error(), ctx)
 		return nil, 0, err
@@ -797,6 +1059,7 @@ func (r *repository) LoadItems(f Filters) (ItemCollection, uint, error) {
 	var count uint = 0
 	pub.OnOrderedCollection(it, func(col *pub.OrderedCollection) error {
 		count = col.TotalItems
+	loop:
 		for _, it := range col.OrderedItems {
 			if filterLocal && it.GetLink().Contains(pub.IRI(r.BaseURL), false) {
 				continue
@@ -812,6 +1075,12 @@ func (r *repository) LoadItems(f Filters) (ItemCollection, uint, error) {
 			if filterPrivate && i.Private() {
 				continue
 			}
+			for _, prev := range items {
+				if HashesEqual(prev.Hash, i.Hash) {
+					// NOTE(marius): an item can be both created and shared by the accounts an inbox belongs to
+					continue loop
+				}
+			}
 			items = append(items, i)
 		}
 		return nil
@@ -819,23 +1088,27 @@ func (r *repository) LoadItems(f Filters) (ItemCollection, uint, error) {
 
 	// TODO(marius): move this somewhere more palatable
 	//  it's currently done like this when loading from collections of Activities that only contain the ID of the object
-	toLoad := make(Hashes, 0)
-	for _, i := range items {
-		if i.IsValid() && !i.Deleted() && i.SubmittedAt.IsZero() {
-			toLoad = append(toLoad, Hash(i.Metadata.ID))
-		}
+	items, err = r.loadItemsObjects(items...)
+	if err != nil {
+		return nil, 0, err
 	}
-	if len(toLoad) > 0 {
-		return r.LoadItems(Filters{
-			LoadItemsFilter: LoadItemsFilter{
-				Key: toLoad,
-			},
-		})
+	if filterPrivate {
+		// NOTE(marius): we know if the objects of the Announce activities are private only after loading them
+		public := make(ItemCollection, 0, len(items))
+		for _, i := range items {
+			if !i.Private() {
+				public = append(public, i)
+			}
+		}
+		items = public
 	}
 	items, err = r.loadItemsAuthors(items...)
 	if Instance.Config.VotingEnabled {
 		items, err = r.loadItemsVotes(items...)
 	}
+	if err == nil {
+		items, err = r.loadItemsShares(items...)
+	}
 
 	return items, count, err
 }
@@ -1072,10 +1345,50 @@ func (r *repository) getAuthorRequestURL(a *Account) string {
 	return reqURL
 }
 
+// SaveItem saves the item to FedBOX and updates its entry of the search index
 func (r *repository) SaveItem(it Item) (Item, error) {
+	it, err := r.saveItem(it)
+	if err != nil {
+		return it, err
+	}
+	if err := updateIndex(r.index, it); err != nil {
+		r.errFn("unable to update the search index", log.Ctx{"err": err, "item": it.Hash})
+	}
+	return it, nil
+}
+
+// resolveMentions replaces the guessed IRIs of the remote accounts mentioned in the item with the IRIs of
+// their actors, loaded through WebFinger, and adds the actors to the item's CC, so their instances notify them
+func (r *repository) resolveMentions(it *Item) {
+	if r.webfinger == nil || !it.HasMetadata() || len(it.Metadata.Mentions) == 0 {
+		return
+	}
+	md := *it.Metadata
+	md.Mentions = append(TagCollection{}, it.Metadata.Mentions...)
+	md.CC = append([]*Account{}, it.Metadata.CC...)
+	for k, men := range md.Mentions {
+		if isLocalMention(men) {
+			continue
+		}
+		host := mentionHost(men)
+		iri, err := r.webfinger.Resolve(men.Name, host)
+		if err != nil {
+			r.errFn("unable to resolve mention", log.Ctx{"err": err, "mention": fmt.Sprintf("%s@%s", men.Name, host)})
+			continue
+		}
+		md.Mentions[k].URL = iri.String()
+		md.CC = append(md.CC, &Account{Handle: men.Name, Metadata: &AccountMetadata{ID: iri.String()}})
+	}
+	it.Metadata = &md
+}
+
+func (r *repository) saveItem(it Item) (Item, error) {
 	if !it.SubmittedBy.IsValid() || !it.SubmittedBy.HasMetadata() {
 		return Item{}, errors.Newf("Invalid item submitter")
 	}
+	if !it.Deleted() {
+		r.resolveMentions(&it)
+	}
 	art := loadAPItem(it)
 	author := loadAPPerson(*it.SubmittedBy)
 	if !accountValidForC2S(it.SubmittedBy) {
@@ -1101,11 +1414,13 @@ func (r *repository) SaveItem(it Item) (Item, error) {
 				cc = append(cc, pub.IRI(rec.Metadata.ID))
 			}
 		}
-		if len(it.Metadata.Mentions) > 0 {
-			names := make([]string, 0)
-			for _, m := range it.Metadata.Mentions {
+		names := make([]string, 0)
+		for _, m := range it.Metadata.Mentions {
+			if isLocalMention(m) {
 				names = append(names, m.Name)
 			}
+		}
+		if len(names) > 0 {
 			ff := Filters{
 				LoadAccountsFilter: LoadAccountsFilter{
 					Handle: names,
@@ -1164,6 +1479,10 @@ func (r *repository) SaveItem(it Item) (Item, error) {
 		r.errFn(err.Error(), nil)
 		return it, err
 	}
+	if it.Deleted() {
+		// the tombstone of a deleted item has no author to load
+		return it, nil
+	}
 	items, err := r.loadItemsAuthors(it)
 	return items[0], err
 }
@@ -1188,12 +1507,106 @@ func (r *repository) LoadAccounts(f Filters) (AccountCollection, uint, error) {
 			}
 			accounts = append(accounts, acc)
 		}
+		r.loadAccountsRoles(accounts)
 		accounts, err = r.loadAccountsVotes(accounts...)
 		return err
 	})
 	return accounts, count, nil
 }
 
+// loadRoles loads the roles of the local actors from the instance actor
+func (r *repository) loadRoles() (*pub.Actor, map[pub.IRI]Role, error) {
+	if len(r.app) == 0 {
+		return nil, nil, errors.Errorf("the instance actor is not set")
+	}
+	app, err := r.fedbox.Actor(r.app)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, rolesFromTags(app.Tag), nil
+}
+
+// rolesTTL is how long we keep the roles of the local actors before loading them again from the instance actor
+const rolesTTL = time.Minute
+
+// rolesCache keeps the roles of the local actors, and serializes the updates of the instance actor storing them
+type rolesCache struct {
+	mu      sync.Mutex
+	roles   map[pub.IRI]Role
+	expires time.Time
+}
+
+// cachedRoles returns the roles of the local actors, loading them from the instance actor when they're not current
+func (r *repository) cachedRoles() (map[pub.IRI]Role, error) {
+	c := r.roles
+	if c == nil {
+		_, roles, err := r.loadRoles()
+		return roles, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roles != nil && time.Now().Before(c.expires) {
+		return c.roles, nil
+	}
+	_, roles, err := r.loadRoles()
+	if err != nil {
+		return nil, err
+	}
+	c.roles, c.expires = roles, time.Now().Add(rolesTTL)
+	return roles, nil
+}
+
+func (r *repository) loadAccountsRoles(accounts AccountCollection) {
+	if len(r.app) == 0 || len(accounts) == 0 {
+		return
+	}
+	roles, err := r.cachedRoles()
+	if err != nil {
+		r.errFn(err.Error(), log.Ctx{"app": r.app})
+		return
+	}
+	for i, a := range accounts {
+		if a.HasMetadata() && HostIsLocal(a.Metadata.ID) {
+			accounts[i].Role = roles[pub.IRI(a.Metadata.ID)]
+		}
+	}
+}
+
+// saveRole stores the role of the account in the tags of the instance actor, so only the instance can change it.
+// The updates are serialized, and they start from the current tags, so they don't overwrite each other.
+func (r *repository) saveRole(a Account) error {
+	if len(r.app) == 0 && !a.Role.IsValid() {
+		return nil
+	}
+	c := r.roles
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	}
+	app, roles, err := r.loadRoles()
+	if err != nil {
+		return err
+	}
+	id := pub.IRI(a.Metadata.ID)
+	if roles[id] != a.Role {
+		app.Tag = withRoleTag(app.Tag, id, a.Role)
+		act := pub.Activity{
+			Type:    pub.UpdateType,
+			To:      pub.ItemCollection{pub.PublicNS},
+			Actor:   app.GetLink(),
+			Object:  app,
+			Updated: time.Now().UTC(),
+		}
+		if _, _, err = r.fedbox.ToOutbox(act); err != nil {
+			return err
+		}
+	}
+	if c != nil {
+		c.roles, c.expires = rolesFromTags(app.Tag), time.Now().Add(rolesTTL)
+	}
+	return nil
+}
+
 func (r *repository) LoadAccount(f Filters) (Account, error) {
 	var accounts AccountCollection
 	var err error
@@ -1222,6 +1635,27 @@ func Values(f Filters) func() url.Values {
 	}
 }
 
+// itemsValues returns the query values for loading the items, FedBOX matches the links to the domain of the URL filter
+// as the links containing any of its linkDomainURLs, and the links to the page of the Link filter as the links containing
+// any of its linkPathURLs
+func itemsValues(f Filters) func() url.Values {
+	return func() url.Values {
+		v := Values(f)()
+		if len(f.LoadItemsFilter.URL) > 0 || len(f.LoadItemsFilter.Link) > 0 {
+			if v == nil {
+				v = url.Values{}
+			}
+		}
+		if len(f.LoadItemsFilter.URL) > 0 {
+			v["url"] = linkDomainURLs(f.LoadItemsFilter.URL)
+		}
+		if len(f.LoadItemsFilter.Link) > 0 {
+			v["url"] = append(v["url"], linkPathURLs(f.LoadItemsFilter.Link)...)
+		}
+		return v
+	}
+}
+
 func (r *repository) LoadFollowRequests(ed *Account, f Filters) (FollowRequests, uint, error) {
 	if len(f.Type) == 0 {
 		f.Type = pub.ActivityVocabularyTypes{pub.FollowType}
@@ -1238,21 +1672,63 @@ func (r *repository) LoadFollowRequests(ed *Account, f Filters) (FollowRequests,
 		for _, fr := range followReq.Collection() {
 			f := FollowRequest{}
 			if err := f.FromActivityPub(fr); err == nil {
-				if !accountInCollection(*f.SubmittedBy, ed.Followers) {
+				if ed == nil || !accountInCollection(*f.SubmittedBy, ed.Followers) {
 					requests = append(requests, f)
 				}
 			}
 		}
+		if ed == nil {
+			requests = r.withoutFollowResponses(requests)
+		}
 		requests, err = r.loadAuthors(requests...)
 	}
 	return requests, uint(len(requests)), nil
 }
 
+// withoutFollowResponses returns the follow requests which didn't receive an Accept or a Reject yet.
+// The followed accounts can belong to other instances, so we don't rely on the followers collections,
+// we load the responses to the requests from the activities FedBOX received, with a single request.
+func (r *repository) withoutFollowResponses(requests FollowRequests) FollowRequests {
+	f := Filters{}
+	f.Type = pub.ActivityVocabularyTypes{pub.AcceptType, pub.RejectType}
+	for _, req := range requests {
+		if req.Metadata != nil && len(req.Metadata.ID) > 0 {
+			f.LoadFollowRequestsFilter.On = append(f.LoadFollowRequestsFilter.On, Hash(req.Metadata.ID))
+		}
+	}
+	if len(f.LoadFollowRequestsFilter.On) == 0 {
+		return requests
+	}
+	// NOTE(marius): a request can receive both an Accept and a Reject
+	f.MaxItems = 2 * len(f.LoadFollowRequestsFilter.On)
+	col, err := r.fedbox.Activities(Values(f))
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return requests
+	}
+	answered := make(map[string]bool)
+	for _, res := range col.Collection() {
+		pub.OnActivity(res, func(a *pub.Activity) error {
+			if a.Object != nil {
+				answered[a.Object.GetLink().String()] = true
+			}
+			return nil
+		})
+	}
+	pending := make(FollowRequests, 0)
+	for _, req := range requests {
+		if req.Metadata == nil || !answered[req.Metadata.ID] {
+			pending = append(pending, req)
+		}
+	}
+	return pending
+}
+
 func (r *repository) SendFollowResponse(f FollowRequest, accept bool) error {
 	ed := f.Object
 	er := f.SubmittedBy
 	if !accountValidForC2S(ed) {
-		return errors.Unauthorizedf("invalid account %s", ed)
+		return errors.Unauthorizedf("invalid account %s", ed.Handle)
 	}
 
 	to := make(pub.ItemCollection, 0)
@@ -1302,6 +1778,15 @@ func (r *repository) FollowAccount(er, ed Account) error {
 		Object: followed.GetLink(),
 		Actor:  follower.GetLink(),
 	}
+	if ed.HasMetadata() && len(ed.Metadata.ID) > 0 && !strings.HasPrefix(ed.Metadata.ID, r.BaseURL) {
+		// NOTE(marius): actors of other instances get sent in full, so FedBOX can store them
+		if p, err := r.fedbox.Actor(pub.IRI(ed.Metadata.ID)); err == nil {
+			follow.Object = p
+		} else {
+			follow.Object = pub.IRI(ed.Metadata.ID)
+		}
+		follow.To = append(follow.To, follow.Object.GetLink())
+	}
 	_, _, err := r.fedbox.ToOutbox(follow)
 	if err != nil {
 		r.errFn(err.Error(), nil)
@@ -1310,6 +1795,564 @@ func (r *repository) FollowAccount(er, ed Account) error {
 	return nil
 }
 
+// accountIRI returns the IRI of the account's actor, which for the accounts of other instances isn't under our ActorsURL
+func accountIRI(a Account) pub.IRI {
+	if a.HasMetadata() && len(a.Metadata.ID) > 0 {
+		return pub.IRI(a.Metadata.ID)
+	}
+	return loadAPPerson(a).GetLink()
+}
+
+// loadActivitiesOn returns the activities of type typ that er sent about ed
+func (r *repository) loadActivitiesOn(typ pub.ActivityVocabularyType, er, ed Account) (pub.ItemCollection, error) {
+	f := Filters{
+		LoadFollowRequestsFilter: LoadFollowRequestsFilter{
+			Actor: Hashes{er.Hash},
+			On:    Hashes{ed.Hash},
+		},
+	}
+	f.Type = pub.ActivityVocabularyTypes{typ}
+	col, err := r.fedbox.Activities(Values(f))
+	if err != nil {
+		return nil, err
+	}
+	activities := make(pub.ItemCollection, 0)
+	for _, it := range col.Collection() {
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			if a.Object != nil && a.Object.GetLink() == accountIRI(ed) {
+				activities = append(activities, a)
+			}
+			return nil
+		})
+	}
+	return r.withoutUndone(er, activities)
+}
+
+// withoutUndone returns the activities of er which weren't undone
+func (r *repository) withoutUndone(er Account, activities pub.ItemCollection) (pub.ItemCollection, error) {
+	if len(activities) == 0 {
+		return activities, nil
+	}
+	f := Filters{
+		LoadFollowRequestsFilter: LoadFollowRequestsFilter{
+			Actor: Hashes{er.Hash},
+		},
+	}
+	f.Type = pub.ActivityVocabularyTypes{pub.UndoType}
+	for _, act := range activities {
+		var h Hash
+		h.FromActivityPub(act)
+		f.LoadFollowRequestsFilter.On = append(f.LoadFollowRequestsFilter.On, h)
+	}
+	f.MaxItems = len(f.LoadFollowRequestsFilter.On)
+	undos, err := r.fedbox.Activities(Values(f))
+	if err != nil {
+		return nil, err
+	}
+	result := make(pub.ItemCollection, 0)
+	for _, act := range activities {
+		undone := false
+		for _, u := range undos.Collection() {
+			pub.OnActivity(u, func(a *pub.Activity) error {
+				undone = undone || (a.Object != nil && a.Object.GetLink() == act.GetLink())
+				return nil
+			})
+		}
+		if !undone {
+			result = append(result, act)
+		}
+	}
+	return result, nil
+}
+
+// undo sends Undo activities for the activities received
+func (r *repository) undo(er Account, activities pub.ItemCollection, to pub.ItemCollection) error {
+	for _, act := range activities {
+		undo := pub.Activity{
+			Type:   pub.UndoType,
+			To:     to,
+			BCC:    pub.ItemCollection{pub.IRI(BaseURL)},
+			Actor:  accountIRI(er),
+			Object: act.GetLink(),
+		}
+		if _, _, err := r.fedbox.ToOutbox(undo); err != nil {
+			r.errFn(err.Error(), nil)
+			return err
+		}
+	}
+	return nil
+}
+
+// UnfollowAccount sends an Undo for the Follow activities of er for ed, which covers both
+// the accepted follows and the requests which didn't get a response yet
+func (r *repository) UnfollowAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	follows, err := r.loadActivitiesOn(pub.FollowType, er, ed)
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return err
+	}
+	if len(follows) == 0 {
+		return errors.NotFoundf("account %s is not followed by %s", ed.Handle, er.Handle)
+	}
+	return r.undo(er, follows, pub.ItemCollection{pub.PublicNS, accountIRI(ed)})
+}
+
+// LoadBlockedAccounts returns the accounts that er sent Block activities for, which weren't undone.
+// It loads all the pages of the Block activities.
+func (r *repository) LoadBlockedAccounts(er Account) (AccountCollection, uint, error) {
+	f := Filters{
+		LoadFollowRequestsFilter: LoadFollowRequestsFilter{
+			Actor: Hashes{er.Hash},
+		},
+	}
+	f.Type = pub.ActivityVocabularyTypes{pub.BlockType}
+	accounts := Filters{}
+	err := activitiesPages(r.fedbox.Activities, f, func(page pub.ItemCollection) error {
+		blocks, err := r.withoutUndone(er, page)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			pub.OnActivity(b, func(a *pub.Activity) error {
+				if a.Object != nil {
+					accounts.LoadAccountsFilter.Key = append(accounts.LoadAccountsFilter.Key, Hash(a.Object.GetLink()))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return nil, 0, err
+	}
+	if len(accounts.LoadAccountsFilter.Key) == 0 {
+		return AccountCollection{}, 0, nil
+	}
+	accounts.LoadAccountsFilter.Key = hashesUnique(accounts.LoadAccountsFilter.Key)
+	accounts.MaxItems = len(accounts.LoadAccountsFilter.Key)
+	return r.LoadAccounts(accounts)
+}
+
+// BlockAccount sends a Block activity for ed, which isn't addressed to ed, and removes ed from er's followers
+func (r *repository) BlockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	if !ed.IsValid() || HashesEqual(er.Hash, ed.Hash) {
+		return errors.Newf("invalid account to block")
+	}
+	block := pub.Activity{
+		Type:   pub.BlockType,
+		BCC:    pub.ItemCollection{pub.IRI(BaseURL)},
+		Actor:  accountIRI(er),
+		Object: accountIRI(ed),
+	}
+	if _, _, err := r.fedbox.ToOutbox(block); err != nil {
+		r.errFn(err.Error(), nil)
+		return err
+	}
+	if !er.HasMetadata() || len(er.Metadata.FollowersIRI) == 0 {
+		return nil
+	}
+	remove := pub.Activity{
+		Type:   pub.RemoveType,
+		BCC:    pub.ItemCollection{pub.IRI(BaseURL)},
+		Actor:  accountIRI(er),
+		Object: accountIRI(ed),
+		Target: pub.IRI(er.Metadata.FollowersIRI),
+	}
+	if _, _, err := r.fedbox.ToOutbox(remove); err != nil {
+		r.errFn(err.Error(), nil)
+		return err
+	}
+	return nil
+}
+
+// UnblockAccount sends an Undo for the Block activities of er for ed
+func (r *repository) UnblockAccount(er, ed Account) error {
+	if !accountValidForC2S(&er) {
+		return errors.Unauthorizedf("invalid account %s", er.Handle)
+	}
+	blocks, err := r.loadActivitiesOn(pub.BlockType, er, ed)
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return err
+	}
+	if len(blocks) == 0 {
+		return errors.NotFoundf("account %s is not blocked by %s", ed.Handle, er.Handle)
+	}
+	return r.undo(er, blocks, nil)
+}
+
+// ShareItem sends an Announce activity for the it item to the followers of acc and to its author
+func (r *repository) ShareItem(acc Account, it Item) error {
+	if !accountValidForC2S(&acc) {
+		return errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	if !it.IsValid() || !it.HasMetadata() || it.Private() || it.Deleted() {
+		return errors.Newf("invalid item to share")
+	}
+	ob := pub.IRI(it.Metadata.ID)
+	actor := accountIRI(acc)
+	f := Filters{}
+	f.Type = pub.ActivityVocabularyTypes{pub.AnnounceType}
+	f.LoadVotesFilter.AttributedTo = Hashes{Hash(actor)}
+	if col, err := r.fedbox.Shares(ob, Values(f)); err == nil && col.Count() > 0 {
+		// NOTE(marius): the item was already shared by acc
+		return nil
+	}
+	cc := pub.ItemCollection{pub.IRI(fmt.Sprintf("%s/%s", actor, handlers.Followers))}
+	if it.SubmittedBy.IsValid() && it.SubmittedBy.HasMetadata() && len(it.SubmittedBy.Metadata.ID) > 0 {
+		cc = append(cc, pub.IRI(it.SubmittedBy.Metadata.ID))
+	}
+	act := pub.Activity{
+		Type:   pub.AnnounceType,
+		To:     pub.ItemCollection{pub.PublicNS},
+		CC:     cc,
+		BCC:    pub.ItemCollection{pub.IRI(BaseURL)},
+		Actor:  actor,
+		Object: ob,
+	}
+	if _, _, err := r.fedbox.ToOutbox(act); err != nil {
+		r.errFn(err.Error(), nil)
+		return err
+	}
+	return nil
+}
+
+// activitiesPages loads the activities matching f with load, activitiesBatchSize at a time, and calls fn for
+// each page of them, until all of them are loaded
+func activitiesPages(load func(...FilterFn) (pub.CollectionInterface, error), f Filters, fn func(pub.ItemCollection) error) error {
+	f.MaxItems = activitiesBatchSize
+	loaded := uint(0)
+	for f.Page = 1; ; f.Page++ {
+		col, err := load(Values(f))
+		if err != nil {
+			return err
+		}
+		page := col.Collection()
+		if err := fn(page); err != nil {
+			return err
+		}
+		loaded += uint(len(page))
+		if len(page) == 0 || loaded >= col.Count() {
+			return nil
+		}
+	}
+}
+
+// LoadMessages loads the private items acc created, from their outbox, and the ones addressed to them, from their inbox.
+// It loads all the pages of the two collections.
+func (r *repository) LoadMessages(acc Account, f Filters) (ItemCollection, uint, error) {
+	actor := accountIRI(acc)
+	ff := Filters{}
+	ff.Type = pub.ActivityVocabularyTypes{pub.CreateType}
+
+	items := make(ItemCollection, 0)
+	loaded := make(Hashes, 0)
+	for _, load := range []func(pub.Item, ...FilterFn) (pub.CollectionInterface, error){r.fedbox.Outbox, r.fedbox.Inbox} {
+		load := load
+		err := activitiesPages(func(ff ...FilterFn) (pub.CollectionInterface, error) { return load(actor, ff...) }, ff, func(page pub.ItemCollection) error {
+			for _, it := range page {
+				i := Item{}
+				if err := i.FromActivityPub(it); err != nil {
+					r.errFn(err.Error(), nil)
+					continue
+				}
+				if !i.Private() || i.Deleted() || loaded.Contains(i.Hash) {
+					continue
+				}
+				loaded = append(loaded, i.Hash)
+				items = append(items, i)
+			}
+			return nil
+		})
+		if err != nil {
+			r.errFn(err.Error(), nil)
+			return nil, 0, err
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].SubmittedAt.After(items[j].SubmittedAt)
+	})
+	items, err := r.loadItemsAuthors(items...)
+	start, end := pageBounds(f, len(items))
+	return items[start:end], uint(len(items)), err
+}
+
+// LoadReadMessages loads the objects of the Read activities of acc, from all the pages of their outbox
+func (r *repository) LoadReadMessages(acc Account) (Hashes, error) {
+	f := Filters{}
+	f.Type = pub.ActivityVocabularyTypes{pub.ReadType}
+	actor := accountIRI(acc)
+	read := make(Hashes, 0)
+	err := activitiesPages(func(ff ...FilterFn) (pub.CollectionInterface, error) { return r.fedbox.Outbox(actor, ff...) }, f, func(page pub.ItemCollection) error {
+		for _, it := range page {
+			pub.OnActivity(it, func(a *pub.Activity) error {
+				if a.Type == pub.ReadType && a.Object != nil {
+					h := Hash{}
+					h.FromActivityPub(a.Object)
+					read = append(read, h)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return nil, err
+	}
+	return read, nil
+}
+
+// MarkMessagesRead sends a Read activity for each of the items, addressed only to the instance and not to their authors
+func (r *repository) MarkMessagesRead(acc Account, items ...Item) error {
+	if !accountValidForC2S(&acc) {
+		return errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	for _, it := range items {
+		id, ok := BuildIDFromItem(it)
+		if !ok {
+			continue
+		}
+		read := pub.Activity{
+			Type:   pub.ReadType,
+			BCC:    pub.ItemCollection{pub.IRI(BaseURL)},
+			Actor:  accountIRI(acc),
+			Object: pub.IRI(id),
+		}
+		if _, _, err := r.fedbox.ToOutbox(read); err != nil {
+			r.errFn(err.Error(), nil)
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRemoteAccount resolves the name@host address of an account of another instance through WebFinger
+// and loads its actor
+func (r *repository) LoadRemoteAccount(name, host string) (Account, error) {
+	if r.webfinger == nil {
+		return AnonymousAccount, errors.NotImplementedf("WebFinger resolving is disabled")
+	}
+	iri, err := r.webfinger.Resolve(name, host)
+	if err != nil {
+		return AnonymousAccount, err
+	}
+	// NOTE(marius): the actor is loaded with the client of the resolver, which doesn't connect to private addresses
+	p, err := r.webfinger.Actor(iri)
+	if err != nil {
+		r.errFn(err.Error(), log.Ctx{"iri": iri})
+		return AnonymousAccount, errors.NewNotFound(err, "unable to load actor %s@%s", name, host)
+	}
+	acc := Account{}
+	if err := acc.FromActivityPub(p); err != nil {
+		return AnonymousAccount, err
+	}
+	return acc, nil
+}
+
+// SaveReport sends a Flag activity about the reported item to the instance service actor. Forwarded reports
+// are addressed to the author of the item instead, so they reach the instance the item originates from.
+func (r *repository) SaveReport(rep ItemReport) (ItemReport, error) {
+	if !rep.SubmittedBy.IsValid() || !rep.SubmittedBy.HasMetadata() {
+		return rep, errors.Newf("Invalid report submitter")
+	}
+	if !rep.Item.IsValid() || !rep.Item.HasMetadata() {
+		return rep, errors.Newf("Invalid reported item")
+	}
+	if !accountValidForC2S(rep.SubmittedBy) {
+		return rep, errors.Unauthorizedf("invalid account %s", rep.SubmittedBy.Handle)
+	}
+	reporter := loadAPPerson(*rep.SubmittedBy)
+
+	to := pub.ItemCollection{pub.IRI(BaseURL)}
+	object := pub.ItemCollection{pub.IRI(rep.Item.Metadata.ID)}
+	if rep.Item.SubmittedBy.HasMetadata() && len(rep.Item.SubmittedBy.Metadata.ID) > 0 {
+		author := pub.IRI(rep.Item.SubmittedBy.Metadata.ID)
+		object = append(object, author)
+		if rep.Forward {
+			to = pub.ItemCollection{author}
+		}
+	}
+	flag := pub.Activity{
+		Type:   pub.FlagType,
+		To:     to,
+		Actor:  reporter.GetLink(),
+		Object: object,
+	}
+	flag.Summary.Set(pub.NilLangRef, string(rep.Reason))
+	if len(rep.Text) > 0 {
+		flag.Content.Set(pub.NilLangRef, rep.Text)
+	}
+
+	iri, _, err := r.fedbox.ToOutbox(flag)
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return rep, err
+	}
+	rep.Hash.FromActivityPub(iri)
+	rep.SubmittedAt = time.Now().UTC()
+	rep.Metadata = &ReportMetadata{
+		ID: iri.String(),
+	}
+	return rep, nil
+}
+
+// LoadReports loads the Flag activities received by the instance service actor
+func (r *repository) LoadReports(f Filters) (ItemReports, uint, error) {
+	f.Type = pub.ActivityVocabularyTypes{pub.FlagType}
+
+	url := fmt.Sprintf("%s/%s", BaseURL, handlers.Inbox)
+	col, err := r.fedbox.Collection(pub.IRI(url), Values(f))
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return nil, 0, err
+	}
+	reports := make(ItemReports, 0)
+	accounts := Filters{}
+	items := Filters{}
+	for _, it := range col.Collection() {
+		rep := ItemReport{}
+		if err := rep.FromActivityPub(it); err != nil || !rep.Item.IsValid() {
+			continue
+		}
+		reports = append(reports, rep)
+		accounts.LoadAccountsFilter.Key = append(accounts.LoadAccountsFilter.Key, rep.SubmittedBy.Hash)
+		items.LoadItemsFilter.Key = append(items.LoadItemsFilter.Key, rep.Item.Hash)
+	}
+	if len(reports) == 0 {
+		return reports, 0, nil
+	}
+	accounts.LoadAccountsFilter.Key = hashesUnique(accounts.LoadAccountsFilter.Key)
+	if reporters, _, err := r.LoadAccounts(accounts); err == nil {
+		for k, rep := range reports {
+			for i, acc := range reporters {
+				if accountsEqual(*rep.SubmittedBy, acc) {
+					reports[k].SubmittedBy = &reporters[i]
+				}
+			}
+		}
+	}
+	items.LoadItemsFilter.Key = hashesUnique(items.LoadItemsFilter.Key)
+	if reported, _, err := r.LoadItems(items); err == nil {
+		for k, rep := range reports {
+			for i, it := range reported {
+				if HashesEqual(rep.Item.Hash, it.Hash) {
+					reports[k].Item = &reported[i]
+				}
+			}
+		}
+	}
+	return reports, uint(len(reports)), nil
+}
+
+// SaveModeration records the moderation action as an activity of the instance account, deleting an item
+// is done through SaveItem
+func (r *repository) SaveModeration(m ModerationOp) (ModerationOp, error) {
+	if !accountValidForC2S(m.SubmittedBy) {
+		return m, errors.Unauthorizedf("invalid account %s", m.SubmittedBy.Handle)
+	}
+	act := pub.Activity{
+		To:    pub.ItemCollection{pub.IRI(BaseURL)},
+		Actor: pub.IRI(m.SubmittedBy.Metadata.ID),
+	}
+	if m.Moderator.HasMetadata() {
+		act.AttributedTo = pub.IRI(m.Moderator.Metadata.ID)
+	}
+	if m.Action != ModerationDelete && !m.Report.HasMetadata() {
+		return m, errors.Newf("Invalid report")
+	}
+	switch m.Action {
+	case ModerationDelete:
+		if !m.Item.IsValid() {
+			return m, errors.Newf("Invalid item to delete")
+		}
+		id, _ := BuildIDFromItem(*m.Item)
+		if m.Item.Public() {
+			act.To = append(act.To, pub.PublicNS)
+		}
+		act.Type = pub.DeleteType
+		act.Object = pub.IRI(id)
+		if m.Report.HasMetadata() {
+			act.Context = pub.IRI(m.Report.Metadata.ID)
+		}
+	case ModerationDismiss:
+		act.Type = pub.IgnoreType
+		act.Object = pub.IRI(m.Report.Metadata.ID)
+	case ModerationSuspend:
+		if !m.Account.HasMetadata() {
+			return m, errors.Newf("Invalid account to suspend")
+		}
+		act.Type = pub.BlockType
+		act.Object = pub.IRI(m.Account.Metadata.ID)
+		act.Context = pub.IRI(m.Report.Metadata.ID)
+	default:
+		return m, errors.NotValidf("invalid moderation action %q", m.Action)
+	}
+	iri, _, err := r.fedbox.ToOutbox(act)
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return m, err
+	}
+	if m.Action == ModerationDelete {
+		it := *m.Item
+		it.Delete()
+		if err := updateIndex(r.index, it); err != nil {
+			r.errFn("unable to update the search index", log.Ctx{"err": err, "item": it.Hash})
+		}
+	}
+	m.Hash.FromActivityPub(iri)
+	m.SubmittedAt = time.Now().UTC()
+	m.Metadata = &ModerationMetadata{
+		ID: iri.String(),
+	}
+	return m, nil
+}
+
+// LoadModerations loads the activities that record the actions taken by moderators
+func (r *repository) LoadModerations(f Filters) (ModerationOps, uint, error) {
+	if len(f.Type) == 0 {
+		f.Type = pub.ActivityVocabularyTypes{pub.DeleteType, pub.IgnoreType, pub.BlockType}
+	}
+	col, err := r.fedbox.Activities(Values(f))
+	if err != nil {
+		r.errFn(err.Error(), nil)
+		return nil, 0, err
+	}
+	ops := make(ModerationOps, 0)
+	moderators := Filters{}
+	for _, it := range col.Collection() {
+		m := ModerationOp{}
+		if err := m.FromActivityPub(it); err != nil {
+			continue
+		}
+		ops = append(ops, m)
+		if m.Moderator.IsValid() {
+			moderators.LoadAccountsFilter.Key = append(moderators.LoadAccountsFilter.Key, m.Moderator.Hash)
+		}
+	}
+	if len(moderators.LoadAccountsFilter.Key) == 0 {
+		return ops, uint(len(ops)), nil
+	}
+	moderators.LoadAccountsFilter.Key = hashesUnique(moderators.LoadAccountsFilter.Key)
+	if accounts, _, err := r.LoadAccounts(moderators); err == nil {
+		for k, op := range ops {
+			for i, acc := range accounts {
+				if op.Moderator.IsValid() && accountsEqual(*op.Moderator, acc) {
+					ops[k].Moderator = &accounts[i]
+				}
+			}
+		}
+	}
+	return ops, uint(len(ops)), nil
+}
+
 func (r *repository) SaveAccount(a Account) (Account, error) {
 	p := loadAPPerson(a)
 	id := p.GetLink()
@@ -1356,9 +2399,17 @@ func (r *repository) SaveAccount(a Account) (Account, error) {
 		r.errFn(err.Error(), nil)
 		return a, err
 	}
-	err = a.FromActivityPub(ap)
-	if err != nil {
+	role := a.Role
+	if err = a.FromActivityPub(ap); err != nil {
 		r.errFn(err.Error(), nil)
+		return a, err
+	}
+	if a.Deleted() || !a.IsLocal() {
+		return a, nil
+	}
+	a.Role = role
+	if err = r.saveRole(a); err != nil {
+		r.errFn(err.Error(), log.Ctx{"account": a.Hash, "role": role})
 	}
 	return a, err
 }
@@ -0,0 +1,1120 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/littr.go/internal/fedboxtest"
+	"github.com/mariusor/littr.go/internal/log"
+	"golang.org/x/oauth2"
+)
+
+func fedboxMock(t *testing.T) (*fedboxtest.Server, *repository) {
+	srv := fedboxtest.NewServer()
+	repo := ActivityPubService(appConfig{APIURL: srv.URL, Logger: log.Dev(log.PanicLevel)})
+	return srv, repo
+}
+
+func mockFedboxAccount(t *testing.T, srv *fedboxtest.Server, handle string) Account {
+	p := srv.AddActor(handle, "secret")
+	acc := Account{}
+	if err := acc.FromActivityPub(p); err != nil {
+		t.Fatalf("unable to load account %s: %s", handle, err)
+	}
+	acc.Metadata.OAuth.Token = srv.Token(p.GetLink())
+	return acc
+}
+
+func mockFedboxItem(t *testing.T, repo *repository, it Item) Item {
+	repo.WithAccount(it.SubmittedBy)
+	saved, err := repo.SaveItem(it)
+	if err != nil {
+		t.Fatalf("unable to save item %q: %s", it.Title, err)
+	}
+	return saved
+}
+
+func Test_repository_LoadItems(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+
+	now := time.Now().UTC()
+	link := mockFedboxItem(t, repo, Item{
+		Title:       "A link",
+		Data:        "https://example.com/article",
+		MimeType:    MimeTypeURL,
+		SubmittedBy: &jane,
+		SubmittedAt: now.Add(-2 * time.Hour),
+	})
+	text := mockFedboxItem(t, repo, Item{
+		Title:       "Some text",
+		Data:        "Lorem ipsum dolor",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &john,
+		SubmittedAt: now.Add(-time.Hour),
+	})
+	reply := mockFedboxItem(t, repo, Item{
+		Data:        "a reply",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &john,
+		SubmittedAt: now,
+		Parent:      &link,
+	})
+
+	tests := map[string]struct {
+		f     Filters
+		items ItemCollection
+	}{
+		"index": {
+			f: Filters{LoadItemsFilter: LoadItemsFilter{
+				InReplyTo: []string{""},
+				Deleted:   []bool{false},
+				Federated: []bool{false},
+				Private:   []bool{false},
+			}},
+			items: ItemCollection{text, link},
+		},
+		"author": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{AttributedTo: Hashes{john.Hash}}},
+			items: ItemCollection{reply, text},
+		},
+		"thread": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Context: []string{link.Metadata.ID}}},
+			items: ItemCollection{reply},
+		},
+		"content": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Content: "ipsum", ContentMatchType: MatchFuzzy}},
+			items: ItemCollection{text},
+		},
+		"before": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{SubmittedAt: now.Add(-90 * time.Minute), SubmittedAtMatchType: MatchBefore}},
+			items: ItemCollection{link},
+		},
+		"second page": {
+			f:     Filters{LoadItemsFilter: LoadItemsFilter{Deleted: []bool{false}}, MaxItems: 2, Page: 2},
+			items: ItemCollection{link},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			items, _, err := repo.LoadItems(tt.f)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(items) != len(tt.items) {
+				t.Fatalf("Items count must be %d, received %d", len(tt.items), len(items))
+			}
+			for k, it := range items {
+				if !HashesEqual(it.Hash, tt.items[k].Hash) {
+					t.Errorf("Item %d must be %q, received %q", k, tt.items[k].Data, it.Data)
+				}
+			}
+		})
+	}
+}
+
+func Test_repository_LoadItems_Domain(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	now := time.Now().UTC()
+	link := mockFedboxItem(t, repo, Item{Title: "link", Data: "https://www.example.com/article", MimeType: MimeTypeURL, SubmittedBy: &jane,
+		SubmittedAt: now.Add(-time.Hour)})
+	for _, other := range []string{"https://notexample.com/article", "https://example.com.au/article", "https://other.com/?u=example.com"} {
+		mockFedboxItem(t, repo, Item{Title: "other", Data: other, MimeType: MimeTypeURL, SubmittedBy: &jane, SubmittedAt: now})
+	}
+
+	items, count, err := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{URL: "example.com"}, MaxItems: 1})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if count != 1 || len(items) != 1 || !HashesEqual(items[0].Hash, link.Hash) {
+		t.Errorf("First page of the domain must contain %q out of %d items, received %v out of %d", link.Data, 1, items, count)
+	}
+}
+
+func Test_repository_loadLinkSubmission(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	now := time.Now().UTC()
+	root := mockFedboxItem(t, repo, Item{Title: "root", Data: "https://example.com", MimeType: MimeTypeURL, SubmittedBy: &jane,
+		SubmittedAt: now.Add(-2 * time.Hour)})
+	article := mockFedboxItem(t, repo, Item{Title: "article", Data: "https://www.example.com/article", MimeType: MimeTypeURL,
+		SubmittedBy: &jane, SubmittedAt: now.Add(-2 * time.Hour)})
+	// the links below the page match its FedBOX url filters, they fill more than a batch before the submission we look for
+	for i := 0; i < duplicateLinksBatchSize+5; i++ {
+		mockFedboxItem(t, repo, Item{Title: "other", Data: fmt.Sprintf("https://example.com/article/%d", i), MimeType: MimeTypeURL,
+			SubmittedBy: &jane, SubmittedAt: now.Add(-time.Hour)})
+	}
+
+	since := now.Add(-24 * time.Hour)
+	if prev, ok := loadLinkSubmission(repo, "http://www.example.com/", since); !ok || !HashesEqual(prev.Hash, root.Hash) {
+		t.Errorf("Submission of %q must be %q, received %q", "http://www.example.com/", root.Data, prev.Data)
+	}
+	if prev, ok := loadLinkSubmission(repo, "https://example.com/article/#top", since); !ok || !HashesEqual(prev.Hash, article.Hash) {
+		t.Errorf("Submission of %q must be %q, received %q", "https://example.com/article/#top", article.Data, prev.Data)
+	}
+	if prev, ok := loadLinkSubmission(repo, "https://example.com/other", since); ok {
+		t.Errorf("Link %q must not have submissions, received %q", "https://example.com/other", prev.Data)
+	}
+}
+
+func Test_repository_SaveVote(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	it := mockFedboxItem(t, repo, Item{Data: "test", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	repo.WithAccount(&jane)
+	for _, w := range []int{1, -1} {
+		if _, err := repo.SaveVote(Vote{SubmittedBy: &jane, Item: &it, Weight: w}); err != nil {
+			t.Fatalf("unable to save vote: %s", err)
+		}
+		votes, _, err := repo.LoadVotes(Filters{LoadVotesFilter: LoadVotesFilter{ItemKey: Hashes{it.Hash}}})
+		if err != nil {
+			t.Fatalf("unable to load votes: %s", err)
+		}
+		if len(votes) != 1 {
+			t.Fatalf("Votes count must be %d, received %d", 1, len(votes))
+		}
+		if votes[0].Weight != w {
+			t.Errorf("Vote weight must be %d, received %d", w, votes[0].Weight)
+		}
+		if loaded, _ := repo.LoadItem(Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{it.Hash}}}); loaded.Score != w {
+			t.Errorf("Item score must be %d, received %d", w, loaded.Score)
+		}
+	}
+}
+
+func Test_repository_FollowAccount(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+
+	repo.WithAccount(&john)
+	if err := repo.FollowAccount(john, jane); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, cnt, _ := repo.LoadFollowRequests(&jane, Filters{})
+	if cnt != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, cnt)
+	}
+	if !HashesEqual(requests[0].SubmittedBy.Hash, john.Hash) {
+		t.Errorf("Follow request must be from %s, received %s", john.Hash, requests[0].SubmittedBy.Hash)
+	}
+
+	repo.WithAccount(&jane)
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+	acc, _ := repo.loadAccountsFollowers(jane)
+	if !AccountIsFollowed(&acc, &john) {
+		t.Errorf("Account %s must be followed by %s", acc.Handle, john.Handle)
+	}
+
+	// items submitted by jane are now delivered to john's inbox
+	it := mockFedboxItem(t, repo, Item{Title: "news", Data: "for followers", MimeType: MimeTypeText, SubmittedBy: &jane})
+	items, _, err := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{FollowedBy: john.Hash.String()}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(items) != 1 || !HashesEqual(items[0].Hash, it.Hash) {
+		t.Errorf("Items followed by %s must contain %q", john.Handle, it.Title)
+	}
+}
+
+func Test_repository_BlockAccount(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+
+	repo.WithAccount(&john)
+	if err := repo.FollowAccount(john, jane); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&jane, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	repo.WithAccount(&jane)
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	if err := repo.BlockAccount(jane, john); err != nil {
+		t.Fatalf("unable to block: %s", err)
+	}
+	acc, _ := repo.loadAccountsFollowers(jane)
+	if AccountIsFollowed(&acc, &john) {
+		t.Errorf("the blocked account %s must be removed from the followers of %s", john.Handle, jane.Handle)
+	}
+	blocked, cnt, err := repo.LoadBlockedAccounts(jane)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if cnt != 1 || !HashesEqual(blocked[0].Hash, john.Hash) {
+		t.Fatalf("Account %s must have blocked %s, received %v", jane.Handle, john.Handle, blocked)
+	}
+
+	if err := repo.UnblockAccount(jane, john); err != nil {
+		t.Fatalf("unable to unblock: %s", err)
+	}
+	if _, cnt, _ := repo.LoadBlockedAccounts(jane); cnt != 0 {
+		t.Errorf("Blocked accounts count must be %d after the unblock, received %d", 0, cnt)
+	}
+}
+
+func Test_repository_LoadBlockedAccounts_Paged(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	repo.WithAccount(&jane)
+	count := activitiesBatchSize + 5
+	for i := 0; i < count; i++ {
+		ed := mockFedboxAccount(t, srv, fmt.Sprintf("blocked-%d", i))
+		if err := repo.BlockAccount(jane, ed); err != nil {
+			t.Fatalf("unable to block: %s", err)
+		}
+	}
+	blocked, cnt, err := repo.LoadBlockedAccounts(jane)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if int(cnt) != count || len(blocked) != count {
+		t.Errorf("Account %s must have blocked %d accounts, received %d", jane.Handle, count, len(blocked))
+	}
+}
+
+func Test_repository_loadAccountsFollowing(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	john := mockFedboxAccount(t, srv, "john")
+	for _, handle := range []string{"jane", "bob"} {
+		ed := mockFedboxAccount(t, srv, handle)
+		repo.WithAccount(&john)
+		if err := repo.FollowAccount(john, ed); err != nil {
+			t.Fatalf("unable to follow: %s", err)
+		}
+		requests, _, _ := repo.LoadFollowRequests(&ed, Filters{})
+		if len(requests) != 1 {
+			t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+		}
+		repo.WithAccount(&ed)
+		if err := repo.SendFollowResponse(requests[0], true); err != nil {
+			t.Fatalf("unable to accept follow request: %s", err)
+		}
+	}
+
+	// the following collection gets loaded one page at a time, and doesn't depend on the followers one
+	srv.PageSize = 1
+	john.Metadata.FollowersIRI = ""
+	acc, _ := repo.loadAccountsFollowing(john)
+	if len(acc.Following) != 2 {
+		t.Fatalf("Account %s must follow %d accounts, received %d", john.Handle, 2, len(acc.Following))
+	}
+	for _, handle := range []string{"jane", "bob"} {
+		found := false
+		for _, ed := range acc.Following {
+			found = found || ed.Handle == handle
+		}
+		if !found {
+			t.Errorf("Account %s must follow %s", john.Handle, handle)
+		}
+	}
+}
+
+func Test_repository_loadAccountsFollowRefs(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	john := mockFedboxAccount(t, srv, "john")
+	jane := mockFedboxAccount(t, srv, "jane")
+	repo.WithAccount(&john)
+	if err := repo.FollowAccount(john, jane); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&jane, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	repo.WithAccount(&jane)
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	// the session only needs the IRIs of the follows, the actors don't get loaded
+	srv.ActorLinks = true
+	fresh := ActivityPubService(appConfig{APIURL: srv.URL, CacheBackend: "none", Logger: log.Dev(log.PanicLevel)})
+	janeIRI, _ := url.Parse(jane.Metadata.ID)
+	johnIRI, _ := url.Parse(john.Metadata.ID)
+	actorLoads := 0
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && (r.URL.Path == janeIRI.Path || r.URL.Path == johnIRI.Path) {
+			actorLoads++
+		}
+		handler.ServeHTTP(w, r)
+	})
+	ed, _ := fresh.loadAccountsFollowRefs(jane)
+	er, _ := fresh.loadAccountsFollowRefs(john)
+	if !AccountIsFollowed(&ed, &john) || !AccountFollows(&er, &jane) {
+		t.Errorf("Account %s must be followed by %s", jane.Handle, john.Handle)
+	}
+	if actorLoads > 0 {
+		t.Errorf("Actor requests count must be %d, received %d", 0, actorLoads)
+	}
+}
+
+func Test_HandleLogin(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+	srv.ClientID = "littr"
+	srv.ClientSecret = "littr-secret"
+	srv.AddActor("jane", "secret")
+
+	env := map[string]string{"API_URL": srv.URL, "OAUTH2_KEY": srv.ClientID, "OAUTH2_SECRET": srv.ClientSecret}
+	for k, v := range env {
+		old := os.Getenv(k)
+		os.Setenv(k, v)
+		defer os.Setenv(k, old)
+	}
+
+	noop := func(string, log.Ctx) {}
+	v, _ := ViewInit(appConfig{SessionKeys: [][]byte{[]byte("0123456789abcdef")}}, noop, noop)
+	h := handler{
+		conf:    appConfig{BaseURL: "http://littr.git"},
+		storage: repo,
+		logger:  log.Dev(log.PanicLevel),
+		v:       v,
+	}
+
+	tests := map[string]struct {
+		pw       string
+		location string
+		logged   bool
+	}{
+		"valid":   {pw: "secret", location: "/", logged: true},
+		"invalid": {pw: "wrong", location: "/login", logged: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{}
+			form.Set("handle", "jane")
+			form.Set("pw", tt.pw)
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			w := httptest.NewRecorder()
+			h.HandleLogin(w, r)
+
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("Status must be %d, received %d", http.StatusSeeOther, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.location {
+				t.Errorf("Redirect location must be %q, received %q", tt.location, loc)
+			}
+
+			next := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range w.Result().Cookies() {
+				next.AddCookie(c)
+			}
+			s, err := h.v.s.get(next)
+			if err != nil {
+				t.Fatalf("unable to load session: %s", err)
+			}
+			acc, ok := s.Values[SessionUserKey].(Account)
+			if ok != tt.logged {
+				t.Fatalf("Session account must be present: %t, received %t", tt.logged, ok)
+			}
+			if ok && (acc.Handle != "jane" || len(acc.Metadata.OAuth.Token) == 0) {
+				t.Errorf("Session account must be %q with an OAuth2 token, received %q", "jane", acc.Handle)
+			}
+		})
+	}
+}
+
+func Test_LoadSession_RefreshToken(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.SessionsEnabled = true
+
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+	srv.ClientID = "littr"
+	srv.ClientSecret = "littr-secret"
+	srv.AddActor("jane", "secret")
+
+	env := map[string]string{"API_URL": srv.URL, "OAUTH2_KEY": srv.ClientID, "OAUTH2_SECRET": srv.ClientSecret}
+	for k, v := range env {
+		old := os.Getenv(k)
+		os.Setenv(k, v)
+		defer os.Setenv(k, old)
+	}
+
+	noop := func(string, log.Ctx) {}
+	v, _ := ViewInit(appConfig{SessionKeys: [][]byte{[]byte("0123456789abcdef")}}, noop, noop)
+	h := handler{
+		conf:    appConfig{BaseURL: "http://littr.git"},
+		storage: repo,
+		logger:  log.Dev(log.PanicLevel),
+		v:       v,
+		tokens:  new(tokenRefreshes),
+	}
+
+	form := url.Values{}
+	form.Set("handle", "jane")
+	form.Set("pw", "secret")
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.HandleLogin(w, r)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s, _ := h.v.s.get(r)
+	acc, ok := s.Values[SessionUserKey].(Account)
+	if !ok || acc.Metadata.OAuth.Expiry.IsZero() {
+		t.Fatalf("Session account must have an OAuth2 token expiry")
+	}
+	// expiring the token of the session
+	old := acc.Metadata.OAuth
+	acc.Metadata.OAuth.Expiry = time.Now().Add(-time.Minute)
+	s.Values[SessionUserKey] = acc
+	w = httptest.NewRecorder()
+	h.v.s.save(w, r)
+	expired := w.Result().Cookies()
+	// a refresh token FedBOX doesn't know about
+	acc.Metadata.OAuth.RefreshToken = "invalid"
+	s.Values[SessionUserKey] = acc
+	w = httptest.NewRecorder()
+	h.v.s.save(w, r)
+	invalid := w.Result().Cookies()
+
+	load := func(cookies []*http.Cookie) (*Account, *httptest.ResponseRecorder) {
+		var loaded *Account
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loaded = account(r)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.LoadSession(next).ServeHTTP(w, r)
+		return loaded, w
+	}
+
+	loaded, w := load(expired)
+	if !loaded.IsLogged() || loaded.Handle != "jane" {
+		t.Fatalf("Account must be %q after refreshing the token, received %q", "jane", loaded.Handle)
+	}
+	// the other requests sent with the session from before the refresh carry the same expired token
+	if other, _ := load(expired); !other.IsLogged() || other.Metadata.OAuth.Token != loaded.Metadata.OAuth.Token {
+		t.Errorf("Requests with the refreshed token must use the same new OAuth2 token, received %#v", other.Metadata.OAuth)
+	}
+	if o := loaded.Metadata.OAuth; o.Token == old.Token || o.RefreshToken == old.RefreshToken || !o.Expiry.After(time.Now()) {
+		t.Errorf("Account must have a new OAuth2 token, received %#v", o)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s, _ = h.v.s.get(r)
+	if acc, ok := s.Values[SessionUserKey].(Account); !ok || acc.Metadata.OAuth.Token != loaded.Metadata.OAuth.Token {
+		t.Errorf("Session must be updated with the new OAuth2 token")
+	}
+
+	// the refresh token can't be exchanged, so the account gets logged out
+	loaded, w = load(invalid)
+	if loaded.IsLogged() {
+		t.Errorf("Account must be logged out when the token can't be refreshed, received %q", loaded.Handle)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s, _ = h.v.s.get(r)
+	if _, ok := s.Values[SessionUserKey].(Account); ok {
+		t.Errorf("Session account must be removed when the token can't be refreshed")
+	}
+	if len(s.Flashes()) == 0 {
+		t.Errorf("Session must contain a flash message when the token can't be refreshed")
+	}
+}
+
+func Test_tokenRefreshes_exchange(t *testing.T) {
+	tokens := new(tokenRefreshes)
+	var mu sync.Mutex
+	exchanges := 0
+	exchange := func() (*oauth2.Token, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		exchanges++
+		if exchanges > 1 {
+			return nil, errors.Unauthorizedf("refresh token already used")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &oauth2.Token{AccessToken: "new"}, nil
+	}
+
+	received := make([]*oauth2.Token, 5)
+	var wg sync.WaitGroup
+	for i := range received {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			received[i], _ = tokens.exchange("refresh", exchange)
+		}(i)
+	}
+	wg.Wait()
+
+	if exchanges != 1 {
+		t.Errorf("Refresh token must be exchanged once, received %d exchanges", exchanges)
+	}
+	for _, tok := range received {
+		if tok == nil || tok.AccessToken != "new" {
+			t.Errorf("Concurrent exchanges must receive the same token, received %v", tok)
+		}
+	}
+	if _, err := tokens.exchange("other", exchange); err == nil {
+		t.Errorf("Failed exchange must return the error")
+	}
+	if _, ok := tokens.tokens["other"]; ok {
+		t.Errorf("Failed exchange must not be kept")
+	}
+}
+
+func Test_repository_SaveItem(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	it := mockFedboxItem(t, repo, Item{Title: "before", Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+
+	// loading the item and the listing stores them in the cache
+	f := Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{it.Hash}}}
+	if loaded, _ := repo.LoadItem(f); loaded.Title != "before" {
+		t.Fatalf("Title must be %q, received %q", "before", loaded.Title)
+	}
+	listing := Filters{LoadItemsFilter: LoadItemsFilter{AttributedTo: Hashes{jane.Hash}}}
+	repo.LoadItems(listing)
+
+	it.Title = "after"
+	it.SubmittedBy = &jane
+	it = mockFedboxItem(t, repo, it)
+	if loaded, _ := repo.LoadItem(f); loaded.Title != "after" {
+		t.Errorf("Title must be %q after update, received %q", "after", loaded.Title)
+	}
+	if items, _, _ := repo.LoadItems(listing); len(items) != 1 || items[0].Title != "after" {
+		t.Errorf("Listing must contain the updated item")
+	}
+
+	it.SubmittedBy = &jane
+	it.Delete()
+	if _, err := repo.SaveItem(it); err != nil {
+		t.Fatalf("unable to delete item: %s", err)
+	}
+	if loaded, _ := repo.LoadItem(f); !loaded.Deleted() {
+		t.Errorf("Item must be deleted")
+	}
+}
+
+func Test_repository_LoadMessages(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+
+	msg := Item{
+		Data:        "hello john",
+		MimeType:    MimeTypeText,
+		SubmittedBy: &jane,
+		Metadata:    &ItemMetadata{To: []*Account{&john}},
+	}
+	msg.MakePrivate()
+	msg = mockFedboxItem(t, repo, msg)
+	mockFedboxItem(t, repo, Item{Data: "hello everyone", MimeType: MimeTypeText, SubmittedBy: &jane})
+
+	for _, acc := range []Account{jane, john} {
+		messages, cnt, err := repo.LoadMessages(acc, Filters{})
+		if err != nil {
+			t.Fatalf("unable to load messages: %s", err)
+		}
+		if cnt != 1 || !HashesEqual(messages[0].Hash, msg.Hash) {
+			t.Errorf("Messages of %s must contain only %s, received %v", acc.Handle, msg.Hash, messages)
+		}
+	}
+
+	repo.WithAccount(&john)
+	if cnt := unreadMessagesCount(repo, &john); cnt != 1 {
+		t.Fatalf("Unread messages count must be %d, received %d", 1, cnt)
+	}
+	if err := repo.MarkMessagesRead(john, msg); err != nil {
+		t.Fatalf("unable to mark the message as read: %s", err)
+	}
+	if cnt := unreadMessagesCount(repo, &john); cnt != 0 {
+		t.Errorf("Unread messages count must be %d after reading it, received %d", 0, cnt)
+	}
+}
+
+func Test_repository_LoadMessages_Paged(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	count := activitiesBatchSize + 5
+	messages := make(ItemCollection, 0, count)
+	for i := 0; i < count; i++ {
+		msg := Item{
+			Data:        fmt.Sprintf("hello john %d", i),
+			MimeType:    MimeTypeText,
+			SubmittedBy: &jane,
+			Metadata:    &ItemMetadata{To: []*Account{&john}},
+		}
+		msg.MakePrivate()
+		messages = append(messages, mockFedboxItem(t, repo, msg))
+	}
+
+	for _, acc := range []Account{jane, john} {
+		if _, cnt, _ := repo.LoadMessages(acc, Filters{}); int(cnt) != count {
+			t.Errorf("Messages count of %s must be %d, received %d", acc.Handle, count, cnt)
+		}
+	}
+	repo.WithAccount(&john)
+	if err := repo.MarkMessagesRead(john, messages...); err != nil {
+		t.Fatalf("unable to mark the messages as read: %s", err)
+	}
+	if cnt := unreadMessagesCount(repo, &john); cnt != 0 {
+		t.Errorf("Unread messages count must be %d after reading them, received %d", 0, cnt)
+	}
+}
+
+func Test_repository_SaveReport(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	it := mockFedboxItem(t, repo, Item{Title: "spam", Data: "buy now", MimeType: MimeTypeText, SubmittedBy: &john})
+	other := mockFedboxItem(t, repo, Item{Title: "fine", Data: "nothing to see", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	repo.WithAccount(&jane)
+	rep := ItemReport{SubmittedBy: &jane, Item: &it, Reason: ReasonSpam, Text: "advertising"}
+	if _, err := repo.SaveReport(rep); err != nil {
+		t.Fatalf("unable to save report: %s", err)
+	}
+
+	reports, cnt, err := repo.LoadReports(Filters{})
+	if err != nil {
+		t.Fatalf("unable to load reports: %s", err)
+	}
+	if cnt != 1 {
+		t.Fatalf("Reports count must be %d, received %d", 1, cnt)
+	}
+	r := reports[0]
+	if r.Reason != rep.Reason {
+		t.Errorf("Report reason must be %q, received %q", rep.Reason, r.Reason)
+	}
+	if r.Text != rep.Text {
+		t.Errorf("Report text must be %q, received %q", rep.Text, r.Text)
+	}
+	if !HashesEqual(r.Item.Hash, it.Hash) || r.Item.Title != it.Title {
+		t.Errorf("Reported item must be %q, received %q", it.Title, r.Item.Title)
+	}
+	if r.SubmittedBy.Handle != jane.Handle {
+		t.Errorf("Report must be submitted by %q, received %q", jane.Handle, r.SubmittedBy.Handle)
+	}
+
+	if _, cnt, _ := repo.LoadReports(Filters{LoadReportsFilter: LoadReportsFilter{On: Hashes{other.Hash}}}); cnt != 0 {
+		t.Errorf("Reports count for %q must be %d, received %d", other.Title, 0, cnt)
+	}
+}
+
+func Test_asAccount(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	instance := mockFedboxAccount(t, srv, "littr")
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	it := mockFedboxItem(t, repo, Item{Title: "spam", Data: "buy now", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	repo.WithAccount(&jane)
+	scoped := asAccount(repo, &instance)
+	if _, err := scoped.SaveReport(ItemReport{SubmittedBy: &instance, Item: &it, Reason: ReasonSpam, Forward: true}); err != nil {
+		t.Fatalf("unable to save report as %s: %s", instance.Handle, err)
+	}
+	if _, err := scoped.SaveReport(ItemReport{SubmittedBy: &jane, Item: &it, Reason: ReasonSpam}); err == nil {
+		t.Errorf("saving a report as %s must fail with the credentials of %s", jane.Handle, instance.Handle)
+	}
+	// the credentials of the shared repository are unchanged
+	if _, err := repo.SaveReport(ItemReport{SubmittedBy: &jane, Item: &it, Reason: ReasonSpam}); err != nil {
+		t.Errorf("unable to save report as %s: %s", jane.Handle, err)
+	}
+}
+
+func Test_repository_SaveModeration(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	instance := mockFedboxAccount(t, srv, "littr")
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+
+	reported := make(ItemReports, 0)
+	for _, title := range []string{"spam", "fine", "abuse"} {
+		it := mockFedboxItem(t, repo, Item{Title: title, Data: title, MimeType: MimeTypeText, SubmittedBy: &john})
+		repo.WithAccount(&jane)
+		rep, err := repo.SaveReport(ItemReport{SubmittedBy: &jane, Item: &it, Reason: ReasonOther})
+		if err != nil {
+			t.Fatalf("unable to save report: %s", err)
+		}
+		reported = append(reported, rep)
+	}
+
+	repo.WithAccount(&instance)
+	for k, action := range []ModerationAction{ModerationDelete, ModerationDismiss, ModerationSuspend} {
+		op := ModerationOp{
+			SubmittedBy: &instance,
+			Moderator:   &jane,
+			Action:      action,
+			Report:      &reported[k],
+			Item:        reported[k].Item,
+			Account:     &john,
+		}
+		if _, err := repo.SaveModeration(op); err != nil {
+			t.Fatalf("unable to %s: %s", action, err)
+		}
+	}
+
+	ops, cnt, err := repo.LoadModerations(Filters{LoadReportsFilter: LoadReportsFilter{Actor: Hashes{instance.Hash}}})
+	if err != nil {
+		t.Fatalf("unable to load moderation actions: %s", err)
+	}
+	if cnt != 3 {
+		t.Fatalf("Moderation actions count must be %d, received %d", 3, cnt)
+	}
+	for _, op := range ops {
+		if op.Action != ModerationDelete {
+			continue
+		}
+		if !op.Moderator.IsValid() || op.Moderator.Handle != jane.Handle {
+			t.Errorf("Deletion must record the moderator %s, received %v", jane.Handle, op.Moderator)
+		}
+		if !op.Report.HasMetadata() || op.Report.Metadata.ID != reported[0].Metadata.ID {
+			t.Errorf("Deletion must record the report it resolves %q, received %v", reported[0].Metadata.ID, op.Report)
+		}
+	}
+	reports, _, _ := repo.LoadReports(Filters{})
+	for _, rep := range reports {
+		resolved := rep.Item.Deleted()
+		for _, op := range ops {
+			resolved = resolved || op.Resolves(rep)
+		}
+		if !resolved {
+			t.Errorf("Report for %q must be resolved", rep.Item.Hash)
+		}
+	}
+
+	suspended := Filters{
+		LoadVotesFilter:   LoadVotesFilter{Type: pub.ActivityVocabularyTypes{pub.BlockType}},
+		LoadReportsFilter: LoadReportsFilter{On: Hashes{john.Hash}},
+	}
+	if _, cnt, _ := repo.LoadModerations(suspended); cnt != 1 {
+		t.Errorf("Account %s must be suspended", john.Handle)
+	}
+}
+
+func Test_repository_SaveAccount_Role(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	instance := mockFedboxAccount(t, srv, "littr")
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	repo.app = pub.IRI(instance.Metadata.ID)
+
+	jane.Role = RoleModerator
+	jane.CreatedBy = &instance
+	repo.WithAccount(&instance)
+	if _, err := repo.SaveAccount(jane); err != nil {
+		t.Fatalf("unable to save account: %s", err)
+	}
+
+	for _, a := range []Account{jane, john} {
+		loaded, err := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Key: Hashes{a.Hash}}})
+		if err != nil {
+			t.Fatalf("unable to load account: %s", err)
+		}
+		if loaded.Role != a.Role {
+			t.Errorf("Role of %s must be %q, received %q", a.Handle, a.Role, loaded.Role)
+		}
+	}
+}
+
+func Test_repository_SaveAccount_RoleConcurrent(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	instance := mockFedboxAccount(t, srv, "littr")
+	repo.app = pub.IRI(instance.Metadata.ID)
+	accounts := make(AccountCollection, 4)
+	for i := range accounts {
+		accounts[i] = mockFedboxAccount(t, srv, fmt.Sprintf("mod-%d", i))
+		accounts[i].Role = RoleModerator
+		accounts[i].CreatedBy = &instance
+	}
+	var wg sync.WaitGroup
+	for _, a := range accounts {
+		wg.Add(1)
+		go func(a Account) {
+			defer wg.Done()
+			if _, err := asAccount(repo, &instance).SaveAccount(a); err != nil {
+				t.Errorf("unable to save account %s: %s", a.Handle, err)
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	// the roles are loaded once from the instance actor, while they're current
+	fresh := ActivityPubService(appConfig{APIURL: srv.URL, CacheBackend: "none", Logger: log.Dev(log.PanicLevel)})
+	fresh.app = repo.app
+	app, _ := url.Parse(instance.Metadata.ID)
+	appLoads := 0
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == app.Path {
+			appLoads++
+		}
+		handler.ServeHTTP(w, r)
+	})
+	for _, a := range accounts {
+		loaded, err := fresh.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Key: Hashes{a.Hash}}})
+		if err != nil {
+			t.Fatalf("unable to load account: %s", err)
+		}
+		if loaded.Role != RoleModerator {
+			t.Errorf("Role of %s must be %q, received %q", a.Handle, RoleModerator, loaded.Role)
+		}
+	}
+	if appLoads != 1 {
+		t.Errorf("Instance actor must be loaded %d times, received %d", 1, appLoads)
+	}
+}
+
+func Test_repository_SaveAccount_RoleEscalation(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	instance := mockFedboxAccount(t, srv, "littr")
+	jane := mockFedboxAccount(t, srv, "jane")
+	repo.app = pub.IRI(instance.Metadata.ID)
+
+	// jane updates her own actor with a role tag, bypassing the repository
+	p := loadAPPerson(jane)
+	p.Tag = pub.ItemCollection{RoleAdmin.tag(p.GetLink())}
+	repo.WithAccount(&jane)
+	update := pub.Activity{Type: pub.UpdateType, Actor: p.GetLink(), Object: p}
+	if _, _, err := repo.fedbox.ToOutbox(update); err != nil {
+		t.Fatalf("unable to update actor: %s", err)
+	}
+
+	// jane tries to set the role herself through the repository
+	jane.Role = RoleAdmin
+	jane.CreatedBy = &jane
+	if _, err := repo.SaveAccount(jane); err == nil {
+		t.Errorf("an account must not be able to change its own role")
+	}
+
+	loaded, err := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Key: Hashes{jane.Hash}}})
+	if err != nil {
+		t.Fatalf("unable to load account: %s", err)
+	}
+	if loaded.Role.IsValid() {
+		t.Errorf("Role of %s must not be set, received %q", jane.Handle, loaded.Role)
+	}
+}
+
+func Test_repository_FollowRemoteAccount(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+	remote := fedboxtest.NewServer()
+	defer remote.Close()
+	alice := remote.AddActor("alice", "secret")
+
+	requests := 0
+	wfSrv, wf := webFingerMock(t, &requests, alice.GetLink().String())
+	defer wfSrv.Close()
+	repo.webfinger = wf
+
+	john := mockFedboxAccount(t, srv, "john")
+	repo.WithAccount(&john)
+
+	acc, err := repo.LoadRemoteAccount("alice", strings.TrimPrefix(wfSrv.URL, "https://"))
+	if err != nil {
+		t.Fatalf("unable to load the remote account: %s", err)
+	}
+	if acc.Handle != "alice" || acc.Metadata.ID != alice.GetLink().String() {
+		t.Fatalf("Remote account must be alice with IRI %s, received %s with IRI %s", alice.GetLink(), acc.Handle, acc.Metadata.ID)
+	}
+	if err := repo.FollowAccount(john, acc); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	if _, err := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Key: Hashes{acc.Hash}}}); err != nil {
+		t.Errorf("the followed actor must be stored: %s", err)
+	}
+
+	// the pending requests are filtered by FedBOX, without loading the inboxes of the followers
+	inboxLoads := 0
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/inbox") {
+			inboxLoads++
+		}
+		handler.ServeHTTP(w, r)
+	})
+	pending := Filters{LoadFollowRequestsFilter: LoadFollowRequestsFilter{Actor: Hashes{john.Hash}}}
+	follows, cnt, _ := repo.LoadFollowRequests(nil, pending)
+	if cnt != 1 {
+		t.Fatalf("Pending follow requests count must be %d, received %d", 1, cnt)
+	}
+	if inboxLoads > 0 {
+		t.Errorf("Inbox requests count must be %d, received %d", 0, inboxLoads)
+	}
+	if follows[0].Object.Metadata.ID != acc.Metadata.ID {
+		t.Errorf("Follow request must be for %s, received %s", acc.Metadata.ID, follows[0].Object.Metadata.ID)
+	}
+
+	// the instance of the followed account answers in the follower's inbox
+	accept := fmt.Sprintf(`{"type":"Accept","actor":%q,"object":%q}`, alice.GetLink(), follows[0].Metadata.ID)
+	resp, err := http.Post(john.Metadata.InboxIRI, "application/activity+json", strings.NewReader(accept))
+	if err != nil {
+		t.Fatalf("unable to send the Accept: %s", err)
+	}
+	resp.Body.Close()
+	if _, cnt, _ = repo.LoadFollowRequests(nil, pending); cnt != 0 {
+		t.Errorf("Pending follow requests count must be %d after the Accept, received %d", 0, cnt)
+	}
+}
+
+func Test_HandleFollow_Private(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	requests := 0
+	wfSrv, _ := webFingerMock(t, &requests, "https://social.example/users/alice")
+	defer wfSrv.Close()
+	// the stand-in WebFinger server listens on the loopback interface, which the default resolver refuses
+	repo.webfinger = newWebFingerResolver()
+
+	john := mockFedboxAccount(t, srv, "john")
+	repo.WithAccount(&john)
+	h := mockHandler(repo)
+	h.conf = appConfig{BaseURL: "https://littr.example"}
+	form := url.Values{}
+	form.Set("address", "alice@"+strings.TrimPrefix(wfSrv.URL, "https://"))
+	r := mockFormRequest(http.MethodPost, "/follow", form)
+
+	w := httptest.NewRecorder()
+	h.HandleFollow(w, withHandlerContext(r, repo, &john))
+
+	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "/follow?address=") {
+		t.Errorf("the follow form must be shown again for an account on a private address, redirected to %q", loc)
+	}
+	if requests > 0 {
+		t.Errorf("Requests count to a private address must be %d, received %d", 0, requests)
+	}
+	pending := Filters{LoadFollowRequestsFilter: LoadFollowRequestsFilter{Actor: Hashes{john.Hash}}}
+	if _, cnt, _ := repo.LoadFollowRequests(nil, pending); cnt != 0 {
+		t.Errorf("Pending follow requests count must be %d, received %d", 0, cnt)
+	}
+}
+
+func Test_repository_ShareItem(t *testing.T) {
+	srv, repo := fedboxMock(t)
+	defer srv.Close()
+
+	jane := mockFedboxAccount(t, srv, "jane")
+	john := mockFedboxAccount(t, srv, "john")
+	bob := mockFedboxAccount(t, srv, "bob")
+
+	repo.WithAccount(&bob)
+	if err := repo.FollowAccount(bob, john); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&john, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	repo.WithAccount(&john)
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	it := mockFedboxItem(t, repo, Item{Title: "news", Data: "test", MimeType: MimeTypeText, SubmittedBy: &jane})
+	repo.WithAccount(&john)
+	for i := 0; i < 2; i++ {
+		if err := repo.ShareItem(john, it); err != nil {
+			t.Fatalf("unable to share item: %s", err)
+		}
+	}
+	itemFilter := Filters{LoadItemsFilter: LoadItemsFilter{Key: Hashes{it.Hash}}}
+	if loaded, _ := repo.LoadItem(itemFilter); loaded.Shares != 1 {
+		t.Errorf("Shares count must be %d, received %d", 1, loaded.Shares)
+	}
+
+	// the Announce is delivered to the followers of john
+	items, _, err := repo.LoadItems(Filters{LoadItemsFilter: LoadItemsFilter{FollowedBy: bob.Hash.String()}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(items) != 1 || !HashesEqual(items[0].Hash, it.Hash) {
+		t.Fatalf("Items followed by %s must contain %q, received %v", bob.Handle, it.Title, items)
+	}
+	if items[0].SharedBy == nil || items[0].SharedBy.Handle != john.Handle {
+		t.Errorf("Item must be shared by %s, received %v", john.Handle, items[0].SharedBy)
+	}
+
+	// an Announce from another instance lands in the shared inbox
+	remote := fedboxtest.NewServer()
+	defer remote.Close()
+	alice := remote.AddActor("alice", "secret")
+	announce := fmt.Sprintf(`{"type":"Announce","actor":%q,"object":%q}`, alice.GetLink(), it.Metadata.ID)
+	resp, err := http.Post(fmt.Sprintf("%s/inbox", srv.URL), "application/activity+json", strings.NewReader(announce))
+	if err != nil {
+		t.Fatalf("unable to send the Announce: %s", err)
+	}
+	resp.Body.Close()
+	// the shared inbox is cached, so a fresh client is used to see the remote activity
+	fresh := ActivityPubService(appConfig{APIURL: srv.URL, Logger: log.Dev(log.PanicLevel)})
+	if loaded, _ := fresh.LoadItem(itemFilter); loaded.Shares != 2 {
+		t.Errorf("Shares count must be %d after the remote Announce, received %d", 2, loaded.Shares)
+	}
+}
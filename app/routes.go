@@ -13,6 +13,7 @@ func (h *handler) Routes() func(chi.Router) {
 	return func(r chi.Router) {
 		r.Use(middleware.GetHead)
 		r.Use(ReqLogger(h.logger))
+		r.Use(h.Feeds)
 		r.Use(h.LoadSession)
 		r.Use(SetSecurityHeaders)
 		//r.Use(middleware.RedirectSlashes)
@@ -22,26 +23,36 @@ func (h *handler) Routes() func(chi.Router) {
 		r.Get("/", h.HandleIndex)
 		r.With(h.CSRF).Group(func(r chi.Router) {
 			r.Get("/submit", h.ShowSubmit)
-			r.Post("/submit", h.HandleSubmit)
+			r.With(h.ValidatePermissions(ActionSubmit)).Post("/submit", h.HandleSubmit)
 			r.With(checkUserCreatingEnabled).Get("/register", h.ShowRegister)
 			r.With(checkUserCreatingEnabled).Post("/register", h.HandleRegister)
 		})
 
 		r.Route("/~{handle}", func(r chi.Router) {
-			r.Get("/", h.ShowAccount)
-			r.Post("/", h.HandleSubmit)
-			r.Get("/follow", h.FollowAccount)
-			r.Get("/follow/{action}", h.HandleFollowRequest)
+			r.With(h.CSRF).Get("/", h.ShowAccount)
+			r.Get("/followers", h.ShowAccountFollows)
+			r.Get("/following", h.ShowAccountFollows)
+			r.With(h.ValidatePermissions(ActionComment)).Post("/", h.HandleSubmit)
+			r.With(h.ValidatePermissions(ActionFollow)).Get("/follow", h.FollowAccount)
+			r.With(h.ValidatePermissions(ActionFollow)).Get("/follow/{action}", h.HandleFollowRequest)
+			r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors), h.CSRF).Group(func(r chi.Router) {
+				r.Post("/unfollow", h.UnfollowAccount)
+				r.Post("/block", h.BlockAccount)
+				r.Post("/unblock", h.UnblockAccount)
+			})
+			r.With(h.NeedsSessions, h.CSRF, h.ValidatePermissions(ActionAdmin)).Post("/role", h.HandleRole)
 
 			r.Route("/{hash}", func(r chi.Router) {
 				r.Use(h.CSRF)
 				r.Get("/", h.ShowItem)
-				r.Post("/", h.HandleSubmit)
+				r.With(h.ValidatePermissions(ActionComment)).Post("/", h.HandleSubmit)
 
 				r.Group(func(r chi.Router) {
 					r.Use(h.ValidateLoggedIn(h.v.HandleErrors))
-					r.Get("/yay", h.HandleVoting)
-					r.Get("/nay", h.HandleVoting)
+					r.With(h.ValidatePermissions(ActionVote)).Get("/yay", h.HandleVoting)
+					r.With(h.ValidatePermissions(ActionDownvote)).Get("/nay", h.HandleVoting)
+					r.With(h.ValidatePermissions(ActionShare)).Get("/share", h.ShowShare)
+					r.With(h.ValidatePermissions(ActionShare)).Post("/share", h.HandleShare)
 
 					r.Get("/bad", h.ShowReport)
 					r.Post("/bad", h.HandleReport)
@@ -55,13 +66,22 @@ func (h *handler) Routes() func(chi.Router) {
 			})
 		})
 
-		//r.Get("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/", frontend.HandleDate)
-		//r.Get("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/{hash}", h.ShowItem)
-		//r.Get("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/{hash}/{direction}", h.HandleVoting)
-		//r.Post("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/{hash}", h.HandleSubmit)
+		r.Route("/{year:[0-9]{4}}", func(r chi.Router) {
+			r.Get("/", h.HandleArchive)
+			r.Route("/{month:[0-9]{2}}", func(r chi.Router) {
+				r.Get("/", h.HandleArchive)
+				r.Route("/{day:[0-9]{2}}", func(r chi.Router) {
+					r.Get("/", h.HandleDate)
+					// the item permalinks of the previous versions of littr
+					r.Get("/{hash}", h.HandleDateRedirect)
+					r.Get("/{hash}/{action}", h.HandleDateRedirect)
+				})
+			})
+		})
 
 		// @todo(marius) :link_generation:
 		r.Get("/i/{hash}", h.HandleItemRedirect)
+		r.Get("/preview/{hash}/{kind}", h.ShowPreviewImage)
 
 		// @todo(marius) :link_generation:
 		r.Get("/d", h.HandleDomains)
@@ -69,6 +89,7 @@ func (h *handler) Routes() func(chi.Router) {
 		r.Get("/d/{domain}", h.HandleDomains)
 		// @todo(marius) :link_generation:
 		r.Get("/t/{tag}", h.HandleTags)
+		r.Get("/search", h.HandleSearch)
 
 		r.With(h.NeedsSessions).Get("/logout", h.HandleLogout)
 		r.With(h.CSRF, h.NeedsSessions).Group(func(r chi.Router) {
@@ -78,7 +99,30 @@ func (h *handler) Routes() func(chi.Router) {
 
 		r.Get("/self", h.HandleIndex)
 		r.Get("/federated", h.HandleIndex)
+		r.Get("/hot", h.HandleIndex)
+		r.Get("/new", h.HandleIndex)
+		r.Get("/top", h.HandleIndex)
+		r.Get("/top/{period}", h.HandleIndex)
+		r.Get("/controversial", h.HandleIndex)
 		r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors)).Get("/followed", h.HandleInbox)
+		r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors), h.CSRF).Get("/settings", h.ShowSettings)
+		r.Route("/messages", func(r chi.Router) {
+			r.Use(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors), h.CSRF)
+			r.Get("/", h.ShowMessages)
+			r.Get("/{key}", h.ShowConversation)
+			r.With(h.ValidatePermissions(ActionComment)).Post("/{key}", h.HandleSubmit)
+		})
+		r.Route("/follow", func(r chi.Router) {
+			r.Use(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors), h.ValidatePermissions(ActionFollow), h.CSRF)
+			r.Get("/", h.ShowFollow)
+			r.Post("/", h.HandleFollow)
+		})
+
+		r.Route("/mod", func(r chi.Router) {
+			r.Use(h.NeedsSessions, h.ValidateLoggedIn(h.v.HandleErrors), h.ValidatePermissions(ActionModerate), h.CSRF)
+			r.Get("/", h.ShowModeration)
+			r.Post("/{hash}/{action}", h.HandleModeration)
+		})
 
 		r.Route("/auth", func(r chi.Router) {
 			r.Use(h.NeedsSessions)
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+// mockLoggedRequest returns a request for target, with the session cookies of acc
+func mockLoggedRequest(h handler, method, target string, acc Account) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	s, _ := h.v.s.get(r)
+	s.Values[SessionUserKey] = acc
+	w := httptest.NewRecorder()
+	h.v.s.save(w, r)
+
+	r = httptest.NewRequest(method, target, nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func Test_handler_Routes_StateChangesNeedCSRF(t *testing.T) {
+	conf := Instance.Config
+	defer func() { Instance.Config = conf }()
+	Instance.Config.SessionsEnabled = true
+
+	repo := InMemoryService(appConfig{})
+	instance := mockAccount(t, repo, "instance")
+	jane := mockAccount(t, repo, "jane")
+	john := mockAccount(t, repo, "john")
+	if err := repo.FollowAccount(jane, john); err != nil {
+		t.Fatalf("unable to follow: %s", err)
+	}
+	requests, _, _ := repo.LoadFollowRequests(&john, Filters{})
+	if len(requests) != 1 {
+		t.Fatalf("Follow requests count must be %d, received %d", 1, len(requests))
+	}
+	if err := repo.SendFollowResponse(requests[0], true); err != nil {
+		t.Fatalf("unable to accept follow request: %s", err)
+	}
+
+	it := mockItem(t, repo, Item{Title: "Test", Data: "lorem ipsum", MimeType: MimeTypeText, SubmittedBy: &john})
+
+	h := mockHandler(repo)
+	h.app = &instance
+	h.suspended = new(suspensions)
+	h.conf = appConfig{SessionKeys: [][]byte{[]byte("0123456789abcdef")}}
+	noop := func(string, log.Ctx) {}
+	h.v, _ = ViewInit(h.conf, noop, noop)
+	mux := chi.NewRouter()
+	mux.Route("/", h.Routes())
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		for _, action := range []string{"block", "unfollow", it.Hash.String() + "/share"} {
+			r := mockLoggedRequest(h, method, "/~john/"+action, jane)
+			r.Header.Set("Referer", "/~john")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code == http.StatusSeeOther {
+				t.Errorf("%s /~john/%s without a request token must fail", method, action)
+			}
+		}
+	}
+	if len(repo.shares) != 0 {
+		t.Errorf("Item %s must not be shared without a request token", it.Hash)
+	}
+	if blocked, _, _ := repo.LoadBlockedAccounts(jane); len(blocked) != 0 {
+		t.Errorf("Account %s must not be blocked without a request token", john.Handle)
+	}
+	if acc, _ := repo.LoadAccount(Filters{LoadAccountsFilter: LoadAccountsFilter{Key: Hashes{jane.Hash}}}); !AccountFollows(&acc, &john) {
+		t.Errorf("Account %s must still be followed without a request token", john.Handle)
+	}
+}
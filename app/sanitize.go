@@ -0,0 +1,228 @@
+package app
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// linkRel is the rel attribute of all the links in the content of the items
+const linkRel = "nofollow ugc noopener"
+
+// allowedElements are the HTML elements, with their attributes, that we keep in the content of the items
+var allowedElements = map[string][]string{
+	"a":          {"href", "title", "class"},
+	"abbr":       {"title"},
+	"b":          nil,
+	"blockquote": {"cite"},
+	"br":         nil,
+	"code":       nil,
+	"dd":         nil,
+	"del":        nil,
+	"dl":         nil,
+	"dt":         nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title", "width", "height"},
+	"ins":        nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"small":      nil,
+	"span":       {"class"},
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"align", "colspan", "rowspan"},
+	"tfoot":      nil,
+	"th":         {"align", "colspan", "rowspan"},
+	"thead":      nil,
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// droppedElements are the HTML elements that get removed together with their content,
+// the rest of the elements that aren't allowed are removed, but their text is kept
+var droppedElements = map[string]bool{
+	"applet":    true,
+	"frameset":  true,
+	"head":      true,
+	"iframe":    true,
+	"math":      true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"object":    true,
+	"plaintext": true,
+	"script":    true,
+	"select":    true,
+	"style":     true,
+	"svg":       true,
+	"template":  true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// allowedClasses are the classes used by us and the other ActivityPub services for the mentions and tags
+var allowedClasses = map[string]bool{
+	"ellipsis":  true,
+	"h-card":    true,
+	"hashtag":   true,
+	"invisible": true,
+	"mention":   true,
+	"tag":       true,
+	"u-url":     true,
+}
+
+var voidElements = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"img": true,
+}
+
+// sanitizeURL returns the URL if it's relative or it uses one of the schemes we allow in links and images
+func sanitizeURL(attr, s string) (string, bool) {
+	// NOTE(marius): the browsers ignore the white space and control characters in the scheme,
+	// eg: "java\tscript:", so we remove them before parsing
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), attr == "href"
+	}
+	return "", false
+}
+
+func attrAllowed(attrs []string, name string) bool {
+	for _, a := range attrs {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sanitizeClass(s string) string {
+	classes := make([]string, 0)
+	for _, c := range strings.Fields(s) {
+		if allowedClasses[c] {
+			classes = append(classes, c)
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+// sanitizeHTML removes from the HTML the elements and attributes that aren't in our allow lists, and sets
+// the rel attribute of the links. The elements left open get closed, and the closing tags without a
+// matching element are dropped, so the content can't break the markup of the page it's rendered in.
+func sanitizeHTML(data string) string {
+	buf := bytes.Buffer{}
+	open := make([]string, 0)
+	dropDepth := 0
+	dropping := ""
+
+	z := nethtml.NewTokenizer(strings.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		name := tok.Data
+		if dropDepth > 0 {
+			switch {
+			case tt == nethtml.StartTagToken && name == dropping:
+				dropDepth++
+			case tt == nethtml.EndTagToken && name == dropping:
+				dropDepth--
+			}
+			continue
+		}
+		switch tt {
+		case nethtml.TextToken:
+			buf.WriteString(nethtml.EscapeString(tok.Data))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedElements[name] {
+				if tt == nethtml.StartTagToken {
+					dropping = name
+					dropDepth = 1
+				}
+				continue
+			}
+			attrs, ok := allowedElements[name]
+			if !ok {
+				continue
+			}
+			buf.WriteString("<" + name)
+			for _, a := range tok.Attr {
+				if len(a.Namespace) > 0 || !attrAllowed(attrs, a.Key) {
+					continue
+				}
+				val := a.Val
+				switch a.Key {
+				case "href", "src", "cite":
+					if val, ok = sanitizeURL(a.Key, val); !ok {
+						continue
+					}
+				case "class":
+					if val = sanitizeClass(val); len(val) == 0 {
+						continue
+					}
+				}
+				buf.WriteString(" " + a.Key + `="` + nethtml.EscapeString(val) + `"`)
+			}
+			if name == "a" {
+				buf.WriteString(` rel="` + linkRel + `"`)
+			}
+			buf.WriteString(">")
+			if !voidElements[name] {
+				if tt == nethtml.SelfClosingTagToken {
+					buf.WriteString("</" + name + ">")
+				} else {
+					open = append(open, name)
+				}
+			}
+		case nethtml.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				// closing an element closes the ones opened inside it too
+				for j := len(open) - 1; j >= i; j-- {
+					buf.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		buf.WriteString("</" + open[i] + ">")
+	}
+	return buf.String()
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// xssCorpus contains known XSS payloads, most of them from the OWASP filter evasion cheat sheet
+var xssCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=http://xss.rocks/xss.js></SCRIPT>`,
+	`<scr<script>ipt>alert(1)</scr</script>ipt>`,
+	`<script/xss src="http://xss.rocks/xss.js"></script>`,
+	`<<SCRIPT>alert("XSS");//<</SCRIPT>`,
+	`<IMG SRC="javascript:alert('XSS');">`,
+	`<IMG SRC=javascript:alert('XSS')>`,
+	`<IMG SRC=JaVaScRiPt:alert('XSS')>`,
+	"<IMG SRC=`javascript:alert(\"RSnake says, 'XSS'\")`>",
+	`<IMG """><SCRIPT>alert("XSS")</SCRIPT>">`,
+	`<IMG SRC=javascript:alert(String.fromCharCode(88,83,83))>`,
+	`<IMG SRC=# onmouseover="alert('xxs')">`,
+	`<IMG SRC=/ onerror="alert(String.fromCharCode(88,83,83))"></img>`,
+	`<img src=x onerror="&#0000106&#0000097&#0000118&#0000097&#0000115&#0000099&#0000114&#0000105&#0000112&#0000116&#0000058&#0000097&#0000108&#0000101&#0000114&#0000116&#0000040&#0000039&#0000088&#0000083&#0000083&#0000039&#0000041">`,
+	`<IMG SRC=&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;&#97;&#108;&#101;&#114;&#116;&#40;&#39;&#88;&#83;&#83;&#39;&#41;>`,
+	`<IMG SRC=&#x6A&#x61&#x76&#x61&#x73&#x63&#x72&#x69&#x70&#x74&#x3A&#x61&#x6C&#x65&#x72&#x74&#x28&#x27&#x58&#x53&#x53&#x27&#x29>`,
+	`<IMG SRC="jav	ascript:alert('XSS');">`,
+	`<IMG SRC="jav&#x09;ascript:alert('XSS');">`,
+	`<IMG SRC="jav&#x0A;ascript:alert('XSS');">`,
+	`<IMG SRC=" &#14;  javascript:alert('XSS');">`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href="  JAVASCRIPT:alert(1)">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="#" onclick="alert(1)">click</a>`,
+	`<a href="http://example.com" target="_blank" style="position:fixed;top:0">click</a>`,
+	`<BODY ONLOAD=alert('XSS')>`,
+	`<BGSOUND SRC="javascript:alert('XSS');">`,
+	`<LINK REL="stylesheet" HREF="javascript:alert('XSS');">`,
+	`<STYLE>@import'http://xss.rocks/xss.css';</STYLE>`,
+	`<META HTTP-EQUIV="refresh" CONTENT="0;url=javascript:alert('XSS');">`,
+	`<IFRAME SRC="javascript:alert('XSS');"></IFRAME>`,
+	`<iframe srcdoc="<script>alert(1)</script>">`,
+	`<TABLE BACKGROUND="javascript:alert('XSS')">`,
+	`<DIV STYLE="background-image: url(javascript:alert('XSS'))">`,
+	`<DIV STYLE="width: expression(alert('XSS'));">`,
+	`<BASE HREF="javascript:alert('XSS');//">`,
+	`<OBJECT TYPE="text/x-scriptlet" DATA="http://xss.rocks/scriptlet.html"></OBJECT>`,
+	`<EMBED SRC="data:image/svg+xml;base64,PHN2ZyB4bWxuczpzdmc9Imh0dH A6Ly93d3cudzMub3JnLzIwMDAvc3ZnIiB4bWxucz0iaHR0cDovL3d3dy53My5vcmcv MjAwMC9zdmciIHhtbG5zOnhsaW5rPSJodHRwOi8vd3d3LnczLm9yZy8xOTk5L3hs aW5rIiB2ZXJzaW9uPSIxLjAiIHg9IjAiIHk9IjAiIHdpZHRoPSIxOTQiIGhlaWdodD0iMjAw IiBpZD0ieHNzIj48c2NyaXB0IHR5cGU9InRleHQvZWNtYXNjcmlwdCI+YWxlcnQoIlh TUyIpOzwvc2NyaXB0Pjwvc3ZnPg==" type="image/svg+xml" AllowScriptAccess="always"></EMBED>`,
+	`<svg/onload=alert('XSS')>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)></style></mglyph></table></mtext></math>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<form action="javascript:alert(1)"><button>go</button></form>`,
+	`<input type="image" src="javascript:alert(1)">`,
+	`<details open ontoggle=alert(1)>`,
+	`<video><source onerror="alert(1)"></video>`,
+	`<p>text</p><!--<img src=x onerror=alert(1)>-->`,
+	`<![CDATA[<script>alert(1)</script>]]>`,
+	`<blockquote cite="javascript:alert(1)">quote</blockquote>`,
+	`<span class="mention" onmouseover="alert(1)">@alice</span>`,
+	`</article></section><script>alert(1)</script>`,
+	`<a href="http://example.com/"><img src="http://example.com/x.png" onerror="alert(1)"></a>`,
+	`<p x="<script>alert(1)</script>">text</p>`,
+	`<IMG SRC="jav&#x0D;ascript:alert('XSS');">`,
+	`<a href="jAvAsCrIpT&colon;alert(1)">click</a>`,
+}
+
+// assertSafeHTML parses the HTML the way the browsers do and checks that it only contains the
+// allowed elements and attributes
+func assertSafeHTML(t *testing.T, input, out string) {
+	doc, err := nethtml.Parse(strings.NewReader(out))
+	if err != nil {
+		t.Errorf("unable to parse the sanitized HTML of %q: %s", input, err)
+		return
+	}
+	var check func(n *nethtml.Node)
+	check = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			attrs, ok := allowedElements[n.Data]
+			if !ok && n.Data != "html" && n.Data != "head" && n.Data != "body" {
+				t.Errorf("Element %q must be removed from %q, received %q", n.Data, input, out)
+			}
+			for _, a := range n.Attr {
+				if a.Key == "rel" && n.Data == "a" {
+					continue
+				}
+				if !attrAllowed(attrs, a.Key) {
+					t.Errorf("Attribute %q of %q must be removed from %q, received %q", a.Key, n.Data, input, out)
+				}
+				if v := strings.ToLower(a.Val); strings.Contains(v, "script:") || strings.HasPrefix(v, "data:") {
+					t.Errorf("Attribute %q of %q must not contain a script URL for %q, received %q", a.Key, n.Data, input, out)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			check(c)
+		}
+	}
+	check(doc)
+}
+
+func Test_sanitizeHTML_XSS(t *testing.T) {
+	for _, payload := range xssCorpus {
+		out := sanitizeHTML(payload)
+		assertSafeHTML(t, payload, out)
+		if md := string(Markdown(payload)); len(md) > 0 {
+			assertSafeHTML(t, payload, md)
+		}
+	}
+}
+
+func Test_sanitizeHTML(t *testing.T) {
+	tests := map[string]string{
+		`<p>Hello <b>world</b></p>`:                                     `<p>Hello <b>world</b></p>`,
+		`<a href="https://example.com" target="_blank">link</a>`:        `<a href="https://example.com" rel="nofollow ugc noopener">link</a>`,
+		`<a href="/t/tag" rel="tag" class="mention hashtag x">#tag</a>`: `<a href="/t/tag" class="mention hashtag" rel="nofollow ugc noopener">#tag</a>`,
+		`<p>unclosed <em>emphasis`:                                      `<p>unclosed <em>emphasis</em></p>`,
+		`<div>block</div></article>`:                                    `block`,
+		`1 < 2 & 3 > 2`:                                                 `1 &lt; 2 &amp; 3 &gt; 2`,
+		`<script>alert(1)</script>kept`:                                 `kept`,
+		`<img src="https://example.com/x.png" alt="x"/>`:                `<img src="https://example.com/x.png" alt="x">`,
+	}
+	for input, want := range tests {
+		if out := sanitizeHTML(input); out != want {
+			t.Errorf("Sanitized HTML of %q must be %q, received %q", input, want, out)
+		}
+	}
+}
+
+func Test_replaceTagsInItem(t *testing.T) {
+	name := `tag"><script>alert(1)</script>`
+	it := Item{
+		Data:     "hello #" + name,
+		MimeType: MimeTypeHTML,
+		Metadata: &ItemMetadata{
+			Tags: TagCollection{{Type: TagTag, Name: name, URL: `javascript:alert(1)`}},
+		},
+	}
+	out := string(html(replaceTagsInItem(it)))
+	assertSafeHTML(t, it.Data, out)
+	if strings.Contains(out, "<script") {
+		t.Errorf("Tag names must be escaped, received %q", out)
+	}
+}
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"fmt"
+	gohtml "html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/littr.go/internal/log"
+	"github.com/mariusor/littr.go/internal/search"
+)
+
+// Index is the full text index of the items
+type Index interface {
+	Index(docs ...search.Document) error
+	Remove(ids ...string) error
+	Search(q search.Query) (search.Result, error)
+}
+
+const (
+	defaultSearchIndexPath = "littr.idx"
+	defaultESIndex         = "littr"
+	backfillPageSize       = 100
+)
+
+// initIndex returns the index for the configured search backend, it returns nil when searching is disabled
+func initIndex(c appConfig) (Index, error) {
+	switch c.SearchBackend {
+	case "none":
+		return nil, nil
+	case "es":
+		es := Instance.Config.ES
+		if len(es.Host) == 0 {
+			return nil, errors.Newf("missing ES_HOST for the es search backend")
+		}
+		u := fmt.Sprintf("http://%s", es.Host)
+		if len(es.Port) > 0 {
+			u = fmt.Sprintf("%s:%s", u, es.Port)
+		}
+		name := es.Name
+		if len(name) == 0 {
+			name = defaultESIndex
+		}
+		idx, err := search.NewElastic(u, name, es.User, es.Pw)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	path := c.SearchIndexPath
+	if c.StorageBackend == "memory" {
+		// NOTE(marius): the items don't outlive the process, neither should their index
+		path = ""
+	}
+	idx, err := search.NewEmbedded(path)
+	if err != nil {
+		return idx, err
+	}
+	return idx, nil
+}
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// searchDocument converts an item to the document we're indexing
+func searchDocument(it Item) search.Document {
+	d := search.Document{
+		ID:        it.Hash.String(),
+		Title:     it.Title,
+		Domain:    it.GetDomain(),
+		Published: it.SubmittedAt,
+	}
+	if !it.IsLink() {
+		d.Content = it.Data
+		if it.MimeType == MimeTypeHTML {
+			d.Content = gohtml.UnescapeString(htmlTags.ReplaceAllString(it.Data, " "))
+		}
+	}
+	if it.SubmittedBy != nil {
+		d.Author = it.SubmittedBy.Handle
+	}
+	if it.HasMetadata() {
+		for _, t := range it.Metadata.Tags {
+			if len(t.Name) > 0 {
+				d.Tags = append(d.Tags, t.Name)
+			}
+		}
+	}
+	return d
+}
+
+// updateIndex adds the item to the index, or removes it if it's not supposed to be found anymore
+func updateIndex(idx Index, it Item) error {
+	if idx == nil || len(it.Hash) == 0 {
+		return nil
+	}
+	if it.Deleted() || it.Private() {
+		return idx.Remove(it.Hash.String())
+	}
+	return idx.Index(searchDocument(it))
+}
+
+// BackfillIndex adds all the public items of the repository to the index, returning their number
+func BackfillIndex(repo Repository, idx Index) (int, error) {
+	if idx == nil {
+		return 0, errors.Newf("searching is disabled")
+	}
+	f := Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Deleted: []bool{false},
+			Private: []bool{false},
+		},
+		Page:     1,
+		MaxItems: backfillPageSize,
+	}
+	count := 0
+	for {
+		items, _, err := repo.LoadItems(f)
+		if err != nil {
+			return count, err
+		}
+		docs := make([]search.Document, 0, len(items))
+		for _, it := range items {
+			if it.Deleted() || it.Private() {
+				continue
+			}
+			docs = append(docs, searchDocument(it))
+		}
+		if err := idx.Index(docs...); err != nil {
+			return count, err
+		}
+		count += len(docs)
+		if len(items) < f.MaxItems {
+			return count, nil
+		}
+		f.Page++
+	}
+}
+
+// Backfill indexes the items of the current storage backend
+func (a *Application) Backfill() (int, error) {
+	conf := appConfig{
+		Env:      a.Config.Env,
+		Logger:   a.Logger.New(log.Ctx{"package": "search"}),
+		Secure:   a.Secure,
+		BaseURL:  a.BaseURL,
+		APIURL:   a.APIURL,
+		HostName: a.HostName,
+	}
+	h, err := Init(conf)
+	if err != nil {
+		return 0, err
+	}
+	return BackfillIndex(h.storage, h.index)
+}
+
+// searchItems returns the items matching the query, in the order of their relevance, and the total number of matches
+func (h *handler) searchItems(q search.Query) (ItemCollection, uint, error) {
+	if h.index == nil {
+		return nil, 0, errors.NotImplementedf("searching is disabled")
+	}
+	res, err := h.index.Search(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(res.IDs) == 0 {
+		return ItemCollection{}, res.Total, nil
+	}
+	hashes := make(Hashes, len(res.IDs))
+	pos := make(map[string]int, len(res.IDs))
+	for i, id := range res.IDs {
+		hashes[i] = Hash(id)
+		pos[id] = i
+	}
+	all, _, err := h.storage.LoadItems(Filters{
+		LoadItemsFilter: LoadItemsFilter{
+			Key:     hashes,
+			Deleted: []bool{false},
+		},
+		Page:     1,
+		MaxItems: len(hashes),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	found := make(ItemCollection, len(res.IDs))
+	for _, it := range all {
+		if k, ok := pos[it.Hash.String()]; ok {
+			found[k] = it
+		}
+	}
+	items := make(ItemCollection, 0, len(found))
+	for _, it := range found {
+		if it.IsValid() && !it.Private() {
+			items = append(items, it)
+		}
+	}
+	return items, res.Total, nil
+}
+
+// searchQuery loads the query from the "q", "page" and "maxItems" parameters of the request
+func searchQuery(r *http.Request) search.Query {
+	q := search.Query{
+		Text:     strings.TrimSpace(r.URL.Query().Get("q")),
+		Page:     1,
+		MaxItems: MaxContentItems,
+	}
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		q.Page = p
+	}
+	if m, err := strconv.Atoi(r.URL.Query().Get("maxItems")); err == nil && m > 0 {
+		q.MaxItems = m
+	}
+	return q
+}
+
+// HandleSearch serves /search request
+func (h *handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	q := searchQuery(r)
+	if q.MaxItems > MaxContentItems {
+		q.MaxItems = MaxContentItems
+	}
+	m := searchModel{Query: q.Text}
+	m.Title = "Search"
+	if len(q.Text) == 0 {
+		h.v.RenderTemplate(r, w, "search", m)
+		return
+	}
+	m.Title = fmt.Sprintf("Search: %s", q.Text)
+	items, total, err := h.searchItems(q)
+	if err != nil {
+		h.logger.WithContext(log.Ctx{"q": q.Text}).Error(err.Error())
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "unable to search"))
+		return
+	}
+	comments := loadComments(items)
+	acct := account(r)
+	if acct.IsLogged() {
+		acct.Votes, _, _ = h.storage.LoadVotes(Filters{
+			LoadVotesFilter: LoadVotesFilter{
+				AttributedTo: []Hash{acct.Hash},
+				ItemKey:      comments.getItemsHashes(),
+			},
+			MaxItems: MaxContentItems,
+		})
+	}
+	for _, c := range comments {
+		m.Items = append(m.Items, c)
+	}
+	m.Total = int(total)
+	if uint(q.Page*q.MaxItems) < total {
+		m.nextPage = q.Page + 1
+	}
+	if q.Page > 1 {
+		m.prevPage = q.Page - 1
+	}
+	h.v.RenderTemplate(r, w, "search", m)
+}
+
+// APISearch serves GET /api/v1/search requests
+func (h *handler) APISearch(w http.ResponseWriter, r *http.Request) {
+	q := searchQuery(r)
+	if len(q.Text) == 0 {
+		errors.HandleError(errors.BadRequestf("missing search query")).ServeHTTP(w, r)
+		return
+	}
+	if q.MaxItems > MaxAPIItems {
+		q.MaxItems = MaxAPIItems
+	}
+	all, total, err := h.searchItems(q)
+	if err != nil {
+		h.logger.WithContext(log.Ctx{"q": q.Text}).Error(err.Error())
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	items := make([]apiItem, 0)
+	found := loadComments(all)
+	counts := h.commentsCounts(found)
+	for k, c := range found {
+		it := loadAPIItem(*c)
+		it.CommentsCount = counts[k]
+		items = append(items, it)
+	}
+	col := apiCollection{
+		Page:       q.Page,
+		TotalItems: total,
+		Items:      items,
+	}
+	if uint(q.Page*q.MaxItems) < total {
+		col.Next = absoluteLink(r.URL.Path + string(pageLink(r, q.Page+1)))
+	}
+	if q.Page > 1 {
+		col.Prev = absoluteLink(r.URL.Path + string(pageLink(r, q.Page-1)))
+	}
+	h.renderJSON(w, r, col)
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mariusor/littr.go/internal/search"
+)
+
+func Test_memRepository_SaveItem_Index(t *testing.T) {
+	idx, _ := search.NewEmbedded("")
+	repo := InMemoryService(appConfig{})
+	repo.index = idx
+	h := handler{storage: repo, index: idx}
+
+	jane := mockAccount(t, repo, "jane")
+	now := time.Now().UTC()
+	link := mockItem(t, repo, Item{
+		Title:       "A link about gophers",
+		Data:        "https://example.com/article",
+		MimeType:    MimeTypeURL,
+		SubmittedBy: &jane,
+		SubmittedAt: now.Add(-2 * time.Hour),
+	})
+	text := mockItem(t, repo, Item{
+		Title:       "Some text",
+		Data:        "<p>Lorem ipsum about <b>gophers</b></p>",
+		MimeType:    MimeTypeHTML,
+		SubmittedBy: &jane,
+		SubmittedAt: now.Add(-1 * time.Hour),
+		Metadata:    &ItemMetadata{Tags: TagCollection{{Name: "#golang"}}},
+	})
+
+	hashes := func(q string) []string {
+		items, _, err := h.searchItems(search.Query{Text: q})
+		if err != nil {
+			t.Fatalf("unexpected error searching for %q: %s", q, err)
+		}
+		res := make([]string, 0)
+		for _, it := range items {
+			res = append(res, it.Hash.String())
+		}
+		return res
+	}
+	expect := func(q string, want ...Item) {
+		got := hashes(q)
+		if len(got) != len(want) {
+			t.Fatalf("searching for %q must return %d items, received %v", q, len(want), got)
+		}
+		for i, it := range want {
+			if got[i] != it.Hash.String() {
+				t.Errorf("searching for %q, item %d must be %s, received %s", q, i, it.Hash, got[i])
+			}
+		}
+	}
+
+	expect("gophers", link, text)
+	expect("domain:example.com", link)
+	expect("#golang @jane", text)
+	expect("lorem", text)
+
+	text.Title = "Some edited text"
+	text.Data = "Dolor sit amet"
+	if text, _ = repo.SaveItem(text); text.Data != "Dolor sit amet" {
+		t.Fatalf("unable to edit item")
+	}
+	expect("lorem")
+	expect("dolor", text)
+
+	link.Delete()
+	if _, err := repo.SaveItem(link); err != nil {
+		t.Fatalf("unable to delete item: %s", err)
+	}
+	expect("gophers")
+	if idx.Len() != 1 {
+		t.Errorf("the index must contain 1 item, found %d", idx.Len())
+	}
+}
@@ -15,9 +15,11 @@ import (
 	"html/template"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -67,6 +69,7 @@ func (h *session) save(w http.ResponseWriter, r *http.Request) error {
 
 type view struct {
 	s      *session
+	unread *unreadCounts
 	infoFn LogFn
 	errFn  LogFn
 }
@@ -74,6 +77,7 @@ type view struct {
 func ViewInit(c appConfig, infoFn, errFn LogFn) (*view, error) {
 	v := view{
 		s:      &session{},
+		unread: new(unreadCounts),
 		infoFn: infoFn,
 		errFn:  errFn,
 	}
@@ -89,6 +93,8 @@ func ViewInit(c appConfig, infoFn, errFn LogFn) (*view, error) {
 	switch strings.ToLower(c.SessionsBackend) {
 	case "file":
 		v.s.s, _ = initFileSession(c.HostName, c.Secure, c.SessionKeys...)
+	case "redis":
+		v.s.s, _ = initRedisSession(redisClient(Instance.Config.Redis), c.HostName, c.Secure, c.SessionKeys...)
 	case "cookie":
 		fallthrough
 	default:
@@ -109,6 +115,11 @@ func (h *view) addFlashMessage(typ flashType, r *http.Request, msgs ...string) {
 }
 
 func (h *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name string, m interface{}) error {
+	if t, ok := requestedFeed(r); ok {
+		if f, ok := m.(feedModel); ok {
+			return h.RenderFeed(r, w, t, f)
+		}
+	}
 	var err error
 	var ac *Account
 	var s *sessions.Session
@@ -165,14 +176,16 @@ func (h *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 			"ScoreClass":        scoreClass,
 			"YayLink":           yayLink,
 			"NayLink":           nayLink,
+			"ShareLink":         shareLink,
+			"PreviewLink":       previewLink,
 			"AcceptLink":        acceptLink,
 			"RejectLink":        rejectLink,
-			"PageLink":          pageLink,
+			"PageLink":          func(p int) template.HTML { return pageLink(r, p) },
 			"CanPaginate":       canPaginate,
 			"Config":            func() Configuration { return Instance.Config },
 			"Info":              func() WebInfo { return nodeInfo },
 			"Name":              appName,
-			"Menu":              func() []headerEl { return headerMenu(r) },
+			"Menu":              func() []headerEl { return headerMenu(r, h.unread) },
 			"icon":              icon,
 			"asset":             func(p string) template.HTML { return template.HTML(asset(p)) },
 			"req":               func() *http.Request { return r },
@@ -183,6 +196,9 @@ func (h *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 			"ShowFollowLink":    showFollowedLink,
 			"Follows":           AccountFollows,
 			"IsFollowed":        AccountIsFollowed,
+			"Blocks":            AccountBlocks,
+			"Roles":             func() []Role { return ValidRoles },
+			"FeedLink":          func(t FeedType) string { return feedLink(r, t) },
 			csrf.TemplateTag:    func() template.HTML { return csrf.TemplateField(r) },
 			//"ScoreFmt":          func(i int64) string { return humanize.FormatInteger("#\u202F###", int(i)) },
 			//"NumberFmt":         func(i int64) string { return humanize.FormatInteger("#\u202F###", int(i)) },
@@ -347,8 +363,10 @@ func loadScoreFormat(s int) (string, string) {
 	return numberFormat("%3.1f", score), units
 }
 
-func headerMenu(r *http.Request) []headerEl {
-	sections := []string{"self", "federated", "followed"}
+// headerMenu returns the sections of the header, the unread messages count of the logged account
+// is loaded from the unread counts
+func headerMenu(r *http.Request, unread *unreadCounts) []headerEl {
+	sections := []string{"self", "federated", "followed", "messages"}
 	ret := make([]headerEl, 0)
 	for _, s := range sections {
 		el := headerEl{
@@ -366,6 +384,14 @@ func headerMenu(r *http.Request) []headerEl {
 		case "followed":
 			el.Icon = "star"
 			el.Auth = true
+		case "messages":
+			el.Icon = "lock"
+			el.Auth = true
+			if acc := account(r); acc.IsLogged() {
+				if repo, ok := ContextRepository(r.Context()); ok {
+					el.Count = unread.load(repo, acc)
+				}
+			}
 		}
 		ret = append(ret, el)
 	}
@@ -429,7 +455,7 @@ func getAuthProviders() map[string]string {
 }
 
 func html(data string) template.HTML {
-	return template.HTML(data)
+	return template.HTML(sanitizeHTML(data))
 }
 
 func text(data string) string {
@@ -561,6 +587,10 @@ func nayLink(i Item) string {
 	return scoreLink(i, "nay")
 }
 
+func shareLink(i Item) string {
+	return scoreLink(i, "share")
+}
+
 func acceptLink(f FollowRequest) string {
 	return fmt.Sprintf("%s/%s", followLink(f), "accept")
 }
@@ -569,12 +599,17 @@ func rejectLink(f FollowRequest) string {
 	return fmt.Sprintf("%s/%s", followLink(f), "reject")
 }
 
-func pageLink(p int) template.HTML {
-	if p >= 1 {
-		return template.HTML(fmt.Sprintf("?page=%d", p))
-	} else {
+// pageLink returns the query string for page p, keeping the other URL parameters of the current request
+func pageLink(r *http.Request, p int) template.HTML {
+	if p < 1 {
 		return template.HTML("")
 	}
+	q := url.Values{}
+	if r != nil {
+		q = r.URL.Query()
+	}
+	q.Set("page", strconv.Itoa(p))
+	return template.HTML("?" + q.Encode())
 }
 
 func canPaginate(m interface{}) bool {
@@ -621,11 +656,18 @@ func AccountIsFollowed(a, b *Account) bool {
 	return false
 }
 
-func showFollowedLink(logged, current *Account) bool {
-	if !Instance.Config.UserFollowingEnabled {
-		return false
+// AccountBlocks checks if a blocked b
+func AccountBlocks(a, b *Account) bool {
+	for _, acc := range a.Blocked {
+		if HashesEqual(acc.Hash, b.Hash) {
+			return true
+		}
 	}
-	if !logged.IsLogged() {
+	return false
+}
+
+func showFollowedLink(logged, current *Account) bool {
+	if !logged.Can(ActionFollow) {
 		return false
 	}
 	if HashesEqual(logged.Hash, current.Hash) {
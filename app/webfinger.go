@@ -5,18 +5,30 @@ import (
 	"encoding/xml"
 	"fmt"
 	"github.com/writeas/go-nodeinfo"
+	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
+	"github.com/mariusor/littr.go/internal/cache"
 )
 
 type link struct {
-	Rel      string `json:"rel,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Href     string `json:"href,omitempty"`
-	Template string `json:"template,omitempty"`
+	Rel      string `json:"rel,omitempty" xml:"rel,attr,omitempty"`
+	Type     string `json:"type,omitempty" xml:"type,attr,omitempty"`
+	Href     string `json:"href,omitempty" xml:"href,attr,omitempty"`
+	Template string `json:"template,omitempty" xml:"template,attr,omitempty"`
+}
+
+// hostMeta is the host-meta document described in RFC 6415, it gets serialized both as XRD and as JRD
+type hostMeta struct {
+	XMLName xml.Name `json:"-" xml:"http://docs.oasis-open.org/ns/xri/xrd-1.0 XRD"`
+	Links   []link   `json:"links" xml:"Link"`
 }
 
 type node struct {
@@ -26,13 +38,13 @@ type node struct {
 }
 
 type NodeInfoResolver struct {
-	storage  *repository
+	storage  Repository
 	users    int
 	comments int
 	posts    int
 }
 
-func NodeInfoResolverNew(storage *repository) NodeInfoResolver {
+func NodeInfoResolverNew(storage Repository) NodeInfoResolver {
 	n := NodeInfoResolver{
 		storage: storage,
 	}
@@ -108,22 +120,52 @@ func NodeInfoConfig() nodeinfo.Config {
 	}
 }
 
-// HandleHostMeta serves /.well-known/host-meta
+// hostMetaJSONAccepted checks if the client prefers the JRD representation of host-meta over the XRD one
+func hostMetaJSONAccepted(accept string) bool {
+	for _, mt := range strings.Split(accept, ",") {
+		if i := strings.Index(mt, ";"); i >= 0 {
+			mt = mt[:i]
+		}
+		switch strings.TrimSpace(mt) {
+		case "application/jrd+json", "application/json":
+			return true
+		case "application/xrd+xml", "application/xml", "text/xml":
+			return false
+		}
+	}
+	return false
+}
+
+// HandleHostMeta serves /.well-known/host-meta and /.well-known/host-meta.json
+// The XRD document is the default, the JRD one is served for the ".json" path or when the Accept header asks for it.
 func (h handler) HandleHostMeta(w http.ResponseWriter, r *http.Request) {
-	hm := node{
-		Subject: "",
-		Aliases: nil,
+	hm := hostMeta{
 		Links: []link{
 			{
 				Rel:      "lrdd",
-				Type:     "application/xrd+json",
-				Template: fmt.Sprintf("%s/.well-known/node?resource={uri}", h.conf.BaseURL),
+				Type:     "application/jrd+json",
+				Template: fmt.Sprintf("%s/.well-known/webfinger?resource={uri}", h.conf.BaseURL),
 			},
 		},
 	}
-	dat, _ := xml.Marshal(hm)
 
-	w.Header().Set("Content-Type", "application/jrd+json")
+	var dat []byte
+	var err error
+	contentType := "application/xrd+xml"
+	if strings.HasSuffix(r.URL.Path, ".json") || hostMetaJSONAccepted(r.Header.Get("Accept")) {
+		contentType = "application/jrd+json"
+		dat, err = json.Marshal(hm)
+	} else {
+		dat, err = xml.Marshal(hm)
+		dat = append([]byte(xml.Header), dat...)
+	}
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
 	w.WriteHeader(http.StatusOK)
 	w.Write(dat)
 }
@@ -158,7 +200,7 @@ func (h handler) HandleWebFinger(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		id := h.storage.BaseURL
+		id := BaseURL
 		wf.Aliases = []string{
 			id,
 		}
@@ -228,3 +270,142 @@ func (h handler) HandleWebFinger(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(dat)
 }
+
+const (
+	webFingerCacheSize = 512
+	// webFingerCacheTTL is how long we keep the actors resolved through WebFinger
+	webFingerCacheTTL = 24 * time.Hour
+	// webFingerMissTTL is how long we wait before trying again to resolve an account that WebFinger didn't find
+	webFingerMissTTL = 10 * time.Minute
+	// webFingerMaxSize is the maximum size of the WebFinger documents we read
+	webFingerMaxSize = 64 * 1024
+	// webFingerTimeout is the maximum time we wait for the WebFinger documents and the actors they point to
+	webFingerTimeout = 10 * time.Second
+	// actorMaxSize is the maximum size of the remote actors we read
+	actorMaxSize = 512 * 1024
+)
+
+// webFingerResolver loads the ActivityPub actors of the remote accounts from the WebFinger end-point
+// of their instance, caching the results. The hosts come from the users, so its client refuses to connect
+// to private addresses.
+type webFingerResolver struct {
+	client *http.Client
+	cache  Cache
+}
+
+func newWebFingerResolver() *webFingerResolver {
+	return &webFingerResolver{
+		client: &http.Client{
+			Transport: publicTransport(webFingerTimeout),
+			Timeout:   webFingerTimeout,
+		},
+		cache: cache.New(webFingerCacheSize),
+	}
+}
+
+// Actor loads the remote actor at iri, with the same client as the WebFinger requests
+func (wf *webFingerResolver) Actor(iri pub.IRI) (pub.Item, error) {
+	u, err := iri.URL()
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.NotValidf("invalid actor IRI %s", iri)
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid request for actor %s", iri)
+	}
+	req.Header.Set("Accept", `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+	resp, err := wf.client.Do(req)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load actor %s", iri)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, errors.NotFoundf("actor %s", iri)
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Newf("unable to load actor %s: %s", iri, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, actorMaxSize))
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load actor %s", iri)
+	}
+	it, err := pub.UnmarshalJSON(data)
+	if err != nil || it == nil || !pub.ActorTypes.Contains(it.GetType()) {
+		return nil, errors.NotValidf("invalid actor %s", iri)
+	}
+	return it, nil
+}
+
+// Resolve returns the IRI of the actor for the name@host account
+func (wf *webFingerResolver) Resolve(name, host string) (pub.IRI, error) {
+	res := fmt.Sprintf("acct:%s@%s", name, host)
+	if v, ok := wf.cache.Load(res); ok {
+		if iri, ok := v.(pub.IRI); ok && len(iri) > 0 {
+			return iri, nil
+		}
+		return "", errors.NotFoundf("account %s@%s", name, host)
+	}
+	iri, err := wf.load(res, host)
+	if err != nil {
+		// NOTE(marius): we don't cache the errors of the requests, only the accounts that the instance doesn't know
+		if errors.IsNotFound(err) {
+			wf.cache.Store(res, pub.IRI(""), webFingerMissTTL)
+		}
+		return "", err
+	}
+	wf.cache.Store(res, iri, webFingerCacheTTL)
+	return iri, nil
+}
+
+func (wf *webFingerResolver) load(res, host string) (pub.IRI, error) {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     "/.well-known/webfinger",
+		RawQuery: url.Values{"resource": []string{res}}.Encode(),
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", errors.Annotatef(err, "invalid WebFinger request for %s", res)
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+	resp, err := wf.client.Do(req)
+	if err != nil {
+		return "", errors.Annotatef(err, "unable to load WebFinger resource %s", res)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return "", errors.NotFoundf("WebFinger resource %s", res)
+	case resp.StatusCode != http.StatusOK:
+		return "", errors.Newf("unable to load WebFinger resource %s: %s", res, resp.Status)
+	}
+	wfn := node{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, webFingerMaxSize)).Decode(&wfn); err != nil {
+		return "", errors.Annotatef(err, "invalid WebFinger resource %s", res)
+	}
+	for _, l := range wfn.Links {
+		if l.Rel != "self" || len(l.Href) == 0 {
+			continue
+		}
+		typ := strings.TrimSpace(strings.Split(l.Type, ";")[0])
+		if typ == "application/activity+json" || typ == "application/ld+json" {
+			return pub.IRI(l.Href), nil
+		}
+	}
+	return "", errors.NotFoundf("ActivityPub actor for WebFinger resource %s", res)
+}
+
+// splitAccountAddress splits fediverse account addresses like "user@example.com", "@user@example.com"
+// or "acct:user@example.com" into the name of the account and the host of its instance
+func splitAccountAddress(addr string) (string, string, error) {
+	addr = strings.TrimSpace(addr)
+	acct := strings.TrimPrefix(strings.TrimPrefix(addr, "acct:"), "@")
+	pieces := strings.Split(acct, "@")
+	if len(pieces) != 2 || len(pieces[0]) == 0 || len(pieces[1]) == 0 || strings.ContainsAny(acct, "/?#; ") {
+		return "", "", errors.NotValidf("invalid account address %q, it should look like user@example.com", addr)
+	}
+	return pieces[0], strings.ToLower(pieces[1]), nil
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/littr.go/internal/log"
+)
+
+func Test_HandleHostMeta(t *testing.T) {
+	h := handler{conf: appConfig{BaseURL: "https://littr.example"}}
+	template := "https://littr.example/.well-known/webfinger?resource={uri}"
+
+	tests := map[string]struct {
+		path        string
+		accept      string
+		contentType string
+	}{
+		"default":     {path: "/.well-known/host-meta", contentType: "application/xrd+xml"},
+		"accept xrd":  {path: "/.well-known/host-meta", accept: "application/xrd+xml", contentType: "application/xrd+xml"},
+		"accept jrd":  {path: "/.well-known/host-meta", accept: "application/jrd+json", contentType: "application/jrd+json"},
+		"accept json": {path: "/.well-known/host-meta", accept: "text/html;q=0.9, application/json", contentType: "application/jrd+json"},
+		"suffix":      {path: "/.well-known/host-meta.json", contentType: "application/jrd+json"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.HandleHostMeta(w, r)
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Fatalf("Content-Type must be %q, received %q", tt.contentType, ct)
+			}
+			hm := hostMeta{}
+			var err error
+			if tt.contentType == "application/jrd+json" {
+				err = json.Unmarshal(w.Body.Bytes(), &hm)
+			} else {
+				err = xml.Unmarshal(w.Body.Bytes(), &hm)
+			}
+			if err != nil {
+				t.Fatalf("unable to parse the response: %s\n%s", err, w.Body.String())
+			}
+			if len(hm.Links) != 1 || hm.Links[0].Rel != "lrdd" || hm.Links[0].Template != template {
+				t.Errorf("host-meta must contain the lrdd link with the %q template, received %v", template, hm.Links)
+			}
+		})
+	}
+}
+
+// webFingerMock returns a WebFinger end-point which knows only about the alice account, having the actor IRI received
+func webFingerMock(t *testing.T, requests *int, actor string) (*httptest.Server, *webFingerResolver) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != "/.well-known/webfinger" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		res := r.URL.Query().Get("resource")
+		if !strings.HasPrefix(res, "acct:alice@") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jrd+json")
+		w.Write([]byte(`{"subject":"` + res + `","links":[` +
+			`{"rel":"http://webfinger.net/rel/profile-page","type":"text/html","href":"https://social.example/@alice"},` +
+			`{"rel":"self","type":"application/activity+json","href":"` + actor + `"}]}`))
+	}))
+	wf := newWebFingerResolver()
+	wf.client = srv.Client()
+	return srv, wf
+}
+
+func Test_webFingerResolver_Resolve(t *testing.T) {
+	requests := 0
+	srv, wf := webFingerMock(t, &requests, "https://social.example/users/alice")
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	for i := 0; i < 2; i++ {
+		iri, err := wf.Resolve("alice", host)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if iri != "https://social.example/users/alice" {
+			t.Errorf("Actor IRI must be %q, received %q", "https://social.example/users/alice", iri)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := wf.Resolve("bob", host); err == nil {
+			t.Errorf("an unknown account must not be resolved")
+		}
+	}
+	if requests != 2 {
+		t.Errorf("the results must be cached, the server received %d requests instead of %d", requests, 2)
+	}
+}
+
+func Test_webFingerResolver_Private(t *testing.T) {
+	requests := 0
+	srv, _ := webFingerMock(t, &requests, "https://social.example/users/alice")
+	defer srv.Close()
+
+	// the stand-in server listens on the loopback interface, which the default client refuses to connect to
+	wf := newWebFingerResolver()
+	if _, err := wf.Resolve("alice", strings.TrimPrefix(srv.URL, "https://")); err == nil {
+		t.Errorf("resolving an account on a private address must fail")
+	}
+	if _, err := wf.Actor(pub.IRI(srv.URL + "/users/alice")); err == nil {
+		t.Errorf("loading an actor from a private address must fail")
+	}
+	if requests > 0 {
+		t.Errorf("Requests count to a private address must be %d, received %d", 0, requests)
+	}
+}
+
+func Test_repository_resolveMentions(t *testing.T) {
+	requests := 0
+	srv, wf := webFingerMock(t, &requests, "https://social.example/users/alice")
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	r := repository{webfinger: wf, errFn: func(string, log.Ctx) {}}
+	local := getTagFromBytes([]byte("~jane"))
+	remote := getTagFromBytes([]byte("@alice@" + host))
+	unknown := getTagFromBytes([]byte("@bob@" + host))
+	it := Item{Metadata: &ItemMetadata{Mentions: TagCollection{local, remote, unknown}}}
+	original := it.Metadata
+
+	r.resolveMentions(&it)
+	if it.Metadata.Mentions[0].URL != local.URL || it.Metadata.Mentions[2].URL != unknown.URL {
+		t.Errorf("the local and the unresolved mentions must not be changed")
+	}
+	if it.Metadata.Mentions[1].URL != "https://social.example/users/alice" {
+		t.Errorf("Mention IRI must be %q, received %q", "https://social.example/users/alice", it.Metadata.Mentions[1].URL)
+	}
+	if len(it.Metadata.CC) != 1 || it.Metadata.CC[0].Metadata.ID != "https://social.example/users/alice" {
+		t.Errorf("the resolved actor must be added to the item's CC, received %v", it.Metadata.CC)
+	}
+	if original.Mentions[1].URL != remote.URL {
+		t.Errorf("the metadata of the received item must not be modified")
+	}
+}
+
+func Test_splitAccountAddress(t *testing.T) {
+	tests := map[string]struct {
+		addr, name, host string
+		valid            bool
+	}{
+		"plain":      {"alice@social.example", "alice", "social.example", true},
+		"mention":    {"@alice@Social.Example", "alice", "social.example", true},
+		"acct":       {" acct:alice@social.example ", "alice", "social.example", true},
+		"port":       {"alice@localhost:3000", "alice", "localhost:3000", true},
+		"no host":    {"alice", "", "", false},
+		"empty name": {"@social.example", "", "", false},
+		"url":        {"alice@social.example/users/alice", "", "", false},
+		"two hosts":  {"alice@social.example@other.example", "", "", false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			n, host, err := splitAccountAddress(tt.addr)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Validity must be %t, received error %v", tt.valid, err)
+			}
+			if n != tt.name || host != tt.host {
+				t.Errorf("Address must be split into %q and %q, received %q and %q", tt.name, tt.host, n, host)
+			}
+		})
+	}
+}
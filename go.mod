@@ -3,6 +3,7 @@ module github.com/mariusor/littr.go
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.17.0
 	github.com/captncraig/cors v0.0.0-20190703115713-e80254a89df1 // indirect
 	github.com/go-ap/activitypub v0.0.0-20191222130856-db8e40c89444
 	github.com/go-ap/client v0.0.0-20191222183513-a49cd9f438bb
@@ -11,7 +12,9 @@ require (
 	github.com/go-ap/jsonld v0.0.0-20191222183131-1f7910127b87
 	github.com/go-chi/chi v4.0.2+incompatible
 	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/gomodule/redigo v1.7.0
 	github.com/gorilla/csrf v1.6.2
+	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.0
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.3.0
@@ -24,7 +27,8 @@ require (
 	github.com/writeas/go-nodeinfo v1.0.0
 	github.com/writeas/go-webfinger v0.0.0-20190106002315-85cf805c86d2 // indirect
 	gitlab.com/golang-commonmark/markdown v0.0.0-20191127184510-91b5b3c99c19
-	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553 // indirect
+	golang.org/x/crypto v0.0.0-20191206172530-e9b2fee46413
+	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553
 	golang.org/x/oauth2 v0.0.0-20191202225959-858c2ad4c8b6
 	golang.org/x/text v0.3.2
 	google.golang.org/appengine v1.6.5 // indirect
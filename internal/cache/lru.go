@@ -0,0 +1,102 @@
+// Package cache provides an in-process least recently used cache with per entry expiration.
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	val     interface{}
+	expires time.Time
+}
+
+// LRU is a size bound cache which evicts the least recently used entries first
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// New returns a LRU cache holding at most size entries
+func New(size int) *LRU {
+	return &LRU{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Load returns the value stored for key, if it exists and it hasn't expired
+func (c *LRU) Load(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && c.now().After(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.val, true
+}
+
+// Store saves the value for key, a zero ttl means the entry never expires
+func (c *LRU) Store(key string, val interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.val = val
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, val: val, expires: expires})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove deletes the entries for the received keys, including the ones that only differ from them by their query string
+func (c *LRU) Remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, el := range c.items {
+		for _, key := range keys {
+			if k == key || strings.HasPrefix(k, key+"?") {
+				c.removeElement(el)
+				break
+			}
+		}
+	}
+}
+
+// Len returns the number of entries in the cache
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *LRU) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
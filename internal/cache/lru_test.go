@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_Store(t *testing.T) {
+	c := New(2)
+	c.Store("a", 1, 0)
+	c.Store("b", 2, 0)
+	c.Load("a")
+	c.Store("c", 3, 0)
+
+	if _, ok := c.Load("b"); ok {
+		t.Errorf("Least recently used entry %q must have been evicted", "b")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Load(k); !ok {
+			t.Errorf("Entry %q must be present", k)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Length must be %d, received %d", 2, c.Len())
+	}
+}
+
+func TestLRU_Load(t *testing.T) {
+	now := time.Now()
+	c := New(10)
+	c.now = func() time.Time { return now }
+	c.Store("a", 1, time.Minute)
+
+	if v, ok := c.Load("a"); !ok || v != 1 {
+		t.Errorf("Value must be %d, received %v", 1, v)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Load("a"); ok {
+		t.Errorf("Expired entry %q must not be loaded", "a")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Length must be %d, received %d", 0, c.Len())
+	}
+}
+
+func TestLRU_Remove(t *testing.T) {
+	c := New(10)
+	c.Store("http://example.com/inbox", 1, 0)
+	c.Store("http://example.com/inbox?type=Like", 2, 0)
+	c.Store("http://example.com/inbox-other", 3, 0)
+
+	c.Remove("http://example.com/inbox")
+	if c.Len() != 1 {
+		t.Errorf("Length must be %d, received %d", 1, c.Len())
+	}
+	if _, ok := c.Load("http://example.com/inbox-other"); !ok {
+		t.Errorf("Entry %q must be present", "http://example.com/inbox-other")
+	}
+}
@@ -0,0 +1,326 @@
+package fedboxtest
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/handlers"
+)
+
+// The values of the littr.go MatchType constants, used in the submittedAtMatchType and contentMatchType parameters
+const (
+	matchEquals = 1 << iota
+	matchFuzzy
+	matchBefore
+	matchAfter
+)
+
+const defaultMaxItems = 100
+
+func (s *Server) filterCollection(iri pub.IRI, col []pub.IRI, q url.Values) pub.Item {
+	res := pub.OrderedCollectionNew(pub.ID(iri))
+
+	items := make(pub.ItemCollection, 0)
+	for i := len(col) - 1; i >= 0; i-- {
+		it := s.deref(col[i])
+		if matches(it, q) {
+			items = append(items, it)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return published(items[i]).After(published(items[j]))
+	})
+	res.TotalItems = uint(len(items))
+	if s.ActorLinks && isFollowsCollection(iri) {
+		for k, it := range items {
+			items[k] = it.GetLink()
+		}
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if s.PageSize > 0 && page < 1 {
+		res.First = pub.IRI(fmt.Sprintf("%s?page=1", iri))
+		return res
+	}
+	if page < 1 {
+		page = 1
+	}
+	max, _ := strconv.Atoi(q.Get("maxItems"))
+	if s.PageSize > 0 {
+		max = s.PageSize
+	}
+	if max < 1 {
+		max = defaultMaxItems
+	}
+	start := (page - 1) * max
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + max
+	if end > len(items) {
+		end = len(items)
+	}
+	if s.PageSize == 0 {
+		res.OrderedItems = items[start:end]
+		return res
+	}
+	p := pub.OrderedCollectionPageNew(res)
+	p.ID = pub.ID(fmt.Sprintf("%s?page=%d", iri, page))
+	p.OrderedItems = items[start:end]
+	if end < len(items) {
+		p.Next = pub.IRI(fmt.Sprintf("%s?page=%d", iri, page+1))
+	}
+	return p
+}
+
+func isFollowsCollection(iri pub.IRI) bool {
+	typ := handlers.CollectionType(path.Base(iri.String()))
+	return typ == handlers.Followers || typ == handlers.Following
+}
+
+func published(it pub.Item) time.Time {
+	var t time.Time
+	pub.OnObject(it, func(o *pub.Object) error {
+		t = o.Published
+		return nil
+	})
+	return t
+}
+
+// objectOf returns the object the item filters should be applied to: for activities that create
+// or modify an object, that object, otherwise the item itself
+func objectOf(it pub.Item) pub.Item {
+	switch it.GetType() {
+	case pub.CreateType, pub.UpdateType, pub.DeleteType:
+		var ob pub.Item
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			ob = a.Object
+			return nil
+		})
+		if ob != nil && ob.IsObject() {
+			return ob
+		}
+	}
+	return it
+}
+
+func iriMatches(i pub.IRI, v string) bool {
+	if len(i) == 0 {
+		return false
+	}
+	return i.String() == v || path.Base(i.String()) == v
+}
+
+func matchesAny(it pub.Item, vals []string) bool {
+	if it == nil {
+		return false
+	}
+	items := pub.ItemCollection{it}
+	if col, ok := it.(pub.ItemCollection); ok {
+		items = col
+	}
+	for _, i := range items {
+		for _, v := range vals {
+			if iriMatches(i.GetLink(), v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesName(it pub.Item, name string) bool {
+	match := false
+	pub.OnObject(it, func(o *pub.Object) error {
+		for _, n := range o.Name {
+			match = match || n.Value == name
+		}
+		return nil
+	})
+	if pub.ActorTypes.Contains(it.GetType()) {
+		pub.OnActor(it, func(p *pub.Actor) error {
+			for _, n := range p.PreferredUsername {
+				match = match || n.Value == name
+			}
+			return nil
+		})
+	}
+	return match
+}
+
+func matchesContent(o *pub.Object, v string, typ int) bool {
+	values := make([]string, 0)
+	for _, nlv := range []pub.NaturalLanguageValues{o.Name, o.Content, o.Summary, o.Source.Content} {
+		for _, n := range nlv {
+			values = append(values, n.Value)
+		}
+	}
+	for _, val := range values {
+		if typ&matchFuzzy == matchFuzzy && strings.Contains(strings.ToLower(val), strings.ToLower(v)) {
+			return true
+		}
+		if typ&matchFuzzy != matchFuzzy && val == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesTime(t time.Time, v string, typ int) bool {
+	at, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return false
+	}
+	switch {
+	case typ&matchBefore == matchBefore:
+		return t.Before(at)
+	case typ&matchAfter == matchAfter:
+		return t.After(at)
+	default:
+		return t.Equal(at)
+	}
+}
+
+func matchesActivity(it pub.Item, fn func(a *pub.Activity) bool) bool {
+	match := false
+	pub.OnActivity(it, func(a *pub.Activity) error {
+		match = fn(a)
+		return nil
+	})
+	return match
+}
+
+func matchesObject(it pub.Item, fn func(o *pub.Object) bool) bool {
+	match := false
+	pub.OnObject(it, func(o *pub.Object) error {
+		match = fn(o)
+		return nil
+	})
+	return match
+}
+
+// matches checks the item against the query parameters that the littr.go Values(Filters) function generates,
+// multiple values for the same parameter match if any of them do
+func matches(it pub.Item, q url.Values) bool {
+	isActivity := pub.ActivityTypes.Contains(it.GetType())
+	ob := objectOf(it)
+
+	contentMatch, _ := strconv.Atoi(q.Get("contentMatchType"))
+	timeMatch, _ := strconv.Atoi(q.Get("submittedAtMatchType"))
+	for key, vals := range q {
+		var match bool
+		switch key {
+		case "type":
+			for _, v := range vals {
+				match = match || strings.EqualFold(string(it.GetType()), v)
+			}
+		case "iri":
+			match = matchesAny(it.GetLink(), vals)
+		case "id":
+			for _, v := range vals {
+				match = match || strings.Contains(it.GetLink().String(), v)
+			}
+		case "name":
+			for _, v := range vals {
+				match = match || matchesName(it, v)
+			}
+		case "deleted":
+			deleted := it.GetType() == pub.TombstoneType
+			for _, v := range vals {
+				match = match || strconv.FormatBool(deleted) == v
+			}
+		case "inbox":
+			if pub.ActorTypes.Contains(it.GetType()) {
+				pub.OnActor(it, func(p *pub.Actor) error {
+					match = matchesAny(p.Inbox, vals)
+					return nil
+				})
+			}
+		case "actor":
+			match = matchesActivity(it, func(a *pub.Activity) bool {
+				return matchesAny(a.Actor, vals)
+			})
+		case "object":
+			match = matchesActivity(it, func(a *pub.Activity) bool {
+				return matchesAny(a.Object, vals)
+			})
+		case "attributedTo":
+			if isActivity {
+				match = matchesActivity(it, func(a *pub.Activity) bool {
+					return matchesAny(a.Actor, vals)
+				})
+			} else {
+				match = matchesObject(it, func(o *pub.Object) bool {
+					return matchesAny(o.AttributedTo, vals)
+				})
+			}
+		case "inReplyTo":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if len(v) == 0 && o.InReplyTo == nil {
+						return true
+					}
+				}
+				return matchesAny(o.InReplyTo, vals)
+			})
+		case "context":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if (len(v) == 0 || v == "0") && o.Context == nil {
+						return true
+					}
+				}
+				return matchesAny(o.Context, vals)
+			})
+		case "mediaType":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if string(o.MediaType) == v || string(o.Source.MediaType) == v {
+						return true
+					}
+				}
+				return false
+			})
+		case "content":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if matchesContent(o, v, contentMatch) {
+						return true
+					}
+				}
+				return false
+			})
+		case "url":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if o.URL != nil && strings.Contains(o.URL.GetLink().String(), v) {
+						return true
+					}
+				}
+				return false
+			})
+		case "submittedAt":
+			match = matchesObject(ob, func(o *pub.Object) bool {
+				for _, v := range vals {
+					if matchesTime(o.Published, v, timeMatch) {
+						return true
+					}
+				}
+				return false
+			})
+		default:
+			// parameters that don't filter, or that FedBOX doesn't support, eg: page, maxItems, email, depth
+			match = true
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,609 @@
+// Package fedboxtest provides an in-process stand-in for a FedBOX instance.
+//
+// It serves enough of the ActivityPub C2S API and of the OAuth2 token end-point for the
+// littr.go repository code to be exercised in tests without a running FedBOX.
+package fedboxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/handlers"
+	j "github.com/go-ap/jsonld"
+	"github.com/pborman/uuid"
+)
+
+const (
+	actors     = handlers.CollectionType("actors")
+	objects    = handlers.CollectionType("objects")
+	activities = handlers.CollectionType("activities")
+)
+
+// Server is a FedBOX stand-in running on a httptest.Server
+type Server struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the OAuth2 application credentials the token end-point accepts.
+	// When ClientID is empty, any client is accepted.
+	ClientID     string
+	ClientSecret string
+	// PageSize, when set, makes the collections be served paged: the collection itself only links to
+	// its first page and each OrderedCollectionPage holds at most PageSize items and links to the next one.
+	PageSize int
+	// ActorLinks, when set, makes the followers and following collections hold the IRIs of the actors,
+	// like the collections of remote instances do, instead of the actors themselves.
+	ActorLinks bool
+
+	mu          sync.RWMutex
+	items       map[pub.IRI]pub.Item
+	collections map[pub.IRI][]pub.IRI
+	passwords   map[pub.IRI]string
+	tokens      map[string]pub.IRI
+	refresh     map[string]pub.IRI
+}
+
+// NewServer starts and returns a new Server, the caller should call Close when finished
+func NewServer() *Server {
+	pub.ItemTyperFunc = pub.JSONGetItemByType
+
+	s := &Server{
+		items:       make(map[pub.IRI]pub.Item),
+		collections: make(map[pub.IRI][]pub.IRI),
+		passwords:   make(map[pub.IRI]string),
+		tokens:      make(map[string]pub.IRI),
+		refresh:     make(map[string]pub.IRI),
+	}
+	s.Server = httptest.NewServer(s)
+	for _, col := range []handlers.CollectionType{actors, objects, activities, handlers.Inbox} {
+		s.collections[s.iri(col)] = make([]pub.IRI, 0)
+	}
+	return s
+}
+
+func (s *Server) iri(parts ...interface{}) pub.IRI {
+	p := make([]string, len(parts))
+	for i, part := range parts {
+		p[i] = fmt.Sprintf("%s", part)
+	}
+	return pub.IRI(fmt.Sprintf("%s/%s", s.URL, strings.Join(p, "/")))
+}
+
+// AddActor creates a new Person actor with the handle and password received
+func (s *Server) AddActor(handle, pw string) *pub.Actor {
+	p := pub.Actor{Type: pub.PersonType}
+	p.Name = pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: handle}}
+	p.PreferredUsername = pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: handle}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createActor(&p)
+	s.passwords[p.GetLink()] = pw
+	return &p
+}
+
+// Token returns a new OAuth2 access token for the actor
+func (s *Server) Token(actor pub.IRI) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.newToken(actor)
+}
+
+func (s *Server) newToken(actor pub.IRI) string {
+	tok := uuid.New()
+	s.tokens[tok] = actor
+	return tok
+}
+
+// ServeHTTP
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	iri := pub.IRI(fmt.Sprintf("%s%s", s.URL, r.URL.Path))
+
+	switch {
+	case r.URL.Path == "/oauth/token" && r.Method == http.MethodPost:
+		s.handleToken(w, r)
+	case r.Method == http.MethodGet:
+		s.handleGet(w, r, iri)
+	case r.Method == http.MethodPost && path.Base(r.URL.Path) == string(handlers.Outbox):
+		s.handleOutbox(w, r, iri)
+	case r.Method == http.MethodPost && path.Base(r.URL.Path) == string(handlers.Inbox):
+		s.handleInbox(w, r, iri)
+	default:
+		errors.HandleError(errors.MethodNotAllowedf("invalid %s request for %s", r.Method, r.URL.Path)).ServeHTTP(w, r)
+	}
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, iri pub.IRI) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var it pub.Item
+	if col, ok := s.collections[iri]; ok {
+		it = s.filterCollection(iri, col, r.URL.Query())
+	} else if ob, ok := s.items[iri]; ok {
+		it = ob
+	} else {
+		errors.HandleError(errors.NotFoundf("%s not found", iri)).ServeHTTP(w, r)
+		return
+	}
+	s.write(w, http.StatusOK, "", it)
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, location pub.IRI, it pub.Item) {
+	data, err := j.Marshal(it)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	if len(location) > 0 {
+		w.Header().Set("Location", location.String())
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// deref returns the item to be rendered in a collection, activities get their objects embedded
+func (s *Server) deref(iri pub.IRI) pub.Item {
+	it, ok := s.items[iri]
+	if !ok {
+		return iri
+	}
+	if !pub.ActivityTypes.Contains(it.GetType()) {
+		return it
+	}
+	act, err := pub.ToActivity(it)
+	if err != nil || act.Object == nil {
+		return it
+	}
+	cpy := *act
+	if ob, ok := s.items[act.Object.GetLink()]; ok && !pub.ActivityTypes.Contains(ob.GetType()) {
+		cpy.Object = ob
+	}
+	return &cpy
+}
+
+func (s *Server) handleOutbox(w http.ResponseWriter, r *http.Request, iri pub.IRI) {
+	owner := pub.IRI(strings.TrimSuffix(iri.String(), "/"+string(handlers.Outbox)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[iri]; !ok {
+		errors.HandleError(errors.NotFoundf("%s not found", iri)).ServeHTTP(w, r)
+		return
+	}
+	tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if actor, ok := s.tokens[tok]; !ok || actor != owner {
+		errors.HandleError(errors.Unauthorizedf("invalid OAuth2 token for %s", owner)).ServeHTTP(w, r)
+		return
+	}
+	act, err := loadActivity(r)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	if act.Actor == nil || act.Actor.GetLink() != owner {
+		errors.HandleError(errors.Forbiddenf("activity actor does not match the outbox owner")).ServeHTTP(w, r)
+		return
+	}
+	status, res, err := s.processActivity(act)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	s.append(iri, act.GetLink())
+	s.deliver(act)
+	s.write(w, status, res.GetLink(), res)
+}
+
+func (s *Server) handleInbox(w http.ResponseWriter, r *http.Request, iri pub.IRI) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[iri]; !ok {
+		errors.HandleError(errors.NotFoundf("%s not found", iri)).ServeHTTP(w, r)
+		return
+	}
+	act, err := loadActivity(r)
+	if err != nil {
+		errors.HandleError(err).ServeHTTP(w, r)
+		return
+	}
+	if act.Actor == nil {
+		errors.HandleError(errors.NotValidf("missing activity actor")).ServeHTTP(w, r)
+		return
+	}
+	switch act.Type {
+	case pub.AcceptType, pub.RejectType, pub.FollowType, pub.UndoType, pub.AnnounceType:
+		if _, _, err := s.processActivity(act); err != nil {
+			errors.HandleError(err).ServeHTTP(w, r)
+			return
+		}
+	default:
+		s.storeActivity(act)
+	}
+	s.append(iri, act.GetLink())
+	s.append(s.iri(handlers.Inbox), act.GetLink())
+	s.write(w, http.StatusCreated, act.GetLink(), act)
+}
+
+func loadActivity(r *http.Request) (*pub.Activity, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "unable to read request body")
+	}
+	it, err := pub.UnmarshalJSON(body)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "unable to unmarshal activity")
+	}
+	act, err := pub.ToActivity(it)
+	if err != nil {
+		return nil, errors.NewNotValid(err, "%s is not a valid activity", it.GetType())
+	}
+	return act, nil
+}
+
+func (s *Server) append(col pub.IRI, it pub.IRI) {
+	for _, i := range s.collections[col] {
+		if i == it {
+			return
+		}
+	}
+	s.collections[col] = append(s.collections[col], it)
+}
+
+func (s *Server) remove(col pub.IRI, it pub.IRI) {
+	items := s.collections[col]
+	for k, i := range items {
+		if i == it {
+			s.collections[col] = append(items[:k], items[k+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) storeActivity(act *pub.Activity) {
+	if len(act.ID) == 0 {
+		act.ID = pub.ID(s.iri(activities, uuid.New()))
+	}
+	if act.Published.IsZero() {
+		act.Published = time.Now().UTC()
+	}
+	s.items[act.GetLink()] = act
+	s.append(s.iri(activities), act.GetLink())
+}
+
+// processActivity applies the side effects of an activity received in an outbox and returns the status
+// and the item that FedBOX would respond with
+func (s *Server) processActivity(act *pub.Activity) (int, pub.Item, error) {
+	now := time.Now().UTC()
+	switch act.Type {
+	case pub.CreateType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		if pub.ActorTypes.Contains(act.Object.GetType()) {
+			p, err := pub.ToActor(act.Object)
+			if err != nil {
+				return 0, nil, errors.NewNotValid(err, "invalid actor")
+			}
+			p.ID = ""
+			s.createActor(p)
+			act.Object = p
+		} else {
+			ob, err := pub.ToObject(act.Object)
+			if err != nil {
+				return 0, nil, errors.NewNotValid(err, "invalid object")
+			}
+			s.createObject(ob, act.Actor.GetLink())
+			act.Object = ob
+		}
+		s.storeActivity(act)
+		return http.StatusCreated, act.Object, nil
+	case pub.UpdateType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		iri := act.Object.GetLink()
+		old, ok := s.items[iri]
+		if !ok {
+			return 0, nil, errors.NotFoundf("%s not found", iri)
+		}
+		if err := pub.OnObject(act.Object, func(ob *pub.Object) error {
+			pub.OnObject(old, func(o *pub.Object) error {
+				ob.Published = o.Published
+				if ob.AttributedTo == nil {
+					ob.AttributedTo = o.AttributedTo
+				}
+				ob.Replies, ob.Likes, ob.Shares = o.Replies, o.Likes, o.Shares
+				return nil
+			})
+			ob.Updated = now
+			return nil
+		}); err != nil {
+			return 0, nil, errors.NewNotValid(err, "invalid object")
+		}
+		if pub.ActorTypes.Contains(old.GetType()) {
+			pub.OnActor(old, func(o *pub.Actor) error {
+				return pub.OnActor(act.Object, func(p *pub.Actor) error {
+					p.Inbox, p.Outbox, p.Liked = o.Inbox, o.Outbox, o.Liked
+					p.Followers, p.Following = o.Followers, o.Following
+					return nil
+				})
+			})
+		}
+		s.items[iri] = act.Object
+		s.storeActivity(act)
+		return http.StatusOK, act.Object, nil
+	case pub.DeleteType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		iri := act.Object.GetLink()
+		old, ok := s.items[iri]
+		if !ok {
+			return 0, nil, errors.NotFoundf("%s not found", iri)
+		}
+		del := pub.Tombstone{ID: pub.ID(iri), Type: pub.TombstoneType, FormerType: old.GetType(), Deleted: now}
+		pub.OnObject(old, func(o *pub.Object) error {
+			del.Published = o.Published
+			del.Updated = now
+			del.Context = o.Context
+			del.InReplyTo = o.InReplyTo
+			del.Replies = o.Replies
+			return nil
+		})
+		s.items[iri] = &del
+		s.storeActivity(act)
+		return http.StatusGone, &del, nil
+	case pub.LikeType, pub.DislikeType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		ob, ok := s.items[act.Object.GetLink()]
+		if !ok {
+			return 0, nil, errors.NotFoundf("%s not found", act.Object.GetLink())
+		}
+		act.Object = ob.GetLink()
+		s.storeActivity(act)
+		s.append(pub.IRI(fmt.Sprintf("%s/%s", act.Actor.GetLink(), handlers.Liked)), act.GetLink())
+		s.append(pub.IRI(fmt.Sprintf("%s/%s", ob.GetLink(), handlers.Likes)), act.GetLink())
+	case pub.AnnounceType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		ob, ok := s.items[act.Object.GetLink()]
+		if !ok {
+			return 0, nil, errors.NotFoundf("%s not found", act.Object.GetLink())
+		}
+		act.Object = ob.GetLink()
+		s.storeActivity(act)
+		s.append(pub.IRI(fmt.Sprintf("%s/%s", ob.GetLink(), handlers.Shares)), act.GetLink())
+	case pub.UndoType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		undone, ok := s.items[act.Object.GetLink()]
+		if !ok {
+			return 0, nil, errors.NotFoundf("%s not found", act.Object.GetLink())
+		}
+		pub.OnActivity(undone, func(u *pub.Activity) error {
+			switch u.Type {
+			case pub.LikeType, pub.DislikeType:
+				s.remove(s.iri(handlers.Inbox), u.GetLink())
+				s.remove(pub.IRI(fmt.Sprintf("%s/%s", u.Actor.GetLink(), handlers.Liked)), u.GetLink())
+				s.remove(pub.IRI(fmt.Sprintf("%s/%s", u.Object.GetLink(), handlers.Likes)), u.GetLink())
+			case pub.FollowType:
+				s.remove(pub.IRI(fmt.Sprintf("%s/%s", u.Object.GetLink(), handlers.Followers)), u.Actor.GetLink())
+				s.remove(pub.IRI(fmt.Sprintf("%s/%s", u.Actor.GetLink(), handlers.Following)), u.Object.GetLink())
+			}
+			return nil
+		})
+		act.Object = undone.GetLink()
+		s.storeActivity(act)
+	case pub.FollowType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		if _, ok := s.items[act.Object.GetLink()]; !ok && pub.ActorTypes.Contains(act.Object.GetType()) {
+			// actors of other instances are stored when they get followed
+			s.items[act.Object.GetLink()] = act.Object
+			s.append(s.iri(actors), act.Object.GetLink())
+		}
+		act.Object = act.Object.GetLink()
+		s.storeActivity(act)
+		s.append(pub.IRI(fmt.Sprintf("%s/%s", act.Object.GetLink(), handlers.Inbox)), act.GetLink())
+	case pub.RemoveType:
+		if act.Object == nil || act.Target == nil {
+			return 0, nil, errors.NotValidf("missing object or target for %s", act.Type)
+		}
+		target := act.Target.GetLink()
+		if !strings.HasPrefix(target.String(), act.Actor.GetLink().String()+"/") {
+			return 0, nil, errors.Forbiddenf("%s can not remove items from %s", act.Actor.GetLink(), target)
+		}
+		s.remove(target, act.Object.GetLink())
+		if path.Base(target.String()) == string(handlers.Followers) {
+			s.remove(pub.IRI(fmt.Sprintf("%s/%s", act.Object.GetLink(), handlers.Following)), act.Actor.GetLink())
+		}
+		s.storeActivity(act)
+	case pub.AcceptType, pub.RejectType:
+		if act.Object == nil {
+			return 0, nil, errors.NotValidf("missing object for %s", act.Type)
+		}
+		follow, ok := s.items[act.Object.GetLink()]
+		if !ok || follow.GetType() != pub.FollowType {
+			return 0, nil, errors.NotFoundf("follow request %s not found", act.Object.GetLink())
+		}
+		pub.OnActivity(follow, func(f *pub.Activity) error {
+			if act.Type == pub.AcceptType {
+				s.append(pub.IRI(fmt.Sprintf("%s/%s", f.Object.GetLink(), handlers.Followers)), f.Actor.GetLink())
+				s.append(pub.IRI(fmt.Sprintf("%s/%s", f.Actor.GetLink(), handlers.Following)), f.Object.GetLink())
+			}
+			s.append(pub.IRI(fmt.Sprintf("%s/%s", f.Actor.GetLink(), handlers.Inbox)), act.GetLink())
+			return nil
+		})
+		act.Object = follow.GetLink()
+		s.storeActivity(act)
+		s.append(pub.IRI(fmt.Sprintf("%s/%s", act.Actor.GetLink(), handlers.Inbox)), act.GetLink())
+	default:
+		s.storeActivity(act)
+	}
+	return http.StatusCreated, act, nil
+}
+
+func (s *Server) createActor(p *pub.Actor) {
+	id := s.iri(actors, uuid.New())
+	p.ID = pub.ID(id)
+	if p.Published.IsZero() {
+		p.Published = time.Now().UTC()
+	}
+	p.Inbox = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Inbox))
+	p.Outbox = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Outbox))
+	p.Liked = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Liked))
+	p.Followers = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Followers))
+	p.Following = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Following))
+	for _, col := range []pub.Item{p.Inbox, p.Outbox, p.Liked, p.Followers, p.Following} {
+		s.collections[col.GetLink()] = make([]pub.IRI, 0)
+	}
+	s.items[id] = p
+	s.append(s.iri(actors), id)
+}
+
+func (s *Server) createObject(ob *pub.Object, author pub.IRI) {
+	id := s.iri(objects, uuid.New())
+	ob.ID = pub.ID(id)
+	if ob.AttributedTo == nil {
+		ob.AttributedTo = author
+	}
+	if ob.Published.IsZero() {
+		ob.Published = time.Now().UTC()
+	}
+	ob.Replies = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Replies))
+	ob.Likes = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Likes))
+	ob.Shares = pub.IRI(fmt.Sprintf("%s/%s", id, handlers.Shares))
+	for _, col := range []pub.Item{ob.Replies, ob.Likes, ob.Shares} {
+		s.collections[col.GetLink()] = make([]pub.IRI, 0)
+	}
+	if ob.InReplyTo != nil {
+		parents := pub.ItemCollection{ob.InReplyTo}
+		if col, ok := ob.InReplyTo.(pub.ItemCollection); ok {
+			parents = col
+		}
+		for _, par := range parents {
+			s.append(pub.IRI(fmt.Sprintf("%s/%s", par.GetLink(), handlers.Replies)), id)
+		}
+	}
+	s.items[id] = ob
+	s.append(s.iri(objects), id)
+}
+
+// deliver adds the activity to the shared inbox and to the inboxes of its local recipients,
+// followers collections get expanded to their items
+func (s *Server) deliver(act *pub.Activity) {
+	s.append(s.iri(handlers.Inbox), act.GetLink())
+
+	recipients := make(pub.ItemCollection, 0)
+	recipients = append(recipients, act.To...)
+	recipients = append(recipients, act.Bto...)
+	recipients = append(recipients, act.CC...)
+	recipients = append(recipients, act.BCC...)
+	for _, rec := range recipients {
+		iri := rec.GetLink()
+		if path.Base(iri.String()) == string(handlers.Followers) {
+			for _, fol := range s.collections[iri] {
+				s.append(pub.IRI(fmt.Sprintf("%s/%s", fol, handlers.Inbox)), act.GetLink())
+			}
+			continue
+		}
+		if it, ok := s.items[iri]; ok && pub.ActorTypes.Contains(it.GetType()) {
+			s.append(pub.IRI(fmt.Sprintf("%s/%s", iri, handlers.Inbox)), act.GetLink())
+		}
+	}
+}
+
+type token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(http.StatusBadRequest, tokenError{Error: "invalid_request"})
+		return
+	}
+	if !s.validClient(r) {
+		writeJSON(http.StatusUnauthorized, tokenError{Error: "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var actor pub.IRI
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		handle := r.PostForm.Get("username")
+		for iri, pw := range s.passwords {
+			if pw != r.PostForm.Get("password") {
+				continue
+			}
+			if p, ok := s.items[iri]; ok && matchesName(p, handle) {
+				actor = iri
+				break
+			}
+		}
+	case "refresh_token":
+		ref := r.PostForm.Get("refresh_token")
+		actor = s.refresh[ref]
+		delete(s.refresh, ref)
+	default:
+		writeJSON(http.StatusBadRequest, tokenError{Error: "unsupported_grant_type"})
+		return
+	}
+	if len(actor) == 0 {
+		writeJSON(http.StatusUnauthorized, tokenError{Error: "invalid_grant"})
+		return
+	}
+	ref := uuid.New()
+	s.refresh[ref] = actor
+	writeJSON(http.StatusOK, token{
+		AccessToken:  s.newToken(actor),
+		TokenType:    "Bearer",
+		RefreshToken: ref,
+		ExpiresIn:    3600,
+	})
+}
+
+func (s *Server) validClient(r *http.Request) bool {
+	if len(s.ClientID) == 0 {
+		return true
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	return id == s.ClientID && secret == s.ClientSecret
+}
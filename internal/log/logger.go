@@ -89,7 +89,7 @@ func context(l *logger) logrus.Fields {
 	return c
 }
 
-func (l logger) New(c ...interface{}) Logger {
+func (l *logger) New(c ...interface{}) Logger {
 	return l.WithContext(c)
 }
 
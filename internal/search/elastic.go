@@ -0,0 +1,242 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Elastic stores the documents in an Elasticsearch index, using its REST API
+type Elastic struct {
+	URL    string
+	Name   string
+	User   string
+	Pw     string
+	Client *http.Client
+}
+
+// elasticMapping keeps the fields we're filtering on as keywords, so they only match whole values
+var elasticMapping = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"title":     map[string]string{"type": "text"},
+			"content":   map[string]string{"type": "text"},
+			"domain":    map[string]string{"type": "keyword"},
+			"tags":      map[string]string{"type": "keyword"},
+			"author":    map[string]string{"type": "keyword"},
+			"published": map[string]string{"type": "date"},
+		},
+	},
+}
+
+// NewElastic returns a client for the Elasticsearch index named index, of the server at u, creating the index if it doesn't exist
+func NewElastic(u, index, user, pw string) (*Elastic, error) {
+	e := &Elastic{
+		URL:    strings.TrimRight(u, "/"),
+		Name:   index,
+		User:   user,
+		Pw:     pw,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	res, err := e.do(http.MethodHead, e.indexURL(), nil)
+	if err != nil {
+		return e, err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return e, nil
+	}
+	res, err = e.do(http.MethodPut, e.indexURL(), elasticMapping)
+	if err != nil {
+		return e, err
+	}
+	return e, e.check(res)
+}
+
+func (e *Elastic) indexURL() string {
+	return fmt.Sprintf("%s/%s", e.URL, url.PathEscape(e.Name))
+}
+
+func (e *Elastic) docURL(id string) string {
+	return fmt.Sprintf("%s/_doc/%s", e.indexURL(), url.PathEscape(id))
+}
+
+func (e *Elastic) do(method, u string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		dat, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(dat)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.User) > 0 {
+		req.SetBasicAuth(e.User, e.Pw)
+	}
+	if body != nil {
+		if _, ok := body.([]byte); ok {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	return e.Client.Do(req)
+}
+
+// check returns an error if the response has an error status, and closes its body
+func (e *Elastic) check(res *http.Response) error {
+	defer res.Body.Close()
+	if res.StatusCode < http.StatusBadRequest {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("elasticsearch responded with %s: %s", res.Status, msg)
+}
+
+// Index adds the documents to the index, replacing the existing ones with the same ID.
+// Multiple documents are sent as a single bulk request.
+func (e *Elastic) Index(docs ...Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if len(docs) == 1 {
+		res, err := e.do(http.MethodPut, e.docURL(docs[0].ID), docs[0])
+		if err != nil {
+			return err
+		}
+		return e.check(res)
+	}
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	for _, d := range docs {
+		enc.Encode(map[string]interface{}{"index": map[string]string{"_index": e.Name, "_id": d.ID}})
+		enc.Encode(d)
+	}
+	res, err := e.do(http.MethodPost, fmt.Sprintf("%s/_bulk", e.URL), buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return e.check(res)
+}
+
+// Remove deletes the documents with the received IDs from the index
+func (e *Elastic) Remove(ids ...string) error {
+	for _, id := range ids {
+		res, err := e.do(http.MethodDelete, e.docURL(id), nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			continue
+		}
+		if err := e.check(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elasticQuery builds the query DSL for the terms: the fielded ones are filters, the rest must all match
+func elasticQuery(terms []Term) map[string]interface{} {
+	must := make([]interface{}, 0)
+	filter := make([]interface{}, 0)
+	words := make([]string, 0)
+	for _, t := range terms {
+		switch t.Field {
+		case FieldTag:
+			filter = append(filter, map[string]interface{}{"term": map[string]string{"tags": "#" + t.Value}})
+		case FieldAuthor, FieldDomain:
+			filter = append(filter, map[string]interface{}{"term": map[string]string{t.Field: t.Value}})
+		default:
+			words = append(words, t.Value)
+		}
+	}
+	if len(words) > 0 {
+		must = append(must, map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":    strings.Join(words, " "),
+				"fields":   []string{"title^3", "tags^3", "author^2", "domain^2", "content"},
+				"operator": "and",
+			},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   must,
+			"filter": filter,
+		},
+	}
+}
+
+// Search returns the documents matching all the terms of the query, the most relevant first
+func (e *Elastic) Search(q Query) (Result, error) {
+	terms := ParseQuery(q.Text)
+	if len(terms) == 0 {
+		return Result{}, nil
+	}
+	size := q.MaxItems
+	if size <= 0 {
+		size = 10
+	}
+	page := q.Page
+	if page < 1 {
+		page = 1
+	}
+	body := map[string]interface{}{
+		"from":    (page - 1) * size,
+		"size":    size,
+		"_source": false,
+		"query":   elasticQuery(terms),
+		"sort":    []interface{}{"_score", map[string]string{"published": "desc"}},
+	}
+	res, err := e.do(http.MethodPost, fmt.Sprintf("%s/_search", e.indexURL()), body)
+	if err != nil {
+		return Result{}, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return Result{}, e.check(res)
+	}
+	defer res.Body.Close()
+
+	r := struct {
+		Hits struct {
+			Total json.RawMessage `json:"total"`
+			Hits  []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return Result{}, err
+	}
+	result := Result{IDs: make([]string, 0, len(r.Hits.Hits))}
+	for _, h := range r.Hits.Hits {
+		result.IDs = append(result.IDs, h.ID)
+	}
+	// NOTE(marius): Elasticsearch 7 returns the total as an object, the older versions as a number
+	total := struct {
+		Value uint `json:"value"`
+	}{}
+	if err := json.Unmarshal(r.Hits.Total, &total); err == nil {
+		result.Total = total.Value
+	} else {
+		json.Unmarshal(r.Hits.Total, &result.Total)
+	}
+	return result, nil
+}
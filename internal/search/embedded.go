@@ -0,0 +1,199 @@
+package search
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field weights for the words matching any field
+const (
+	weightTitle   = 3
+	weightTag     = 3
+	weightAuthor  = 2
+	weightDomain  = 2
+	weightContent = 1
+)
+
+// Embedded is an inverted index kept in memory. If it has a path, the documents get saved to it
+// after every change, and loaded from it when the index is created.
+type Embedded struct {
+	mu    sync.RWMutex
+	path  string
+	docs  map[string]Document
+	terms map[Term]map[string]int
+}
+
+// NewEmbedded returns an embedded index, persisted at path if it's not empty
+func NewEmbedded(path string) (*Embedded, error) {
+	e := &Embedded{
+		path:  path,
+		docs:  make(map[string]Document),
+		terms: make(map[Term]map[string]int),
+	}
+	if len(path) == 0 {
+		return e, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+
+	docs := make(map[string]Document)
+	if err := gob.NewDecoder(f).Decode(&docs); err != nil {
+		return e, err
+	}
+	for id, doc := range docs {
+		doc.ID = id
+		e.add(doc)
+	}
+	return e, nil
+}
+
+// Len returns the number of indexed documents
+func (e *Embedded) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.docs)
+}
+
+func documentTerms(d Document) map[Term]int {
+	terms := make(map[Term]int)
+	addWords := func(s string, weight int) {
+		for _, w := range Tokenize(s) {
+			terms[Term{Value: w}] += weight
+		}
+	}
+	addWords(d.Title, weightTitle)
+	addWords(d.Content, weightContent)
+	addWords(d.Author, weightAuthor)
+	addWords(d.Domain, weightDomain)
+	if len(d.Author) > 0 {
+		terms[Term{Field: FieldAuthor, Value: strings.ToLower(d.Author)}] += 1
+	}
+	if len(d.Domain) > 0 {
+		terms[Term{Field: FieldDomain, Value: strings.ToLower(d.Domain)}] += 1
+	}
+	for _, t := range d.Tags {
+		t = strings.ToLower(strings.TrimPrefix(t, "#"))
+		addWords(t, weightTag)
+		terms[Term{Field: FieldTag, Value: t}] += 1
+	}
+	return terms
+}
+
+func (e *Embedded) add(d Document) {
+	e.remove(d.ID)
+	e.docs[d.ID] = d
+	for t, w := range documentTerms(d) {
+		if _, ok := e.terms[t]; !ok {
+			e.terms[t] = make(map[string]int)
+		}
+		e.terms[t][d.ID] = w
+	}
+}
+
+func (e *Embedded) remove(id string) {
+	old, ok := e.docs[id]
+	if !ok {
+		return
+	}
+	for t := range documentTerms(old) {
+		delete(e.terms[t], id)
+		if len(e.terms[t]) == 0 {
+			delete(e.terms, t)
+		}
+	}
+	delete(e.docs, id)
+}
+
+// Index adds the documents to the index, replacing the existing ones with the same ID
+func (e *Embedded) Index(docs ...Document) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, d := range docs {
+		e.add(d)
+	}
+	return e.save()
+}
+
+// Remove deletes the documents with the received IDs from the index
+func (e *Embedded) Remove(ids ...string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range ids {
+		e.remove(id)
+	}
+	return e.save()
+}
+
+// Search returns the documents matching all the terms of the query, the most relevant first
+func (e *Embedded) Search(q Query) (Result, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	terms := ParseQuery(q.Text)
+	if len(terms) == 0 {
+		return Result{}, nil
+	}
+	scores := make(map[string]int)
+	for k, t := range terms {
+		matches := e.terms[t]
+		if k == 0 {
+			for id, w := range matches {
+				scores[id] = w
+			}
+			continue
+		}
+		for id := range scores {
+			w, ok := matches[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += w
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return e.docs[ids[i]].Published.After(e.docs[ids[j]].Published)
+	})
+	start, end := q.bounds(len(ids))
+	return Result{IDs: ids[start:end], Total: uint(len(ids))}, nil
+}
+
+// save writes the documents to the index's path. The file gets replaced only after it was fully written.
+func (e *Embedded) save() error {
+	if len(e.path) == 0 {
+		return nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(e.path), filepath.Base(e.path))
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(e.docs); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), e.path)
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testDocs = []Document{
+	{
+		ID:        "go",
+		Title:     "The Go programming language",
+		Content:   "Go is an open source programming language.",
+		Domain:    "golang.org",
+		Tags:      []string{"#golang"},
+		Author:    "jane",
+		Published: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:        "rust",
+		Title:     "Rust",
+		Content:   "A language empowering everyone to build reliable software.",
+		Domain:    "rust-lang.org",
+		Tags:      []string{"#rust"},
+		Author:    "john",
+		Published: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:        "comment",
+		Content:   "I prefer the Go language, it has #golang channels",
+		Tags:      []string{"#golang"},
+		Author:    "john",
+		Published: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := map[string][]Term{
+		"":                   {},
+		"Go language":        {{Value: "go"}, {Value: "language"}},
+		"#GoLang @jane":      {{Field: FieldTag, Value: "golang"}, {Field: FieldAuthor, Value: "jane"}},
+		"domain:golang.org":  {{Field: FieldDomain, Value: "golang.org"}},
+		"author:john a rust": {{Field: FieldAuthor, Value: "john"}, {Value: "rust"}},
+	}
+	for q, want := range tests {
+		if got := ParseQuery(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseQuery(%q) = %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestEmbedded_Search(t *testing.T) {
+	e, _ := NewEmbedded("")
+	if err := e.Index(testDocs...); err != nil {
+		t.Fatalf("unable to index documents: %s", err)
+	}
+	tests := map[string]struct {
+		q   Query
+		ids []string
+	}{
+		"words":     {q: Query{Text: "language"}, ids: []string{"go", "comment", "rust"}},
+		"all words": {q: Query{Text: "go language"}, ids: []string{"go", "comment"}},
+		"tag":       {q: Query{Text: "#golang"}, ids: []string{"comment", "go"}},
+		"author":    {q: Query{Text: "@john language"}, ids: []string{"comment", "rust"}},
+		"domain":    {q: Query{Text: "domain:rust-lang.org"}, ids: []string{"rust"}},
+		"none":      {q: Query{Text: "python"}, ids: []string{}},
+		"page":      {q: Query{Text: "language", Page: 2, MaxItems: 2}, ids: []string{"rust"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := e.Search(tt.q)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(res.IDs, tt.ids) {
+				t.Errorf("Search(%q) = %v, want %v", tt.q.Text, res.IDs, tt.ids)
+			}
+		})
+	}
+}
+
+func TestEmbedded_Persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "littr-search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.gob")
+
+	e, _ := NewEmbedded(path)
+	e.Index(testDocs...)
+	e.Remove("rust")
+
+	e, err = NewEmbedded(path)
+	if err != nil {
+		t.Fatalf("unable to load index: %s", err)
+	}
+	if e.Len() != 2 {
+		t.Errorf("the loaded index must contain 2 documents, found %d", e.Len())
+	}
+	res, _ := e.Search(Query{Text: "rust"})
+	if len(res.IDs) != 0 {
+		t.Errorf("the removed document must not be found, received %v", res.IDs)
+	}
+	res, _ = e.Search(Query{Text: "channels"})
+	if !reflect.DeepEqual(res.IDs, []string{"comment"}) {
+		t.Errorf("the loaded index must find the comment, received %v", res.IDs)
+	}
+}
@@ -0,0 +1,114 @@
+// Package search provides the full text indexes for the littr items: an embedded one, kept in memory and
+// optionally persisted to disk, and a client for an Elasticsearch index.
+package search
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Document is the indexed representation of an item
+type Document struct {
+	ID        string    `json:"-"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	Domain    string    `json:"domain,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Published time.Time `json:"published"`
+}
+
+// Query is a search request. Its text can contain "#tag", "@handle", "author:handle" and "domain:host" terms,
+// which match only the corresponding fields of the documents, the rest of the words match any field.
+type Query struct {
+	Text     string
+	Page     int
+	MaxItems int
+}
+
+// Result holds the IDs of the documents matching a query, in the order of their relevance,
+// and the total number of matches
+type Result struct {
+	IDs   []string
+	Total uint
+}
+
+// Term is a word of a query, or of a document, with the field it must match. Field is empty for
+// the words that can match any field.
+type Term struct {
+	Field string
+	Value string
+}
+
+const (
+	FieldTag    = "tag"
+	FieldAuthor = "author"
+	FieldDomain = "domain"
+)
+
+// Tokenize splits s into lower case words
+func Tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	result := words[:0]
+	for _, w := range words {
+		if len(w) > 1 {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// ParseQuery splits the text of a query into terms
+func ParseQuery(s string) []Term {
+	terms := make([]Term, 0)
+	for _, w := range strings.Fields(s) {
+		field, val := "", w
+		switch {
+		case strings.HasPrefix(w, "#"):
+			field, val = FieldTag, w[1:]
+		case strings.HasPrefix(w, "@"):
+			field, val = FieldAuthor, w[1:]
+		default:
+			for _, f := range []string{FieldTag, FieldAuthor, FieldDomain} {
+				if strings.HasPrefix(w, f+":") {
+					field, val = f, w[len(f)+1:]
+					break
+				}
+			}
+		}
+		if field != "" {
+			if val = strings.ToLower(strings.TrimSpace(val)); len(val) > 0 {
+				terms = append(terms, Term{Field: field, Value: val})
+			}
+			continue
+		}
+		for _, t := range Tokenize(w) {
+			terms = append(terms, Term{Value: t})
+		}
+	}
+	return terms
+}
+
+// bounds returns the limits of the page of results requested by q
+func (q Query) bounds(total int) (int, int) {
+	size := q.MaxItems
+	if size <= 0 {
+		size = total
+	}
+	page := q.Page
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * size
+	if start > total {
+		start = total
+	}
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return start, end
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/go-ap/errors"
@@ -25,11 +26,13 @@ func main() {
 	var port int
 	var host string
 	var env string
+	var backfill bool
 
 	flag.DurationVar(&wait, "graceful-timeout", defaultTimeout, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
 	flag.IntVar(&port, "port", defaultPort, "the port on which we should listen on")
 	flag.StringVar(&host, "host", "", "the host on which we should listen on")
 	flag.StringVar(&env, "env", "unknown", "the environment type")
+	flag.BoolVar(&backfill, "search-backfill", false, "index the existing items for the full text search, and exit")
 	flag.Parse()
 
 	e := app.EnvType(env)
@@ -37,6 +40,16 @@ func main() {
 	errors.IncludeBacktrace = app.Instance.Config.Env == app.DEV
 	app.Logger = app.Instance.Logger.New(log.Ctx{"package": "app"})
 
+	if backfill {
+		cnt, err := app.Instance.Backfill()
+		if err != nil {
+			app.Logger.Errorf("Unable to backfill the search index: %s", err)
+			os.Exit(1)
+		}
+		app.Logger.WithContext(log.Ctx{"count": cnt}).Info("Backfilled the search index")
+		return
+	}
+
 	// Routes
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)